@@ -35,6 +35,86 @@ func (m *MockUserServiceClient) EXPECT() *MockUserServiceClientMockRecorder {
 	return m.recorder
 }
 
+// AssignRole mocks base method.
+func (m *MockUserServiceClient) AssignRole(ctx context.Context, in *AssignRoleRequest, opts ...grpc.CallOption) (*AssignRoleReply, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{ctx, in}
+	for _, a := range opts {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "AssignRole", varargs...)
+	ret0, _ := ret[0].(*AssignRoleReply)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AssignRole indicates an expected call of AssignRole.
+func (mr *MockUserServiceClientMockRecorder) AssignRole(ctx, in interface{}, opts ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{ctx, in}, opts...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AssignRole", reflect.TypeOf((*MockUserServiceClient)(nil).AssignRole), varargs...)
+}
+
+// ChangePassword mocks base method.
+func (m *MockUserServiceClient) ChangePassword(ctx context.Context, in *ChangePasswordRequest, opts ...grpc.CallOption) (*ChangePasswordReply, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{ctx, in}
+	for _, a := range opts {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "ChangePassword", varargs...)
+	ret0, _ := ret[0].(*ChangePasswordReply)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ChangePassword indicates an expected call of ChangePassword.
+func (mr *MockUserServiceClientMockRecorder) ChangePassword(ctx, in interface{}, opts ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{ctx, in}, opts...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ChangePassword", reflect.TypeOf((*MockUserServiceClient)(nil).ChangePassword), varargs...)
+}
+
+// ConfirmMfa mocks base method.
+func (m *MockUserServiceClient) ConfirmMfa(ctx context.Context, in *ConfirmMfaRequest, opts ...grpc.CallOption) (*ConfirmMfaReply, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{ctx, in}
+	for _, a := range opts {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "ConfirmMfa", varargs...)
+	ret0, _ := ret[0].(*ConfirmMfaReply)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ConfirmMfa indicates an expected call of ConfirmMfa.
+func (mr *MockUserServiceClientMockRecorder) ConfirmMfa(ctx, in interface{}, opts ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{ctx, in}, opts...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConfirmMfa", reflect.TypeOf((*MockUserServiceClient)(nil).ConfirmMfa), varargs...)
+}
+
+// CreateApiKey mocks base method.
+func (m *MockUserServiceClient) CreateApiKey(ctx context.Context, in *CreateApiKeyRequest, opts ...grpc.CallOption) (*CreateApiKeyReply, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{ctx, in}
+	for _, a := range opts {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "CreateApiKey", varargs...)
+	ret0, _ := ret[0].(*CreateApiKeyReply)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateApiKey indicates an expected call of CreateApiKey.
+func (mr *MockUserServiceClientMockRecorder) CreateApiKey(ctx, in interface{}, opts ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{ctx, in}, opts...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateApiKey", reflect.TypeOf((*MockUserServiceClient)(nil).CreateApiKey), varargs...)
+}
+
 // CreateUser mocks base method.
 func (m *MockUserServiceClient) CreateUser(ctx context.Context, in *CreateUserRequest, opts ...grpc.CallOption) (*CreateUserReply, error) {
 	m.ctrl.T.Helper()
@@ -42,17 +122,457 @@ func (m *MockUserServiceClient) CreateUser(ctx context.Context, in *CreateUserRe
 	for _, a := range opts {
 		varargs = append(varargs, a)
 	}
-	ret := m.ctrl.Call(m, "CreateUser", varargs...)
-	ret0, _ := ret[0].(*CreateUserReply)
+	ret := m.ctrl.Call(m, "CreateUser", varargs...)
+	ret0, _ := ret[0].(*CreateUserReply)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateUser indicates an expected call of CreateUser.
+func (mr *MockUserServiceClientMockRecorder) CreateUser(ctx, in interface{}, opts ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{ctx, in}, opts...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateUser", reflect.TypeOf((*MockUserServiceClient)(nil).CreateUser), varargs...)
+}
+
+// DeleteUser mocks base method.
+func (m *MockUserServiceClient) DeleteUser(ctx context.Context, in *DeleteUserRequest, opts ...grpc.CallOption) (*DeleteUserReply, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{ctx, in}
+	for _, a := range opts {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "DeleteUser", varargs...)
+	ret0, _ := ret[0].(*DeleteUserReply)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteUser indicates an expected call of DeleteUser.
+func (mr *MockUserServiceClientMockRecorder) DeleteUser(ctx, in interface{}, opts ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{ctx, in}, opts...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUser", reflect.TypeOf((*MockUserServiceClient)(nil).DeleteUser), varargs...)
+}
+
+// DisableMfa mocks base method.
+func (m *MockUserServiceClient) DisableMfa(ctx context.Context, in *DisableMfaRequest, opts ...grpc.CallOption) (*DisableMfaReply, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{ctx, in}
+	for _, a := range opts {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "DisableMfa", varargs...)
+	ret0, _ := ret[0].(*DisableMfaReply)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DisableMfa indicates an expected call of DisableMfa.
+func (mr *MockUserServiceClientMockRecorder) DisableMfa(ctx, in interface{}, opts ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{ctx, in}, opts...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DisableMfa", reflect.TypeOf((*MockUserServiceClient)(nil).DisableMfa), varargs...)
+}
+
+// EnrollMfa mocks base method.
+func (m *MockUserServiceClient) EnrollMfa(ctx context.Context, in *EnrollMfaRequest, opts ...grpc.CallOption) (*EnrollMfaReply, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{ctx, in}
+	for _, a := range opts {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "EnrollMfa", varargs...)
+	ret0, _ := ret[0].(*EnrollMfaReply)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// EnrollMfa indicates an expected call of EnrollMfa.
+func (mr *MockUserServiceClientMockRecorder) EnrollMfa(ctx, in interface{}, opts ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{ctx, in}, opts...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EnrollMfa", reflect.TypeOf((*MockUserServiceClient)(nil).EnrollMfa), varargs...)
+}
+
+// GetUser mocks base method.
+func (m *MockUserServiceClient) GetUser(ctx context.Context, in *GetUserRequest, opts ...grpc.CallOption) (*GetUserReply, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{ctx, in}
+	for _, a := range opts {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "GetUser", varargs...)
+	ret0, _ := ret[0].(*GetUserReply)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUser indicates an expected call of GetUser.
+func (mr *MockUserServiceClientMockRecorder) GetUser(ctx, in interface{}, opts ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{ctx, in}, opts...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUser", reflect.TypeOf((*MockUserServiceClient)(nil).GetUser), varargs...)
+}
+
+// GetUserByEmail mocks base method.
+func (m *MockUserServiceClient) GetUserByEmail(ctx context.Context, in *GetUserByEmailRequest, opts ...grpc.CallOption) (*GetUserByEmailReply, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{ctx, in}
+	for _, a := range opts {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "GetUserByEmail", varargs...)
+	ret0, _ := ret[0].(*GetUserByEmailReply)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserByEmail indicates an expected call of GetUserByEmail.
+func (mr *MockUserServiceClientMockRecorder) GetUserByEmail(ctx, in interface{}, opts ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{ctx, in}, opts...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByEmail", reflect.TypeOf((*MockUserServiceClient)(nil).GetUserByEmail), varargs...)
+}
+
+// ListApiKeys mocks base method.
+func (m *MockUserServiceClient) ListApiKeys(ctx context.Context, in *ListApiKeysRequest, opts ...grpc.CallOption) (*ListApiKeysReply, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{ctx, in}
+	for _, a := range opts {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "ListApiKeys", varargs...)
+	ret0, _ := ret[0].(*ListApiKeysReply)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListApiKeys indicates an expected call of ListApiKeys.
+func (mr *MockUserServiceClientMockRecorder) ListApiKeys(ctx, in interface{}, opts ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{ctx, in}, opts...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListApiKeys", reflect.TypeOf((*MockUserServiceClient)(nil).ListApiKeys), varargs...)
+}
+
+// ListUsers mocks base method.
+func (m *MockUserServiceClient) ListUsers(ctx context.Context, in *ListUsersRequest, opts ...grpc.CallOption) (*ListUsersReply, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{ctx, in}
+	for _, a := range opts {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "ListUsers", varargs...)
+	ret0, _ := ret[0].(*ListUsersReply)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListUsers indicates an expected call of ListUsers.
+func (mr *MockUserServiceClientMockRecorder) ListUsers(ctx, in interface{}, opts ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{ctx, in}, opts...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListUsers", reflect.TypeOf((*MockUserServiceClient)(nil).ListUsers), varargs...)
+}
+
+// LockUser mocks base method.
+func (m *MockUserServiceClient) LockUser(ctx context.Context, in *LockUserRequest, opts ...grpc.CallOption) (*LockUserReply, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{ctx, in}
+	for _, a := range opts {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "LockUser", varargs...)
+	ret0, _ := ret[0].(*LockUserReply)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// LockUser indicates an expected call of LockUser.
+func (mr *MockUserServiceClientMockRecorder) LockUser(ctx, in interface{}, opts ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{ctx, in}, opts...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LockUser", reflect.TypeOf((*MockUserServiceClient)(nil).LockUser), varargs...)
+}
+
+// Login mocks base method.
+func (m *MockUserServiceClient) Login(ctx context.Context, in *LoginRequest, opts ...grpc.CallOption) (*LoginReply, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{ctx, in}
+	for _, a := range opts {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "Login", varargs...)
+	ret0, _ := ret[0].(*LoginReply)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Login indicates an expected call of Login.
+func (mr *MockUserServiceClientMockRecorder) Login(ctx, in interface{}, opts ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{ctx, in}, opts...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Login", reflect.TypeOf((*MockUserServiceClient)(nil).Login), varargs...)
+}
+
+// Logout mocks base method.
+func (m *MockUserServiceClient) Logout(ctx context.Context, in *LogoutRequest, opts ...grpc.CallOption) (*LogoutReply, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{ctx, in}
+	for _, a := range opts {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "Logout", varargs...)
+	ret0, _ := ret[0].(*LogoutReply)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Logout indicates an expected call of Logout.
+func (mr *MockUserServiceClientMockRecorder) Logout(ctx, in interface{}, opts ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{ctx, in}, opts...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Logout", reflect.TypeOf((*MockUserServiceClient)(nil).Logout), varargs...)
+}
+
+// LogoutEverywhere mocks base method.
+func (m *MockUserServiceClient) LogoutEverywhere(ctx context.Context, in *LogoutEverywhereRequest, opts ...grpc.CallOption) (*LogoutEverywhereReply, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{ctx, in}
+	for _, a := range opts {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "LogoutEverywhere", varargs...)
+	ret0, _ := ret[0].(*LogoutEverywhereReply)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// LogoutEverywhere indicates an expected call of LogoutEverywhere.
+func (mr *MockUserServiceClientMockRecorder) LogoutEverywhere(ctx, in interface{}, opts ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{ctx, in}, opts...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LogoutEverywhere", reflect.TypeOf((*MockUserServiceClient)(nil).LogoutEverywhere), varargs...)
+}
+
+// ReactivateUser mocks base method.
+func (m *MockUserServiceClient) ReactivateUser(ctx context.Context, in *ReactivateUserRequest, opts ...grpc.CallOption) (*ReactivateUserReply, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{ctx, in}
+	for _, a := range opts {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "ReactivateUser", varargs...)
+	ret0, _ := ret[0].(*ReactivateUserReply)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReactivateUser indicates an expected call of ReactivateUser.
+func (mr *MockUserServiceClientMockRecorder) ReactivateUser(ctx, in interface{}, opts ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{ctx, in}, opts...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReactivateUser", reflect.TypeOf((*MockUserServiceClient)(nil).ReactivateUser), varargs...)
+}
+
+// RefreshToken mocks base method.
+func (m *MockUserServiceClient) RefreshToken(ctx context.Context, in *RefreshTokenRequest, opts ...grpc.CallOption) (*LoginReply, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{ctx, in}
+	for _, a := range opts {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "RefreshToken", varargs...)
+	ret0, _ := ret[0].(*LoginReply)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RefreshToken indicates an expected call of RefreshToken.
+func (mr *MockUserServiceClientMockRecorder) RefreshToken(ctx, in interface{}, opts ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{ctx, in}, opts...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RefreshToken", reflect.TypeOf((*MockUserServiceClient)(nil).RefreshToken), varargs...)
+}
+
+// RequestPasswordReset mocks base method.
+func (m *MockUserServiceClient) RequestPasswordReset(ctx context.Context, in *RequestPasswordResetRequest, opts ...grpc.CallOption) (*RequestPasswordResetReply, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{ctx, in}
+	for _, a := range opts {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "RequestPasswordReset", varargs...)
+	ret0, _ := ret[0].(*RequestPasswordResetReply)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RequestPasswordReset indicates an expected call of RequestPasswordReset.
+func (mr *MockUserServiceClientMockRecorder) RequestPasswordReset(ctx, in interface{}, opts ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{ctx, in}, opts...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RequestPasswordReset", reflect.TypeOf((*MockUserServiceClient)(nil).RequestPasswordReset), varargs...)
+}
+
+// ResendVerificationEmail mocks base method.
+func (m *MockUserServiceClient) ResendVerificationEmail(ctx context.Context, in *ResendVerificationEmailRequest, opts ...grpc.CallOption) (*ResendVerificationEmailReply, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{ctx, in}
+	for _, a := range opts {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "ResendVerificationEmail", varargs...)
+	ret0, _ := ret[0].(*ResendVerificationEmailReply)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ResendVerificationEmail indicates an expected call of ResendVerificationEmail.
+func (mr *MockUserServiceClientMockRecorder) ResendVerificationEmail(ctx, in interface{}, opts ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{ctx, in}, opts...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResendVerificationEmail", reflect.TypeOf((*MockUserServiceClient)(nil).ResendVerificationEmail), varargs...)
+}
+
+// ResetPassword mocks base method.
+func (m *MockUserServiceClient) ResetPassword(ctx context.Context, in *ResetPasswordRequest, opts ...grpc.CallOption) (*ResetPasswordReply, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{ctx, in}
+	for _, a := range opts {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "ResetPassword", varargs...)
+	ret0, _ := ret[0].(*ResetPasswordReply)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ResetPassword indicates an expected call of ResetPassword.
+func (mr *MockUserServiceClientMockRecorder) ResetPassword(ctx, in interface{}, opts ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{ctx, in}, opts...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResetPassword", reflect.TypeOf((*MockUserServiceClient)(nil).ResetPassword), varargs...)
+}
+
+// RevokeApiKey mocks base method.
+func (m *MockUserServiceClient) RevokeApiKey(ctx context.Context, in *RevokeApiKeyRequest, opts ...grpc.CallOption) (*RevokeApiKeyReply, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{ctx, in}
+	for _, a := range opts {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "RevokeApiKey", varargs...)
+	ret0, _ := ret[0].(*RevokeApiKeyReply)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RevokeApiKey indicates an expected call of RevokeApiKey.
+func (mr *MockUserServiceClientMockRecorder) RevokeApiKey(ctx, in interface{}, opts ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{ctx, in}, opts...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeApiKey", reflect.TypeOf((*MockUserServiceClient)(nil).RevokeApiKey), varargs...)
+}
+
+// SuspendUser mocks base method.
+func (m *MockUserServiceClient) SuspendUser(ctx context.Context, in *SuspendUserRequest, opts ...grpc.CallOption) (*SuspendUserReply, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{ctx, in}
+	for _, a := range opts {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "SuspendUser", varargs...)
+	ret0, _ := ret[0].(*SuspendUserReply)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SuspendUser indicates an expected call of SuspendUser.
+func (mr *MockUserServiceClientMockRecorder) SuspendUser(ctx, in interface{}, opts ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{ctx, in}, opts...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SuspendUser", reflect.TypeOf((*MockUserServiceClient)(nil).SuspendUser), varargs...)
+}
+
+// UnlockUser mocks base method.
+func (m *MockUserServiceClient) UnlockUser(ctx context.Context, in *UnlockUserRequest, opts ...grpc.CallOption) (*UnlockUserReply, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{ctx, in}
+	for _, a := range opts {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "UnlockUser", varargs...)
+	ret0, _ := ret[0].(*UnlockUserReply)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// CreateUser indicates an expected call of CreateUser.
-func (mr *MockUserServiceClientMockRecorder) CreateUser(ctx, in interface{}, opts ...interface{}) *gomock.Call {
+// UnlockUser indicates an expected call of UnlockUser.
+func (mr *MockUserServiceClientMockRecorder) UnlockUser(ctx, in interface{}, opts ...interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	varargs := append([]interface{}{ctx, in}, opts...)
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateUser", reflect.TypeOf((*MockUserServiceClient)(nil).CreateUser), varargs...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UnlockUser", reflect.TypeOf((*MockUserServiceClient)(nil).UnlockUser), varargs...)
+}
+
+// UpdateUser mocks base method.
+func (m *MockUserServiceClient) UpdateUser(ctx context.Context, in *UpdateUserRequest, opts ...grpc.CallOption) (*UpdateUserReply, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{ctx, in}
+	for _, a := range opts {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "UpdateUser", varargs...)
+	ret0, _ := ret[0].(*UpdateUserReply)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateUser indicates an expected call of UpdateUser.
+func (mr *MockUserServiceClientMockRecorder) UpdateUser(ctx, in interface{}, opts ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{ctx, in}, opts...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateUser", reflect.TypeOf((*MockUserServiceClient)(nil).UpdateUser), varargs...)
+}
+
+// VerifyEmail mocks base method.
+func (m *MockUserServiceClient) VerifyEmail(ctx context.Context, in *VerifyEmailRequest, opts ...grpc.CallOption) (*VerifyEmailReply, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{ctx, in}
+	for _, a := range opts {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "VerifyEmail", varargs...)
+	ret0, _ := ret[0].(*VerifyEmailReply)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// VerifyEmail indicates an expected call of VerifyEmail.
+func (mr *MockUserServiceClientMockRecorder) VerifyEmail(ctx, in interface{}, opts ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{ctx, in}, opts...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "VerifyEmail", reflect.TypeOf((*MockUserServiceClient)(nil).VerifyEmail), varargs...)
+}
+
+// VerifyMfa mocks base method.
+func (m *MockUserServiceClient) VerifyMfa(ctx context.Context, in *VerifyMfaRequest, opts ...grpc.CallOption) (*LoginReply, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{ctx, in}
+	for _, a := range opts {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "VerifyMfa", varargs...)
+	ret0, _ := ret[0].(*LoginReply)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// VerifyMfa indicates an expected call of VerifyMfa.
+func (mr *MockUserServiceClientMockRecorder) VerifyMfa(ctx, in interface{}, opts ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{ctx, in}, opts...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "VerifyMfa", reflect.TypeOf((*MockUserServiceClient)(nil).VerifyMfa), varargs...)
 }
 
 // MockUserServiceServer is a mock of UserServiceServer interface.
@@ -78,6 +598,66 @@ func (m *MockUserServiceServer) EXPECT() *MockUserServiceServerMockRecorder {
 	return m.recorder
 }
 
+// AssignRole mocks base method.
+func (m *MockUserServiceServer) AssignRole(arg0 context.Context, arg1 *AssignRoleRequest) (*AssignRoleReply, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AssignRole", arg0, arg1)
+	ret0, _ := ret[0].(*AssignRoleReply)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AssignRole indicates an expected call of AssignRole.
+func (mr *MockUserServiceServerMockRecorder) AssignRole(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AssignRole", reflect.TypeOf((*MockUserServiceServer)(nil).AssignRole), arg0, arg1)
+}
+
+// ChangePassword mocks base method.
+func (m *MockUserServiceServer) ChangePassword(arg0 context.Context, arg1 *ChangePasswordRequest) (*ChangePasswordReply, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ChangePassword", arg0, arg1)
+	ret0, _ := ret[0].(*ChangePasswordReply)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ChangePassword indicates an expected call of ChangePassword.
+func (mr *MockUserServiceServerMockRecorder) ChangePassword(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ChangePassword", reflect.TypeOf((*MockUserServiceServer)(nil).ChangePassword), arg0, arg1)
+}
+
+// ConfirmMfa mocks base method.
+func (m *MockUserServiceServer) ConfirmMfa(arg0 context.Context, arg1 *ConfirmMfaRequest) (*ConfirmMfaReply, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConfirmMfa", arg0, arg1)
+	ret0, _ := ret[0].(*ConfirmMfaReply)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ConfirmMfa indicates an expected call of ConfirmMfa.
+func (mr *MockUserServiceServerMockRecorder) ConfirmMfa(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConfirmMfa", reflect.TypeOf((*MockUserServiceServer)(nil).ConfirmMfa), arg0, arg1)
+}
+
+// CreateApiKey mocks base method.
+func (m *MockUserServiceServer) CreateApiKey(arg0 context.Context, arg1 *CreateApiKeyRequest) (*CreateApiKeyReply, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateApiKey", arg0, arg1)
+	ret0, _ := ret[0].(*CreateApiKeyReply)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateApiKey indicates an expected call of CreateApiKey.
+func (mr *MockUserServiceServerMockRecorder) CreateApiKey(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateApiKey", reflect.TypeOf((*MockUserServiceServer)(nil).CreateApiKey), arg0, arg1)
+}
+
 // CreateUser mocks base method.
 func (m *MockUserServiceServer) CreateUser(arg0 context.Context, arg1 *CreateUserRequest) (*CreateUserReply, error) {
 	m.ctrl.T.Helper()
@@ -93,6 +673,336 @@ func (mr *MockUserServiceServerMockRecorder) CreateUser(arg0, arg1 interface{})
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateUser", reflect.TypeOf((*MockUserServiceServer)(nil).CreateUser), arg0, arg1)
 }
 
+// DeleteUser mocks base method.
+func (m *MockUserServiceServer) DeleteUser(arg0 context.Context, arg1 *DeleteUserRequest) (*DeleteUserReply, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteUser", arg0, arg1)
+	ret0, _ := ret[0].(*DeleteUserReply)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteUser indicates an expected call of DeleteUser.
+func (mr *MockUserServiceServerMockRecorder) DeleteUser(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUser", reflect.TypeOf((*MockUserServiceServer)(nil).DeleteUser), arg0, arg1)
+}
+
+// DisableMfa mocks base method.
+func (m *MockUserServiceServer) DisableMfa(arg0 context.Context, arg1 *DisableMfaRequest) (*DisableMfaReply, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DisableMfa", arg0, arg1)
+	ret0, _ := ret[0].(*DisableMfaReply)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DisableMfa indicates an expected call of DisableMfa.
+func (mr *MockUserServiceServerMockRecorder) DisableMfa(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DisableMfa", reflect.TypeOf((*MockUserServiceServer)(nil).DisableMfa), arg0, arg1)
+}
+
+// EnrollMfa mocks base method.
+func (m *MockUserServiceServer) EnrollMfa(arg0 context.Context, arg1 *EnrollMfaRequest) (*EnrollMfaReply, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EnrollMfa", arg0, arg1)
+	ret0, _ := ret[0].(*EnrollMfaReply)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// EnrollMfa indicates an expected call of EnrollMfa.
+func (mr *MockUserServiceServerMockRecorder) EnrollMfa(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EnrollMfa", reflect.TypeOf((*MockUserServiceServer)(nil).EnrollMfa), arg0, arg1)
+}
+
+// GetUser mocks base method.
+func (m *MockUserServiceServer) GetUser(arg0 context.Context, arg1 *GetUserRequest) (*GetUserReply, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUser", arg0, arg1)
+	ret0, _ := ret[0].(*GetUserReply)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUser indicates an expected call of GetUser.
+func (mr *MockUserServiceServerMockRecorder) GetUser(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUser", reflect.TypeOf((*MockUserServiceServer)(nil).GetUser), arg0, arg1)
+}
+
+// GetUserByEmail mocks base method.
+func (m *MockUserServiceServer) GetUserByEmail(arg0 context.Context, arg1 *GetUserByEmailRequest) (*GetUserByEmailReply, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserByEmail", arg0, arg1)
+	ret0, _ := ret[0].(*GetUserByEmailReply)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserByEmail indicates an expected call of GetUserByEmail.
+func (mr *MockUserServiceServerMockRecorder) GetUserByEmail(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByEmail", reflect.TypeOf((*MockUserServiceServer)(nil).GetUserByEmail), arg0, arg1)
+}
+
+// ListApiKeys mocks base method.
+func (m *MockUserServiceServer) ListApiKeys(arg0 context.Context, arg1 *ListApiKeysRequest) (*ListApiKeysReply, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListApiKeys", arg0, arg1)
+	ret0, _ := ret[0].(*ListApiKeysReply)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListApiKeys indicates an expected call of ListApiKeys.
+func (mr *MockUserServiceServerMockRecorder) ListApiKeys(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListApiKeys", reflect.TypeOf((*MockUserServiceServer)(nil).ListApiKeys), arg0, arg1)
+}
+
+// ListUsers mocks base method.
+func (m *MockUserServiceServer) ListUsers(arg0 context.Context, arg1 *ListUsersRequest) (*ListUsersReply, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListUsers", arg0, arg1)
+	ret0, _ := ret[0].(*ListUsersReply)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListUsers indicates an expected call of ListUsers.
+func (mr *MockUserServiceServerMockRecorder) ListUsers(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListUsers", reflect.TypeOf((*MockUserServiceServer)(nil).ListUsers), arg0, arg1)
+}
+
+// LockUser mocks base method.
+func (m *MockUserServiceServer) LockUser(arg0 context.Context, arg1 *LockUserRequest) (*LockUserReply, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LockUser", arg0, arg1)
+	ret0, _ := ret[0].(*LockUserReply)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// LockUser indicates an expected call of LockUser.
+func (mr *MockUserServiceServerMockRecorder) LockUser(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LockUser", reflect.TypeOf((*MockUserServiceServer)(nil).LockUser), arg0, arg1)
+}
+
+// Login mocks base method.
+func (m *MockUserServiceServer) Login(arg0 context.Context, arg1 *LoginRequest) (*LoginReply, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Login", arg0, arg1)
+	ret0, _ := ret[0].(*LoginReply)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Login indicates an expected call of Login.
+func (mr *MockUserServiceServerMockRecorder) Login(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Login", reflect.TypeOf((*MockUserServiceServer)(nil).Login), arg0, arg1)
+}
+
+// Logout mocks base method.
+func (m *MockUserServiceServer) Logout(arg0 context.Context, arg1 *LogoutRequest) (*LogoutReply, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Logout", arg0, arg1)
+	ret0, _ := ret[0].(*LogoutReply)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Logout indicates an expected call of Logout.
+func (mr *MockUserServiceServerMockRecorder) Logout(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Logout", reflect.TypeOf((*MockUserServiceServer)(nil).Logout), arg0, arg1)
+}
+
+// LogoutEverywhere mocks base method.
+func (m *MockUserServiceServer) LogoutEverywhere(arg0 context.Context, arg1 *LogoutEverywhereRequest) (*LogoutEverywhereReply, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LogoutEverywhere", arg0, arg1)
+	ret0, _ := ret[0].(*LogoutEverywhereReply)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// LogoutEverywhere indicates an expected call of LogoutEverywhere.
+func (mr *MockUserServiceServerMockRecorder) LogoutEverywhere(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LogoutEverywhere", reflect.TypeOf((*MockUserServiceServer)(nil).LogoutEverywhere), arg0, arg1)
+}
+
+// ReactivateUser mocks base method.
+func (m *MockUserServiceServer) ReactivateUser(arg0 context.Context, arg1 *ReactivateUserRequest) (*ReactivateUserReply, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReactivateUser", arg0, arg1)
+	ret0, _ := ret[0].(*ReactivateUserReply)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReactivateUser indicates an expected call of ReactivateUser.
+func (mr *MockUserServiceServerMockRecorder) ReactivateUser(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReactivateUser", reflect.TypeOf((*MockUserServiceServer)(nil).ReactivateUser), arg0, arg1)
+}
+
+// RefreshToken mocks base method.
+func (m *MockUserServiceServer) RefreshToken(arg0 context.Context, arg1 *RefreshTokenRequest) (*LoginReply, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RefreshToken", arg0, arg1)
+	ret0, _ := ret[0].(*LoginReply)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RefreshToken indicates an expected call of RefreshToken.
+func (mr *MockUserServiceServerMockRecorder) RefreshToken(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RefreshToken", reflect.TypeOf((*MockUserServiceServer)(nil).RefreshToken), arg0, arg1)
+}
+
+// RequestPasswordReset mocks base method.
+func (m *MockUserServiceServer) RequestPasswordReset(arg0 context.Context, arg1 *RequestPasswordResetRequest) (*RequestPasswordResetReply, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RequestPasswordReset", arg0, arg1)
+	ret0, _ := ret[0].(*RequestPasswordResetReply)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RequestPasswordReset indicates an expected call of RequestPasswordReset.
+func (mr *MockUserServiceServerMockRecorder) RequestPasswordReset(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RequestPasswordReset", reflect.TypeOf((*MockUserServiceServer)(nil).RequestPasswordReset), arg0, arg1)
+}
+
+// ResendVerificationEmail mocks base method.
+func (m *MockUserServiceServer) ResendVerificationEmail(arg0 context.Context, arg1 *ResendVerificationEmailRequest) (*ResendVerificationEmailReply, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ResendVerificationEmail", arg0, arg1)
+	ret0, _ := ret[0].(*ResendVerificationEmailReply)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ResendVerificationEmail indicates an expected call of ResendVerificationEmail.
+func (mr *MockUserServiceServerMockRecorder) ResendVerificationEmail(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResendVerificationEmail", reflect.TypeOf((*MockUserServiceServer)(nil).ResendVerificationEmail), arg0, arg1)
+}
+
+// ResetPassword mocks base method.
+func (m *MockUserServiceServer) ResetPassword(arg0 context.Context, arg1 *ResetPasswordRequest) (*ResetPasswordReply, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ResetPassword", arg0, arg1)
+	ret0, _ := ret[0].(*ResetPasswordReply)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ResetPassword indicates an expected call of ResetPassword.
+func (mr *MockUserServiceServerMockRecorder) ResetPassword(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResetPassword", reflect.TypeOf((*MockUserServiceServer)(nil).ResetPassword), arg0, arg1)
+}
+
+// RevokeApiKey mocks base method.
+func (m *MockUserServiceServer) RevokeApiKey(arg0 context.Context, arg1 *RevokeApiKeyRequest) (*RevokeApiKeyReply, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeApiKey", arg0, arg1)
+	ret0, _ := ret[0].(*RevokeApiKeyReply)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RevokeApiKey indicates an expected call of RevokeApiKey.
+func (mr *MockUserServiceServerMockRecorder) RevokeApiKey(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeApiKey", reflect.TypeOf((*MockUserServiceServer)(nil).RevokeApiKey), arg0, arg1)
+}
+
+// SuspendUser mocks base method.
+func (m *MockUserServiceServer) SuspendUser(arg0 context.Context, arg1 *SuspendUserRequest) (*SuspendUserReply, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SuspendUser", arg0, arg1)
+	ret0, _ := ret[0].(*SuspendUserReply)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SuspendUser indicates an expected call of SuspendUser.
+func (mr *MockUserServiceServerMockRecorder) SuspendUser(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SuspendUser", reflect.TypeOf((*MockUserServiceServer)(nil).SuspendUser), arg0, arg1)
+}
+
+// UnlockUser mocks base method.
+func (m *MockUserServiceServer) UnlockUser(arg0 context.Context, arg1 *UnlockUserRequest) (*UnlockUserReply, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UnlockUser", arg0, arg1)
+	ret0, _ := ret[0].(*UnlockUserReply)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UnlockUser indicates an expected call of UnlockUser.
+func (mr *MockUserServiceServerMockRecorder) UnlockUser(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UnlockUser", reflect.TypeOf((*MockUserServiceServer)(nil).UnlockUser), arg0, arg1)
+}
+
+// UpdateUser mocks base method.
+func (m *MockUserServiceServer) UpdateUser(arg0 context.Context, arg1 *UpdateUserRequest) (*UpdateUserReply, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateUser", arg0, arg1)
+	ret0, _ := ret[0].(*UpdateUserReply)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateUser indicates an expected call of UpdateUser.
+func (mr *MockUserServiceServerMockRecorder) UpdateUser(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateUser", reflect.TypeOf((*MockUserServiceServer)(nil).UpdateUser), arg0, arg1)
+}
+
+// VerifyEmail mocks base method.
+func (m *MockUserServiceServer) VerifyEmail(arg0 context.Context, arg1 *VerifyEmailRequest) (*VerifyEmailReply, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "VerifyEmail", arg0, arg1)
+	ret0, _ := ret[0].(*VerifyEmailReply)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// VerifyEmail indicates an expected call of VerifyEmail.
+func (mr *MockUserServiceServerMockRecorder) VerifyEmail(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "VerifyEmail", reflect.TypeOf((*MockUserServiceServer)(nil).VerifyEmail), arg0, arg1)
+}
+
+// VerifyMfa mocks base method.
+func (m *MockUserServiceServer) VerifyMfa(arg0 context.Context, arg1 *VerifyMfaRequest) (*LoginReply, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "VerifyMfa", arg0, arg1)
+	ret0, _ := ret[0].(*LoginReply)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// VerifyMfa indicates an expected call of VerifyMfa.
+func (mr *MockUserServiceServerMockRecorder) VerifyMfa(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "VerifyMfa", reflect.TypeOf((*MockUserServiceServer)(nil).VerifyMfa), arg0, arg1)
+}
+
 // mustEmbedUnimplementedUserServiceServer mocks base method.
 func (m *MockUserServiceServer) mustEmbedUnimplementedUserServiceServer() {
 	m.ctrl.T.Helper()
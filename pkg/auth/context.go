@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+
+	"github.com/status-owl/user-service/pkg/model"
+)
+
+// Principal is the authenticated caller of an operation
+type Principal struct {
+	UserID string
+	Role   model.Role
+	// MFA is set if the caller has passed a second factor
+	MFA bool
+	// APIKeyID is set if the caller has authenticated with a personal API key instead of an access token
+	APIKeyID string
+	// Scopes restricts the operations of callers authenticated with an API key
+	Scopes []model.Scope
+}
+
+// String implements Stringer interface
+func (p *Principal) String() string {
+	return fmt.Sprintf("Principal { user_id = %q, role = %q, mfa = %t, api_key_id = %q }",
+		p.UserID, p.Role, p.MFA, p.APIKeyID)
+}
+
+// HasScope reports whether the caller may perform operations requiring given scope,
+// callers authenticated with an access token aren't restricted
+func (p *Principal) HasScope(scope model.Scope) bool {
+	if p.APIKeyID == "" {
+		return true
+	}
+
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// IsAdmin reports whether the caller is an administrator
+func (p *Principal) IsAdmin() bool {
+	return p.Role == model.Admin
+}
+
+// PrincipalFromClaims returns the caller the access token has been issued to
+func PrincipalFromClaims(claims *Claims) *Principal {
+	return &Principal{UserID: claims.Subject, Role: claims.Role, MFA: claims.MFA}
+}
+
+type principalKey struct{}
+
+// NewContext returns a copy of ctx carrying given caller
+func NewContext(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext returns the caller carried by ctx, anonymous calls have none
+func FromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok && p != nil
+}
+
+type clientIPKey struct{}
+
+// NewClientIPContext returns a copy of ctx carrying the source address of the caller,
+// failed logins are tracked per address
+func NewClientIPContext(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+// ClientIPFromContext returns the source address of the caller carried by ctx
+func ClientIPFromContext(ctx context.Context) (string, bool) {
+	ip, ok := ctx.Value(clientIPKey{}).(string)
+	return ip, ok && ip != ""
+}
+
+type clientCertKey struct{}
+
+// NewClientCertContext returns a copy of ctx carrying the verified certificate the caller
+// presented on the TLS handshake, it identifies services calling via mutual TLS
+func NewClientCertContext(ctx context.Context, cert *x509.Certificate) context.Context {
+	return context.WithValue(ctx, clientCertKey{}, cert)
+}
+
+// ClientCertFromContext returns the client certificate carried by ctx,
+// callers without one are authenticated by their tokens only
+func ClientCertFromContext(ctx context.Context) (*x509.Certificate, bool) {
+	cert, ok := ctx.Value(clientCertKey{}).(*x509.Certificate)
+	return cert, ok && cert != nil
+}
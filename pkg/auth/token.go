@@ -0,0 +1,251 @@
+// Package auth issues and verifies the JWT access tokens of the status-owl services.
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/status-owl/user-service/pkg/model"
+)
+
+var (
+	// ErrInvalidToken signals that a token is malformed, expired or not signed by us
+	ErrInvalidToken = errors.New("invalid token")
+)
+
+// Claims are the claims of an access token, the subject is the user id
+type Claims struct {
+	Role model.Role `json:"role"`
+	// Purpose is empty for access tokens, tokens with a purpose grant no access
+	Purpose string `json:"purpose,omitempty"`
+	// EMail is the confirmed address of email verification tokens
+	EMail string `json:"email,omitempty"`
+	// MFA is set if the user has passed a second factor
+	MFA bool `json:"mfa,omitempty"`
+	jwt.RegisteredClaims
+}
+
+const (
+	// emailVerificationPurpose is the purpose of the tokens confirming email addresses
+	emailVerificationPurpose = "email_verification"
+	// mfaChallengePurpose is the purpose of the tokens proving the first factor of a login
+	mfaChallengePurpose = "mfa_challenge"
+)
+
+// Signer issues RS256 signed access tokens and verifies them
+type Signer struct {
+	key      *rsa.PrivateKey
+	keyID    string
+	issuer   string
+	audience string
+	ttl      time.Duration
+	// now returns the current time, replaced in tests
+	now func() time.Time
+}
+
+// NewSigner creates a signer issuing tokens with given issuer and audience valid for ttl
+func NewSigner(key *rsa.PrivateKey, issuer, audience string, ttl time.Duration) *Signer {
+	return &Signer{
+		key:      key,
+		keyID:    thumbprint(&key.PublicKey),
+		issuer:   issuer,
+		audience: audience,
+		ttl:      ttl,
+		now:      time.Now,
+	}
+}
+
+// Issue creates a signed access token for given user,
+// users with multi-factor authentication enabled can't log in without passing it
+func (s *Signer) Issue(user *model.User) (*model.Token, error) {
+	now := s.now().Truncate(time.Second)
+	expiresAt := now.Add(s.ttl)
+
+	signed, err := s.sign(&Claims{Role: user.Role, MFA: user.MFAEnabled}, user.ID, s.audience, now, expiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.Token{AccessToken: signed, ExpiresAt: expiresAt}, nil
+}
+
+// IssueEMailVerification creates a signed token confirming the email address of given user valid for ttl,
+// it's addressed to the issuer itself so other services don't accept it
+func (s *Signer) IssueEMailVerification(user *model.User, ttl time.Duration) (string, error) {
+	now := s.now().Truncate(time.Second)
+	claims := Claims{Purpose: emailVerificationPurpose, EMail: user.EMail}
+	return s.sign(&claims, user.ID, s.issuer, now, now.Add(ttl))
+}
+
+// IssueMFAChallenge creates a signed token proving that given user has passed the first factor of a login,
+// it's exchanged for an access token together with the second factor within ttl
+func (s *Signer) IssueMFAChallenge(user *model.User, ttl time.Duration) (string, error) {
+	now := s.now().Truncate(time.Second)
+	return s.sign(&Claims{Purpose: mfaChallengePurpose}, user.ID, s.issuer, now, now.Add(ttl))
+}
+
+// sign completes the registered claims and signs them
+func (s *Signer) sign(claims *Claims, subject, audience string, now, expiresAt time.Time) (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("failed to generate token id: %w", err)
+	}
+
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ID:        hex.EncodeToString(id),
+		Issuer:    s.issuer,
+		Subject:   subject,
+		Audience:  jwt.ClaimStrings{audience},
+		IssuedAt:  jwt.NewNumericDate(now),
+		NotBefore: jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = s.keyID
+
+	signed, err := token.SignedString(s.key)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign token: %w", err)
+	}
+
+	return signed, nil
+}
+
+// Verify checks the signature and the registered claims of given access token
+func (s *Signer) Verify(token string) (*Claims, error) {
+	return s.verify(token, s.audience, "")
+}
+
+// VerifyEMailVerification checks given email verification token,
+// the subject of the returned claims is the user id
+func (s *Signer) VerifyEMailVerification(token string) (*Claims, error) {
+	claims, err := s.verify(token, s.issuer, emailVerificationPurpose)
+	if err != nil {
+		return nil, err
+	}
+	if claims.EMail == "" {
+		return nil, ErrInvalidToken
+	}
+
+	return claims, nil
+}
+
+// VerifyMFAChallenge checks given multi-factor challenge token,
+// the subject of the returned claims is the user id
+func (s *Signer) VerifyMFAChallenge(token string) (*Claims, error) {
+	return s.verify(token, s.issuer, mfaChallengePurpose)
+}
+
+// verify checks the signature and the registered claims of given token
+// together with its audience and purpose
+func (s *Signer) verify(token, audience, purpose string) (*Claims, error) {
+	var claims Claims
+	// the claims are validated below using s.now
+	parser := jwt.Parser{ValidMethods: []string{jwt.SigningMethodRS256.Alg()}, SkipClaimsValidation: true}
+	_, err := parser.ParseWithClaims(token, &claims, func(t *jwt.Token) (interface{}, error) {
+		if kid, _ := t.Header["kid"].(string); kid != s.keyID {
+			return nil, fmt.Errorf("unknown key id %q", kid)
+		}
+		return &s.key.PublicKey, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidToken, err.Error())
+	}
+
+	now := s.now()
+	if !claims.VerifyIssuer(s.issuer, true) ||
+		!claims.VerifyAudience(audience, true) ||
+		!claims.VerifyExpiresAt(now, true) ||
+		!claims.VerifyNotBefore(now, false) ||
+		claims.Purpose != purpose ||
+		claims.Subject == "" {
+		return nil, ErrInvalidToken
+	}
+
+	return &claims, nil
+}
+
+// JWK is a public key in the JSON Web Key format of RFC 7517
+type JWK struct {
+	KeyType   string `json:"kty"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+	N         string `json:"n"`
+	E         string `json:"e"`
+}
+
+// JWKSet is a set of public keys, see RFC 7517
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys other services need to verify the access tokens offline
+func (s *Signer) JWKS() *JWKSet {
+	pub := &s.key.PublicKey
+	return &JWKSet{Keys: []JWK{{
+		KeyType:   "RSA",
+		Use:       "sig",
+		Algorithm: jwt.SigningMethodRS256.Alg(),
+		KeyID:     s.keyID,
+		N:         base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	}}}
+}
+
+// thumbprint computes the JWK thumbprint of RFC 7638, it's used as key id
+func thumbprint(key *rsa.PublicKey) string {
+	json := fmt.Sprintf(`{"e":"%s","kty":"RSA","n":"%s"}`,
+		base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+	)
+	sum := sha256.Sum256([]byte(json))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// GenerateRSAKey generates a new 2048 bit signing key
+func GenerateRSAKey() (*rsa.PrivateKey, error) {
+	return rsa.GenerateKey(rand.Reader, 2048)
+}
+
+// LoadRSAKey reads a PEM encoded RSA private key in PKCS #1 or PKCS #8 format
+func LoadRSAKey(path string) (*rsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in %q", path)
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse key %q: %w", path, err)
+	}
+
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("key %q is no RSA key", path)
+	}
+
+	return rsaKey, nil
+}
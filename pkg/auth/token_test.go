@@ -0,0 +1,217 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/status-owl/user-service/pkg/model"
+)
+
+// testKey is shared by all tests, generating keys is slow
+var testKey = func() *rsa.PrivateKey {
+	key, err := GenerateRSAKey()
+	if err != nil {
+		panic(err)
+	}
+	return key
+}()
+
+func TestIssueAndVerify(t *testing.T) {
+	a := assert.New(t)
+	now := time.Date(2021, 12, 24, 18, 0, 0, 0, time.UTC)
+	signer := NewSigner(testKey, "user-service", "status-owl", 15*time.Minute)
+	signer.now = func() time.Time { return now }
+
+	token, err := signer.Issue(&model.User{ID: "123", Role: model.Admin})
+	a.Nil(err)
+	a.Equal(now.Add(15*time.Minute), token.ExpiresAt)
+
+	claims, err := signer.Verify(token.AccessToken)
+	if a.Nil(err) {
+		a.Equal("123", claims.Subject)
+		a.Equal(model.Admin, claims.Role)
+		a.Equal("user-service", claims.Issuer)
+		a.Equal(jwt.ClaimStrings{"status-owl"}, claims.Audience)
+		a.NotEmpty(claims.ID)
+	}
+
+	other, err := signer.Issue(&model.User{ID: "123", Role: model.Admin})
+	a.Nil(err)
+	a.NotEqual(token.AccessToken, other.AccessToken, "every token has its own id")
+
+	// expired
+	signer.now = func() time.Time { return now.Add(15 * time.Minute) }
+	_, err = signer.Verify(token.AccessToken)
+	a.ErrorIs(err, ErrInvalidToken)
+}
+
+func TestEMailVerification(t *testing.T) {
+	a := assert.New(t)
+	now := time.Date(2021, 12, 24, 18, 0, 0, 0, time.UTC)
+	signer := NewSigner(testKey, "user-service", "status-owl", 15*time.Minute)
+	signer.now = func() time.Time { return now }
+
+	token, err := signer.IssueEMailVerification(&model.User{ID: "123", EMail: "john@example.com"}, 24*time.Hour)
+	a.Nil(err)
+
+	claims, err := signer.VerifyEMailVerification(token)
+	if a.Nil(err) {
+		a.Equal("123", claims.Subject)
+		a.Equal("john@example.com", claims.EMail)
+		a.Equal(jwt.ClaimStrings{"user-service"}, claims.Audience)
+	}
+
+	// verification tokens grant no access and vice versa
+	_, err = signer.Verify(token)
+	a.ErrorIs(err, ErrInvalidToken)
+
+	access, err := signer.Issue(&model.User{ID: "123", EMail: "john@example.com"})
+	a.Nil(err)
+	_, err = signer.VerifyEMailVerification(access.AccessToken)
+	a.ErrorIs(err, ErrInvalidToken)
+
+	// expired
+	signer.now = func() time.Time { return now.Add(24 * time.Hour) }
+	_, err = signer.VerifyEMailVerification(token)
+	a.ErrorIs(err, ErrInvalidToken)
+}
+
+func TestMFAChallenge(t *testing.T) {
+	a := assert.New(t)
+	now := time.Date(2021, 12, 24, 18, 0, 0, 0, time.UTC)
+	signer := NewSigner(testKey, "user-service", "status-owl", 15*time.Minute)
+	signer.now = func() time.Time { return now }
+
+	user := &model.User{ID: "123", Role: model.Admin, MFAEnabled: true}
+	token, err := signer.IssueMFAChallenge(user, 5*time.Minute)
+	a.Nil(err)
+
+	claims, err := signer.VerifyMFAChallenge(token)
+	if a.Nil(err) {
+		a.Equal("123", claims.Subject)
+		a.Equal(jwt.ClaimStrings{"user-service"}, claims.Audience)
+	}
+
+	// challenges grant no access and vice versa
+	_, err = signer.Verify(token)
+	a.ErrorIs(err, ErrInvalidToken)
+	verification, err := signer.IssueEMailVerification(user, time.Hour)
+	a.Nil(err)
+	_, err = signer.VerifyMFAChallenge(verification)
+	a.ErrorIs(err, ErrInvalidToken)
+
+	// the access tokens of users with multi-factor authentication tell so
+	access, err := signer.Issue(user)
+	a.Nil(err)
+	claims, err = signer.Verify(access.AccessToken)
+	if a.Nil(err) {
+		a.True(claims.MFA)
+		a.True(PrincipalFromClaims(claims).MFA)
+	}
+
+	// expired
+	signer.now = func() time.Time { return now.Add(5 * time.Minute) }
+	_, err = signer.VerifyMFAChallenge(token)
+	a.ErrorIs(err, ErrInvalidToken)
+}
+
+func TestVerifyForeignTokens(t *testing.T) {
+	a := assert.New(t)
+	signer := NewSigner(testKey, "user-service", "status-owl", time.Minute)
+
+	otherKey, err := GenerateRSAKey()
+	a.Nil(err)
+
+	for name, other := range map[string]*Signer{
+		"other key":      NewSigner(otherKey, "user-service", "status-owl", time.Minute),
+		"other issuer":   NewSigner(testKey, "other-service", "status-owl", time.Minute),
+		"other audience": NewSigner(testKey, "user-service", "other", time.Minute),
+	} {
+		token, err := other.Issue(&model.User{ID: "123", Role: model.Admin})
+		a.Nil(err)
+
+		_, err = signer.Verify(token.AccessToken)
+		a.ErrorIs(err, ErrInvalidToken, name)
+	}
+
+	// unsigned tokens are rejected
+	unsigned, err := jwt.NewWithClaims(jwt.SigningMethodNone, &Claims{
+		Role:             model.Admin,
+		RegisteredClaims: jwt.RegisteredClaims{Subject: "123", Issuer: "user-service"},
+	}).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	a.Nil(err)
+
+	for _, token := range []string{unsigned, "", "not.a.token"} {
+		_, err = signer.Verify(token)
+		a.ErrorIs(err, ErrInvalidToken, token)
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	a := assert.New(t)
+	signer := NewSigner(testKey, "user-service", "status-owl", time.Minute)
+
+	jwks := signer.JWKS()
+	if !a.Len(jwks.Keys, 1) {
+		return
+	}
+
+	jwk := jwks.Keys[0]
+	a.Equal("RSA", jwk.KeyType)
+	a.Equal("RS256", jwk.Algorithm)
+	a.Equal("sig", jwk.Use)
+
+	// the published key verifies the tokens
+	n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+	a.Nil(err)
+	e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+	a.Nil(err)
+	pub := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+
+	token, err := signer.Issue(&model.User{ID: "123", Role: model.Reporter})
+	a.Nil(err)
+
+	parsed, err := jwt.Parse(token.AccessToken, func(t *jwt.Token) (interface{}, error) {
+		a.Equal(jwk.KeyID, t.Header["kid"])
+		return pub, nil
+	})
+	a.Nil(err)
+	a.True(parsed.Valid)
+}
+
+func TestLoadRSAKey(t *testing.T) {
+	a := assert.New(t)
+	dir := t.TempDir()
+
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(testKey)
+	a.Nil(err)
+
+	for name, block := range map[string]*pem.Block{
+		"pkcs1.pem": {Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(testKey)},
+		"pkcs8.pem": {Type: "PRIVATE KEY", Bytes: pkcs8},
+	} {
+		path := filepath.Join(dir, name)
+		a.Nil(os.WriteFile(path, pem.EncodeToMemory(block), 0600))
+
+		key, err := LoadRSAKey(path)
+		if a.Nil(err, name) {
+			a.True(testKey.Equal(key), name)
+		}
+	}
+
+	path := filepath.Join(dir, "invalid.pem")
+	a.Nil(os.WriteFile(path, []byte(strings.Repeat("x", 32)), 0600))
+	_, err = LoadRSAKey(path)
+	a.NotNil(err)
+}
@@ -0,0 +1,229 @@
+// Package certs keeps the TLS certificates of the servers up to date
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// ParseClientAuth returns the client certificate policy of given name: none, optional or require.
+// Given client certificates are verified against the client CAs in both of the latter.
+func ParseClientAuth(s string) (tls.ClientAuthType, error) {
+	switch s {
+	case "none":
+		return tls.NoClientCert, nil
+	case "optional":
+		return tls.VerifyClientCertIfGiven, nil
+	case "require":
+		return tls.RequireAndVerifyClientCert, nil
+	default:
+		return tls.NoClientCert, fmt.Errorf("unknown client auth %q, expected one of: none, optional, require", s)
+	}
+}
+
+// Reloader serves a certificate and optionally the CAs client certificates are verified against
+// from PEM files and reloads them once the files have changed, so certificates are rotated
+// without restarting the service
+type Reloader struct {
+	certFile     string
+	keyFile      string
+	clientCAFile string
+	logger       zerolog.Logger
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	modTimes  map[string]time.Time
+}
+
+// NewReloader loads the key pair and the client CAs, the latter are optional
+func NewReloader(certFile, keyFile, clientCAFile string, logger zerolog.Logger) (*Reloader, error) {
+	r := &Reloader{
+		certFile:     certFile,
+		keyFile:      keyFile,
+		clientCAFile: clientCAFile,
+		logger:       logger,
+	}
+
+	if _, err := r.Reload(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *Reloader) files() []string {
+	files := []string{r.certFile, r.keyFile}
+	if r.clientCAFile != "" {
+		files = append(files, r.clientCAFile)
+	}
+	return files
+}
+
+// Reload loads the files again if any of them has changed since the last load and reports
+// whether it did. On failure the certificates loaded before are kept.
+func (r *Reloader) Reload() (bool, error) {
+	modTimes := make(map[string]time.Time)
+	for _, f := range r.files() {
+		info, err := os.Stat(f)
+		if err != nil {
+			return false, fmt.Errorf("failed to stat %q: %w", f, err)
+		}
+		modTimes[f] = info.ModTime()
+	}
+
+	r.mu.RLock()
+	changed := r.modTimes == nil
+	for f, t := range modTimes {
+		if !r.modTimes[f].Equal(t) {
+			changed = true
+		}
+	}
+	r.mu.RUnlock()
+
+	if !changed {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("failed to load the key pair: %w", err)
+	}
+
+	var clientCAs *x509.CertPool
+	if r.clientCAFile != "" {
+		clientCAs, err = loadCertPool(r.clientCAFile)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.cert = &cert
+	r.clientCAs = clientCAs
+	r.modTimes = modTimes
+
+	return true, nil
+}
+
+// loadCertPool reads the PEM encoded certificates of given file
+func loadCertPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the client CA file: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in %q", path)
+	}
+
+	return pool, nil
+}
+
+// Run reloads the files in given interval until ctx is done,
+// failures are logged and retried on the next run
+func (r *Reloader) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := r.Reload()
+			if err != nil {
+				r.logger.Error().
+					Err(err).
+					Str("cert_file", r.certFile).
+					Msg("failed to reload the certificates, keeping the current ones")
+				continue
+			}
+			if reloaded {
+				r.logger.Info().
+					Str("cert_file", r.certFile).
+					Msg("certificates reloaded")
+			}
+		}
+	}
+}
+
+// GetCertificate returns the current certificate, see tls.Config
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.cert, nil
+}
+
+// TLSConfig returns a server configuration using the current certificate for every handshake.
+// Client certificates are verified against the current client CAs, the CAs are fixed once
+// passed as tls.Config.ClientCAs, so the verification is done here instead.
+func (r *Reloader) TLSConfig(clientAuth tls.ClientAuthType) *tls.Config {
+	cfg := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: r.GetCertificate,
+	}
+
+	switch clientAuth {
+	case tls.VerifyClientCertIfGiven:
+		cfg.ClientAuth = tls.RequestClientCert
+		cfg.VerifyPeerCertificate = r.verifyClientCert
+	case tls.RequireAndVerifyClientCert:
+		cfg.ClientAuth = tls.RequireAnyClientCert
+		cfg.VerifyPeerCertificate = r.verifyClientCert
+	default:
+		cfg.ClientAuth = clientAuth
+	}
+
+	return cfg
+}
+
+// verifyClientCert verifies the chain presented by a client, clients without
+// a certificate are refused by the handshake already if one is required
+func (r *Reloader) verifyClientCert(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+	if len(rawCerts) == 0 {
+		return nil
+	}
+
+	certs := make([]*x509.Certificate, 0, len(rawCerts))
+	for _, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return fmt.Errorf("failed to parse client certificate: %w", err)
+		}
+		certs = append(certs, cert)
+	}
+
+	r.mu.RLock()
+	roots := r.clientCAs
+	r.mu.RUnlock()
+	if roots == nil {
+		return errors.New("no client CAs configured")
+	}
+
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: x509.NewCertPool(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	for _, cert := range certs[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+
+	if _, err := certs[0].Verify(opts); err != nil {
+		return fmt.Errorf("failed to verify client certificate: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,292 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+// testCA issues the certificates of a test
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate CA key: %s", err.Error())
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create CA certificate: %s", err.Error())
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse CA certificate: %s", err.Error())
+	}
+
+	return &testCA{cert: cert, key: key}
+}
+
+// issue returns a PEM encoded certificate and key with given common name and usage
+func (ca *testCA) issue(t *testing.T, name string, usage x509.ExtKeyUsage) ([]byte, []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %s", err.Error())
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %s", err.Error())
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %s", err.Error())
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+}
+
+func (ca *testCA) pem() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw})
+}
+
+func (ca *testCA) pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	return pool
+}
+
+// writeFile writes given data and moves the modification time forward,
+// so a rewrite is noticed even within the resolution of the file system
+func writeFile(t *testing.T, path string, data []byte, modTime time.Time) {
+	t.Helper()
+
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("failed to write %q: %s", path, err.Error())
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("failed to touch %q: %s", path, err.Error())
+	}
+}
+
+// connect returns both ends of a loopback tcp connection, unlike net.Pipe they're buffered,
+// so both sides may write alerts at the same time
+func connect(t *testing.T) (net.Conn, net.Conn) {
+	t.Helper()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err.Error())
+	}
+	defer lis.Close()
+
+	clientConn, err := net.Dial("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to dial: %s", err.Error())
+	}
+	serverConn, err := lis.Accept()
+	if err != nil {
+		t.Fatalf("failed to accept: %s", err.Error())
+	}
+
+	return serverConn, clientConn
+}
+
+// handshake connects a client with given config to a server with given config
+// and returns the state of the server's connection
+func handshake(t *testing.T, serverCfg, clientCfg *tls.Config) (*tls.ConnectionState, error) {
+	t.Helper()
+
+	serverConn, clientConn := connect(t)
+	defer serverConn.Close()
+	defer clientConn.Close()
+
+	go func() {
+		_ = tls.Client(clientConn, clientCfg).Handshake()
+	}()
+
+	server := tls.Server(serverConn, serverCfg)
+	if err := server.Handshake(); err != nil {
+		return nil, err
+	}
+	state := server.ConnectionState()
+	return &state, nil
+}
+
+// servedName returns the common name of the certificate a client is served
+func servedName(t *testing.T, serverCfg *tls.Config, roots *x509.CertPool) string {
+	t.Helper()
+
+	serverConn, clientConn := connect(t)
+	defer serverConn.Close()
+	defer clientConn.Close()
+
+	go func() {
+		_ = tls.Server(serverConn, serverCfg).Handshake()
+	}()
+
+	client := tls.Client(clientConn, &tls.Config{RootCAs: roots, ServerName: "127.0.0.1"})
+	if err := client.Handshake(); err != nil {
+		t.Fatalf("failed to connect: %s", err.Error())
+	}
+	return client.ConnectionState().PeerCertificates[0].Subject.CommonName
+}
+
+func TestParseClientAuth(t *testing.T) {
+	a := assert.New(t)
+
+	for name, want := range map[string]tls.ClientAuthType{
+		"none":     tls.NoClientCert,
+		"optional": tls.VerifyClientCertIfGiven,
+		"require":  tls.RequireAndVerifyClientCert,
+	} {
+		got, err := ParseClientAuth(name)
+		a.Nil(err)
+		a.Equal(want, got, name)
+	}
+
+	_, err := ParseClientAuth("verify")
+	a.NotNil(err)
+}
+
+func TestReload(t *testing.T) {
+	a := assert.New(t)
+	ca := newTestCA(t, "test-ca")
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+
+	now := time.Now()
+	cert, key := ca.issue(t, "first", x509.ExtKeyUsageServerAuth)
+	writeFile(t, certFile, cert, now)
+	writeFile(t, keyFile, key, now)
+
+	r, err := NewReloader(certFile, keyFile, "", zerolog.Nop())
+	a.Nil(err)
+
+	cfg := r.TLSConfig(tls.NoClientCert)
+	a.Equal("first", servedName(t, cfg, ca.pool()))
+
+	reloaded, err := r.Reload()
+	a.Nil(err)
+	a.False(reloaded, "unchanged files aren't loaded again")
+
+	// a broken key pair is refused, the current certificate is kept
+	writeFile(t, certFile, []byte("garbage"), now.Add(time.Second))
+	reloaded, err = r.Reload()
+	a.NotNil(err)
+	a.False(reloaded)
+	a.Equal("first", servedName(t, cfg, ca.pool()))
+
+	cert, key = ca.issue(t, "second", x509.ExtKeyUsageServerAuth)
+	writeFile(t, certFile, cert, now.Add(2*time.Second))
+	writeFile(t, keyFile, key, now.Add(2*time.Second))
+	reloaded, err = r.Reload()
+	a.Nil(err)
+	a.True(reloaded)
+	a.Equal("second", servedName(t, cfg, ca.pool()), "new connections get the new certificate")
+}
+
+func TestNewReloaderMissingFiles(t *testing.T) {
+	a := assert.New(t)
+	dir := t.TempDir()
+
+	_, err := NewReloader(filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), "", zerolog.Nop())
+	a.NotNil(err)
+}
+
+func TestClientAuth(t *testing.T) {
+	a := assert.New(t)
+	ca := newTestCA(t, "test-ca")
+	other := newTestCA(t, "other-ca")
+	dir := t.TempDir()
+	certFile, keyFile, caFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), filepath.Join(dir, "ca.crt")
+
+	now := time.Now()
+	cert, key := ca.issue(t, "user-service", x509.ExtKeyUsageServerAuth)
+	writeFile(t, certFile, cert, now)
+	writeFile(t, keyFile, key, now)
+	writeFile(t, caFile, ca.pem(), now)
+
+	r, err := NewReloader(certFile, keyFile, caFile, zerolog.Nop())
+	a.Nil(err)
+
+	clientConfig := func(issuer *testCA, usage x509.ExtKeyUsage) *tls.Config {
+		cert, key := issuer.issue(t, "status-service", usage)
+		pair, err := tls.X509KeyPair(cert, key)
+		if err != nil {
+			t.Fatalf("failed to load client key pair: %s", err.Error())
+		}
+		return &tls.Config{RootCAs: ca.pool(), ServerName: "127.0.0.1", Certificates: []tls.Certificate{pair}}
+	}
+	anonymous := &tls.Config{RootCAs: ca.pool(), ServerName: "127.0.0.1"}
+
+	for _, clientAuth := range []tls.ClientAuthType{tls.VerifyClientCertIfGiven, tls.RequireAndVerifyClientCert} {
+		cfg := r.TLSConfig(clientAuth)
+
+		state, err := handshake(t, cfg, clientConfig(ca, x509.ExtKeyUsageClientAuth))
+		if a.Nil(err) && a.Len(state.PeerCertificates, 1) {
+			a.Equal("status-service", state.PeerCertificates[0].Subject.CommonName)
+		}
+
+		_, err = handshake(t, cfg, clientConfig(other, x509.ExtKeyUsageClientAuth))
+		a.NotNil(err, "certificates of unknown CAs are refused")
+
+		_, err = handshake(t, cfg, clientConfig(ca, x509.ExtKeyUsageServerAuth))
+		a.NotNil(err, "certificates not issued for client auth are refused")
+
+		state, err = handshake(t, cfg, anonymous)
+		if clientAuth == tls.RequireAndVerifyClientCert {
+			a.NotNil(err, "clients have to present a certificate")
+		} else if a.Nil(err) {
+			a.Empty(state.PeerCertificates)
+		}
+	}
+
+	// the client CAs are reloaded as well
+	writeFile(t, caFile, other.pem(), now.Add(time.Second))
+	_, err = r.Reload()
+	a.Nil(err)
+
+	_, err = handshake(t, r.TLSConfig(tls.RequireAndVerifyClientCert), clientConfig(other, x509.ExtKeyUsageClientAuth))
+	a.Nil(err)
+}
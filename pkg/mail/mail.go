@@ -0,0 +1,176 @@
+// Package mail delivers the mails sent to the users of the status-owl services.
+package mail
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrInvalidHeader signals that an address or the subject contains line breaks
+	ErrInvalidHeader = errors.New("invalid mail header")
+)
+
+// Message is a mail addressed to a single recipient
+type Message struct {
+	To      string
+	Subject string
+	// Text is the plain text body
+	Text string
+	// HTML is an optional alternative to the plain text body
+	HTML string
+}
+
+// String implements Stringer interface, the body isn't included since it may contain secrets
+func (m *Message) String() string {
+	return fmt.Sprintf("Message { to = ***, subject = %q }", m.Subject)
+}
+
+// Mailer delivers messages
+type Mailer interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// Middleware decorates a Mailer
+type Middleware func(Mailer) Mailer
+
+// encode formats given message according to RFC 5322,
+// messages with a HTML body are sent as multipart/alternative
+func encode(from string, msg *Message, date time.Time) ([]byte, error) {
+	for _, h := range []string{from, msg.To, msg.Subject} {
+		if strings.ContainsAny(h, "\r\n") {
+			return nil, ErrInvalidHeader
+		}
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+
+	if msg.HTML == "" {
+		buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+		buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+		if err := writeQuotedPrintable(&buf, msg.Text); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	parts := multipart.NewWriter(&buf)
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", parts.Boundary())
+
+	// the preferred alternative comes last
+	for _, alt := range []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {alt.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err = writeQuotedPrintable(w, alt.body); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func writeQuotedPrintable(w io.Writer, s string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(s)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+// writerMailer writes the encoded messages to a writer
+type writerMailer struct {
+	mu   sync.Mutex
+	w    io.Writer
+	from string
+}
+
+// NewWriterMailer creates a Mailer writing the messages to w instead of delivering them,
+// e.g. to os.Stdout during development
+func NewWriterMailer(w io.Writer, from string) Mailer {
+	return &writerMailer{w: w, from: from}
+}
+
+func (m *writerMailer) Send(_ context.Context, msg *Message) error {
+	data, err := encode(m.from, msg, time.Now())
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// separates the messages like an mbox file does
+	if _, err = fmt.Fprintf(m.w, "From %s\r\n%s\r\n", m.from, data); err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+
+	return nil
+}
+
+// fileMailer drops every message into its own file
+type fileMailer struct {
+	dir  string
+	from string
+}
+
+// NewFileMailer creates a Mailer writing every message to a .eml file in dir,
+// the directory is created if it doesn't exist
+func NewFileMailer(dir, from string) (Mailer, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create mail directory: %w", err)
+	}
+
+	return &fileMailer{dir: dir, from: from}, nil
+}
+
+func (m *fileMailer) Send(_ context.Context, msg *Message) error {
+	now := time.Now()
+	data, err := encode(m.from, msg, now)
+	if err != nil {
+		return err
+	}
+
+	suffix := make([]byte, 4)
+	if _, err = rand.Read(suffix); err != nil {
+		return fmt.Errorf("failed to generate file name: %w", err)
+	}
+
+	// the names sort by the time the messages were sent
+	name := fmt.Sprintf("%s-%s.eml", now.UTC().Format("20060102T150405.000000000"), hex.EncodeToString(suffix))
+	if err = os.WriteFile(filepath.Join(m.dir, name), data, 0o640); err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+
+	return nil
+}
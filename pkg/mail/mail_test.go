@@ -0,0 +1,127 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	netmail "net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// parse decodes an encoded message and returns its headers and the bodies by content type
+func parse(t *testing.T, data []byte) (netmail.Header, map[string]string) {
+	t.Helper()
+
+	m, err := netmail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("failed to parse message: %s", err.Error())
+	}
+
+	mediaType, params, err := mime.ParseMediaType(m.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("failed to parse content type: %s", err.Error())
+	}
+
+	bodies := make(map[string]string)
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		body, _ := io.ReadAll(quotedprintable.NewReader(m.Body))
+		bodies[mediaType] = string(body)
+		return m.Header, bodies
+	}
+
+	r := multipart.NewReader(m.Body, params["boundary"])
+	for {
+		// multipart decodes quoted-printable parts transparently
+		p, err := r.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to read part: %s", err.Error())
+		}
+
+		partType, _, _ := mime.ParseMediaType(p.Header.Get("Content-Type"))
+		body, _ := io.ReadAll(p)
+		bodies[partType] = string(body)
+	}
+
+	return m.Header, bodies
+}
+
+func TestEncode(t *testing.T) {
+	a := assert.New(t)
+	date := time.Date(2021, 12, 24, 18, 0, 0, 0, time.UTC)
+
+	data, err := encode("status-owl <no-reply@example.com>", &Message{
+		To:      "john@example.com",
+		Subject: "Grüße",
+		Text:    "Hello John",
+		HTML:    "<p>Hello John</p>",
+	}, date)
+	a.Nil(err)
+
+	header, bodies := parse(t, data)
+	a.Equal("status-owl <no-reply@example.com>", header.Get("From"))
+	a.Equal("john@example.com", header.Get("To"))
+	subject, err := new(mime.WordDecoder).DecodeHeader(header.Get("Subject"))
+	a.Nil(err)
+	a.Equal("Grüße", subject)
+	a.Equal("Fri, 24 Dec 2021 18:00:00 +0000", header.Get("Date"))
+	a.Equal(map[string]string{"text/plain": "Hello John", "text/html": "<p>Hello John</p>"}, bodies)
+
+	data, err = encode("no-reply@example.com", &Message{To: "john@example.com", Subject: "Hi", Text: "Hello John"}, date)
+	a.Nil(err)
+	_, bodies = parse(t, data)
+	a.Equal(map[string]string{"text/plain": "Hello John"}, bodies)
+
+	// headers can't be injected
+	_, err = encode("no-reply@example.com", &Message{To: "john@example.com\r\nBcc: mary@example.com"}, date)
+	a.ErrorIs(err, ErrInvalidHeader)
+}
+
+func TestWriterMailer(t *testing.T) {
+	a := assert.New(t)
+
+	var buf bytes.Buffer
+	mailer := NewWriterMailer(&buf, "no-reply@example.com")
+	a.Nil(mailer.Send(context.Background(), &Message{To: "john@example.com", Subject: "Hi", Text: "Hello John"}))
+
+	out := buf.String()
+	a.True(strings.HasPrefix(out, "From no-reply@example.com\r\n"))
+	a.Contains(out, "Subject: Hi\r\n")
+	a.Contains(out, "Hello John")
+}
+
+func TestFileMailer(t *testing.T) {
+	a := assert.New(t)
+	dir := filepath.Join(t.TempDir(), "mails")
+
+	mailer, err := NewFileMailer(dir, "no-reply@example.com")
+	a.Nil(err)
+
+	for _, to := range []string{"john@example.com", "mary@example.com"} {
+		a.Nil(mailer.Send(context.Background(), &Message{To: to, Subject: "Hi", Text: "Hello"}))
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	a.Nil(err)
+	a.Len(files, 2, "every message has its own file")
+
+	var recipients []string
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		a.Nil(err)
+		header, _ := parse(t, data)
+		recipients = append(recipients, header.Get("To"))
+	}
+	a.ElementsMatch([]string{"john@example.com", "mary@example.com"}, recipients)
+}
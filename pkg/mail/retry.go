@@ -0,0 +1,52 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/textproto"
+	"time"
+)
+
+// RetryMiddleware returns a Middleware retrying messages which failed with transient errors
+// up to retries times, it waits backoff before the first retry and doubles it for every further one
+func RetryMiddleware(retries int, backoff time.Duration) Middleware {
+	return func(next Mailer) Mailer {
+		return &retryMiddleware{next: next, retries: retries, backoff: backoff}
+	}
+}
+
+type retryMiddleware struct {
+	next    Mailer
+	retries int
+	backoff time.Duration
+}
+
+func (mw *retryMiddleware) Send(ctx context.Context, msg *Message) error {
+	wait := mw.backoff
+	for attempt := 0; ; attempt++ {
+		err := mw.next.Send(ctx, msg)
+		if err == nil || attempt == mw.retries || !isTransient(err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
+
+// isTransient reports whether sending a message may succeed later on,
+// that's the case for 4xx replies of SMTP servers and network errors
+func isTransient(err error) bool {
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) {
+		return protoErr.Code >= 400 && protoErr.Code < 500
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
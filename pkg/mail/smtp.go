@@ -0,0 +1,114 @@
+package mail
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	netmail "net/mail"
+	"net/smtp"
+	"time"
+)
+
+// SMTPConfig configures the delivery via SMTP
+type SMTPConfig struct {
+	// Addr is host:port of the server
+	Addr string
+	// Username and Password are used for PLAIN authentication if set,
+	// it's refused without TLS unless the server runs on localhost
+	Username, Password string
+	// From is the sender of all messages, e.g. status-owl <no-reply@example.com>
+	From string
+}
+
+// smtpMailer delivers the messages to a SMTP server
+type smtpMailer struct {
+	cfg  SMTPConfig
+	host string
+	// sender is the bare address of cfg.From
+	sender string
+}
+
+// NewSMTPMailer creates a Mailer delivering the messages to a SMTP server,
+// STARTTLS is used if the server supports it
+func NewSMTPMailer(cfg SMTPConfig) (Mailer, error) {
+	host, _, err := net.SplitHostPort(cfg.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid smtp address %q: %w", cfg.Addr, err)
+	}
+
+	from, err := netmail.ParseAddress(cfg.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sender %q: %w", cfg.From, err)
+	}
+
+	return &smtpMailer{cfg: cfg, host: host, sender: from.Address}, nil
+}
+
+func (m *smtpMailer) Send(ctx context.Context, msg *Message) error {
+	data, err := encode(m.cfg.From, msg, time.Now())
+	if err != nil {
+		return err
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", m.cfg.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to the smtp server: %w", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	// net/smtp doesn't know about contexts
+	if deadline, ok := ctx.Deadline(); ok {
+		if err = conn.SetDeadline(deadline); err != nil {
+			return err
+		}
+	}
+
+	if err = m.send(conn, msg.To, data); err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+
+	return nil
+}
+
+// send runs a SMTP session delivering data to given recipient
+func (m *smtpMailer) send(conn net.Conn, to string, data []byte) error {
+	c, err := smtp.NewClient(conn, m.host)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = c.Close() }()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err = c.StartTLS(&tls.Config{ServerName: m.host}); err != nil {
+			return err
+		}
+	}
+
+	if m.cfg.Username != "" {
+		if err = c.Auth(smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.host)); err != nil {
+			return err
+		}
+	}
+
+	if err = c.Mail(m.sender); err != nil {
+		return err
+	}
+	if err = c.Rcpt(to); err != nil {
+		return err
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(data); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
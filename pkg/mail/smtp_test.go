@@ -0,0 +1,189 @@
+package mail
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSMTPServer accepts mails on a local port and records them
+type fakeSMTPServer struct {
+	lis net.Listener
+
+	mu sync.Mutex
+	// rcptReplies are the replies to the next RCPT commands, 250 once empty
+	rcptReplies []string
+	// mails are the received messages by recipient
+	mails map[string]string
+}
+
+func newFakeSMTPServer(t *testing.T) *fakeSMTPServer {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err.Error())
+	}
+
+	s := &fakeSMTPServer{lis: lis, mails: make(map[string]string)}
+	go s.serve()
+	t.Cleanup(func() { _ = lis.Close() })
+
+	return s
+}
+
+func (s *fakeSMTPServer) addr() string {
+	return s.lis.Addr().String()
+}
+
+func (s *fakeSMTPServer) serve() {
+	for {
+		conn, err := s.lis.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+// replyToRcpt sets the replies to the next RCPT commands
+func (s *fakeSMTPServer) replyToRcpt(replies ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rcptReplies = replies
+}
+
+func (s *fakeSMTPServer) nextRcptReply() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.rcptReplies) == 0 {
+		return "250 OK"
+	}
+	reply := s.rcptReplies[0]
+	s.rcptReplies = s.rcptReplies[1:]
+	return reply
+}
+
+// handle speaks just enough SMTP to satisfy net/smtp
+func (s *fakeSMTPServer) handle(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+
+	tp := textproto.NewConn(conn)
+	reply := func(line string) { _ = tp.PrintfLine("%s", line) }
+	reply("220 localhost ESMTP fake")
+
+	var rcpt string
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+
+		cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch cmd {
+		case "EHLO", "HELO":
+			reply("250 localhost")
+		case "MAIL":
+			reply("250 OK")
+		case "RCPT":
+			rcpt = strings.Trim(strings.TrimPrefix(line, "RCPT TO:"), "<>")
+			reply(s.nextRcptReply())
+		case "DATA":
+			reply("354 go ahead")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.mails[rcpt] = string(data)
+			s.mu.Unlock()
+			reply("250 OK")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+func (s *fakeSMTPServer) mail(to string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, ok := s.mails[to]
+	return m, ok
+}
+
+func TestSMTPMailer(t *testing.T) {
+	a := assert.New(t)
+	srv := newFakeSMTPServer(t)
+
+	mailer, err := NewSMTPMailer(SMTPConfig{Addr: srv.addr(), From: "status-owl <no-reply@example.com>"})
+	a.Nil(err)
+
+	err = mailer.Send(context.Background(), &Message{To: "john@example.com", Subject: "Hi", Text: "Hello John"})
+	a.Nil(err)
+
+	data, ok := srv.mail("john@example.com")
+	if a.True(ok) {
+		header, bodies := parse(t, []byte(data))
+		a.Equal("Hi", header.Get("Subject"))
+		a.Equal("Hello John", strings.TrimSpace(bodies["text/plain"]))
+	}
+
+	// rejected recipients fail permanently
+	srv.replyToRcpt("550 no such user")
+	err = mailer.Send(context.Background(), &Message{To: "mary@example.com", Subject: "Hi", Text: "Hello Mary"})
+	a.NotNil(err)
+	a.False(isTransient(err))
+
+	_, err = NewSMTPMailer(SMTPConfig{Addr: "localhost", From: "no-reply@example.com"})
+	a.NotNil(err, "the port is required")
+}
+
+func TestRetryMiddleware(t *testing.T) {
+	a := assert.New(t)
+	srv := newFakeSMTPServer(t)
+
+	smtpMailer, err := NewSMTPMailer(SMTPConfig{Addr: srv.addr(), From: "no-reply@example.com"})
+	a.Nil(err)
+	mailer := RetryMiddleware(2, time.Millisecond)(smtpMailer)
+
+	// greylisting servers reject the first attempts temporarily
+	srv.replyToRcpt("451 try again later", "451 try again later")
+	a.Nil(mailer.Send(context.Background(), &Message{To: "john@example.com", Subject: "Hi", Text: "Hello"}))
+	_, ok := srv.mail("john@example.com")
+	a.True(ok)
+
+	// the retries are exhausted
+	srv.replyToRcpt("451 try again later", "451 try again later", "451 try again later")
+	err = mailer.Send(context.Background(), &Message{To: "mary@example.com", Subject: "Hi", Text: "Hello"})
+	a.NotNil(err)
+	a.True(isTransient(err))
+
+	// permanent failures aren't retried
+	srv.replyToRcpt("550 no such user", "250 OK")
+	a.NotNil(mailer.Send(context.Background(), &Message{To: "eve@example.com", Subject: "Hi", Text: "Hello"}))
+	_, ok = srv.mail("eve@example.com")
+	a.False(ok)
+}
+
+func TestIsTransient(t *testing.T) {
+	a := assert.New(t)
+
+	a.True(isTransient(&textproto.Error{Code: 421, Msg: "service not available"}))
+	a.False(isTransient(&textproto.Error{Code: 554, Msg: "transaction failed"}))
+	a.True(isTransient(&net.OpError{Op: "dial", Err: &net.DNSError{IsTemporary: true}}))
+	a.False(isTransient(ErrInvalidHeader))
+
+	_, err := bufio.NewReader(strings.NewReader("")).ReadByte()
+	a.False(isTransient(err))
+}
@@ -0,0 +1,137 @@
+package mail
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"strings"
+	texttemplate "text/template"
+)
+
+// DefaultLocale is used if a message has no variant for the requested locale
+const DefaultLocale = "en"
+
+// embedded contains the default templates
+//
+//go:embed templates/*
+var embedded embed.FS
+
+// Templates renders messages from text and HTML templates.
+// Every message <name> has a text template <name>.<locale>.txt defining its subject
+// in the block "subject" and optionally a HTML template <name>.<locale>.html.
+type Templates struct {
+	// text and html map <name>.<locale> to the templates
+	text map[string]*texttemplate.Template
+	html map[string]*htmltemplate.Template
+}
+
+// ParseTemplates parses the templates in the root directory of given file system
+func ParseTemplates(fsys fs.FS) (*Templates, error) {
+	t := &Templates{
+		text: make(map[string]*texttemplate.Template),
+		html: make(map[string]*htmltemplate.Template),
+	}
+
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list templates: %w", err)
+	}
+
+	for _, e := range entries {
+		name := e.Name()
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read template %q: %w", name, err)
+		}
+
+		key := strings.TrimSuffix(name, path.Ext(name))
+		switch path.Ext(name) {
+		case ".txt":
+			tmpl, err := texttemplate.New(name).Option("missingkey=error").Parse(string(data))
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse template %q: %w", name, err)
+			}
+			if tmpl.Lookup("subject") == nil {
+				return nil, fmt.Errorf("template %q doesn't define a subject", name)
+			}
+			t.text[key] = tmpl
+		case ".html":
+			tmpl, err := htmltemplate.New(name).Option("missingkey=error").Parse(string(data))
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse template %q: %w", name, err)
+			}
+			t.html[key] = tmpl
+		}
+	}
+
+	return t, nil
+}
+
+// DefaultTemplates returns the templates embedded into the binary
+func DefaultTemplates() *Templates {
+	sub, err := fs.Sub(embedded, "templates")
+	if err != nil {
+		panic(err)
+	}
+
+	t, err := ParseTemplates(sub)
+	if err != nil {
+		panic(fmt.Sprintf("embedded mail templates are broken: %s", err.Error()))
+	}
+
+	return t
+}
+
+// Render renders the message with given name in the requested locale, e.g. de-AT.
+// It falls back to the language and to DefaultLocale, the recipient is left empty.
+func (t *Templates) Render(name, locale string, data interface{}) (*Message, error) {
+	key, ok := t.lookup(name, locale)
+	if !ok {
+		return nil, fmt.Errorf("no template for message %q", name)
+	}
+
+	var subject, text bytes.Buffer
+	tmpl := t.text[key]
+	if err := tmpl.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return nil, fmt.Errorf("failed to render subject of %q: %w", key, err)
+	}
+	if err := tmpl.Execute(&text, data); err != nil {
+		return nil, fmt.Errorf("failed to render text of %q: %w", key, err)
+	}
+
+	msg := &Message{
+		Subject: strings.TrimSpace(subject.String()),
+		Text:    strings.TrimLeft(text.String(), "\n"),
+	}
+
+	if tmpl, ok := t.html[key]; ok {
+		var html bytes.Buffer
+		if err := tmpl.Execute(&html, data); err != nil {
+			return nil, fmt.Errorf("failed to render html of %q: %w", key, err)
+		}
+		msg.HTML = html.String()
+	}
+
+	return msg, nil
+}
+
+// lookup returns the key of the best matching text template
+func (t *Templates) lookup(name, locale string) (string, bool) {
+	candidates := []string{locale}
+	if i := strings.IndexAny(locale, "-_"); i > 0 {
+		candidates = append(candidates, locale[:i])
+	}
+	candidates = append(candidates, DefaultLocale)
+
+	for _, c := range candidates {
+		key := name + "." + strings.ToLower(c)
+		if _, ok := t.text[key]; ok {
+			return key, true
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,81 @@
+package mail
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRender(t *testing.T) {
+	a := assert.New(t)
+
+	templates, err := ParseTemplates(fstest.MapFS{
+		"greeting.en.txt":  {Data: []byte(`{{define "subject"}}Hello {{.}}{{end}}` + "\nHello {{.}}!\n")},
+		"greeting.en.html": {Data: []byte(`<p>Hello {{.}}!</p>`)},
+		"greeting.de.txt":  {Data: []byte(`{{define "subject"}}Hallo {{.}}{{end}}` + "\nHallo {{.}}!\n")},
+	})
+	a.Nil(err)
+
+	msg, err := templates.Render("greeting", "en", "<John>")
+	if a.Nil(err) {
+		a.Equal("Hello <John>", msg.Subject)
+		a.Equal("Hello <John>!\n", msg.Text)
+		a.Equal("<p>Hello &lt;John&gt;!</p>", msg.HTML, "the html is escaped")
+	}
+
+	// regional variants fall back to the language
+	msg, err = templates.Render("greeting", "de-AT", "John")
+	if a.Nil(err) {
+		a.Equal("Hallo John", msg.Subject)
+		a.Empty(msg.HTML)
+	}
+
+	// unknown locales fall back to the default one
+	msg, err = templates.Render("greeting", "fr", "John")
+	if a.Nil(err) {
+		a.Equal("Hello John", msg.Subject)
+	}
+
+	_, err = templates.Render("farewell", "en", "John")
+	a.NotNil(err)
+}
+
+func TestParseTemplatesWithoutSubject(t *testing.T) {
+	_, err := ParseTemplates(fstest.MapFS{
+		"greeting.en.txt": {Data: []byte("Hello {{.}}!")},
+	})
+	assert.NotNil(t, err)
+}
+
+func TestDefaultTemplates(t *testing.T) {
+	a := assert.New(t)
+	templates := DefaultTemplates()
+
+	tests := []struct {
+		name string
+		data interface{}
+	}{
+		{"verification", struct {
+			Name       string
+			Token      string
+			ValidHours int
+		}{"John", "secret", 24}},
+		{"password_reset", struct {
+			Name         string
+			Token        string
+			ValidMinutes int
+		}{"John", "secret", 60}},
+	}
+
+	for _, tt := range tests {
+		for _, locale := range []string{"en", "de"} {
+			msg, err := templates.Render(tt.name, locale, tt.data)
+			if a.Nil(err, "%s.%s", tt.name, locale) {
+				a.NotEmpty(msg.Subject)
+				a.Contains(msg.Text, "secret")
+				a.Contains(msg.HTML, "secret")
+			}
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Scope restricts the operations an API key may be used for
+type Scope string
+
+const (
+	// ScopeUsersRead allows reading and listing users
+	ScopeUsersRead Scope = "users:read"
+	// ScopeUsersWrite allows creating, updating and deleting users and changing their status
+	ScopeUsersWrite Scope = "users:write"
+)
+
+// Scopes lists all known scopes, API keys created without scopes are granted all of them
+var Scopes = []Scope{ScopeUsersRead, ScopeUsersWrite}
+
+// String implements Stringer interface
+func (s Scope) String() string {
+	return string(s)
+}
+
+// ScopeFromString parses a scope, the second return value is false for unknown scopes
+func ScopeFromString(s string) (Scope, bool) {
+	for _, scope := range Scopes {
+		if string(scope) == s {
+			return scope, true
+		}
+	}
+	return "", false
+}
+
+// APIKey is the persisted part of a personal API key,
+// the key itself is only shown to the user once on creation
+type APIKey struct {
+	ID     string
+	UserID string
+	// Name describes what the key is used for, e.g. the CI pipeline
+	Name string
+	// Prefix is the beginning of the key, it tells the keys of a user apart without revealing them
+	Prefix string
+	// Hash is the SHA-256 hash of the key, keys are looked up by it
+	Hash      string
+	Scopes    []Scope
+	CreatedAt time.Time
+	// ExpiresAt is zero for keys which never expire
+	ExpiresAt time.Time
+}
+
+// HasScope reports whether the key grants given scope
+func (k *APIKey) HasScope(scope Scope) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// IsExpired reports whether the key has expired at given time
+func (k *APIKey) IsExpired(now time.Time) bool {
+	return !k.ExpiresAt.IsZero() && !now.Before(k.ExpiresAt)
+}
+
+// String implements Stringer interface
+func (k *APIKey) String() string {
+	scopes := make([]string, len(k.Scopes))
+	for i, s := range k.Scopes {
+		scopes[i] = string(s)
+	}
+
+	return fmt.Sprintf("APIKey { id = %q, user_id = %q, name = %q, prefix = %q, scopes = [%s], hash = *** }",
+		k.ID, k.UserID, k.Name, k.Prefix, strings.Join(scopes, " "))
+}
@@ -0,0 +1,59 @@
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+// SortField names the property users are sorted by
+type SortField string
+
+const (
+	SortByCreatedAt SortField = "created_at"
+	SortByName      SortField = "name"
+	SortByEMail     SortField = "email"
+)
+
+// String implements Stringer interface
+func (f SortField) String() string {
+	return string(f)
+}
+
+// UserFilter restricts the listed users, zero values match every user
+type UserFilter struct {
+	Role   Role
+	Status Status
+	// EMailPrefix matches the beginning of the email address ignoring the case
+	EMailPrefix string
+	// NameContains matches a part of the name ignoring the case
+	NameContains string
+	// CreatedBefore and CreatedAfter are exclusive bounds of the creation time
+	CreatedBefore, CreatedAfter time.Time
+}
+
+// UserQuery describes a page of users to be listed
+type UserQuery struct {
+	Filter     UserFilter
+	SortBy     SortField
+	Descending bool
+	// Limit is the maximum number of users on a page
+	Limit int
+	// Cursor points behind the last user of the previous page,
+	// it's empty for the first page
+	Cursor string
+}
+
+// String implements Stringer interface
+func (q UserQuery) String() string {
+	return fmt.Sprintf(
+		"UserQuery { role = %q, status = %q, sort = %q, descending = %t, limit = %d, cursor = %q, email = ***, name = *** }",
+		q.Filter.Role, q.Filter.Status, q.SortBy, q.Descending, q.Limit, q.Cursor,
+	)
+}
+
+// UserPage is a page of listed users
+type UserPage struct {
+	Users []*User
+	// NextCursor points to the next page, it's empty for the last page
+	NextCursor string
+}
@@ -0,0 +1,60 @@
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+// Token grants access to the status-owl services on behalf of a user
+type Token struct {
+	// AccessToken is a signed JWT containing the user's id and role
+	AccessToken string
+	ExpiresAt   time.Time
+	// RefreshToken can be exchanged once for a new token, it's empty if none has been issued
+	RefreshToken string
+	// MFAToken is issued instead of the other tokens to users with multi-factor authentication,
+	// it's exchanged for them together with a code until ExpiresAt
+	MFAToken string
+}
+
+// String implements Stringer interface
+func (t *Token) String() string {
+	return fmt.Sprintf("Token { expires_at = %s, access_token = ***, refresh_token = ***, mfa_token = *** }",
+		t.ExpiresAt.Format(time.RFC3339))
+}
+
+// RefreshToken is the persisted part of a refresh token,
+// the token itself is only known to the client
+type RefreshToken struct {
+	// ID is the SHA-256 hash of the token
+	ID     string
+	UserID string
+	// FamilyID is shared by all tokens descending from the same login
+	FamilyID  string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	// UsedAt is set as soon as the token has been exchanged, zero for unused tokens
+	UsedAt time.Time
+}
+
+// String implements Stringer interface
+func (t *RefreshToken) String() string {
+	return fmt.Sprintf("RefreshToken { user_id = %q, family_id = %q, expires_at = %s }",
+		t.UserID, t.FamilyID, t.ExpiresAt.Format(time.RFC3339))
+}
+
+// PasswordResetToken is the persisted part of a password reset token,
+// the token itself is only mailed to the user
+type PasswordResetToken struct {
+	// ID is the SHA-256 hash of the token
+	ID        string
+	UserID    string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+// String implements Stringer interface
+func (t *PasswordResetToken) String() string {
+	return fmt.Sprintf("PasswordResetToken { user_id = %q, expires_at = %s }",
+		t.UserID, t.ExpiresAt.Format(time.RFC3339))
+}
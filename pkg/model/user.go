@@ -1,32 +1,98 @@
 package model
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
+// Role grants privileges to a user, it's represented by the same strings in the http api,
+// the stores and the tokens, the grpc api maps it to the pb.Role enum
 type Role string
 
 const (
-	Unknown   Role = "UNKNOWN"
-	Admin     Role = "ADMIN"
-	Reporter  Role = "REPORTER"
-	Undefined Role = "UNDEFINED"
+	// Admin users manage all users
+	Admin    Role = "ADMIN"
+	Reporter Role = "REPORTER"
+	// Regular users manage themselves only, every user but the first one starts as regular user
+	Regular Role = "REGULAR"
 )
 
+// Roles lists all roles
+var Roles = []Role{Admin, Reporter, Regular}
+
 // String implements Stringer interface
 func (r Role) String() string {
 	return string(r)
 }
 
-func RoleFromString(s string) Role {
+// RoleFromString parses a role, ok is false for unknown values
+func RoleFromString(s string) (role Role, ok bool) {
+	for _, r := range Roles {
+		if string(r) == s {
+			return r, true
+		}
+	}
+	return "", false
+}
+
+// Status is the lifecycle state of a user
+type Status string
+
+const (
+	// Pending users haven't verified their email address yet
+	Pending Status = "PENDING"
+	Active  Status = "ACTIVE"
+	// Suspended users are refused at login until they're reactivated
+	Suspended Status = "SUSPENDED"
+	// Locked users are refused at login like suspended ones, but for security reasons
+	Locked Status = "LOCKED"
+	// Deleted is the final state, deleted users are removed from the store
+	Deleted Status = "DELETED"
+)
+
+// String implements Stringer interface
+func (s Status) String() string {
+	return string(s)
+}
+
+// StatusFromString parses a status, unknown values result in Active,
+// users stored before the lifecycle was introduced have no status and are active
+func StatusFromString(s string) Status {
 	switch s {
-	case string(Unknown):
-		return Unknown
-	case string(Admin):
-		return Admin
-	case string(Reporter):
-		return Reporter
+	case string(Pending):
+		return Pending
+	case string(Suspended):
+		return Suspended
+	case string(Locked):
+		return Locked
+	case string(Deleted):
+		return Deleted
 	default:
-		return Undefined
+		return Active
+	}
+}
+
+// statusTransitions lists the states a user may change to from each state
+var statusTransitions = map[Status][]Status{
+	Pending:   {Active, Suspended, Locked, Deleted},
+	Active:    {Suspended, Locked, Deleted},
+	Suspended: {Pending, Active, Deleted},
+	Locked:    {Pending, Active, Deleted},
+}
+
+// CanTransitionTo reports whether a user may change from status s to next
+func (s Status) CanTransitionTo(next Status) bool {
+	for _, allowed := range statusTransitions[s] {
+		if allowed == next {
+			return true
+		}
 	}
+	return false
+}
+
+// CanLogIn reports whether users of status s may log in
+func (s Status) CanLogIn() bool {
+	return s == Pending || s == Active
 }
 
 // User represents an application user
@@ -34,12 +100,56 @@ type User struct {
 	ID    string
 	Name  string
 	EMail string
-	Role  Role
+	// EMailVerified is set as soon as the user has confirmed the email address
+	EMailVerified bool
+	Role          Role
+	Status        Status
+	// Version is incremented on every modification
+	Version int64
+	// CreatedAt is set by the store when the user is created
+	CreatedAt time.Time
+	// PasswordHash is the encoded hash of the user's password, empty if no password is set
+	PasswordHash string
+	// FailedLogins counts the failed logins since the last successful one,
+	// it isn't changed by updates and doesn't increment the version
+	FailedLogins int
+	// LockedUntil is the time the user may log in again after too many failed logins,
+	// zero if the user isn't locked out
+	LockedUntil time.Time
+	// TOTPSecret is the base32 encoded secret of the user's authenticator,
+	// it's pending until MFAEnabled is set
+	TOTPSecret string
+	// MFAEnabled is set as soon as the user has confirmed the enrollment of an authenticator,
+	// logins require a code of it from then on
+	MFAEnabled bool
+	// TOTPLastStep is the time step of the last code accepted, so codes can't be replayed
+	TOTPLastStep int64
+	// RecoveryCodes are the hashes of the unused recovery codes, each one replaces a code once
+	RecoveryCodes []string
+}
+
+// IsLockedOut reports whether the user is locked out of logging in at given time
+func (u *User) IsLockedOut(at time.Time) bool {
+	return at.Before(u.LockedUntil)
 }
 
 // String implements Stringer interface
 func (u *User) String() string {
-	return fmt.Sprintf("RequestedUser { id = %q, role = %q, email = ***, name = *** }", u.ID, u.Role)
+	return fmt.Sprintf("RequestedUser { id = %q, role = %q, status = %q, mfa = %t, version = %d, email = ***, name = *** }",
+		u.ID, u.Role, u.Status, u.MFAEnabled, u.Version)
+}
+
+// MFAEnrollment is the pending authenticator of a user
+type MFAEnrollment struct {
+	// Secret is the base32 encoded secret for entering it manually
+	Secret string
+	// URI is the otpauth provisioning URI, usually shown as QR code
+	URI string
+}
+
+// String implements Stringer interface
+func (e *MFAEnrollment) String() string {
+	return "MFAEnrollment { secret = ***, uri = *** }"
 }
 
 // RequestedUser represent a user that
@@ -48,9 +158,24 @@ func (u *User) String() string {
 // and no role - it can be assigned by the admin user later on
 type RequestedUser struct {
 	EMail, Name string
+	// Password is optional, users without one can't log in
+	Password string
 }
 
 // String implements Stringer interface
 func (u RequestedUser) String() string {
-	return "RequestedUser { email = ***, name = *** }"
+	return "RequestedUser { email = ***, name = ***, password = *** }"
+}
+
+// UserUpdate represents requested changes
+// of an existing user, empty fields are left unchanged
+type UserUpdate struct {
+	EMail, Name string
+	// Version the changes are based on, 0 skips the check
+	Version int64
+}
+
+// String implements Stringer interface
+func (u UserUpdate) String() string {
+	return fmt.Sprintf("UserUpdate { version = %d, email = ***, name = *** }", u.Version)
 }
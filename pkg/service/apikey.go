@@ -0,0 +1,191 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/status-owl/user-service/pkg/auth"
+	"github.com/status-owl/user-service/pkg/model"
+	"github.com/status-owl/user-service/pkg/store"
+)
+
+const (
+	// APIKeyPrefix starts every personal API key, so they're told apart from access tokens
+	// and found by secret scanners
+	APIKeyPrefix = "sowl_"
+	// apiKeyVisibleLength is the length of the beginning of a key shown in listings
+	apiKeyVisibleLength = len(APIKeyPrefix) + 8
+	// MaxAPIKeyNameLength is the maximum length of the name of an API key
+	MaxAPIKeyNameLength = 100
+)
+
+// newAPIKeyID returns a random id, keys are revoked by it
+func newAPIKeyID() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate api key id: %w", err)
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// newAPIKey returns a random key starting with APIKeyPrefix
+func newAPIKey() (string, error) {
+	token, err := newRefreshToken()
+	if err != nil {
+		return "", err
+	}
+
+	return APIKeyPrefix + token, nil
+}
+
+// validateAPIKey checks the parameters of a key to create, the known scopes are listed in model.Scopes
+func validateAPIKey(name string, scopes []model.Scope, expiresAt, now time.Time) *ValidationErrors {
+	var err ValidationErrors
+	if name = strings.TrimSpace(name); name == "" {
+		err = err.Append(ValidationError{
+			Name:   "name",
+			Reason: "name is not set",
+		})
+	} else if len(name) > MaxAPIKeyNameLength {
+		err = err.Append(ValidationError{
+			Name:   "name",
+			Reason: fmt.Sprintf("name must not be longer than %d characters", MaxAPIKeyNameLength),
+		})
+	}
+
+	for _, scope := range scopes {
+		if _, ok := model.ScopeFromString(string(scope)); !ok {
+			err = err.Append(ValidationError{
+				Name:   "scopes",
+				Reason: fmt.Sprintf("unknown scope %q", scope),
+			})
+		}
+	}
+
+	if !expiresAt.IsZero() && !expiresAt.After(now) {
+		err = err.Append(ValidationError{
+			Name:   "expires_at",
+			Reason: "expiry has to be in the future",
+		})
+	}
+
+	// no validation errors
+	if len(err.Errors) == 0 {
+		return nil
+	}
+
+	return &err
+}
+
+func (s *userService) CreateAPIKey(
+	ctx context.Context,
+	id, name string,
+	scopes []model.Scope,
+	expiresAt time.Time,
+) (*model.APIKey, string, error) {
+	now := time.Now()
+	if err := validateAPIKey(name, scopes, expiresAt, now); err != nil {
+		return nil, "", err
+	}
+
+	// keys of unknown users would never be accepted anyway
+	if _, err := s.userStore.FindByID(ctx, id); err != nil {
+		return nil, "", translateStoreError(err)
+	}
+
+	if len(scopes) == 0 {
+		scopes = model.Scopes
+	}
+
+	keyID, err := newAPIKeyID()
+	if err != nil {
+		return nil, "", err
+	}
+
+	key, err := newAPIKey()
+	if err != nil {
+		return nil, "", err
+	}
+
+	apiKey := &model.APIKey{
+		ID:        keyID,
+		UserID:    id,
+		Name:      strings.TrimSpace(name),
+		Prefix:    key[:apiKeyVisibleLength],
+		Hash:      hashRefreshToken(key),
+		Scopes:    append([]model.Scope(nil), scopes...),
+		CreatedAt: now,
+		ExpiresAt: expiresAt,
+	}
+	if err = s.apiKeyStore.Create(ctx, apiKey); err != nil {
+		return nil, "", err
+	}
+
+	return apiKey, key, nil
+}
+
+func (s *userService) ListAPIKeys(ctx context.Context, id string) ([]*model.APIKey, error) {
+	if _, err := s.userStore.FindByID(ctx, id); err != nil {
+		return nil, translateStoreError(err)
+	}
+
+	return s.apiKeyStore.ListByUser(ctx, id)
+}
+
+func (s *userService) RevokeAPIKey(ctx context.Context, id, keyID string) error {
+	if err := s.apiKeyStore.Delete(ctx, id, keyID); err != nil {
+		if errors.Is(err, store.ErrAPIKeyNotFound) {
+			return ErrAPIKeyNotFound
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (s *userService) AuthenticateAPIKey(ctx context.Context, key string) (*auth.Principal, error) {
+	if !strings.HasPrefix(key, APIKeyPrefix) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	apiKey, err := s.apiKeyStore.FindByHash(ctx, hashRefreshToken(key))
+	if err != nil {
+		if errors.Is(err, store.ErrAPIKeyNotFound) {
+			return nil, ErrInvalidAPIKey
+		}
+		return nil, err
+	}
+
+	if apiKey.IsExpired(time.Now()) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	user, err := s.userStore.FindByID(ctx, apiKey.UserID)
+	if err != nil {
+		if translateStoreError(err) == ErrUserNotFound {
+			return nil, ErrInvalidAPIKey
+		}
+		return nil, err
+	}
+
+	// keys of suspended or locked users are refused like their logins
+	if err = checkCanLogIn(user); err != nil {
+		return nil, err
+	}
+
+	// the role and the second factor are the user's current ones, not the ones at the key's creation,
+	// enabling multi-factor authentication revokes the keys created before
+	return &auth.Principal{
+		UserID:   user.ID,
+		Role:     user.Role,
+		MFA:      user.MFAEnabled,
+		APIKeyID: apiKey.ID,
+		Scopes:   apiKey.Scopes,
+	}, nil
+}
@@ -0,0 +1,187 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/status-owl/user-service/pkg/auth"
+	"github.com/status-owl/user-service/pkg/model"
+)
+
+func TestCreateAPIKey(t *testing.T) {
+	a := assert.New(t)
+	svc := newTestService()
+	ctx := context.Background()
+
+	id := mustCreateRegular(t, svc)
+
+	_, _, err := svc.CreateAPIKey(ctx, id, " ", []model.Scope{"users:everything"}, time.Now().Add(-time.Minute))
+	var verr *ValidationErrors
+	if a.ErrorAs(err, &verr) {
+		a.Equal([]ValidationError{
+			{Name: "name", Reason: "name is not set"},
+			{Name: "scopes", Reason: `unknown scope "users:everything"`},
+			{Name: "expires_at", Reason: "expiry has to be in the future"},
+		}, verr.Errors)
+	}
+
+	_, _, err = svc.CreateAPIKey(ctx, "unknown", "ci", nil, time.Time{})
+	a.ErrorIs(err, ErrUserNotFound)
+
+	apiKey, key, err := svc.CreateAPIKey(ctx, id, " ci ", nil, time.Time{})
+	a.Nil(err)
+	a.True(strings.HasPrefix(key, APIKeyPrefix), key)
+	a.True(strings.HasPrefix(key, apiKey.Prefix), "the prefix is the beginning of the key")
+	a.Len(apiKey.Prefix, apiKeyVisibleLength)
+	a.Equal("ci", apiKey.Name)
+	a.Equal(model.Scopes, apiKey.Scopes, "keys without scopes are granted all")
+	a.True(apiKey.ExpiresAt.IsZero())
+	a.Equal(hashRefreshToken(key), apiKey.Hash, "keys are stored hashed")
+
+	expiresAt := time.Now().Add(time.Hour)
+	readOnly, _, err := svc.CreateAPIKey(ctx, id, "dashboard", []model.Scope{model.ScopeUsersRead}, expiresAt)
+	a.Nil(err)
+	a.Equal([]model.Scope{model.ScopeUsersRead}, readOnly.Scopes)
+
+	keys, err := svc.ListAPIKeys(ctx, id)
+	a.Nil(err)
+	// both keys may have been created within the same millisecond, the order is tested by the stores
+	ids := make(map[string]*model.APIKey)
+	for _, k := range keys {
+		ids[k.ID] = k
+	}
+	a.Len(ids, 2)
+	a.Contains(ids, apiKey.ID)
+	if a.Contains(ids, readOnly.ID) {
+		a.Equal(expiresAt.UTC().Truncate(time.Millisecond), ids[readOnly.ID].ExpiresAt)
+	}
+}
+
+func TestAuthenticateAPIKey(t *testing.T) {
+	a := assert.New(t)
+	svc := newTestService()
+	ctx := context.Background()
+
+	id := mustCreateRegular(t, svc)
+	a.Nil(svc.VerifyEMail(ctx, id, "verify:"+id+":john@example.com"))
+
+	apiKey, key, err := svc.CreateAPIKey(ctx, id, "ci", []model.Scope{model.ScopeUsersRead}, time.Time{})
+	a.Nil(err)
+
+	principal, err := svc.AuthenticateAPIKey(ctx, key)
+	a.Nil(err)
+	a.Equal(&auth.Principal{
+		UserID:   id,
+		Role:     model.Regular,
+		APIKeyID: apiKey.ID,
+		Scopes:   []model.Scope{model.ScopeUsersRead},
+	}, principal)
+
+	_, err = svc.AuthenticateAPIKey(ctx, "sowl_unknown")
+	a.ErrorIs(err, ErrInvalidAPIKey)
+
+	// the prefix is stripped of a valid key
+	_, err = svc.AuthenticateAPIKey(ctx, strings.TrimPrefix(key, APIKeyPrefix))
+	a.ErrorIs(err, ErrInvalidAPIKey)
+
+	_, err = svc.Suspend(ctx, id)
+	a.Nil(err)
+	_, err = svc.AuthenticateAPIKey(ctx, key)
+	a.ErrorIs(err, ErrUserSuspended, "keys of suspended users are refused")
+
+	_, err = svc.Reactivate(ctx, id)
+	a.Nil(err)
+	_, err = svc.AuthenticateAPIKey(ctx, key)
+	a.Nil(err)
+
+	a.ErrorIs(svc.RevokeAPIKey(ctx, "another", apiKey.ID), ErrAPIKeyNotFound, "keys are revoked by their owners only")
+	a.Nil(svc.RevokeAPIKey(ctx, id, apiKey.ID))
+	a.ErrorIs(svc.RevokeAPIKey(ctx, id, apiKey.ID), ErrAPIKeyNotFound)
+
+	_, err = svc.AuthenticateAPIKey(ctx, key)
+	a.ErrorIs(err, ErrInvalidAPIKey, "revoked keys are refused")
+}
+
+func TestAuthenticateExpiredAPIKey(t *testing.T) {
+	a := assert.New(t)
+	svc := newTestService()
+	ctx := context.Background()
+
+	id := mustCreateRegular(t, svc)
+
+	key, err := newAPIKey()
+	a.Nil(err)
+
+	// expired keys can't be created via the service
+	now := time.Now()
+	a.Nil(svc.apiKeyStore.Create(ctx, &model.APIKey{
+		ID:        "k1",
+		UserID:    id,
+		Name:      "ci",
+		Prefix:    key[:apiKeyVisibleLength],
+		Hash:      hashRefreshToken(key),
+		Scopes:    model.Scopes,
+		CreatedAt: now.Add(-time.Hour),
+		ExpiresAt: now.Add(-time.Minute),
+	}))
+
+	_, err = svc.AuthenticateAPIKey(ctx, key)
+	a.ErrorIs(err, ErrInvalidAPIKey)
+}
+
+func TestAPIKeysAreRevoked(t *testing.T) {
+	a := assert.New(t)
+	svc := newTestService()
+	ctx := context.Background()
+
+	id, _ := mustLogin(t, svc)
+	_, key, err := svc.CreateAPIKey(ctx, id, "ci", nil, time.Time{})
+	a.Nil(err)
+
+	mustEnableMFA(t, svc, id)
+	_, err = svc.AuthenticateAPIKey(ctx, key)
+	a.ErrorIs(err, ErrInvalidAPIKey, "enabling multi-factor authentication revokes the keys")
+
+	_, key, err = svc.CreateAPIKey(ctx, id, "ci", nil, time.Time{})
+	a.Nil(err)
+
+	principal, err := svc.AuthenticateAPIKey(ctx, key)
+	a.Nil(err)
+	a.True(principal.MFA, "keys of users with multi-factor authentication have their privileges")
+
+	otherID, err := svc.Create(ctx, model.RequestedUser{EMail: "mary@example.com", Name: "Mary"})
+	a.Nil(err)
+	_, key, err = svc.CreateAPIKey(ctx, otherID, "ci", nil, time.Time{})
+	a.Nil(err)
+
+	a.Nil(svc.Delete(ctx, otherID))
+	_, err = svc.AuthenticateAPIKey(ctx, key)
+	a.ErrorIs(err, ErrInvalidAPIKey, "deleting a user revokes its keys")
+}
+
+func TestAPIKeysAreRevokedWithThePassword(t *testing.T) {
+	a := assert.New(t)
+	svc := newTestService()
+	ctx := context.Background()
+
+	id, _ := mustLogin(t, svc)
+	_, key, err := svc.CreateAPIKey(ctx, id, "ci", nil, time.Time{})
+	a.Nil(err)
+
+	// the owner recovers the account from someone who has created a key
+	a.Nil(svc.RequestPasswordReset(ctx, "john@example.com"))
+	a.Nil(svc.ResetPassword(ctx, lastMailedToken(t, svc), "battery-Staple-8"))
+	_, err = svc.AuthenticateAPIKey(ctx, key)
+	a.ErrorIs(err, ErrInvalidAPIKey, "resetting the password revokes the keys")
+
+	_, key, err = svc.CreateAPIKey(ctx, id, "ci", nil, time.Time{})
+	a.Nil(err)
+
+	a.Nil(svc.ChangePassword(ctx, id, "battery-Staple-8", "battery-Staple-9"))
+	_, err = svc.AuthenticateAPIKey(ctx, key)
+	a.ErrorIs(err, ErrInvalidAPIKey, "changing the password revokes the keys")
+}
@@ -0,0 +1,355 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/status-owl/user-service/pkg/auth"
+	"github.com/status-owl/user-service/pkg/model"
+)
+
+// policy decides whether the caller may perform an operation on the user with given id,
+// the caller is nil for anonymous calls
+type policy func(caller *auth.Principal, id string) bool
+
+var (
+	// anyone may perform the operation, the credentials are part of the request
+	anyone policy = func(*auth.Principal, string) bool { return true }
+	// admin restricts the operation to administrators
+	admin policy = func(caller *auth.Principal, _ string) bool {
+		return caller != nil && caller.IsAdmin()
+	}
+	// self restricts the operation to the user it's performed on
+	self policy = func(caller *auth.Principal, id string) bool {
+		return caller != nil && caller.UserID == id
+	}
+	// selfOrAdmin restricts the operation to the user it's performed on and to administrators
+	selfOrAdmin policy = func(caller *auth.Principal, id string) bool {
+		return self(caller, id) || admin(caller, id)
+	}
+)
+
+// policies lists who may perform which operation of the UserService,
+// every method has to be listed, unknown ones are denied
+var policies = map[string]policy{
+	"Create":   anyone,
+	"Delete":   admin,
+	"FindByID": selfOrAdmin,
+	// looking up arbitrary email addresses would tell which ones are registered
+	"FindByEMail":      admin,
+	"Update":           selfOrAdmin,
+	"List":             admin,
+	"ChangePassword":   self,
+	"Authenticate":     anyone,
+	"Login":            anyone,
+	"Refresh":          anyone,
+	"Logout":           anyone,
+	"LogoutEverywhere": selfOrAdmin,
+	"AssignRole":       admin,
+	// the token proves the ownership of the email address
+	"VerifyEMail":        anyone,
+	"ResendVerification": selfOrAdmin,
+	// the token proves the ownership of the email address
+	"RequestPasswordReset": anyone,
+	"ResetPassword":        anyone,
+	"Suspend":              admin,
+	"Reactivate":           admin,
+	"Lock":                 admin,
+	"Unlock":               admin,
+	// admins without a second factor have to be able to enroll one
+	"EnrollMFA":  self,
+	"ConfirmMFA": self,
+	"DisableMFA": self,
+	// the challenge token proves the password
+	"VerifyMFA":    anyone,
+	"CreateAPIKey": self,
+	"ListAPIKeys":  selfOrAdmin,
+	"RevokeAPIKey": selfOrAdmin,
+	// the key is the credential
+	"AuthenticateAPIKey": anyone,
+}
+
+// scopes lists the scope an API key needs for an operation of the UserService,
+// callers authenticated with an API key are denied the operations not listed,
+// so a leaked key can neither log in, change credentials nor create further keys
+var scopes = map[string]model.Scope{
+	"Create":      model.ScopeUsersWrite,
+	"Delete":      model.ScopeUsersWrite,
+	"FindByID":    model.ScopeUsersRead,
+	"FindByEMail": model.ScopeUsersRead,
+	"Update":      model.ScopeUsersWrite,
+	"List":        model.ScopeUsersRead,
+	"AssignRole":  model.ScopeUsersWrite,
+	"Suspend":     model.ScopeUsersWrite,
+	"Reactivate":  model.ScopeUsersWrite,
+	"Lock":        model.ScopeUsersWrite,
+	"Unlock":      model.ScopeUsersWrite,
+}
+
+// AuthorizationMiddleware returns a service middleware enforcing the policies,
+// the caller is read from the context, see auth.NewContext
+func AuthorizationMiddleware() Middleware {
+	return func(next UserService) UserService {
+		return &authorizationMiddleware{next}
+	}
+}
+
+type authorizationMiddleware struct {
+	next UserService
+}
+
+// authorize checks if the caller may perform given operation on the user with given id,
+// admins who haven't passed a second factor are evaluated as users without a role
+func authorize(ctx context.Context, method, id string) error {
+	caller, _ := auth.FromContext(ctx)
+
+	if caller != nil && caller.APIKeyID != "" {
+		if scope, ok := scopes[method]; !ok || !caller.HasScope(scope) {
+			return ErrForbidden
+		}
+	}
+
+	allowed, ok := policies[method]
+	if ok && allowed(withoutMFAPrivileges(caller), id) {
+		return nil
+	}
+
+	if caller == nil {
+		return ErrUnauthenticated
+	}
+	if ok && allowed(caller, id) {
+		return ErrMFARequired
+	}
+	return ErrForbidden
+}
+
+// withoutMFAPrivileges returns the caller without the privileges requiring a second factor
+func withoutMFAPrivileges(caller *auth.Principal) *auth.Principal {
+	if caller == nil || !caller.IsAdmin() || caller.MFA {
+		return caller
+	}
+
+	demoted := *caller
+	demoted.Role = model.Regular
+	return &demoted
+}
+
+func (mw *authorizationMiddleware) Create(ctx context.Context, user model.RequestedUser) (string, error) {
+	if err := authorize(ctx, "Create", ""); err != nil {
+		return "", err
+	}
+	return mw.next.Create(ctx, user)
+}
+
+func (mw *authorizationMiddleware) Delete(ctx context.Context, id string) error {
+	if err := authorize(ctx, "Delete", id); err != nil {
+		return err
+	}
+	return mw.next.Delete(ctx, id)
+}
+
+func (mw *authorizationMiddleware) FindByID(ctx context.Context, id string) (*model.User, error) {
+	if err := authorize(ctx, "FindByID", id); err != nil {
+		return nil, err
+	}
+	return hideLockout(ctx)(mw.next.FindByID(ctx, id))
+}
+
+func (mw *authorizationMiddleware) FindByEMail(ctx context.Context, email string) (*model.User, error) {
+	if err := authorize(ctx, "FindByEMail", ""); err != nil {
+		return nil, err
+	}
+	return mw.next.FindByEMail(ctx, email)
+}
+
+func (mw *authorizationMiddleware) Update(ctx context.Context, id string, update model.UserUpdate) (*model.User, error) {
+	if err := authorize(ctx, "Update", id); err != nil {
+		return nil, err
+	}
+	return hideLockout(ctx)(mw.next.Update(ctx, id, update))
+}
+
+// hideLockout returns a function clearing the failed logins of a user unless the caller is an admin,
+// they're of use to admins only and would tell attackers how long to wait
+func hideLockout(ctx context.Context) func(*model.User, error) (*model.User, error) {
+	return func(user *model.User, err error) (*model.User, error) {
+		if caller, _ := auth.FromContext(ctx); user != nil && !admin(withoutMFAPrivileges(caller), user.ID) {
+			user.FailedLogins = 0
+			user.LockedUntil = time.Time{}
+		}
+		return user, err
+	}
+}
+
+func (mw *authorizationMiddleware) List(ctx context.Context, query model.UserQuery) (*model.UserPage, error) {
+	if err := authorize(ctx, "List", ""); err != nil {
+		return nil, err
+	}
+	return mw.next.List(ctx, query)
+}
+
+func (mw *authorizationMiddleware) ChangePassword(ctx context.Context, id, currentPassword, newPassword string) error {
+	if err := authorize(ctx, "ChangePassword", id); err != nil {
+		return err
+	}
+	return mw.next.ChangePassword(ctx, id, currentPassword, newPassword)
+}
+
+func (mw *authorizationMiddleware) Authenticate(ctx context.Context, email, password string) (*model.User, error) {
+	if err := authorize(ctx, "Authenticate", ""); err != nil {
+		return nil, err
+	}
+	return mw.next.Authenticate(ctx, email, password)
+}
+
+func (mw *authorizationMiddleware) Login(ctx context.Context, email, password string) (*model.Token, error) {
+	if err := authorize(ctx, "Login", ""); err != nil {
+		return nil, err
+	}
+	return mw.next.Login(ctx, email, password)
+}
+
+func (mw *authorizationMiddleware) Refresh(ctx context.Context, refreshToken string) (*model.Token, error) {
+	if err := authorize(ctx, "Refresh", ""); err != nil {
+		return nil, err
+	}
+	return mw.next.Refresh(ctx, refreshToken)
+}
+
+func (mw *authorizationMiddleware) Logout(ctx context.Context, refreshToken string) error {
+	if err := authorize(ctx, "Logout", ""); err != nil {
+		return err
+	}
+	return mw.next.Logout(ctx, refreshToken)
+}
+
+func (mw *authorizationMiddleware) LogoutEverywhere(ctx context.Context, id string) error {
+	if err := authorize(ctx, "LogoutEverywhere", id); err != nil {
+		return err
+	}
+	return mw.next.LogoutEverywhere(ctx, id)
+}
+
+func (mw *authorizationMiddleware) AssignRole(ctx context.Context, id string, role model.Role) (*model.User, error) {
+	if err := authorize(ctx, "AssignRole", id); err != nil {
+		return nil, err
+	}
+	return mw.next.AssignRole(ctx, id, role)
+}
+
+func (mw *authorizationMiddleware) VerifyEMail(ctx context.Context, id, token string) error {
+	if err := authorize(ctx, "VerifyEMail", id); err != nil {
+		return err
+	}
+	return mw.next.VerifyEMail(ctx, id, token)
+}
+
+func (mw *authorizationMiddleware) ResendVerification(ctx context.Context, id string) error {
+	if err := authorize(ctx, "ResendVerification", id); err != nil {
+		return err
+	}
+	return mw.next.ResendVerification(ctx, id)
+}
+
+func (mw *authorizationMiddleware) RequestPasswordReset(ctx context.Context, email string) error {
+	if err := authorize(ctx, "RequestPasswordReset", ""); err != nil {
+		return err
+	}
+	return mw.next.RequestPasswordReset(ctx, email)
+}
+
+func (mw *authorizationMiddleware) ResetPassword(ctx context.Context, token, newPassword string) error {
+	if err := authorize(ctx, "ResetPassword", ""); err != nil {
+		return err
+	}
+	return mw.next.ResetPassword(ctx, token, newPassword)
+}
+
+func (mw *authorizationMiddleware) Suspend(ctx context.Context, id string) (*model.User, error) {
+	if err := authorize(ctx, "Suspend", id); err != nil {
+		return nil, err
+	}
+	return mw.next.Suspend(ctx, id)
+}
+
+func (mw *authorizationMiddleware) Reactivate(ctx context.Context, id string) (*model.User, error) {
+	if err := authorize(ctx, "Reactivate", id); err != nil {
+		return nil, err
+	}
+	return mw.next.Reactivate(ctx, id)
+}
+
+func (mw *authorizationMiddleware) Lock(ctx context.Context, id string) (*model.User, error) {
+	if err := authorize(ctx, "Lock", id); err != nil {
+		return nil, err
+	}
+	return mw.next.Lock(ctx, id)
+}
+
+func (mw *authorizationMiddleware) Unlock(ctx context.Context, id string) (*model.User, error) {
+	if err := authorize(ctx, "Unlock", id); err != nil {
+		return nil, err
+	}
+	return mw.next.Unlock(ctx, id)
+}
+
+func (mw *authorizationMiddleware) EnrollMFA(ctx context.Context, id string) (*model.MFAEnrollment, error) {
+	if err := authorize(ctx, "EnrollMFA", id); err != nil {
+		return nil, err
+	}
+	return mw.next.EnrollMFA(ctx, id)
+}
+
+func (mw *authorizationMiddleware) ConfirmMFA(ctx context.Context, id, code string) ([]string, error) {
+	if err := authorize(ctx, "ConfirmMFA", id); err != nil {
+		return nil, err
+	}
+	return mw.next.ConfirmMFA(ctx, id, code)
+}
+
+func (mw *authorizationMiddleware) DisableMFA(ctx context.Context, id, code string) error {
+	if err := authorize(ctx, "DisableMFA", id); err != nil {
+		return err
+	}
+	return mw.next.DisableMFA(ctx, id, code)
+}
+
+func (mw *authorizationMiddleware) VerifyMFA(ctx context.Context, mfaToken, code string) (*model.Token, error) {
+	if err := authorize(ctx, "VerifyMFA", ""); err != nil {
+		return nil, err
+	}
+	return mw.next.VerifyMFA(ctx, mfaToken, code)
+}
+
+func (mw *authorizationMiddleware) CreateAPIKey(
+	ctx context.Context,
+	id, name string,
+	scopes []model.Scope,
+	expiresAt time.Time,
+) (*model.APIKey, string, error) {
+	if err := authorize(ctx, "CreateAPIKey", id); err != nil {
+		return nil, "", err
+	}
+	return mw.next.CreateAPIKey(ctx, id, name, scopes, expiresAt)
+}
+
+func (mw *authorizationMiddleware) ListAPIKeys(ctx context.Context, id string) ([]*model.APIKey, error) {
+	if err := authorize(ctx, "ListAPIKeys", id); err != nil {
+		return nil, err
+	}
+	return mw.next.ListAPIKeys(ctx, id)
+}
+
+func (mw *authorizationMiddleware) RevokeAPIKey(ctx context.Context, id, keyID string) error {
+	if err := authorize(ctx, "RevokeAPIKey", id); err != nil {
+		return err
+	}
+	return mw.next.RevokeAPIKey(ctx, id, keyID)
+}
+
+func (mw *authorizationMiddleware) AuthenticateAPIKey(ctx context.Context, key string) (*auth.Principal, error) {
+	if err := authorize(ctx, "AuthenticateAPIKey", ""); err != nil {
+		return nil, err
+	}
+	return mw.next.AuthenticateAPIKey(ctx, key)
+}
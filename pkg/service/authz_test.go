@@ -0,0 +1,284 @@
+package service
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/status-owl/user-service/pkg/auth"
+	"github.com/status-owl/user-service/pkg/model"
+)
+
+func TestPoliciesCoverAllMethods(t *testing.T) {
+	typ := reflect.TypeOf((*UserService)(nil)).Elem()
+	for i := 0; i < typ.NumMethod(); i++ {
+		_, ok := policies[typ.Method(i).Name]
+		assert.True(t, ok, "no policy for %s", typ.Method(i).Name)
+	}
+}
+
+func TestScopesNameMethods(t *testing.T) {
+	typ := reflect.TypeOf((*UserService)(nil)).Elem()
+	for method := range scopes {
+		_, ok := typ.MethodByName(method)
+		assert.True(t, ok, "scope of unknown method %s", method)
+	}
+}
+
+func TestAuthorizationMiddleware(t *testing.T) {
+	var (
+		adminCaller    = &auth.Principal{UserID: "1", Role: model.Admin, MFA: true}
+		reporterCaller = &auth.Principal{UserID: "2", Role: model.Reporter}
+		// adminWithoutMFA hasn't passed a second factor
+		adminWithoutMFA = &auth.Principal{UserID: "1", Role: model.Admin}
+		// readOnlyKey has authenticated with an API key restricted to reading
+		readOnlyKey = &auth.Principal{UserID: "1", Role: model.Admin, MFA: true, APIKeyID: "k1",
+			Scopes: []model.Scope{model.ScopeUsersRead}}
+	)
+
+	tests := []struct {
+		name   string
+		caller *auth.Principal
+		// call invokes an operation of given service
+		call func(ctx context.Context, svc UserService) error
+		// whether the call is passed to the next service
+		allowed bool
+		wantErr error
+	}{
+		{
+			name:    "admins may delete users",
+			caller:  adminCaller,
+			call:    func(ctx context.Context, svc UserService) error { return svc.Delete(ctx, "2") },
+			allowed: true,
+		},
+		{
+			name:    "users may not delete themselves",
+			caller:  reporterCaller,
+			call:    func(ctx context.Context, svc UserService) error { return svc.Delete(ctx, "2") },
+			wantErr: ErrForbidden,
+		},
+		{
+			name:    "anonymous callers have to authenticate",
+			call:    func(ctx context.Context, svc UserService) error { return svc.Delete(ctx, "2") },
+			wantErr: ErrUnauthenticated,
+		},
+		{
+			name:   "users may read themselves",
+			caller: reporterCaller,
+			call: func(ctx context.Context, svc UserService) error {
+				_, err := svc.FindByID(ctx, "2")
+				return err
+			},
+			allowed: true,
+		},
+		{
+			name:   "users may not read others",
+			caller: reporterCaller,
+			call: func(ctx context.Context, svc UserService) error {
+				_, err := svc.FindByID(ctx, "1")
+				return err
+			},
+			wantErr: ErrForbidden,
+		},
+		{
+			name:   "admins may look up users by email address",
+			caller: adminCaller,
+			call: func(ctx context.Context, svc UserService) error {
+				_, err := svc.FindByEMail(ctx, "john@example.com")
+				return err
+			},
+			allowed: true,
+		},
+		{
+			name:   "users may not look up others by email address",
+			caller: reporterCaller,
+			call: func(ctx context.Context, svc UserService) error {
+				_, err := svc.FindByEMail(ctx, "john@example.com")
+				return err
+			},
+			wantErr: ErrForbidden,
+		},
+		{
+			name:   "admins may update others",
+			caller: adminCaller,
+			call: func(ctx context.Context, svc UserService) error {
+				_, err := svc.Update(ctx, "2", model.UserUpdate{Name: "John"})
+				return err
+			},
+			allowed: true,
+		},
+		{
+			name:   "users may not update others",
+			caller: reporterCaller,
+			call: func(ctx context.Context, svc UserService) error {
+				_, err := svc.Update(ctx, "1", model.UserUpdate{Name: "John"})
+				return err
+			},
+			wantErr: ErrForbidden,
+		},
+		{
+			name:   "only admins list users",
+			caller: reporterCaller,
+			call: func(ctx context.Context, svc UserService) error {
+				_, err := svc.List(ctx, model.UserQuery{})
+				return err
+			},
+			wantErr: ErrForbidden,
+		},
+		{
+			name:    "admins may not change passwords of others",
+			caller:  adminCaller,
+			call:    func(ctx context.Context, svc UserService) error { return svc.ChangePassword(ctx, "2", "old", "new") },
+			wantErr: ErrForbidden,
+		},
+		{
+			name:   "users may not assign roles to themselves",
+			caller: reporterCaller,
+			call: func(ctx context.Context, svc UserService) error {
+				_, err := svc.AssignRole(ctx, "2", model.Admin)
+				return err
+			},
+			wantErr: ErrForbidden,
+		},
+		{
+			name:    "admins have to pass a second factor",
+			caller:  adminWithoutMFA,
+			call:    func(ctx context.Context, svc UserService) error { return svc.Delete(ctx, "2") },
+			wantErr: ErrMFARequired,
+		},
+		{
+			name:   "admins without a second factor may read themselves",
+			caller: adminWithoutMFA,
+			call: func(ctx context.Context, svc UserService) error {
+				_, err := svc.FindByID(ctx, "1")
+				return err
+			},
+			allowed: true,
+		},
+		{
+			name:   "admins without a second factor may enroll one",
+			caller: adminWithoutMFA,
+			call: func(ctx context.Context, svc UserService) error {
+				_, err := svc.EnrollMFA(ctx, "1")
+				return err
+			},
+			allowed: true,
+		},
+		{
+			name:   "admins may not enroll authenticators for others",
+			caller: adminCaller,
+			call: func(ctx context.Context, svc UserService) error {
+				_, err := svc.EnrollMFA(ctx, "2")
+				return err
+			},
+			wantErr: ErrForbidden,
+		},
+		{
+			name:   "api keys may be used within their scopes",
+			caller: readOnlyKey,
+			call: func(ctx context.Context, svc UserService) error {
+				_, err := svc.FindByID(ctx, "2")
+				return err
+			},
+			allowed: true,
+		},
+		{
+			name:    "api keys may not be used beyond their scopes",
+			caller:  readOnlyKey,
+			call:    func(ctx context.Context, svc UserService) error { return svc.Delete(ctx, "2") },
+			wantErr: ErrForbidden,
+		},
+		{
+			name:   "api keys may not create further keys",
+			caller: &auth.Principal{UserID: "1", Role: model.Admin, MFA: true, APIKeyID: "k1", Scopes: model.Scopes},
+			call: func(ctx context.Context, svc UserService) error {
+				_, _, err := svc.CreateAPIKey(ctx, "1", "ci", nil, time.Time{})
+				return err
+			},
+			wantErr: ErrForbidden,
+		},
+		{
+			name: "anonymous callers may log in",
+			call: func(ctx context.Context, svc UserService) error {
+				_, err := svc.Login(ctx, "john@example.com", "secret")
+				return err
+			},
+			allowed: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			next := NewMockUserService(ctrl)
+			if tt.allowed {
+				// any call to the next service succeeds
+				rec := next.EXPECT()
+				rec.Delete(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+				rec.FindByID(gomock.Any(), gomock.Any()).Return(&model.User{}, nil).AnyTimes()
+				rec.FindByEMail(gomock.Any(), gomock.Any()).Return(&model.User{}, nil).AnyTimes()
+				rec.Update(gomock.Any(), gomock.Any(), gomock.Any()).Return(&model.User{}, nil).AnyTimes()
+				rec.Login(gomock.Any(), gomock.Any(), gomock.Any()).Return(&model.Token{}, nil).AnyTimes()
+				rec.EnrollMFA(gomock.Any(), gomock.Any()).Return(&model.MFAEnrollment{}, nil).AnyTimes()
+			}
+
+			ctx := context.Background()
+			if tt.caller != nil {
+				ctx = auth.NewContext(ctx, tt.caller)
+			}
+
+			err := tt.call(ctx, AuthorizationMiddleware()(next))
+			assert.Equal(t, tt.wantErr, err)
+		})
+	}
+}
+
+func TestAuthorizationMiddlewareHidesLockout(t *testing.T) {
+	lockedUntil := time.Now().Add(time.Minute)
+
+	tests := []struct {
+		name   string
+		caller *auth.Principal
+		// whether the failed logins are passed on
+		visible bool
+	}{
+		{
+			name:    "admins see the failed logins",
+			caller:  &auth.Principal{UserID: "1", Role: model.Admin, MFA: true},
+			visible: true,
+		},
+		{
+			name:   "users don't see their own failed logins",
+			caller: &auth.Principal{UserID: "2", Role: model.Reporter},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			next := NewMockUserService(ctrl)
+			next.EXPECT().
+				FindByID(gomock.Any(), "2").
+				Return(&model.User{ID: "2", FailedLogins: 5, LockedUntil: lockedUntil}, nil)
+
+			user, err := AuthorizationMiddleware()(next).FindByID(auth.NewContext(context.Background(), tt.caller), "2")
+			a.Nil(err)
+			if tt.visible {
+				a.Equal(5, user.FailedLogins)
+				a.Equal(lockedUntil, user.LockedUntil)
+			} else {
+				a.Zero(user.FailedLogins)
+				a.True(user.LockedUntil.IsZero())
+			}
+		})
+	}
+}
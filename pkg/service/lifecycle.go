@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+
+	"github.com/status-owl/user-service/pkg/model"
+)
+
+// checkCanLogIn returns an error if given user isn't allowed to log in
+func checkCanLogIn(user *model.User) error {
+	switch user.Status {
+	case model.Suspended:
+		return ErrUserSuspended
+	case model.Locked:
+		return ErrUserLocked
+	default:
+		return nil
+	}
+}
+
+func (s *userService) Suspend(ctx context.Context, id string) (*model.User, error) {
+	return s.changeStatus(ctx, id, func(*model.User) model.Status { return model.Suspended })
+}
+
+func (s *userService) Lock(ctx context.Context, id string) (*model.User, error) {
+	return s.changeStatus(ctx, id, func(*model.User) model.Status { return model.Locked })
+}
+
+func (s *userService) Reactivate(ctx context.Context, id string) (*model.User, error) {
+	return s.changeStatus(ctx, id, reactivatedStatus)
+}
+
+// reactivatedStatus returns the status a user returns to once reactivated,
+// users who haven't verified their email address yet return to pending
+func reactivatedStatus(user *model.User) model.Status {
+	if !user.EMailVerified {
+		return model.Pending
+	}
+	return model.Active
+}
+
+// changeStatus moves a user to the status returned by next,
+// users no longer allowed to log in lose their refresh tokens
+func (s *userService) changeStatus(ctx context.Context, id string, next func(*model.User) model.Status) (*model.User, error) {
+	user, err := s.userStore.FindByID(ctx, id)
+	if err != nil {
+		return nil, translateStoreError(err)
+	}
+
+	status := next(user)
+	if !user.Status.CanTransitionTo(status) {
+		return nil, &TransitionError{From: user.Status, To: status}
+	}
+
+	if !status.CanLogIn() && user.Role == model.Admin {
+		return nil, ErrAdminNotSuspendable
+	}
+
+	user.Status = status
+	if err = s.userStore.Update(ctx, user); err != nil {
+		return nil, translateStoreError(err)
+	}
+
+	if !status.CanLogIn() {
+		if _, err = s.tokenStore.DeleteByUser(ctx, id); err != nil {
+			return nil, err
+		}
+	}
+
+	return user, nil
+}
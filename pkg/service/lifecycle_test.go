@@ -0,0 +1,139 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/status-owl/user-service/pkg/model"
+)
+
+// mustCreateRegular creates an admin followed by a regular user with a password and returns the latter's id
+func mustCreateRegular(t *testing.T, svc *userService) string {
+	t.Helper()
+	ctx := context.Background()
+
+	if _, err := svc.Create(ctx, model.RequestedUser{EMail: "admin@example.com", Name: "Admin"}); err != nil {
+		t.Fatalf("failed to create admin: %s", err.Error())
+	}
+
+	id, err := svc.Create(ctx, model.RequestedUser{EMail: "john@example.com", Name: "John", Password: "correct-Horse-7"})
+	if err != nil {
+		t.Fatalf("failed to create user: %s", err.Error())
+	}
+
+	return id
+}
+
+func TestLifecycle(t *testing.T) {
+	a := assert.New(t)
+	svc := newTestService()
+	ctx := context.Background()
+
+	id := mustCreateRegular(t, svc)
+
+	user, err := svc.FindByID(ctx, id)
+	a.Nil(err)
+	a.Equal(model.Pending, user.Status, "new users are pending")
+
+	a.Nil(svc.VerifyEMail(ctx, id, "verify:"+id+":john@example.com"))
+	user, err = svc.FindByID(ctx, id)
+	a.Nil(err)
+	a.Equal(model.Active, user.Status, "verifying the email address activates the user")
+
+	user, err = svc.Suspend(ctx, id)
+	a.Nil(err)
+	a.Equal(model.Suspended, user.Status)
+
+	_, err = svc.Suspend(ctx, id)
+	var terr *TransitionError
+	if a.ErrorAs(err, &terr) {
+		a.Equal(model.Suspended, terr.From)
+		a.Equal(model.Suspended, terr.To)
+	}
+
+	_, err = svc.Lock(ctx, id)
+	a.ErrorAs(err, &terr, "suspended users have to be reactivated before being locked")
+
+	user, err = svc.Reactivate(ctx, id)
+	a.Nil(err)
+	a.Equal(model.Active, user.Status)
+
+	_, err = svc.Reactivate(ctx, id)
+	a.ErrorAs(err, &terr, "active users can't be reactivated")
+
+	user, err = svc.Lock(ctx, id)
+	a.Nil(err)
+	a.Equal(model.Locked, user.Status)
+
+	_, err = svc.Suspend(ctx, "unknown")
+	a.ErrorIs(err, ErrUserNotFound)
+}
+
+func TestReactivateUnverified(t *testing.T) {
+	a := assert.New(t)
+	svc := newTestService()
+	ctx := context.Background()
+
+	id := mustCreateRegular(t, svc)
+
+	_, err := svc.Suspend(ctx, id)
+	a.Nil(err)
+
+	user, err := svc.Reactivate(ctx, id)
+	a.Nil(err)
+	a.Equal(model.Pending, user.Status, "unverified users return to pending")
+}
+
+func TestSuspendedCantLogIn(t *testing.T) {
+	a := assert.New(t)
+	svc := newTestService()
+	ctx := context.Background()
+
+	id := mustCreateRegular(t, svc)
+
+	// pending users may log in
+	token, err := svc.Login(ctx, "john@example.com", "correct-Horse-7")
+	a.Nil(err)
+
+	_, err = svc.Suspend(ctx, id)
+	a.Nil(err)
+
+	_, err = svc.Login(ctx, "john@example.com", "correct-Horse-7")
+	a.ErrorIs(err, ErrUserSuspended)
+	_, err = svc.Refresh(ctx, token.RefreshToken)
+	a.ErrorIs(err, ErrInvalidRefreshToken, "suspending revokes the refresh tokens")
+
+	// wrong passwords don't reveal the status
+	_, err = svc.Login(ctx, "john@example.com", "wrong")
+	a.ErrorIs(err, ErrInvalidCredentials)
+
+	_, err = svc.Reactivate(ctx, id)
+	a.Nil(err)
+	_, err = svc.Login(ctx, "john@example.com", "correct-Horse-7")
+	a.Nil(err)
+
+	_, err = svc.Lock(ctx, id)
+	a.Nil(err)
+	_, err = svc.Login(ctx, "john@example.com", "correct-Horse-7")
+	a.ErrorIs(err, ErrUserLocked)
+}
+
+func TestSuspendAdmin(t *testing.T) {
+	a := assert.New(t)
+	svc := newTestService()
+	ctx := context.Background()
+
+	id, err := svc.Create(ctx, model.RequestedUser{EMail: "admin@example.com", Name: "Admin"})
+	a.Nil(err)
+
+	_, err = svc.Suspend(ctx, id)
+	a.ErrorIs(err, ErrAdminNotSuspendable)
+	_, err = svc.Lock(ctx, id)
+	a.ErrorIs(err, ErrAdminNotSuspendable)
+
+	user, err := svc.FindByID(ctx, id)
+	a.Nil(err)
+	a.Equal(model.Pending, user.Status)
+}
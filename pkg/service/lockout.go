@@ -0,0 +1,173 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/status-owl/user-service/pkg/auth"
+	"github.com/status-owl/user-service/pkg/model"
+)
+
+// LockoutPolicy configures when failed logins lock out users and source addresses
+type LockoutPolicy struct {
+	// MaxFailures is the count of consecutive failed logins locking out a user
+	MaxFailures int
+	// MaxFailuresPerIP is the count of failed logins locking out a source address, whatever users they target
+	MaxFailuresPerIP int
+	// Lockout is the duration of the first lockout, it doubles with every further failed login
+	Lockout time.Duration
+	// MaxLockout limits the duration of a lockout, the failed logins of a source address
+	// are forgotten if there hasn't been another one for this long
+	MaxLockout time.Duration
+}
+
+// DefaultLockoutPolicy locks out users after 5 and source addresses after 20 failed logins
+// for a minute, up to an hour
+var DefaultLockoutPolicy = LockoutPolicy{
+	MaxFailures:      5,
+	MaxFailuresPerIP: 20,
+	Lockout:          time.Minute,
+	MaxLockout:       time.Hour,
+}
+
+// lockoutFor returns how long to lock out after given count of failed logins,
+// zero if the count is still below the threshold max
+func (p LockoutPolicy) lockoutFor(failures, max int) time.Duration {
+	if max <= 0 || failures < max {
+		return 0
+	}
+
+	lockout := p.Lockout
+	for i := max; i < failures && lockout < p.MaxLockout; i++ {
+		lockout *= 2
+	}
+	if lockout > p.MaxLockout {
+		lockout = p.MaxLockout
+	}
+
+	return lockout
+}
+
+// lockout tracks the failed logins per source address,
+// the state is kept in memory and isn't shared between instances.
+// The failed logins per user are kept in the user store.
+type lockout struct {
+	mu     sync.Mutex
+	policy LockoutPolicy
+	// addrs maps the source addresses to their failed logins
+	addrs map[string]*addrFailures
+	// now returns the current time, replaced in tests
+	now func() time.Time
+}
+
+type addrFailures struct {
+	count       int
+	last        time.Time
+	lockedUntil time.Time
+}
+
+func newLockout(policy LockoutPolicy) *lockout {
+	return &lockout{
+		policy: policy,
+		addrs:  make(map[string]*addrFailures),
+		now:    time.Now,
+	}
+}
+
+// isAddrLockedOut reports whether logins from given source address are refused
+func (l *lockout) isAddrLockedOut(addr string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, ok := l.addrs[addr]
+	return ok && l.now().Before(f.lockedUntil)
+}
+
+// addAddrFailure records a failed login from given source address
+func (l *lockout) addAddrFailure(addr string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	// forget the addresses which have been quiet for long enough, so the map doesn't grow forever
+	for a, f := range l.addrs {
+		if now.Sub(f.last) >= l.policy.MaxLockout && !now.Before(f.lockedUntil) {
+			delete(l.addrs, a)
+		}
+	}
+
+	f, ok := l.addrs[addr]
+	if !ok {
+		f = &addrFailures{}
+		l.addrs[addr] = f
+	}
+
+	f.count++
+	f.last = now
+	if d := l.policy.lockoutFor(f.count, l.policy.MaxFailuresPerIP); d > 0 {
+		f.lockedUntil = now.Add(d)
+	}
+}
+
+// addFailedLogin records a failed login of given user and from the caller's source address,
+// the user is locked out as soon as its failures reach the threshold
+func (s *userService) addFailedLogin(ctx context.Context, user *model.User) error {
+	if addr, ok := auth.ClientIPFromContext(ctx); ok {
+		s.lockout.addAddrFailure(addr)
+	}
+
+	if user == nil {
+		return nil
+	}
+
+	failures, err := s.userStore.AddFailedLogin(ctx, user.ID)
+	if err != nil {
+		return translateStoreError(err)
+	}
+
+	if d := s.lockout.policy.lockoutFor(failures, s.lockout.policy.MaxFailures); d > 0 {
+		if err = s.userStore.LockOutUntil(ctx, user.ID, s.lockout.now().Add(d)); err != nil {
+			return translateStoreError(err)
+		}
+	}
+
+	return nil
+}
+
+// resetFailedLogins clears the failed logins of given user after it has proven to know its password,
+// failures are logged only since the user is let in anyway
+func (s *userService) resetFailedLogins(ctx context.Context, user *model.User) {
+	if user.FailedLogins == 0 && user.LockedUntil.IsZero() {
+		return
+	}
+
+	if err := s.userStore.ResetFailedLogins(ctx, user.ID); err != nil {
+		s.logger.Error().
+			Err(err).
+			Str("id", user.ID).
+			Msg("failed to reset the failed logins")
+		return
+	}
+
+	user.FailedLogins = 0
+	user.LockedUntil = time.Time{}
+}
+
+func (s *userService) Unlock(ctx context.Context, id string) (*model.User, error) {
+	if err := s.userStore.ResetFailedLogins(ctx, id); err != nil {
+		return nil, translateStoreError(err)
+	}
+
+	user, err := s.userStore.FindByID(ctx, id)
+	if err != nil {
+		return nil, translateStoreError(err)
+	}
+
+	// a lock set by an admin is lifted as well, suspensions are left to Reactivate
+	if user.Status == model.Locked {
+		return s.changeStatus(ctx, id, reactivatedStatus)
+	}
+
+	return user, nil
+}
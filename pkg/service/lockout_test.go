@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/status-owl/user-service/pkg/auth"
+	"github.com/status-owl/user-service/pkg/model"
+)
+
+func TestLockoutFor(t *testing.T) {
+	policy := LockoutPolicy{Lockout: time.Minute, MaxLockout: 5 * time.Minute}
+
+	tests := []struct {
+		failures, max int
+		want          time.Duration
+	}{
+		{failures: 2, max: 3, want: 0},
+		{failures: 3, max: 3, want: time.Minute},
+		{failures: 4, max: 3, want: 2 * time.Minute},
+		{failures: 5, max: 3, want: 4 * time.Minute},
+		{failures: 6, max: 3, want: 5 * time.Minute},
+		{failures: 100, max: 3, want: 5 * time.Minute},
+		// a threshold of 0 disables the lockout
+		{failures: 100, max: 0, want: 0},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, policy.lockoutFor(tt.failures, tt.max), "%d failures, max %d", tt.failures, tt.max)
+	}
+}
+
+// newLockoutTestService returns a test service whose lockouts are driven by the returned clock
+func newLockoutTestService(policy LockoutPolicy) (*userService, *time.Time) {
+	svc := newTestService()
+	svc.lockout = newLockout(policy)
+
+	now := time.Now()
+	svc.lockout.now = func() time.Time { return now }
+	return svc, &now
+}
+
+func TestLoginLockout(t *testing.T) {
+	a := assert.New(t)
+	svc, now := newLockoutTestService(LockoutPolicy{MaxFailures: 3, Lockout: time.Minute, MaxLockout: time.Hour})
+	ctx := context.Background()
+
+	id, _ := mustLogin(t, svc)
+
+	for i := 0; i < 3; i++ {
+		_, err := svc.Login(ctx, "john@example.com", "wrong")
+		a.ErrorIs(err, ErrInvalidCredentials)
+	}
+
+	user, err := svc.FindByID(ctx, id)
+	a.Nil(err)
+	a.Equal(3, user.FailedLogins)
+	a.Equal(now.Add(time.Minute), user.LockedUntil)
+
+	_, err = svc.Login(ctx, "john@example.com", "correct-Horse-7")
+	a.ErrorIs(err, ErrTooManyFailedLogins, "the password isn't checked while locked out")
+
+	// the next failure after the lockout doubles it
+	*now = now.Add(time.Minute)
+	_, err = svc.Login(ctx, "john@example.com", "wrong")
+	a.ErrorIs(err, ErrInvalidCredentials)
+	user, err = svc.FindByID(ctx, id)
+	a.Nil(err)
+	a.Equal(now.Add(2*time.Minute), user.LockedUntil)
+
+	*now = now.Add(2 * time.Minute)
+	_, err = svc.Login(ctx, "john@example.com", "correct-Horse-7")
+	a.Nil(err)
+
+	user, err = svc.FindByID(ctx, id)
+	a.Nil(err)
+	a.Zero(user.FailedLogins, "a successful login resets the failed ones")
+	a.True(user.LockedUntil.IsZero())
+}
+
+func TestLoginLockoutPerIP(t *testing.T) {
+	a := assert.New(t)
+	svc, now := newLockoutTestService(LockoutPolicy{MaxFailures: 100, MaxFailuresPerIP: 3, Lockout: time.Minute, MaxLockout: time.Hour})
+
+	mustLogin(t, svc)
+
+	attacker := auth.NewClientIPContext(context.Background(), "192.0.2.1")
+	for _, email := range []string{"mary@example.com", "mark@example.com", "john@example.com"} {
+		_, err := svc.Login(attacker, email, "wrong")
+		a.ErrorIs(err, ErrInvalidCredentials)
+	}
+
+	_, err := svc.Login(attacker, "john@example.com", "correct-Horse-7")
+	a.ErrorIs(err, ErrTooManyFailedLogins)
+
+	// other addresses aren't affected
+	other := auth.NewClientIPContext(context.Background(), "192.0.2.2")
+	_, err = svc.Login(other, "john@example.com", "correct-Horse-7")
+	a.Nil(err)
+
+	*now = now.Add(time.Minute)
+	_, err = svc.Login(attacker, "john@example.com", "correct-Horse-7")
+	a.Nil(err)
+}
+
+func TestUnlock(t *testing.T) {
+	a := assert.New(t)
+	svc, _ := newLockoutTestService(LockoutPolicy{MaxFailures: 1, Lockout: time.Minute, MaxLockout: time.Hour})
+	ctx := context.Background()
+
+	id, _ := mustLogin(t, svc)
+
+	_, err := svc.Login(ctx, "john@example.com", "wrong")
+	a.ErrorIs(err, ErrInvalidCredentials)
+	_, err = svc.Login(ctx, "john@example.com", "correct-Horse-7")
+	a.ErrorIs(err, ErrTooManyFailedLogins)
+
+	user, err := svc.Unlock(ctx, id)
+	a.Nil(err)
+	a.Zero(user.FailedLogins)
+	a.True(user.LockedUntil.IsZero())
+	a.Equal(int64(1), user.Version, "unlocking doesn't modify the user")
+
+	_, err = svc.Login(ctx, "john@example.com", "correct-Horse-7")
+	a.Nil(err)
+
+	_, err = svc.Unlock(ctx, "unknown")
+	a.ErrorIs(err, ErrUserNotFound)
+}
+
+func TestUnlockLockedUser(t *testing.T) {
+	a := assert.New(t)
+	svc, _ := newLockoutTestService(DefaultLockoutPolicy)
+	ctx := context.Background()
+
+	id := mustCreateRegular(t, svc)
+	a.Nil(svc.VerifyEMail(ctx, id, "verify:"+id+":john@example.com"))
+
+	_, err := svc.Lock(ctx, id)
+	a.Nil(err)
+	_, err = svc.Login(ctx, "john@example.com", "correct-Horse-7")
+	a.ErrorIs(err, ErrUserLocked)
+
+	user, err := svc.Unlock(ctx, id)
+	a.Nil(err)
+	a.Equal(model.Active, user.Status, "unlocking lifts the lock")
+
+	_, err = svc.Login(ctx, "john@example.com", "correct-Horse-7")
+	a.Nil(err)
+
+	// suspensions aren't lifted by unlocking
+	_, err = svc.Suspend(ctx, id)
+	a.Nil(err)
+	user, err = svc.Unlock(ctx, id)
+	a.Nil(err)
+	a.Equal(model.Suspended, user.Status)
+}
+
+func TestResetPasswordEndsLockout(t *testing.T) {
+	a := assert.New(t)
+	svc, _ := newLockoutTestService(LockoutPolicy{MaxFailures: 1, Lockout: time.Minute, MaxLockout: time.Hour})
+	ctx := context.Background()
+
+	id, _ := mustLogin(t, svc)
+
+	_, err := svc.Login(ctx, "john@example.com", "wrong")
+	a.ErrorIs(err, ErrInvalidCredentials)
+
+	a.Nil(svc.RequestPasswordReset(ctx, "john@example.com"))
+	a.Nil(svc.ResetPassword(ctx, lastMailedToken(t, svc), "another-Horse-8"))
+
+	user, err := svc.FindByID(ctx, id)
+	a.Nil(err)
+	a.True(user.LockedUntil.IsZero())
+
+	_, err = svc.Login(ctx, "john@example.com", "another-Horse-8")
+	a.Nil(err)
+}
@@ -0,0 +1,232 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/status-owl/user-service/pkg/model"
+	"github.com/status-owl/user-service/pkg/totp"
+)
+
+const (
+	// MFAChallengeTTL is the time a user has to enter the second factor after the password
+	MFAChallengeTTL = 5 * time.Minute
+	// TOTPIssuer is the name authenticator apps list the accounts under
+	TOTPIssuer = "Status Owl"
+	// RecoveryCodeCount is the count of recovery codes generated when enabling multi-factor authentication
+	RecoveryCodeCount = 10
+	// totpSkew is the count of time steps a code is accepted before and after the current one,
+	// so the clocks of authenticators may drift a little
+	totpSkew = 1
+)
+
+// newRecoveryCode returns a random code like 5f2a9-c03e1
+func newRecoveryCode() (string, error) {
+	b := make([]byte, 5)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate recovery code: %w", err)
+	}
+
+	code := hex.EncodeToString(b)
+	return code[:5] + "-" + code[5:], nil
+}
+
+// hashRecoveryCode returns the hash a recovery code is stored as,
+// the case and the separators are ignored since users type them
+func hashRecoveryCode(code string) string {
+	normalized := strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(code))
+
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// challengeMFA issues the token a user with multi-factor authentication exchanges together with a code
+func (s *userService) challengeMFA(user *model.User) (*model.Token, error) {
+	expiresAt := time.Now().Add(MFAChallengeTTL)
+	token, err := s.issuer.IssueMFAChallenge(user, MFAChallengeTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.Token{MFAToken: token, ExpiresAt: expiresAt}, nil
+}
+
+// verifyCode checks given code against the authenticator and the recovery codes of given user,
+// the accepted code is burnt in user which has to be stored afterwards
+func (s *userService) verifyCode(user *model.User, code string) bool {
+	if step, ok := totp.Validate(user.TOTPSecret, code, s.lockout.now(), totpSkew); ok {
+		// every code is accepted once only
+		if step <= user.TOTPLastStep {
+			return false
+		}
+		user.TOTPLastStep = step
+		return true
+	}
+
+	hash := hashRecoveryCode(code)
+	for i, stored := range user.RecoveryCodes {
+		if subtle.ConstantTimeCompare([]byte(stored), []byte(hash)) == 1 {
+			// the stored slice isn't modified, the store may share it
+			remaining := make([]string, 0, len(user.RecoveryCodes)-1)
+			remaining = append(remaining, user.RecoveryCodes[:i]...)
+			user.RecoveryCodes = append(remaining, user.RecoveryCodes[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *userService) EnrollMFA(ctx context.Context, id string) (*model.MFAEnrollment, error) {
+	user, err := s.userStore.FindByID(ctx, id)
+	if err != nil {
+		return nil, translateStoreError(err)
+	}
+
+	if user.MFAEnabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	// enrolling again replaces the pending secret, e.g. if the first one hasn't been scanned
+	if user.TOTPSecret, err = totp.GenerateSecret(); err != nil {
+		return nil, err
+	}
+
+	if err = s.userStore.Update(ctx, user); err != nil {
+		return nil, translateStoreError(err)
+	}
+
+	return &model.MFAEnrollment{
+		Secret: user.TOTPSecret,
+		URI:    totp.ProvisioningURI(user.TOTPSecret, TOTPIssuer, user.EMail),
+	}, nil
+}
+
+func (s *userService) ConfirmMFA(ctx context.Context, id, code string) ([]string, error) {
+	user, err := s.userStore.FindByID(ctx, id)
+	if err != nil {
+		return nil, translateStoreError(err)
+	}
+
+	if user.MFAEnabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	if user.TOTPSecret == "" {
+		return nil, ErrMFANotEnrolled
+	}
+
+	// recovery codes don't exist yet, so only the authenticator's code is accepted
+	if !s.verifyCode(user, code) {
+		return nil, ErrInvalidMFACode
+	}
+
+	codes := make([]string, RecoveryCodeCount)
+	user.RecoveryCodes = make([]string, RecoveryCodeCount)
+	for i := range codes {
+		if codes[i], err = newRecoveryCode(); err != nil {
+			return nil, err
+		}
+		user.RecoveryCodes[i] = hashRecoveryCode(codes[i])
+	}
+
+	user.MFAEnabled = true
+	if err = s.userStore.Update(ctx, user); err != nil {
+		return nil, translateStoreError(err)
+	}
+
+	// sessions started with the password only must not outlive the second factor
+	if _, err = s.tokenStore.DeleteByUser(ctx, id); err != nil {
+		return nil, err
+	}
+	// so must the API keys, they'd be granted the privileges of the second factor otherwise
+	if _, err = s.apiKeyStore.DeleteByUser(ctx, id); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+func (s *userService) DisableMFA(ctx context.Context, id, code string) error {
+	user, err := s.userStore.FindByID(ctx, id)
+	if err != nil {
+		return translateStoreError(err)
+	}
+
+	if !user.MFAEnabled {
+		return ErrMFANotEnrolled
+	}
+
+	if !s.verifyCode(user, code) {
+		return ErrInvalidMFACode
+	}
+
+	// the last step is kept, so codes accepted before can't be replayed after enrolling again
+	user.MFAEnabled = false
+	user.TOTPSecret = ""
+	user.RecoveryCodes = nil
+	if err = s.userStore.Update(ctx, user); err != nil {
+		return translateStoreError(err)
+	}
+
+	return nil
+}
+
+func (s *userService) VerifyMFA(ctx context.Context, mfaToken, code string) (*model.Token, error) {
+	claims, err := s.issuer.VerifyMFAChallenge(mfaToken)
+	if err != nil {
+		return nil, ErrInvalidMFAToken
+	}
+
+	user, err := s.userStore.FindByID(ctx, claims.Subject)
+	if err != nil {
+		if translateStoreError(err) == ErrUserNotFound {
+			return nil, ErrInvalidMFAToken
+		}
+		return nil, err
+	}
+
+	// multi-factor authentication has been disabled since the login
+	if !user.MFAEnabled {
+		return nil, ErrInvalidMFAToken
+	}
+
+	// codes are guessed at the pace of the lockout at most, like passwords
+	if user.IsLockedOut(s.lockout.now()) {
+		return nil, ErrTooManyFailedLogins
+	}
+	if err = checkCanLogIn(user); err != nil {
+		return nil, err
+	}
+
+	if !s.verifyCode(user, code) {
+		if err = s.addFailedLogin(ctx, user); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidMFACode
+	}
+
+	if err = s.userStore.Update(ctx, user); err != nil {
+		return nil, translateStoreError(err)
+	}
+
+	s.resetFailedLogins(ctx, user)
+
+	// every login starts a new family of refresh tokens
+	familyID, err := newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	return s.issueTokens(ctx, user, familyID)
+}
@@ -0,0 +1,206 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/status-owl/user-service/pkg/model"
+	"github.com/status-owl/user-service/pkg/totp"
+)
+
+// mustCode returns the code of given authenticator secret at given time
+func mustCode(t *testing.T, secret string, at time.Time) string {
+	t.Helper()
+
+	code, err := totp.Code(secret, totp.Step(at))
+	if err != nil {
+		t.Fatalf("failed to generate code: %s", err.Error())
+	}
+	return code
+}
+
+// mustEnableMFA enrolls and confirms an authenticator for the user with given id
+// and returns its secret together with the recovery codes
+func mustEnableMFA(t *testing.T, svc *userService, id string) (string, []string) {
+	t.Helper()
+	ctx := context.Background()
+
+	enrollment, err := svc.EnrollMFA(ctx, id)
+	if err != nil {
+		t.Fatalf("failed to enroll: %s", err.Error())
+	}
+
+	codes, err := svc.ConfirmMFA(ctx, id, mustCode(t, enrollment.Secret, svc.lockout.now()))
+	if err != nil {
+		t.Fatalf("failed to confirm: %s", err.Error())
+	}
+
+	return enrollment.Secret, codes
+}
+
+func TestEnrollMFA(t *testing.T) {
+	a := assert.New(t)
+	svc := newTestService()
+	ctx := context.Background()
+	now := time.Date(2021, 12, 24, 18, 0, 0, 0, time.UTC)
+	svc.lockout.now = func() time.Time { return now }
+
+	id, token := mustLogin(t, svc)
+
+	_, err := svc.ConfirmMFA(ctx, id, "123456")
+	a.ErrorIs(err, ErrMFANotEnrolled)
+
+	enrollment, err := svc.EnrollMFA(ctx, id)
+	a.Nil(err)
+	a.NotEmpty(enrollment.Secret)
+	a.True(strings.HasPrefix(enrollment.URI, "otpauth://totp/"), enrollment.URI)
+	a.Contains(enrollment.URI, "secret="+enrollment.Secret)
+
+	// the secret is pending until confirmed
+	user, err := svc.FindByID(ctx, id)
+	a.Nil(err)
+	a.False(user.MFAEnabled)
+	a.Equal(enrollment.Secret, user.TOTPSecret)
+
+	_, err = svc.ConfirmMFA(ctx, id, "000000")
+	a.ErrorIs(err, ErrInvalidMFACode)
+
+	codes, err := svc.ConfirmMFA(ctx, id, mustCode(t, enrollment.Secret, now))
+	a.Nil(err)
+	a.Len(codes, RecoveryCodeCount)
+
+	user, err = svc.FindByID(ctx, id)
+	a.Nil(err)
+	a.True(user.MFAEnabled)
+	if a.Len(user.RecoveryCodes, RecoveryCodeCount) {
+		a.NotEqual(codes[0], user.RecoveryCodes[0], "recovery codes are stored hashed")
+		a.Equal(hashRecoveryCode(codes[0]), user.RecoveryCodes[0])
+	}
+
+	_, err = svc.Refresh(ctx, token.RefreshToken)
+	a.ErrorIs(err, ErrInvalidRefreshToken, "enabling multi-factor authentication ends the sessions")
+
+	_, err = svc.EnrollMFA(ctx, id)
+	a.ErrorIs(err, ErrMFAAlreadyEnabled)
+}
+
+func TestLoginWithMFA(t *testing.T) {
+	a := assert.New(t)
+	svc := newTestService()
+	ctx := context.Background()
+	now := time.Date(2021, 12, 24, 18, 0, 0, 0, time.UTC)
+	svc.lockout.now = func() time.Time { return now }
+
+	id, _ := mustLogin(t, svc)
+	secret, _ := mustEnableMFA(t, svc, id)
+
+	challenge, err := svc.Login(ctx, "john@example.com", "correct-Horse-7")
+	a.Nil(err)
+	a.Equal("mfa:"+id, challenge.MFAToken)
+	a.Empty(challenge.AccessToken, "no access is granted before the second factor")
+	a.Empty(challenge.RefreshToken)
+
+	_, err = svc.VerifyMFA(ctx, "invalid", mustCode(t, secret, now))
+	a.ErrorIs(err, ErrInvalidMFAToken)
+
+	_, err = svc.VerifyMFA(ctx, challenge.MFAToken, "000000")
+	a.ErrorIs(err, ErrInvalidMFACode)
+
+	// the code the enrollment has been confirmed with can't be replayed
+	_, err = svc.VerifyMFA(ctx, challenge.MFAToken, mustCode(t, secret, now))
+	a.ErrorIs(err, ErrInvalidMFACode)
+
+	now = now.Add(totp.Period)
+	token, err := svc.VerifyMFA(ctx, challenge.MFAToken, mustCode(t, secret, now))
+	a.Nil(err)
+	a.Equal(id+":"+string(model.Admin), token.AccessToken)
+	a.NotEmpty(token.RefreshToken)
+
+	user, err := svc.FindByID(ctx, id)
+	a.Nil(err)
+	a.Zero(user.FailedLogins, "a successful login resets the failed ones")
+
+	_, err = svc.Refresh(ctx, token.RefreshToken)
+	a.Nil(err)
+}
+
+func TestLoginWithRecoveryCode(t *testing.T) {
+	a := assert.New(t)
+	svc := newTestService()
+	ctx := context.Background()
+
+	id, _ := mustLogin(t, svc)
+	_, codes := mustEnableMFA(t, svc, id)
+
+	challenge, err := svc.Login(ctx, "john@example.com", "correct-Horse-7")
+	a.Nil(err)
+
+	// recovery codes are accepted whatever the case and the separators
+	_, err = svc.VerifyMFA(ctx, challenge.MFAToken, strings.ToUpper(strings.ReplaceAll(codes[3], "-", " ")))
+	a.Nil(err)
+
+	user, err := svc.FindByID(ctx, id)
+	a.Nil(err)
+	a.Len(user.RecoveryCodes, RecoveryCodeCount-1)
+
+	_, err = svc.VerifyMFA(ctx, challenge.MFAToken, codes[3])
+	a.ErrorIs(err, ErrInvalidMFACode, "recovery codes are accepted once only")
+}
+
+func TestVerifyMFALockout(t *testing.T) {
+	a := assert.New(t)
+	svc := newTestService()
+	ctx := context.Background()
+
+	id, _ := mustLogin(t, svc)
+	_, codes := mustEnableMFA(t, svc, id)
+
+	challenge, err := svc.Login(ctx, "john@example.com", "correct-Horse-7")
+	a.Nil(err)
+
+	for i := 0; i < DefaultLockoutPolicy.MaxFailures; i++ {
+		_, err = svc.VerifyMFA(ctx, challenge.MFAToken, "000000")
+		a.ErrorIs(err, ErrInvalidMFACode)
+	}
+
+	_, err = svc.VerifyMFA(ctx, challenge.MFAToken, codes[0])
+	a.ErrorIs(err, ErrTooManyFailedLogins, "codes aren't verified while locked out")
+}
+
+func TestDisableMFA(t *testing.T) {
+	a := assert.New(t)
+	svc := newTestService()
+	ctx := context.Background()
+	now := time.Date(2021, 12, 24, 18, 0, 0, 0, time.UTC)
+	svc.lockout.now = func() time.Time { return now }
+
+	id, _ := mustLogin(t, svc)
+	a.ErrorIs(svc.DisableMFA(ctx, id, "123456"), ErrMFANotEnrolled)
+
+	secret, _ := mustEnableMFA(t, svc, id)
+	challenge, err := svc.Login(ctx, "john@example.com", "correct-Horse-7")
+	a.Nil(err)
+
+	a.ErrorIs(svc.DisableMFA(ctx, id, "000000"), ErrInvalidMFACode)
+
+	now = now.Add(totp.Period)
+	a.Nil(svc.DisableMFA(ctx, id, mustCode(t, secret, now)))
+
+	user, err := svc.FindByID(ctx, id)
+	a.Nil(err)
+	a.False(user.MFAEnabled)
+	a.Empty(user.TOTPSecret)
+	a.Empty(user.RecoveryCodes)
+
+	_, err = svc.VerifyMFA(ctx, challenge.MFAToken, mustCode(t, secret, now.Add(totp.Period)))
+	a.ErrorIs(err, ErrInvalidMFAToken, "challenges issued before disabling are void")
+
+	token, err := svc.Login(ctx, "john@example.com", "correct-Horse-7")
+	a.Nil(err)
+	a.NotEmpty(token.AccessToken)
+	a.Empty(token.MFAToken)
+}
@@ -2,9 +2,13 @@ package service
 
 import (
 	"context"
+	"errors"
+	"time"
+
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/rs/zerolog"
+	"github.com/status-owl/user-service/pkg/auth"
 	"github.com/status-owl/user-service/pkg/model"
 )
 
@@ -99,69 +103,1041 @@ func (mw *loggingMiddleware) FindByID(ctx context.Context, id string) (user *mod
 	return
 }
 
-// Instrumenting Middleware
+func (mw *loggingMiddleware) FindByEMail(ctx context.Context, email string) (user *model.User, err error) {
+	logger := mw.logger.With().
+		Str("method", "FindByEMail").
+		Str("email", email).
+		Logger()
 
-func InstrumentingMiddleware() Middleware {
-	return func(next UserService) UserService {
-		return &instrumentingMiddleware{
-			createdUsers: promauto.NewCounterVec(prometheus.CounterOpts{
-				Namespace: "status_owl",
-				Subsystem: "user_service",
-				Name:      "users_created",
-				Help:      "Total count of created users",
-			}, []string{"status"}),
-			fetchedUsers: promauto.NewCounterVec(prometheus.CounterOpts{
-				Namespace: "status_owl",
-				Subsystem: "user_service",
-				Name:      "users_fetched",
-				Help:      "Total count of fetched users",
-			}, []string{"status"}),
-			deletedUsers: promauto.NewCounterVec(prometheus.CounterOpts{
-				Namespace: "status_owl",
-				Subsystem: "user_service",
-				Name:      "users_deleted",
-				Help:      "Total count of deleted users",
-			}, []string{"status"}),
-			next: next,
+	logger.Trace().Msg("about to find an user")
+
+	defer func() {
+		if err != nil {
+			logger.Error().
+				Err(err).
+				Msg("failed to find an user")
+		} else {
+			logger.Info().
+				Stringer("user", user).
+				Msg("user found")
 		}
-	}
+	}()
+
+	user, err = mw.next.FindByEMail(ctx, email)
+	return
 }
 
-type instrumentingMiddleware struct {
-	createdUsers, fetchedUsers, deletedUsers *prometheus.CounterVec
-	next                                     UserService
+func (mw *loggingMiddleware) Update(ctx context.Context, id string, update model.UserUpdate) (user *model.User, err error) {
+	logger := mw.logger.With().
+		Str("method", "Update").
+		Str("id", id).
+		Stringer("update", update).
+		Logger()
+
+	logger.Trace().Msg("about to update an user")
+
+	defer func() {
+		if err != nil {
+			logger.Error().
+				Err(err).
+				Msg("failed to update an user")
+		} else {
+			logger.Info().
+				Stringer("user", user).
+				Msg("user updated")
+		}
+	}()
+
+	user, err = mw.next.Update(ctx, id, update)
+	return
 }
 
-func (mw *instrumentingMiddleware) Delete(ctx context.Context, id string) (err error) {
+func (mw *loggingMiddleware) List(ctx context.Context, query model.UserQuery) (page *model.UserPage, err error) {
+	logger := mw.logger.With().
+		Str("method", "List").
+		Stringer("query", query).
+		Logger()
+
+	logger.Trace().Msg("about to list users")
+
 	defer func() {
-		mw.deletedUsers.With(prometheus.Labels{"status": err2Status(err)}).Inc()
+		if err != nil {
+			logger.Error().
+				Err(err).
+				Msg("failed to list users")
+		} else {
+			logger.Info().
+				Int("count", len(page.Users)).
+				Bool("more", page.NextCursor != "").
+				Msg("users listed")
+		}
 	}()
 
-	err = mw.next.Delete(ctx, id)
+	page, err = mw.next.List(ctx, query)
 	return
 }
 
-func err2Status(err error) string {
-	if err != nil {
-		return "failed"
-	}
-	return "success"
+func (mw *loggingMiddleware) ChangePassword(ctx context.Context, id, currentPassword, newPassword string) (err error) {
+	logger := mw.logger.With().
+		Str("method", "ChangePassword").
+		Str("id", id).
+		Logger()
+
+	logger.Trace().Msg("about to change the password of an user")
+
+	defer func() {
+		if err != nil {
+			logger.Error().
+				Err(err).
+				Msg("failed to change the password of an user")
+		} else {
+			logger.Info().
+				Msg("password changed")
+		}
+	}()
+
+	return mw.next.ChangePassword(ctx, id, currentPassword, newPassword)
 }
 
-func (mw *instrumentingMiddleware) Create(ctx context.Context, user model.RequestedUser) (id string, err error) {
+func (mw *loggingMiddleware) Authenticate(ctx context.Context, email, password string) (user *model.User, err error) {
+	logger := mw.logger.With().
+		Str("method", "Authenticate").
+		Logger()
+
+	logger.Trace().Msg("about to authenticate an user")
+
 	defer func() {
-		mw.createdUsers.With(prometheus.Labels{"status": err2Status(err)}).Inc()
+		if err != nil {
+			logger.Info().
+				Err(err).
+				Msg("failed to authenticate an user")
+		} else {
+			logger.Info().
+				Str("id", user.ID).
+				Msg("user authenticated")
+		}
 	}()
 
-	id, err = mw.next.Create(ctx, user)
+	user, err = mw.next.Authenticate(ctx, email, password)
 	return
 }
 
-func (mw *instrumentingMiddleware) FindByID(ctx context.Context, id string) (user *model.User, err error) {
+func (mw *loggingMiddleware) Login(ctx context.Context, email, password string) (token *model.Token, err error) {
+	logger := mw.logger.With().
+		Str("method", "Login").
+		Logger()
+
+	logger.Trace().Msg("about to log in an user")
+
 	defer func() {
-		mw.fetchedUsers.With(prometheus.Labels{"status": err2Status(err)}).Inc()
+		if err != nil {
+			logger.Info().
+				Err(err).
+				Msg("failed to log in an user")
+		} else {
+			logger.Info().
+				Stringer("token", token).
+				Msg("user logged in")
+		}
 	}()
 
-	user, err = mw.next.FindByID(ctx, id)
+	token, err = mw.next.Login(ctx, email, password)
+	return
+}
+
+func (mw *loggingMiddleware) Refresh(ctx context.Context, refreshToken string) (token *model.Token, err error) {
+	logger := mw.logger.With().
+		Str("method", "Refresh").
+		Logger()
+
+	logger.Trace().Msg("about to refresh a token")
+
+	defer func() {
+		if err != nil {
+			logger.Info().
+				Err(err).
+				Msg("failed to refresh a token")
+		} else {
+			logger.Info().
+				Stringer("token", token).
+				Msg("token refreshed")
+		}
+	}()
+
+	token, err = mw.next.Refresh(ctx, refreshToken)
+	return
+}
+
+func (mw *loggingMiddleware) Logout(ctx context.Context, refreshToken string) (err error) {
+	logger := mw.logger.With().
+		Str("method", "Logout").
+		Logger()
+
+	logger.Trace().Msg("about to log out an user")
+
+	defer func() {
+		if err != nil {
+			logger.Error().
+				Err(err).
+				Msg("failed to log out an user")
+		} else {
+			logger.Info().
+				Msg("user logged out")
+		}
+	}()
+
+	return mw.next.Logout(ctx, refreshToken)
+}
+
+func (mw *loggingMiddleware) LogoutEverywhere(ctx context.Context, id string) (err error) {
+	logger := mw.logger.With().
+		Str("method", "LogoutEverywhere").
+		Str("id", id).
+		Logger()
+
+	logger.Trace().Msg("about to log out an user everywhere")
+
+	defer func() {
+		if err != nil {
+			logger.Error().
+				Err(err).
+				Msg("failed to log out an user everywhere")
+		} else {
+			logger.Info().
+				Msg("user logged out everywhere")
+		}
+	}()
+
+	return mw.next.LogoutEverywhere(ctx, id)
+}
+
+func (mw *loggingMiddleware) AssignRole(ctx context.Context, id string, role model.Role) (user *model.User, err error) {
+	logger := mw.logger.With().
+		Str("method", "AssignRole").
+		Str("id", id).
+		Stringer("role", role).
+		Logger()
+
+	logger.Trace().Msg("about to assign a role to an user")
+
+	defer func() {
+		if err != nil {
+			logger.Error().
+				Err(err).
+				Msg("failed to assign a role to an user")
+		} else {
+			logger.Info().
+				Msg("role assigned")
+		}
+	}()
+
+	user, err = mw.next.AssignRole(ctx, id, role)
+	return
+}
+
+func (mw *loggingMiddleware) VerifyEMail(ctx context.Context, id, token string) (err error) {
+	logger := mw.logger.With().
+		Str("method", "VerifyEMail").
+		Str("id", id).
+		Logger()
+
+	logger.Trace().Msg("about to verify an email address")
+
+	defer func() {
+		if err != nil {
+			logger.Error().
+				Err(err).
+				Msg("failed to verify an email address")
+		} else {
+			logger.Info().
+				Msg("email address verified")
+		}
+	}()
+
+	return mw.next.VerifyEMail(ctx, id, token)
+}
+
+func (mw *loggingMiddleware) ResendVerification(ctx context.Context, id string) (err error) {
+	logger := mw.logger.With().
+		Str("method", "ResendVerification").
+		Str("id", id).
+		Logger()
+
+	logger.Trace().Msg("about to resend a verification mail")
+
+	defer func() {
+		if err != nil {
+			logger.Error().
+				Err(err).
+				Msg("failed to resend a verification mail")
+		} else {
+			logger.Info().
+				Msg("verification mail resent")
+		}
+	}()
+
+	return mw.next.ResendVerification(ctx, id)
+}
+
+func (mw *loggingMiddleware) RequestPasswordReset(ctx context.Context, email string) (err error) {
+	logger := mw.logger.With().
+		Str("method", "RequestPasswordReset").
+		Logger()
+
+	logger.Trace().Msg("about to request a password reset")
+
+	defer func() {
+		if err != nil {
+			logger.Error().
+				Err(err).
+				Msg("failed to request a password reset")
+		} else {
+			logger.Info().
+				Msg("password reset requested")
+		}
+	}()
+
+	return mw.next.RequestPasswordReset(ctx, email)
+}
+
+func (mw *loggingMiddleware) ResetPassword(ctx context.Context, token, newPassword string) (err error) {
+	logger := mw.logger.With().
+		Str("method", "ResetPassword").
+		Logger()
+
+	logger.Trace().Msg("about to reset a password")
+
+	defer func() {
+		if err != nil {
+			logger.Info().
+				Err(err).
+				Msg("failed to reset a password")
+		} else {
+			logger.Info().
+				Msg("password reset")
+		}
+	}()
+
+	return mw.next.ResetPassword(ctx, token, newPassword)
+}
+
+func (mw *loggingMiddleware) Suspend(ctx context.Context, id string) (user *model.User, err error) {
+	logger := mw.logger.With().
+		Str("method", "Suspend").
+		Str("id", id).
+		Logger()
+
+	logger.Trace().Msg("about to suspend an user")
+
+	defer func() {
+		if err != nil {
+			logger.Error().
+				Err(err).
+				Msg("failed to suspend an user")
+		} else {
+			logger.Info().
+				Msg("user suspended")
+		}
+	}()
+
+	user, err = mw.next.Suspend(ctx, id)
+	return
+}
+
+func (mw *loggingMiddleware) Reactivate(ctx context.Context, id string) (user *model.User, err error) {
+	logger := mw.logger.With().
+		Str("method", "Reactivate").
+		Str("id", id).
+		Logger()
+
+	logger.Trace().Msg("about to reactivate an user")
+
+	defer func() {
+		if err != nil {
+			logger.Error().
+				Err(err).
+				Msg("failed to reactivate an user")
+		} else {
+			logger.Info().
+				Msg("user reactivated")
+		}
+	}()
+
+	user, err = mw.next.Reactivate(ctx, id)
+	return
+}
+
+func (mw *loggingMiddleware) Lock(ctx context.Context, id string) (user *model.User, err error) {
+	logger := mw.logger.With().
+		Str("method", "Lock").
+		Str("id", id).
+		Logger()
+
+	logger.Trace().Msg("about to lock an user")
+
+	defer func() {
+		if err != nil {
+			logger.Error().
+				Err(err).
+				Msg("failed to lock an user")
+		} else {
+			logger.Info().
+				Msg("user locked")
+		}
+	}()
+
+	user, err = mw.next.Lock(ctx, id)
+	return
+}
+
+func (mw *loggingMiddleware) Unlock(ctx context.Context, id string) (user *model.User, err error) {
+	logger := mw.logger.With().
+		Str("method", "Unlock").
+		Str("id", id).
+		Logger()
+
+	logger.Trace().Msg("about to unlock an user")
+
+	defer func() {
+		if err != nil {
+			logger.Error().
+				Err(err).
+				Msg("failed to unlock an user")
+		} else {
+			logger.Info().
+				Msg("user unlocked")
+		}
+	}()
+
+	user, err = mw.next.Unlock(ctx, id)
+	return
+}
+
+func (mw *loggingMiddleware) EnrollMFA(ctx context.Context, id string) (enrollment *model.MFAEnrollment, err error) {
+	logger := mw.logger.With().
+		Str("method", "EnrollMFA").
+		Str("id", id).
+		Logger()
+
+	logger.Trace().Msg("about to enroll an authenticator")
+
+	defer func() {
+		if err != nil {
+			logger.Info().
+				Err(err).
+				Msg("failed to enroll an authenticator")
+		} else {
+			logger.Info().
+				Msg("authenticator enrolled")
+		}
+	}()
+
+	enrollment, err = mw.next.EnrollMFA(ctx, id)
+	return
+}
+
+func (mw *loggingMiddleware) ConfirmMFA(ctx context.Context, id, code string) (recoveryCodes []string, err error) {
+	logger := mw.logger.With().
+		Str("method", "ConfirmMFA").
+		Str("id", id).
+		Logger()
+
+	logger.Trace().Msg("about to enable multi-factor authentication")
+
+	defer func() {
+		if err != nil {
+			logger.Info().
+				Err(err).
+				Msg("failed to enable multi-factor authentication")
+		} else {
+			logger.Info().
+				Msg("multi-factor authentication enabled")
+		}
+	}()
+
+	recoveryCodes, err = mw.next.ConfirmMFA(ctx, id, code)
+	return
+}
+
+func (mw *loggingMiddleware) DisableMFA(ctx context.Context, id, code string) (err error) {
+	logger := mw.logger.With().
+		Str("method", "DisableMFA").
+		Str("id", id).
+		Logger()
+
+	logger.Trace().Msg("about to disable multi-factor authentication")
+
+	defer func() {
+		if err != nil {
+			logger.Info().
+				Err(err).
+				Msg("failed to disable multi-factor authentication")
+		} else {
+			logger.Info().
+				Msg("multi-factor authentication disabled")
+		}
+	}()
+
+	return mw.next.DisableMFA(ctx, id, code)
+}
+
+func (mw *loggingMiddleware) VerifyMFA(ctx context.Context, mfaToken, code string) (token *model.Token, err error) {
+	logger := mw.logger.With().
+		Str("method", "VerifyMFA").
+		Logger()
+
+	logger.Trace().Msg("about to verify a second factor")
+
+	defer func() {
+		if err != nil {
+			logger.Info().
+				Err(err).
+				Msg("failed to verify a second factor")
+		} else {
+			logger.Info().
+				Stringer("token", token).
+				Msg("user logged in with a second factor")
+		}
+	}()
+
+	token, err = mw.next.VerifyMFA(ctx, mfaToken, code)
+	return
+}
+
+func (mw *loggingMiddleware) CreateAPIKey(
+	ctx context.Context,
+	id, name string,
+	scopes []model.Scope,
+	expiresAt time.Time,
+) (apiKey *model.APIKey, key string, err error) {
+	logger := mw.logger.With().
+		Str("method", "CreateAPIKey").
+		Str("id", id).
+		Str("name", name).
+		Logger()
+
+	logger.Trace().Msg("about to create an api key")
+
+	defer func() {
+		if err != nil {
+			logger.Info().
+				Err(err).
+				Msg("failed to create an api key")
+		} else {
+			logger.Info().
+				Stringer("api_key", apiKey).
+				Msg("api key created")
+		}
+	}()
+
+	apiKey, key, err = mw.next.CreateAPIKey(ctx, id, name, scopes, expiresAt)
+	return
+}
+
+func (mw *loggingMiddleware) ListAPIKeys(ctx context.Context, id string) (keys []*model.APIKey, err error) {
+	logger := mw.logger.With().
+		Str("method", "ListAPIKeys").
+		Str("id", id).
+		Logger()
+
+	logger.Trace().Msg("about to list the api keys of a user")
+
+	defer func() {
+		if err != nil {
+			logger.Info().
+				Err(err).
+				Msg("failed to list the api keys of a user")
+		} else {
+			logger.Info().
+				Int("count", len(keys)).
+				Msg("api keys of a user listed")
+		}
+	}()
+
+	keys, err = mw.next.ListAPIKeys(ctx, id)
+	return
+}
+
+func (mw *loggingMiddleware) RevokeAPIKey(ctx context.Context, id, keyID string) (err error) {
+	logger := mw.logger.With().
+		Str("method", "RevokeAPIKey").
+		Str("id", id).
+		Str("key_id", keyID).
+		Logger()
+
+	logger.Trace().Msg("about to revoke an api key")
+
+	defer func() {
+		if err != nil {
+			logger.Info().
+				Err(err).
+				Msg("failed to revoke an api key")
+		} else {
+			logger.Info().
+				Msg("api key revoked")
+		}
+	}()
+
+	return mw.next.RevokeAPIKey(ctx, id, keyID)
+}
+
+func (mw *loggingMiddleware) AuthenticateAPIKey(ctx context.Context, key string) (principal *auth.Principal, err error) {
+	logger := mw.logger.With().
+		Str("method", "AuthenticateAPIKey").
+		Logger()
+
+	logger.Trace().Msg("about to authenticate an api key")
+
+	defer func() {
+		if err != nil {
+			logger.Info().
+				Err(err).
+				Msg("failed to authenticate an api key")
+		} else {
+			logger.Debug().
+				Stringer("principal", principal).
+				Msg("api key authenticated")
+		}
+	}()
+
+	principal, err = mw.next.AuthenticateAPIKey(ctx, key)
+	return
+}
+
+// Instrumenting Middleware
+
+func InstrumentingMiddleware() Middleware {
+	return func(next UserService) UserService {
+		return &instrumentingMiddleware{
+			createdUsers: promauto.NewCounterVec(prometheus.CounterOpts{
+				Namespace: "status_owl",
+				Subsystem: "user_service",
+				Name:      "users_created",
+				Help:      "Total count of created users",
+			}, []string{"status"}),
+			fetchedUsers: promauto.NewCounterVec(prometheus.CounterOpts{
+				Namespace: "status_owl",
+				Subsystem: "user_service",
+				Name:      "users_fetched",
+				Help:      "Total count of fetched users",
+			}, []string{"status"}),
+			deletedUsers: promauto.NewCounterVec(prometheus.CounterOpts{
+				Namespace: "status_owl",
+				Subsystem: "user_service",
+				Name:      "users_deleted",
+				Help:      "Total count of deleted users",
+			}, []string{"status"}),
+			updatedUsers: promauto.NewCounterVec(prometheus.CounterOpts{
+				Namespace: "status_owl",
+				Subsystem: "user_service",
+				Name:      "users_updated",
+				Help:      "Total count of updated users",
+			}, []string{"status"}),
+			listedUsers: promauto.NewCounterVec(prometheus.CounterOpts{
+				Namespace: "status_owl",
+				Subsystem: "user_service",
+				Name:      "users_listed",
+				Help:      "Total count of user listings",
+			}, []string{"status"}),
+			changedPasswords: promauto.NewCounterVec(prometheus.CounterOpts{
+				Namespace: "status_owl",
+				Subsystem: "user_service",
+				Name:      "passwords_changed",
+				Help:      "Total count of password changes",
+			}, []string{"status"}),
+			authentications: promauto.NewCounterVec(prometheus.CounterOpts{
+				Namespace: "status_owl",
+				Subsystem: "user_service",
+				Name:      "authentications",
+				Help:      "Total count of authentications",
+			}, []string{"status"}),
+			logins: promauto.NewCounterVec(prometheus.CounterOpts{
+				Namespace: "status_owl",
+				Subsystem: "user_service",
+				Name:      "logins",
+				Help:      "Total count of logins",
+			}, []string{"status"}),
+			refreshes: promauto.NewCounterVec(prometheus.CounterOpts{
+				Namespace: "status_owl",
+				Subsystem: "user_service",
+				Name:      "token_refreshes",
+				Help:      "Total count of token refreshes",
+			}, []string{"status"}),
+			logouts: promauto.NewCounterVec(prometheus.CounterOpts{
+				Namespace: "status_owl",
+				Subsystem: "user_service",
+				Name:      "logouts",
+				Help:      "Total count of logouts, including the ones from everywhere",
+			}, []string{"status"}),
+			assignedRoles: promauto.NewCounterVec(prometheus.CounterOpts{
+				Namespace: "status_owl",
+				Subsystem: "user_service",
+				Name:      "roles_assigned",
+				Help:      "Total count of role assignments",
+			}, []string{"status"}),
+			verifiedEMails: promauto.NewCounterVec(prometheus.CounterOpts{
+				Namespace: "status_owl",
+				Subsystem: "user_service",
+				Name:      "emails_verified",
+				Help:      "Total count of email verifications",
+			}, []string{"status"}),
+			resentVerifications: promauto.NewCounterVec(prometheus.CounterOpts{
+				Namespace: "status_owl",
+				Subsystem: "user_service",
+				Name:      "verification_mails_resent",
+				Help:      "Total count of verification mails sent on request",
+			}, []string{"status"}),
+			requestedResets: promauto.NewCounterVec(prometheus.CounterOpts{
+				Namespace: "status_owl",
+				Subsystem: "user_service",
+				Name:      "password_resets_requested",
+				Help:      "Total count of password reset requests",
+			}, []string{"status"}),
+			resetPasswords: promauto.NewCounterVec(prometheus.CounterOpts{
+				Namespace: "status_owl",
+				Subsystem: "user_service",
+				Name:      "passwords_reset",
+				Help:      "Total count of password resets",
+			}, []string{"status"}),
+			statusChanges: promauto.NewCounterVec(prometheus.CounterOpts{
+				Namespace: "status_owl",
+				Subsystem: "user_service",
+				Name:      "status_changes",
+				Help:      "Total count of user status changes by the requested operation",
+			}, []string{"operation", "status"}),
+			lockedOutLogins: promauto.NewCounter(prometheus.CounterOpts{
+				Namespace: "status_owl",
+				Subsystem: "user_service",
+				Name:      "logins_locked_out",
+				Help:      "Total count of logins refused after too many failed ones",
+			}),
+			unlocks: promauto.NewCounterVec(prometheus.CounterOpts{
+				Namespace: "status_owl",
+				Subsystem: "user_service",
+				Name:      "users_unlocked",
+				Help:      "Total count of lockouts ended by admins",
+			}, []string{"status"}),
+			mfaChanges: promauto.NewCounterVec(prometheus.CounterOpts{
+				Namespace: "status_owl",
+				Subsystem: "user_service",
+				Name:      "mfa_changes",
+				Help:      "Total count of multi-factor authentication enrollments by the requested operation",
+			}, []string{"operation", "status"}),
+			mfaVerifications: promauto.NewCounterVec(prometheus.CounterOpts{
+				Namespace: "status_owl",
+				Subsystem: "user_service",
+				Name:      "mfa_verifications",
+				Help:      "Total count of second factors verified during logins",
+			}, []string{"status"}),
+			apiKeyChanges: promauto.NewCounterVec(prometheus.CounterOpts{
+				Namespace: "status_owl",
+				Subsystem: "user_service",
+				Name:      "api_key_changes",
+				Help:      "Total count of api key creations and revocations by the requested operation",
+			}, []string{"operation", "status"}),
+			listedAPIKeys: promauto.NewCounterVec(prometheus.CounterOpts{
+				Namespace: "status_owl",
+				Subsystem: "user_service",
+				Name:      "api_keys_listed",
+				Help:      "Total count of api key listings",
+			}, []string{"status"}),
+			apiKeyAuthentications: promauto.NewCounterVec(prometheus.CounterOpts{
+				Namespace: "status_owl",
+				Subsystem: "user_service",
+				Name:      "api_key_authentications",
+				Help:      "Total count of requests authenticated by api keys",
+			}, []string{"status"}),
+			next: next,
+		}
+	}
+}
+
+type instrumentingMiddleware struct {
+	createdUsers, fetchedUsers, deletedUsers, updatedUsers, listedUsers *prometheus.CounterVec
+	changedPasswords, authentications, logins, refreshes, logouts       *prometheus.CounterVec
+	assignedRoles, verifiedEMails, resentVerifications                  *prometheus.CounterVec
+	requestedResets, resetPasswords, statusChanges, unlocks             *prometheus.CounterVec
+	mfaChanges, mfaVerifications                                        *prometheus.CounterVec
+	apiKeyChanges, listedAPIKeys, apiKeyAuthentications                 *prometheus.CounterVec
+	lockedOutLogins                                                     prometheus.Counter
+	next                                                                UserService
+}
+
+func (mw *instrumentingMiddleware) Delete(ctx context.Context, id string) (err error) {
+	defer func() {
+		mw.deletedUsers.With(prometheus.Labels{"status": err2Status(err)}).Inc()
+	}()
+
+	err = mw.next.Delete(ctx, id)
+	return
+}
+
+func err2Status(err error) string {
+	if err != nil {
+		return "failed"
+	}
+	return "success"
+}
+
+func (mw *instrumentingMiddleware) Create(ctx context.Context, user model.RequestedUser) (id string, err error) {
+	defer func() {
+		mw.createdUsers.With(prometheus.Labels{"status": err2Status(err)}).Inc()
+	}()
+
+	id, err = mw.next.Create(ctx, user)
+	return
+}
+
+func (mw *instrumentingMiddleware) FindByID(ctx context.Context, id string) (user *model.User, err error) {
+	defer func() {
+		mw.fetchedUsers.With(prometheus.Labels{"status": err2Status(err)}).Inc()
+	}()
+
+	user, err = mw.next.FindByID(ctx, id)
+	return
+}
+
+func (mw *instrumentingMiddleware) FindByEMail(ctx context.Context, email string) (user *model.User, err error) {
+	defer func() {
+		mw.fetchedUsers.With(prometheus.Labels{"status": err2Status(err)}).Inc()
+	}()
+
+	user, err = mw.next.FindByEMail(ctx, email)
+	return
+}
+
+func (mw *instrumentingMiddleware) Update(ctx context.Context, id string, update model.UserUpdate) (user *model.User, err error) {
+	defer func() {
+		mw.updatedUsers.With(prometheus.Labels{"status": err2Status(err)}).Inc()
+	}()
+
+	user, err = mw.next.Update(ctx, id, update)
+	return
+}
+
+func (mw *instrumentingMiddleware) List(ctx context.Context, query model.UserQuery) (page *model.UserPage, err error) {
+	defer func() {
+		mw.listedUsers.With(prometheus.Labels{"status": err2Status(err)}).Inc()
+	}()
+
+	page, err = mw.next.List(ctx, query)
+	return
+}
+
+func (mw *instrumentingMiddleware) ChangePassword(ctx context.Context, id, currentPassword, newPassword string) (err error) {
+	defer func() {
+		mw.changedPasswords.With(prometheus.Labels{"status": err2Status(err)}).Inc()
+	}()
+
+	err = mw.next.ChangePassword(ctx, id, currentPassword, newPassword)
+	return
+}
+
+func (mw *instrumentingMiddleware) Authenticate(ctx context.Context, email, password string) (user *model.User, err error) {
+	defer func() {
+		mw.authentications.With(prometheus.Labels{"status": err2Status(err)}).Inc()
+	}()
+
+	user, err = mw.next.Authenticate(ctx, email, password)
+	return
+}
+
+func (mw *instrumentingMiddleware) Login(ctx context.Context, email, password string) (token *model.Token, err error) {
+	defer func() {
+		mw.logins.With(prometheus.Labels{"status": err2Status(err)}).Inc()
+		if errors.Is(err, ErrTooManyFailedLogins) {
+			mw.lockedOutLogins.Inc()
+		}
+	}()
+
+	token, err = mw.next.Login(ctx, email, password)
+	return
+}
+
+func (mw *instrumentingMiddleware) Refresh(ctx context.Context, refreshToken string) (token *model.Token, err error) {
+	defer func() {
+		mw.refreshes.With(prometheus.Labels{"status": err2Status(err)}).Inc()
+	}()
+
+	token, err = mw.next.Refresh(ctx, refreshToken)
+	return
+}
+
+func (mw *instrumentingMiddleware) Logout(ctx context.Context, refreshToken string) (err error) {
+	defer func() {
+		mw.logouts.With(prometheus.Labels{"status": err2Status(err)}).Inc()
+	}()
+
+	err = mw.next.Logout(ctx, refreshToken)
+	return
+}
+
+func (mw *instrumentingMiddleware) LogoutEverywhere(ctx context.Context, id string) (err error) {
+	defer func() {
+		mw.logouts.With(prometheus.Labels{"status": err2Status(err)}).Inc()
+	}()
+
+	err = mw.next.LogoutEverywhere(ctx, id)
+	return
+}
+
+func (mw *instrumentingMiddleware) AssignRole(ctx context.Context, id string, role model.Role) (user *model.User, err error) {
+	defer func() {
+		mw.assignedRoles.With(prometheus.Labels{"status": err2Status(err)}).Inc()
+	}()
+
+	user, err = mw.next.AssignRole(ctx, id, role)
+	return
+}
+
+func (mw *instrumentingMiddleware) VerifyEMail(ctx context.Context, id, token string) (err error) {
+	defer func() {
+		mw.verifiedEMails.With(prometheus.Labels{"status": err2Status(err)}).Inc()
+	}()
+
+	err = mw.next.VerifyEMail(ctx, id, token)
+	return
+}
+
+func (mw *instrumentingMiddleware) ResendVerification(ctx context.Context, id string) (err error) {
+	defer func() {
+		mw.resentVerifications.With(prometheus.Labels{"status": err2Status(err)}).Inc()
+	}()
+
+	err = mw.next.ResendVerification(ctx, id)
+	return
+}
+
+func (mw *instrumentingMiddleware) RequestPasswordReset(ctx context.Context, email string) (err error) {
+	defer func() {
+		mw.requestedResets.With(prometheus.Labels{"status": err2Status(err)}).Inc()
+	}()
+
+	err = mw.next.RequestPasswordReset(ctx, email)
+	return
+}
+
+func (mw *instrumentingMiddleware) ResetPassword(ctx context.Context, token, newPassword string) (err error) {
+	defer func() {
+		mw.resetPasswords.With(prometheus.Labels{"status": err2Status(err)}).Inc()
+	}()
+
+	err = mw.next.ResetPassword(ctx, token, newPassword)
+	return
+}
+
+func (mw *instrumentingMiddleware) Suspend(ctx context.Context, id string) (user *model.User, err error) {
+	defer func() {
+		mw.statusChanges.With(prometheus.Labels{"operation": "suspend", "status": err2Status(err)}).Inc()
+	}()
+
+	user, err = mw.next.Suspend(ctx, id)
+	return
+}
+
+func (mw *instrumentingMiddleware) Reactivate(ctx context.Context, id string) (user *model.User, err error) {
+	defer func() {
+		mw.statusChanges.With(prometheus.Labels{"operation": "reactivate", "status": err2Status(err)}).Inc()
+	}()
+
+	user, err = mw.next.Reactivate(ctx, id)
+	return
+}
+
+func (mw *instrumentingMiddleware) Lock(ctx context.Context, id string) (user *model.User, err error) {
+	defer func() {
+		mw.statusChanges.With(prometheus.Labels{"operation": "lock", "status": err2Status(err)}).Inc()
+	}()
+
+	user, err = mw.next.Lock(ctx, id)
+	return
+}
+
+func (mw *instrumentingMiddleware) Unlock(ctx context.Context, id string) (user *model.User, err error) {
+	defer func() {
+		mw.unlocks.With(prometheus.Labels{"status": err2Status(err)}).Inc()
+	}()
+
+	user, err = mw.next.Unlock(ctx, id)
+	return
+}
+
+func (mw *instrumentingMiddleware) EnrollMFA(ctx context.Context, id string) (enrollment *model.MFAEnrollment, err error) {
+	defer func() {
+		mw.mfaChanges.With(prometheus.Labels{"operation": "enroll", "status": err2Status(err)}).Inc()
+	}()
+
+	enrollment, err = mw.next.EnrollMFA(ctx, id)
+	return
+}
+
+func (mw *instrumentingMiddleware) ConfirmMFA(ctx context.Context, id, code string) (recoveryCodes []string, err error) {
+	defer func() {
+		mw.mfaChanges.With(prometheus.Labels{"operation": "confirm", "status": err2Status(err)}).Inc()
+	}()
+
+	recoveryCodes, err = mw.next.ConfirmMFA(ctx, id, code)
+	return
+}
+
+func (mw *instrumentingMiddleware) DisableMFA(ctx context.Context, id, code string) (err error) {
+	defer func() {
+		mw.mfaChanges.With(prometheus.Labels{"operation": "disable", "status": err2Status(err)}).Inc()
+	}()
+
+	err = mw.next.DisableMFA(ctx, id, code)
+	return
+}
+
+func (mw *instrumentingMiddleware) VerifyMFA(ctx context.Context, mfaToken, code string) (token *model.Token, err error) {
+	defer func() {
+		mw.mfaVerifications.With(prometheus.Labels{"status": err2Status(err)}).Inc()
+		if errors.Is(err, ErrTooManyFailedLogins) {
+			mw.lockedOutLogins.Inc()
+		}
+	}()
+
+	token, err = mw.next.VerifyMFA(ctx, mfaToken, code)
+	return
+}
+
+func (mw *instrumentingMiddleware) CreateAPIKey(
+	ctx context.Context,
+	id, name string,
+	scopes []model.Scope,
+	expiresAt time.Time,
+) (apiKey *model.APIKey, key string, err error) {
+	defer func() {
+		mw.apiKeyChanges.With(prometheus.Labels{"operation": "create", "status": err2Status(err)}).Inc()
+	}()
+
+	apiKey, key, err = mw.next.CreateAPIKey(ctx, id, name, scopes, expiresAt)
+	return
+}
+
+func (mw *instrumentingMiddleware) ListAPIKeys(ctx context.Context, id string) (keys []*model.APIKey, err error) {
+	defer func() {
+		mw.listedAPIKeys.With(prometheus.Labels{"status": err2Status(err)}).Inc()
+	}()
+
+	keys, err = mw.next.ListAPIKeys(ctx, id)
+	return
+}
+
+func (mw *instrumentingMiddleware) RevokeAPIKey(ctx context.Context, id, keyID string) (err error) {
+	defer func() {
+		mw.apiKeyChanges.With(prometheus.Labels{"operation": "revoke", "status": err2Status(err)}).Inc()
+	}()
+
+	err = mw.next.RevokeAPIKey(ctx, id, keyID)
+	return
+}
+
+func (mw *instrumentingMiddleware) AuthenticateAPIKey(ctx context.Context, key string) (principal *auth.Principal, err error) {
+	defer func() {
+		mw.apiKeyAuthentications.With(prometheus.Labels{"status": err2Status(err)}).Inc()
+	}()
+
+	principal, err = mw.next.AuthenticateAPIKey(ctx, key)
 	return
 }
@@ -0,0 +1,223 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PasswordHasher hashes and verifies passwords,
+// hashes are encoded together with the algorithm and the parameters they were created with
+type PasswordHasher interface {
+	// Hash returns the encoded hash of given password
+	Hash(password string) (string, error)
+	// Verify reports whether given password matches the encoded hash,
+	// hashes created by any of the supported algorithms can be verified
+	Verify(password, hash string) (bool, error)
+	// NeedsRehash reports whether given hash was created with another algorithm or other parameters
+	NeedsRehash(hash string) bool
+}
+
+var (
+	// ErrUnsupportedHash signals that a password hash has an unknown format
+	ErrUnsupportedHash = errors.New("unsupported password hash")
+)
+
+const (
+	// MinPasswordLength is the minimum count of characters of a password
+	MinPasswordLength = 10
+	// MaxPasswordLength is the maximum length of a password in bytes, bcrypt ignores everything beyond
+	MaxPasswordLength = 72
+)
+
+// Argon2idParams are the cost parameters of argon2id
+type Argon2idParams struct {
+	// Memory in KiB
+	Memory  uint32
+	Time    uint32
+	Threads uint8
+}
+
+// DefaultArgon2idParams follow the recommendation of RFC 9106 for memory constrained environments
+var DefaultArgon2idParams = Argon2idParams{
+	Memory:  64 * 1024,
+	Time:    3,
+	Threads: 4,
+}
+
+const (
+	argon2idSaltLength = 16
+	argon2idKeyLength  = 32
+)
+
+type argon2idHasher struct {
+	params Argon2idParams
+}
+
+// NewArgon2idHasher returns a PasswordHasher using argon2id with given parameters
+func NewArgon2idHasher(params Argon2idParams) PasswordHasher {
+	return &argon2idHasher{params}
+}
+
+// Hash satisfies PasswordHasher interface, the hash is encoded in the PHC string format:
+// $argon2id$v=19$m=<memory>,t=<time>,p=<threads>$<salt>$<key>
+func (h *argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, argon2idSaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.params.Time, h.params.Memory, h.params.Threads, argon2idKeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.params.Memory, h.params.Time, h.params.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// Verify satisfies PasswordHasher interface
+func (h *argon2idHasher) Verify(password, hash string) (bool, error) {
+	return verifyPassword(password, hash)
+}
+
+// NeedsRehash satisfies PasswordHasher interface
+func (h *argon2idHasher) NeedsRehash(hash string) bool {
+	params, _, _, err := decodeArgon2idHash(hash)
+	return err != nil || params != h.params
+}
+
+// decodeArgon2idHash decodes a hash created by argon2idHasher
+func decodeArgon2idHash(hash string) (params Argon2idParams, salt, key []byte, err error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, ErrUnsupportedHash
+	}
+
+	var version int
+	if _, err = fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, ErrUnsupportedHash
+	}
+
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Threads)
+	if err != nil {
+		return params, nil, nil, ErrUnsupportedHash
+	}
+
+	if salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return params, nil, nil, ErrUnsupportedHash
+	}
+	if key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(key) == 0 {
+		return params, nil, nil, ErrUnsupportedHash
+	}
+
+	return params, salt, key, nil
+}
+
+type bcryptHasher struct {
+	cost int
+}
+
+// NewBcryptHasher returns a PasswordHasher using bcrypt with given cost
+func NewBcryptHasher(cost int) PasswordHasher {
+	return &bcryptHasher{cost}
+}
+
+// Hash satisfies PasswordHasher interface
+func (h *bcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.cost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	return string(hash), nil
+}
+
+// Verify satisfies PasswordHasher interface
+func (h *bcryptHasher) Verify(password, hash string) (bool, error) {
+	return verifyPassword(password, hash)
+}
+
+// NeedsRehash satisfies PasswordHasher interface
+func (h *bcryptHasher) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != h.cost
+}
+
+// verifyPassword verifies given password against a hash of any supported algorithm,
+// so users keep being able to log in after the algorithm has been changed
+func verifyPassword(password, hash string) (bool, error) {
+	if strings.HasPrefix(hash, "$argon2id$") {
+		params, salt, key, err := decodeArgon2idHash(hash)
+		if err != nil {
+			return false, err
+		}
+
+		actual := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, uint32(len(key)))
+		return subtle.ConstantTimeCompare(key, actual) == 1, nil
+	}
+
+	if strings.HasPrefix(hash, "$2") {
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+		if err == nil {
+			return true, nil
+		}
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		return false, ErrUnsupportedHash
+	}
+
+	return false, ErrUnsupportedHash
+}
+
+// validatePassword checks the strength of a password,
+// the email address and the name of its user must not be part of it
+func validatePassword(password, email, name string) *ValidationError {
+	invalid := func(reason string) *ValidationError {
+		return &ValidationError{Name: "password", Reason: reason}
+	}
+
+	if utf8.RuneCountInString(password) < MinPasswordLength {
+		return invalid(fmt.Sprintf("password must contain at least %d characters", MinPasswordLength))
+	}
+
+	if len(password) > MaxPasswordLength {
+		return invalid(fmt.Sprintf("password must not be longer than %d bytes", MaxPasswordLength))
+	}
+
+	var lower, upper, digit, other int
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			other = 1
+		}
+	}
+
+	if lower+upper+digit+other < 3 {
+		return invalid("password must contain at least three of lower case letters, upper case letters, digits and other characters")
+	}
+
+	lowered := strings.ToLower(password)
+	for _, s := range []string{email, strings.SplitN(email, "@", 2)[0], name} {
+		if s = strings.ToLower(strings.TrimSpace(s)); len(s) >= 3 && strings.Contains(lowered, s) {
+			return invalid("password must not contain the email address or the name")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,94 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPasswordHashers(t *testing.T) {
+	hashers := map[string]PasswordHasher{
+		"argon2id": NewArgon2idHasher(testArgon2idParams),
+		"bcrypt":   NewBcryptHasher(4),
+	}
+
+	for name, hasher := range hashers {
+		t.Run(name, func(t *testing.T) {
+			a := assert.New(t)
+
+			hash, err := hasher.Hash("correct-Horse-7")
+			a.Nil(err)
+			a.False(hasher.NeedsRehash(hash))
+
+			other, err := hasher.Hash("correct-Horse-7")
+			a.Nil(err)
+			a.NotEqual(hash, other, "every hash has its own salt")
+
+			ok, err := hasher.Verify("correct-Horse-7", hash)
+			a.Nil(err)
+			a.True(ok)
+
+			ok, err = hasher.Verify("correct-Horse-8", hash)
+			a.Nil(err)
+			a.False(ok)
+
+			// hashes of the other hashers can be verified but have to be upgraded
+			for otherName, otherHasher := range hashers {
+				if otherName == name {
+					continue
+				}
+
+				hash, err = otherHasher.Hash("correct-Horse-7")
+				a.Nil(err)
+				a.True(hasher.NeedsRehash(hash))
+
+				ok, err = hasher.Verify("correct-Horse-7", hash)
+				a.Nil(err)
+				a.True(ok)
+			}
+
+			for _, hash := range []string{"", "plain", "$argon2id$v=19$m=64,t=1$c2FsdA$a2V5", "$2a$04$short"} {
+				_, err = hasher.Verify("correct-Horse-7", hash)
+				a.ErrorIs(err, ErrUnsupportedHash, hash)
+			}
+		})
+	}
+}
+
+func TestArgon2idHasherParams(t *testing.T) {
+	a := assert.New(t)
+
+	hash, err := NewArgon2idHasher(Argon2idParams{Memory: 64, Time: 2, Threads: 1}).Hash("correct-Horse-7")
+	a.Nil(err)
+	a.True(strings.HasPrefix(hash, "$argon2id$v=19$m=64,t=2,p=1$"), hash)
+
+	a.False(NewArgon2idHasher(Argon2idParams{Memory: 64, Time: 2, Threads: 1}).NeedsRehash(hash))
+	a.True(NewArgon2idHasher(Argon2idParams{Memory: 64, Time: 3, Threads: 1}).NeedsRehash(hash))
+	a.True(NewBcryptHasher(4).NeedsRehash(hash))
+}
+
+func TestValidatePassword(t *testing.T) {
+	for _, tt := range []struct {
+		password string
+		valid    bool
+	}{
+		{"correct-Horse-7", true},
+		{"Tr0ub4dor&3", true},
+		{"ünïcödé-Pässwörd", true},
+		{"short-1A", false},
+		{"alllowercaseletters", false},
+		{"lowercase-and-symbols", false},
+		{"John-Smith-7", false},
+		{"JOHN.SMITH@example.com", false},
+		{"Smith-Horse-7", false},
+		{strings.Repeat("aA1-", 19), false},
+	} {
+		err := validatePassword(tt.password, "john.smith@example.com", "Smith")
+		if tt.valid {
+			assert.Nil(t, err, tt.password)
+		} else if assert.NotNil(t, err, tt.password) {
+			assert.Equal(t, "password", err.Name)
+		}
+	}
+}
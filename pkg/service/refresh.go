@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/status-owl/user-service/pkg/model"
+	"github.com/status-owl/user-service/pkg/store"
+)
+
+// DefaultRefreshTokenTTL is the lifetime of a refresh token if not configured otherwise
+const DefaultRefreshTokenTTL = 30 * 24 * time.Hour
+
+const refreshTokenLength = 32
+
+// newRefreshToken returns a random url safe token
+func newRefreshToken() (string, error) {
+	b := make([]byte, refreshTokenLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashRefreshToken returns the id a refresh token is stored with,
+// tokens can't be restored from a leaked store
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// issueTokens issues an access token and a refresh token belonging to given family
+func (s *userService) issueTokens(ctx context.Context, user *model.User, familyID string) (*model.Token, error) {
+	token, err := s.issuer.Issue(user)
+	if err != nil {
+		return nil, err
+	}
+
+	if token.RefreshToken, err = newRefreshToken(); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	err = s.tokenStore.Create(ctx, &model.RefreshToken{
+		ID:        hashRefreshToken(token.RefreshToken),
+		UserID:    user.ID,
+		FamilyID:  familyID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.refreshTTL),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+func (s *userService) Refresh(ctx context.Context, refreshToken string) (*model.Token, error) {
+	id := hashRefreshToken(refreshToken)
+
+	stored, err := s.tokenStore.FindByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, store.ErrTokenNotFound) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+
+	now := time.Now()
+	if !now.Before(stored.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	// marking the token as used is atomic, only one of concurrent refreshes succeeds
+	if err = s.tokenStore.Use(ctx, id, now); err != nil {
+		switch {
+		case errors.Is(err, store.ErrTokenUsed):
+			// either the token or its successor has been stolen, the whole family is revoked
+			if _, err = s.tokenStore.DeleteFamily(ctx, stored.FamilyID); err != nil {
+				return nil, err
+			}
+			return nil, ErrRefreshTokenReused
+		case errors.Is(err, store.ErrTokenNotFound):
+			// revoked in the meantime
+			return nil, ErrInvalidRefreshToken
+		default:
+			return nil, err
+		}
+	}
+
+	user, err := s.userStore.FindByID(ctx, stored.UserID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			if _, err = s.tokenStore.DeleteByUser(ctx, stored.UserID); err != nil {
+				return nil, err
+			}
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+
+	if err = checkCanLogIn(user); err != nil {
+		return nil, err
+	}
+
+	return s.issueTokens(ctx, user, stored.FamilyID)
+}
+
+func (s *userService) Logout(ctx context.Context, refreshToken string) error {
+	stored, err := s.tokenStore.FindByID(ctx, hashRefreshToken(refreshToken))
+	if err != nil {
+		// logging out twice is fine
+		if errors.Is(err, store.ErrTokenNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	_, err = s.tokenStore.DeleteFamily(ctx, stored.FamilyID)
+	return err
+}
+
+func (s *userService) LogoutEverywhere(ctx context.Context, id string) error {
+	if _, err := s.userStore.FindByID(ctx, id); err != nil {
+		return translateStoreError(err)
+	}
+
+	_, err := s.tokenStore.DeleteByUser(ctx, id)
+	return err
+}
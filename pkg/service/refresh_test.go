@@ -0,0 +1,148 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/status-owl/user-service/pkg/model"
+)
+
+// mustLogin creates a user with a password and logs it in
+func mustLogin(t *testing.T, svc *userService) (string, *model.Token) {
+	t.Helper()
+	ctx := context.Background()
+
+	id, err := svc.Create(ctx, model.RequestedUser{EMail: "john@example.com", Name: "John", Password: "correct-Horse-7"})
+	if err != nil {
+		t.Fatalf("failed to create user: %s", err.Error())
+	}
+
+	token, err := svc.Login(ctx, "john@example.com", "correct-Horse-7")
+	if err != nil {
+		t.Fatalf("failed to log in: %s", err.Error())
+	}
+
+	return id, token
+}
+
+func TestRefresh(t *testing.T) {
+	a := assert.New(t)
+	svc := newTestService()
+	ctx := context.Background()
+
+	id, token := mustLogin(t, svc)
+
+	refreshed, err := svc.Refresh(ctx, token.RefreshToken)
+	a.Nil(err)
+	a.Equal(id+":"+string(model.Admin), refreshed.AccessToken, "the first user is an admin")
+	a.NotEmpty(refreshed.RefreshToken)
+	a.NotEqual(token.RefreshToken, refreshed.RefreshToken, "refresh tokens are rotated")
+
+	// the new refresh token can be used as well
+	_, err = svc.Refresh(ctx, refreshed.RefreshToken)
+	a.Nil(err)
+
+	_, err = svc.Refresh(ctx, "unknown")
+	a.ErrorIs(err, ErrInvalidRefreshToken)
+}
+
+func TestRefreshReuse(t *testing.T) {
+	a := assert.New(t)
+	svc := newTestService()
+	ctx := context.Background()
+
+	_, token := mustLogin(t, svc)
+
+	// another login isn't affected by the reuse
+	other, err := svc.Login(ctx, "john@example.com", "correct-Horse-7")
+	a.Nil(err)
+
+	refreshed, err := svc.Refresh(ctx, token.RefreshToken)
+	a.Nil(err)
+
+	_, err = svc.Refresh(ctx, token.RefreshToken)
+	a.ErrorIs(err, ErrRefreshTokenReused)
+
+	// the whole family has been revoked
+	_, err = svc.Refresh(ctx, refreshed.RefreshToken)
+	a.ErrorIs(err, ErrInvalidRefreshToken)
+
+	_, err = svc.Refresh(ctx, other.RefreshToken)
+	a.Nil(err)
+}
+
+func TestRefreshExpired(t *testing.T) {
+	svc := newTestService()
+	svc.refreshTTL = -time.Second
+
+	_, token := mustLogin(t, svc)
+
+	_, err := svc.Refresh(context.Background(), token.RefreshToken)
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+}
+
+func TestRefreshDeletedUser(t *testing.T) {
+	svc := newTestService()
+	ctx := context.Background()
+
+	// the first user becomes the admin which can't be deleted
+	_, err := svc.Create(ctx, model.RequestedUser{EMail: "mary@example.com", Name: "Mary"})
+	assert.Nil(t, err)
+
+	id, token := mustLogin(t, svc)
+	assert.Nil(t, svc.Delete(ctx, id))
+
+	_, err = svc.Refresh(ctx, token.RefreshToken)
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+}
+
+func TestLogout(t *testing.T) {
+	a := assert.New(t)
+	svc := newTestService()
+	ctx := context.Background()
+
+	_, token := mustLogin(t, svc)
+	refreshed, err := svc.Refresh(ctx, token.RefreshToken)
+	a.Nil(err)
+
+	// logging out with an already used token ends the session as well
+	a.Nil(svc.Logout(ctx, token.RefreshToken))
+	a.Nil(svc.Logout(ctx, token.RefreshToken), "logging out twice succeeds")
+
+	_, err = svc.Refresh(ctx, refreshed.RefreshToken)
+	a.ErrorIs(err, ErrInvalidRefreshToken)
+}
+
+func TestLogoutEverywhere(t *testing.T) {
+	a := assert.New(t)
+	svc := newTestService()
+	ctx := context.Background()
+
+	id, first := mustLogin(t, svc)
+	second, err := svc.Login(ctx, "john@example.com", "correct-Horse-7")
+	a.Nil(err)
+
+	a.Nil(svc.LogoutEverywhere(ctx, id))
+
+	for _, token := range []*model.Token{first, second} {
+		_, err = svc.Refresh(ctx, token.RefreshToken)
+		a.ErrorIs(err, ErrInvalidRefreshToken)
+	}
+
+	a.ErrorIs(svc.LogoutEverywhere(ctx, "123"), ErrUserNotFound)
+}
+
+func TestChangePasswordRevokesRefreshTokens(t *testing.T) {
+	a := assert.New(t)
+	svc := newTestService()
+	ctx := context.Background()
+
+	id, token := mustLogin(t, svc)
+	a.Nil(svc.ChangePassword(ctx, id, "correct-Horse-7", "battery-Staple-8"))
+
+	_, err := svc.Refresh(ctx, token.RefreshToken)
+	a.ErrorIs(err, ErrInvalidRefreshToken)
+}
@@ -0,0 +1,152 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/status-owl/user-service/pkg/mail"
+	"github.com/status-owl/user-service/pkg/model"
+	"github.com/status-owl/user-service/pkg/store"
+)
+
+const (
+	// PasswordResetTokenTTL is the lifetime of the tokens resetting passwords
+	PasswordResetTokenTTL = time.Hour
+	// PasswordResetInterval is the minimum time between two password reset mails to the same user
+	PasswordResetInterval = time.Minute
+	// passwordResetMailTimeout limits issuing and mailing a password reset token including the retries of the mailer
+	passwordResetMailTimeout = time.Minute
+)
+
+func (s *userService) RequestPasswordReset(ctx context.Context, email string) error {
+	user, err := s.userStore.FindByEMail(ctx, email)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	// throttled requests succeed as well, failing them would reveal the address is registered
+	if !s.passwordReset.allow(user.ID) {
+		return nil
+	}
+
+	// so would the time it takes to issue and mail the token, it's done in the background
+	// and failures are logged only, the user can request another mail
+	s.background.Add(1)
+	go func() {
+		defer s.background.Done()
+
+		// the context of the request ends once it has been answered
+		ctx, cancel := context.WithTimeout(context.Background(), passwordResetMailTimeout)
+		defer cancel()
+
+		if err := s.mailPasswordReset(ctx, user); err != nil {
+			s.logger.Error().
+				Err(err).
+				Str("id", user.ID).
+				Msg("failed to send password reset mail")
+		}
+	}()
+
+	return nil
+}
+
+// mailPasswordReset issues a password reset token for given user and mails it,
+// tokens issued before are revoked
+func (s *userService) mailPasswordReset(ctx context.Context, user *model.User) error {
+	token, err := newRefreshToken()
+	if err != nil {
+		return err
+	}
+
+	if _, err = s.resetStore.DeleteByUser(ctx, user.ID); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	err = s.resetStore.Create(ctx, &model.PasswordResetToken{
+		ID:        hashRefreshToken(token),
+		UserID:    user.ID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(PasswordResetTokenTTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	// users have no preferred locale yet
+	msg, err := s.templates.Render("password_reset", mail.DefaultLocale, struct {
+		Name         string
+		Token        string
+		ValidMinutes int
+	}{user.Name, token, int(PasswordResetTokenTTL / time.Minute)})
+	if err != nil {
+		return err
+	}
+
+	msg.To = user.EMail
+	return s.mailer.Send(ctx, msg)
+}
+
+func (s *userService) ResetPassword(ctx context.Context, token, newPassword string) error {
+	id := hashRefreshToken(token)
+
+	stored, err := s.resetStore.FindByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, store.ErrResetTokenNotFound) {
+			return ErrInvalidResetToken
+		}
+		return err
+	}
+
+	if !time.Now().Before(stored.ExpiresAt) {
+		return ErrInvalidResetToken
+	}
+
+	user, err := s.userStore.FindByID(ctx, stored.UserID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return ErrInvalidResetToken
+		}
+		return err
+	}
+
+	// the token is kept for another try if the password is too weak
+	if perr := validatePassword(newPassword, user.EMail, user.Name); perr != nil {
+		return &ValidationErrors{Errors: []ValidationError{*perr}}
+	}
+
+	if user.PasswordHash, err = s.hasher.Hash(newPassword); err != nil {
+		return err
+	}
+
+	// consuming the token is atomic, only one of concurrent resets succeeds
+	if _, err = s.resetStore.Consume(ctx, id); err != nil {
+		if errors.Is(err, store.ErrResetTokenNotFound) {
+			return ErrInvalidResetToken
+		}
+		return err
+	}
+
+	if err = s.userStore.Update(ctx, user); err != nil {
+		return translateStoreError(err)
+	}
+
+	// owning the mailbox is proof enough, the user doesn't have to wait for the lockout to end
+	s.resetFailedLogins(ctx, user)
+
+	// sessions started with the old password must not outlive it, resetting it is how owners
+	// recover their accounts, so neither must API keys created by someone who had taken it over
+	if _, err = s.tokenStore.DeleteByUser(ctx, user.ID); err != nil {
+		return err
+	}
+	if _, err = s.apiKeyStore.DeleteByUser(ctx, user.ID); err != nil {
+		return err
+	}
+
+	_, err = s.resetStore.DeleteByUser(ctx, user.ID)
+	return err
+}
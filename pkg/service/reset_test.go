@@ -0,0 +1,184 @@
+package service
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/status-owl/user-service/pkg/mail"
+	"github.com/status-owl/user-service/pkg/model"
+)
+
+// resetTokenPattern matches the url safe encoded random tokens
+var resetTokenPattern = regexp.MustCompile(`[A-Za-z0-9_-]{43}`)
+
+// lastMailedToken returns the token contained in the last mail sent
+func lastMailedToken(t *testing.T, svc *userService) string {
+	t.Helper()
+
+	sent := sentMails(svc)
+	if len(sent) == 0 {
+		t.Fatal("no mail has been sent")
+	}
+
+	token := resetTokenPattern.FindString(sent[len(sent)-1].Text)
+	if token == "" {
+		t.Fatal("the last mail contains no token")
+	}
+
+	return token
+}
+
+func TestResetPassword(t *testing.T) {
+	a := assert.New(t)
+	svc := newTestService()
+	ctx := context.Background()
+
+	_, session := mustLogin(t, svc)
+
+	a.Nil(svc.RequestPasswordReset(ctx, "john@example.com"))
+	sent := sentMails(svc)
+	a.Equal("john@example.com", sent[len(sent)-1].To)
+	token := lastMailedToken(t, svc)
+
+	var verr *ValidationErrors
+	a.ErrorAs(svc.ResetPassword(ctx, token, "weak"), &verr)
+
+	// the token survives a rejected password
+	a.Nil(svc.ResetPassword(ctx, token, "battery-Staple-8"))
+	a.ErrorIs(svc.ResetPassword(ctx, token, "battery-Staple-9"), ErrInvalidResetToken, "tokens are single use")
+
+	_, err := svc.Login(ctx, "john@example.com", "correct-Horse-7")
+	a.ErrorIs(err, ErrInvalidCredentials)
+	_, err = svc.Login(ctx, "john@example.com", "battery-Staple-8")
+	a.Nil(err)
+
+	_, err = svc.Refresh(ctx, session.RefreshToken)
+	a.ErrorIs(err, ErrInvalidRefreshToken, "existing sessions are revoked")
+
+	a.ErrorIs(svc.ResetPassword(ctx, "forged", "battery-Staple-9"), ErrInvalidResetToken)
+}
+
+func TestRequestPasswordResetUnknownEMail(t *testing.T) {
+	svc := newTestService()
+
+	assert.Nil(t, svc.RequestPasswordReset(context.Background(), "nobody@example.com"))
+	assert.Empty(t, sentMails(svc))
+}
+
+func TestRequestPasswordResetRevokesPreviousTokens(t *testing.T) {
+	a := assert.New(t)
+	svc := newTestService()
+	ctx := context.Background()
+
+	now := time.Now()
+	svc.passwordReset.now = func() time.Time { return now }
+
+	mustLogin(t, svc)
+
+	a.Nil(svc.RequestPasswordReset(ctx, "john@example.com"))
+	first := lastMailedToken(t, svc)
+	count := len(sentMails(svc))
+
+	// throttled requests don't fail, they just don't send a mail
+	a.Nil(svc.RequestPasswordReset(ctx, "john@example.com"))
+	a.Len(sentMails(svc), count)
+
+	now = now.Add(PasswordResetInterval)
+	a.Nil(svc.RequestPasswordReset(ctx, "john@example.com"))
+	second := lastMailedToken(t, svc)
+	a.NotEqual(first, second)
+
+	a.ErrorIs(svc.ResetPassword(ctx, first, "battery-Staple-8"), ErrInvalidResetToken)
+	a.Nil(svc.ResetPassword(ctx, second, "battery-Staple-8"))
+}
+
+// blockingMailer sends the messages once it's released
+type blockingMailer struct {
+	release chan struct{}
+	sent    chan *mail.Message
+}
+
+func (m *blockingMailer) Send(_ context.Context, msg *mail.Message) error {
+	<-m.release
+	m.sent <- msg
+	return nil
+}
+
+func TestRequestPasswordResetDoesNotWaitForTheMail(t *testing.T) {
+	a := assert.New(t)
+	svc := newTestService()
+	ctx := context.Background()
+
+	mustLogin(t, svc)
+	mailer := &blockingMailer{release: make(chan struct{}), sent: make(chan *mail.Message, 1)}
+	svc.mailer = mailer
+
+	// requests for registered addresses must not take longer than the ones for unknown addresses
+	done := make(chan error)
+	go func() { done <- svc.RequestPasswordReset(ctx, "john@example.com") }()
+
+	select {
+	case err := <-done:
+		a.Nil(err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the request waits for the mail to be sent")
+	}
+
+	close(mailer.release)
+	svc.Close()
+	if a.Len(mailer.sent, 1) {
+		a.Equal("john@example.com", (<-mailer.sent).To)
+	}
+}
+
+func TestCloseWaitsForTheMails(t *testing.T) {
+	a := assert.New(t)
+	svc := newTestService()
+	ctx := context.Background()
+
+	mustLogin(t, svc)
+	mailer := &blockingMailer{release: make(chan struct{}), sent: make(chan *mail.Message, 1)}
+	svc.mailer = mailer
+	a.Nil(svc.RequestPasswordReset(ctx, "john@example.com"))
+
+	closed := make(chan struct{})
+	go func() {
+		(&closingService{UserService: svc, base: svc}).Close()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+		t.Fatal("the service is closed before the mail is sent")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(mailer.release)
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the service isn't closed once the mail is sent")
+	}
+	a.Len(mailer.sent, 1)
+}
+
+func TestResetPasswordExpired(t *testing.T) {
+	a := assert.New(t)
+	svc := newTestService()
+	ctx := context.Background()
+
+	id, _ := mustLogin(t, svc)
+	a.Nil(svc.mailPasswordReset(ctx, &model.User{ID: id, Name: "John", EMail: "john@example.com"}))
+	token := lastMailedToken(t, svc)
+
+	stored, err := svc.resetStore.Consume(ctx, hashRefreshToken(token))
+	a.Nil(err)
+	stored.ExpiresAt = time.Now().Add(-time.Second)
+	a.Nil(svc.resetStore.Create(ctx, stored))
+
+	a.ErrorIs(svc.ResetPassword(ctx, token, "battery-Staple-8"), ErrInvalidResetToken)
+}
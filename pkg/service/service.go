@@ -5,8 +5,12 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/rs/zerolog"
+	"github.com/status-owl/user-service/pkg/auth"
+	"github.com/status-owl/user-service/pkg/mail"
 	"github.com/status-owl/user-service/pkg/model"
 	"github.com/status-owl/user-service/pkg/store"
 )
@@ -15,6 +19,73 @@ type UserService interface {
 	Create(ctx context.Context, user model.RequestedUser) (string, error)
 	Delete(ctx context.Context, id string) error
 	FindByID(ctx context.Context, id string) (*model.User, error)
+	// FindByEMail returns the user with given email address
+	FindByEMail(ctx context.Context, email string) (*model.User, error)
+	Update(ctx context.Context, id string, update model.UserUpdate) (*model.User, error)
+	List(ctx context.Context, query model.UserQuery) (*model.UserPage, error)
+	// ChangePassword replaces the password of a user, the current one has to be given,
+	// and revokes all refresh tokens and API keys of the user
+	ChangePassword(ctx context.Context, id, currentPassword, newPassword string) error
+	// Authenticate returns the user with given email address if the password matches
+	Authenticate(ctx context.Context, email, password string) (*model.User, error)
+	// Login authenticates a user and issues an access token together with a refresh token
+	Login(ctx context.Context, email, password string) (*model.Token, error)
+	// Refresh exchanges a refresh token for a new access token and a new refresh token,
+	// reusing a refresh token revokes all tokens descending from the same login
+	Refresh(ctx context.Context, refreshToken string) (*model.Token, error)
+	// Logout revokes the refresh token and all tokens descending from the same login
+	Logout(ctx context.Context, refreshToken string) error
+	// LogoutEverywhere revokes all refresh tokens of a user
+	LogoutEverywhere(ctx context.Context, id string) error
+	// AssignRole changes the role of a user
+	AssignRole(ctx context.Context, id string, role model.Role) (*model.User, error)
+	// VerifyEMail confirms the email address of a user with the token mailed to it
+	VerifyEMail(ctx context.Context, id, token string) error
+	// ResendVerification mails a new verification token to a user with an unverified email address
+	ResendVerification(ctx context.Context, id string) error
+	// RequestPasswordReset mails a single use password reset token to the user with given email address,
+	// it succeeds for unknown addresses as well, so the registered ones can't be told apart
+	RequestPasswordReset(ctx context.Context, email string) error
+	// ResetPassword replaces the password of the user a reset token has been mailed to
+	// and revokes all refresh tokens and API keys of the user
+	ResetPassword(ctx context.Context, token, newPassword string) error
+	// Suspend refuses the login of a user until it's reactivated and revokes its refresh tokens
+	Suspend(ctx context.Context, id string) (*model.User, error)
+	// Reactivate allows a suspended or locked user to log in again
+	Reactivate(ctx context.Context, id string) (*model.User, error)
+	// Lock refuses the login of a user for security reasons until it's reactivated and revokes its refresh tokens
+	Lock(ctx context.Context, id string) (*model.User, error)
+	// Unlock ends the lockout of a user caused by failed logins, clears their count and lifts a Lock
+	Unlock(ctx context.Context, id string) (*model.User, error)
+	// EnrollMFA generates a new authenticator secret for a user, it's pending until confirmed
+	EnrollMFA(ctx context.Context, id string) (*model.MFAEnrollment, error)
+	// ConfirmMFA enables multi-factor authentication with a code of the pending authenticator,
+	// returns the recovery codes and revokes all refresh tokens of the user
+	ConfirmMFA(ctx context.Context, id, code string) ([]string, error)
+	// DisableMFA removes the authenticator and the recovery codes of a user, a code of either has to be given
+	DisableMFA(ctx context.Context, id, code string) error
+	// VerifyMFA exchanges the token returned by Login together with a code of the user's authenticator
+	// or a recovery code for an access token and a refresh token
+	VerifyMFA(ctx context.Context, mfaToken, code string) (*model.Token, error)
+	// CreateAPIKey issues a personal API key for a user and returns it together with the key itself,
+	// which isn't shown again. Keys without scopes are granted all, keys without expiry never expire
+	CreateAPIKey(ctx context.Context, id, name string, scopes []model.Scope, expiresAt time.Time) (*model.APIKey, string, error)
+	// ListAPIKeys returns the API keys of a user, the oldest first
+	ListAPIKeys(ctx context.Context, id string) ([]*model.APIKey, error)
+	// RevokeAPIKey deletes the API key with given id of a user
+	RevokeAPIKey(ctx context.Context, id, keyID string) error
+	// AuthenticateAPIKey returns the caller a personal API key has been issued to
+	AuthenticateAPIKey(ctx context.Context, key string) (*auth.Principal, error)
+}
+
+// TokenIssuer issues access tokens for authenticated users,
+// the tokens confirming their email addresses and the ones challenging them for a second factor
+type TokenIssuer interface {
+	Issue(user *model.User) (*model.Token, error)
+	IssueEMailVerification(user *model.User, ttl time.Duration) (string, error)
+	VerifyEMailVerification(token string) (*auth.Claims, error)
+	IssueMFAChallenge(user *model.User, ttl time.Duration) (string, error)
+	VerifyMFAChallenge(token string) (*auth.Claims, error)
 }
 
 //go:generate mockgen -source service.go -destination mock.go -package $GOPACKAGE
@@ -22,8 +93,67 @@ type UserService interface {
 var (
 	ErrEmailInUse   = errors.New("user with requested email address already exists")
 	ErrUserNotFound = errors.New("user not found")
+	// ErrVersionMismatch signals that a user has another version than the one the changes are based on
+	ErrVersionMismatch = errors.New("user has been modified since the requested version")
+	// ErrConcurrentModification signals that a user has been modified while being updated
+	ErrConcurrentModification = errors.New("user has been modified concurrently")
+	// ErrInvalidCredentials signals that a user doesn't exist, has no password or the password doesn't match
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	// ErrInvalidRefreshToken signals that a refresh token doesn't exist, has expired or has been revoked
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	// ErrRefreshTokenReused signals that a refresh token has been used twice, all tokens of its family are revoked
+	ErrRefreshTokenReused = errors.New("refresh token has already been used")
+	// ErrUnauthenticated signals that an operation requires an authenticated caller
+	ErrUnauthenticated = errors.New("authentication required")
+	// ErrForbidden signals that the caller isn't allowed to perform an operation
+	ErrForbidden = errors.New("operation not allowed")
+	// ErrLastAdmin signals that an operation would delete or demote the last admin
+	ErrLastAdmin = errors.New("last admin can't be removed")
+	// ErrInvalidVerificationToken signals that an email verification token is invalid, expired
+	// or belongs to another user or email address
+	ErrInvalidVerificationToken = errors.New("invalid verification token")
+	// ErrEMailAlreadyVerified signals that the email address of a user has been verified already
+	ErrEMailAlreadyVerified = errors.New("email address has already been verified")
+	// ErrTooManyRequests signals that an operation has been requested too often, it can be retried later
+	ErrTooManyRequests = errors.New("too many requests")
+	// ErrInvalidResetToken signals that a password reset token doesn't exist, has expired or has been used
+	ErrInvalidResetToken = errors.New("invalid password reset token")
+	// ErrUserSuspended signals that a suspended user tried to log in
+	ErrUserSuspended = errors.New("user has been suspended")
+	// ErrUserLocked signals that a locked user tried to log in
+	ErrUserLocked = errors.New("user has been locked")
+	// ErrAdminNotSuspendable signals that an admin was about to be suspended or locked,
+	// the role has to be revoked first, so the last admin can't lock everybody out
+	ErrAdminNotSuspendable = errors.New("admins can't be suspended or locked")
+	// ErrTooManyFailedLogins signals that the user or the source address is locked out after too many failed logins
+	ErrTooManyFailedLogins = errors.New("too many failed logins")
+	// ErrMFARequired signals that an admin has to enable multi-factor authentication
+	// and log in with it before performing an operation reserved to admins
+	ErrMFARequired = errors.New("admins have to enable multi-factor authentication")
+	// ErrMFAAlreadyEnabled signals that a user tried to enroll another authenticator
+	ErrMFAAlreadyEnabled = errors.New("multi-factor authentication has already been enabled")
+	// ErrMFANotEnrolled signals that a user has no authenticator to confirm or disable
+	ErrMFANotEnrolled = errors.New("no authenticator has been enrolled")
+	// ErrInvalidMFACode signals that a code neither matches the user's authenticator nor a recovery code
+	ErrInvalidMFACode = errors.New("invalid multi-factor authentication code")
+	// ErrInvalidMFAToken signals that the token returned by a login is invalid or has expired
+	ErrInvalidMFAToken = errors.New("invalid multi-factor authentication token")
+	// ErrInvalidAPIKey signals that an API key doesn't exist, has expired or has been revoked
+	ErrInvalidAPIKey = errors.New("invalid api key")
+	// ErrAPIKeyNotFound signals that a user has no API key with given id
+	ErrAPIKeyNotFound = errors.New("api key not found")
 )
 
+// TransitionError signals that a user can't change from its current status to the requested one
+type TransitionError struct {
+	From, To model.Status
+}
+
+// Error satisfies error interface
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("user can't change from status %s to %s", e.From, e.To)
+}
+
 type ValidationError struct {
 	Name, Reason string
 }
@@ -59,23 +189,104 @@ func (errors *ValidationErrors) Error() string {
 
 func NewService(
 	store store.UserStore,
+	tokenStore store.RefreshTokenStore,
+	resetStore store.PasswordResetTokenStore,
+	apiKeyStore store.APIKeyStore,
+	hasher PasswordHasher,
+	issuer TokenIssuer,
+	mailer mail.Mailer,
+	refreshTTL time.Duration,
+	lockoutPolicy LockoutPolicy,
 	logger zerolog.Logger,
-) UserService {
+) Service {
+	base := &userService{
+		userStore:          store,
+		tokenStore:         tokenStore,
+		resetStore:         resetStore,
+		apiKeyStore:        apiKeyStore,
+		hasher:             hasher,
+		issuer:             issuer,
+		mailer:             mailer,
+		templates:          mail.DefaultTemplates(),
+		verificationResend: newThrottle(VerificationResendInterval),
+		passwordReset:      newThrottle(PasswordResetInterval),
+		refreshTTL:         refreshTTL,
+		lockout:            newLockout(lockoutPolicy),
+		logger:             logger,
+	}
+
 	var svc UserService
 	{
-		svc = &userService{store}
+		svc = base
+		svc = AuthorizationMiddleware()(svc)
 		svc = LoggingMiddleware(logger)(svc)
 		svc = InstrumentingMiddleware()(svc)
 	}
-	return svc
+	return &closingService{UserService: svc, base: base}
+}
+
+// Service is the UserService returned by NewService, it runs work in the background
+// like mailing password reset tokens, which has to be waited for on shutdown
+type Service interface {
+	UserService
+	// Close waits for the work started in the background to finish,
+	// it must be called once no more calls are made to the service
+	Close()
+}
+
+// closingService waits for the background work of the service the middlewares are wrapped around
+type closingService struct {
+	UserService
+	base *userService
+}
+
+func (s *closingService) Close() {
+	s.base.Close()
 }
 
 type userService struct {
-	userStore store.UserStore
+	userStore   store.UserStore
+	tokenStore  store.RefreshTokenStore
+	resetStore  store.PasswordResetTokenStore
+	apiKeyStore store.APIKeyStore
+	hasher      PasswordHasher
+	issuer      TokenIssuer
+	mailer      mail.Mailer
+	templates   *mail.Templates
+	// verificationResend limits the verification mails per user
+	verificationResend *throttle
+	// passwordReset limits the password reset mails per user
+	passwordReset *throttle
+	// refreshTTL is the lifetime of a refresh token
+	refreshTTL time.Duration
+	// lockout tracks the failed logins per source address and decides on lockouts
+	lockout *lockout
+	// logger reports failures which don't fail the operation
+	logger zerolog.Logger
+	// background tracks the work outliving the operations it was started by
+	background sync.WaitGroup
+}
+
+// Close waits for the work started in the background to finish, see Service
+func (s *userService) Close() {
+	s.background.Wait()
 }
 
 func (s *userService) Delete(ctx context.Context, id string) error {
-	return s.userStore.Delete(ctx, id)
+	if err := s.userStore.Delete(ctx, id); err != nil {
+		return translateStoreError(err)
+	}
+
+	if _, err := s.tokenStore.DeleteByUser(ctx, id); err != nil {
+		return err
+	}
+
+	if _, err := s.resetStore.DeleteByUser(ctx, id); err != nil {
+		return err
+	}
+
+	_, err := s.apiKeyStore.DeleteByUser(ctx, id)
+	return err
 }
 
 func (s *userService) Create(ctx context.Context, user model.RequestedUser) (string, error) {
@@ -93,7 +304,48 @@ func (s *userService) Create(ctx context.Context, user model.RequestedUser) (str
 		return "", ErrEmailInUse
 	}
 
-	return s.userStore.Create(ctx, &model.User{Name: user.Name, EMail: user.EMail})
+	var hash string
+	if user.Password != "" {
+		if hash, err = s.hasher.Hash(user.Password); err != nil {
+			return "", err
+		}
+	}
+
+	id, err := s.createUser(ctx, &model.User{
+		Name:         user.Name,
+		EMail:        user.EMail,
+		Role:         model.Regular,
+		Status:       model.Pending,
+		PasswordHash: hash,
+	})
+	if err != nil {
+		// the user could have been created concurrently
+		return "", translateStoreError(err)
+	}
+
+	// the user can request another mail if this one gets lost
+	s.sendVerification(ctx, &model.User{ID: id, Name: user.Name, EMail: user.EMail})
+
+	return id, nil
+}
+
+// createUser persists given user, the first user becomes admin
+// so there is someone to assign the roles of the following ones
+func (s *userService) createUser(ctx context.Context, user *model.User) (string, error) {
+	hasAdmin, err := s.userStore.HasUsersWithRole(ctx, model.Admin)
+	if err != nil {
+		return "", err
+	}
+
+	if !hasAdmin {
+		id, err := s.userStore.CreateFirstAdmin(ctx, user)
+		if !errors.Is(err, store.ErrAdminExists) {
+			return id, err
+		}
+		// another user has become admin in the meantime
+	}
+
+	return s.userStore.Create(ctx, user)
 }
 
 func (s *userService) validateRequestedUser(user model.RequestedUser) *ValidationErrors {
@@ -112,6 +364,12 @@ func (s *userService) validateRequestedUser(user model.RequestedUser) *Validatio
 		})
 	}
 
+	if user.Password != "" {
+		if perr := validatePassword(user.Password, user.EMail, user.Name); perr != nil {
+			err = err.Append(*perr)
+		}
+	}
+
 	// no validation errors
 	if len(err.Errors) == 0 {
 		return nil
@@ -133,5 +391,305 @@ func (s *userService) hasUserWithEMail(ctx context.Context, email string) (bool,
 }
 
 func (s *userService) FindByID(ctx context.Context, id string) (*model.User, error) {
-	return s.userStore.FindByID(ctx, id)
+	user, err := s.userStore.FindByID(ctx, id)
+	if err != nil {
+		return nil, translateStoreError(err)
+	}
+
+	return user, nil
+}
+
+func (s *userService) FindByEMail(ctx context.Context, email string) (*model.User, error) {
+	user, err := s.userStore.FindByEMail(ctx, email)
+	if err != nil {
+		return nil, translateStoreError(err)
+	}
+
+	return user, nil
+}
+
+func (s *userService) Update(ctx context.Context, id string, update model.UserUpdate) (*model.User, error) {
+	user, err := s.userStore.FindByID(ctx, id)
+	if err != nil {
+		return nil, translateStoreError(err)
+	}
+
+	// the store makes sure the version doesn't change until the user is written
+	if update.Version != 0 && update.Version != user.Version {
+		return nil, ErrVersionMismatch
+	}
+
+	emailChanged := update.EMail != "" && update.EMail != user.EMail
+	if emailChanged {
+		user.EMail = update.EMail
+		user.EMailVerified = false
+	}
+	if update.Name != "" {
+		user.Name = update.Name
+	}
+
+	// the updated user has to be as valid as a newly created one
+	if err := s.validateRequestedUser(model.RequestedUser{EMail: user.EMail, Name: user.Name}); err != nil {
+		return nil, err
+	}
+
+	if emailChanged {
+		userExists, err := s.hasUserWithEMail(ctx, user.EMail)
+		if err != nil {
+			return nil, err
+		}
+
+		if userExists {
+			return nil, ErrEmailInUse
+		}
+	}
+
+	if err = s.userStore.Update(ctx, user); err != nil {
+		if errors.Is(err, store.ErrVersionConflict) && update.Version != 0 {
+			return nil, ErrVersionMismatch
+		}
+		return nil, translateStoreError(err)
+	}
+
+	if emailChanged {
+		s.sendVerification(ctx, user)
+	}
+
+	return user, nil
+}
+
+func (s *userService) AssignRole(ctx context.Context, id string, role model.Role) (*model.User, error) {
+	if _, ok := model.RoleFromString(string(role)); !ok {
+		return nil, &ValidationErrors{Errors: []ValidationError{{
+			Name:   "role",
+			Reason: fmt.Sprintf("unknown role %q", role),
+		}}}
+	}
+
+	user, err := s.userStore.FindByID(ctx, id)
+	if err != nil {
+		return nil, translateStoreError(err)
+	}
+
+	if user.Role == role {
+		return user, nil
+	}
+
+	user.Role = role
+	if err = s.userStore.Update(ctx, user); err != nil {
+		return nil, translateStoreError(err)
+	}
+
+	return user, nil
+}
+
+func (s *userService) ChangePassword(ctx context.Context, id, currentPassword, newPassword string) error {
+	user, err := s.userStore.FindByID(ctx, id)
+	if err != nil {
+		return translateStoreError(err)
+	}
+
+	// users without a password have to reset it
+	if user.PasswordHash == "" {
+		return ErrInvalidCredentials
+	}
+
+	ok, err := s.hasher.Verify(currentPassword, user.PasswordHash)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidCredentials
+	}
+
+	if perr := validatePassword(newPassword, user.EMail, user.Name); perr != nil {
+		return &ValidationErrors{Errors: []ValidationError{*perr}}
+	}
+
+	if user.PasswordHash, err = s.hasher.Hash(newPassword); err != nil {
+		return err
+	}
+
+	if err = s.userStore.Update(ctx, user); err != nil {
+		return translateStoreError(err)
+	}
+
+	// sessions started with the old password must not outlive it
+	if _, err = s.tokenStore.DeleteByUser(ctx, id); err != nil {
+		return err
+	}
+	// neither must API keys created with it, e.g. by someone who has taken over the account
+	_, err = s.apiKeyStore.DeleteByUser(ctx, id)
+	return err
+}
+
+func (s *userService) Authenticate(ctx context.Context, email, password string) (*model.User, error) {
+	if addr, ok := auth.ClientIPFromContext(ctx); ok && s.lockout.isAddrLockedOut(addr) {
+		return nil, ErrTooManyFailedLogins
+	}
+
+	user, err := s.userStore.FindByEMail(ctx, email)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return nil, err
+	}
+
+	if user == nil || user.PasswordHash == "" {
+		// takes as long as verifying a password,
+		// so unknown email addresses can't be told apart by the response time
+		_, _ = s.hasher.Hash(password)
+		if err = s.addFailedLogin(ctx, nil); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidCredentials
+	}
+
+	// the password isn't even verified while locked out, so guessing goes on at the backoff's pace at most
+	if user.IsLockedOut(s.lockout.now()) {
+		return nil, ErrTooManyFailedLogins
+	}
+
+	ok, err := s.hasher.Verify(password, user.PasswordHash)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		if err = s.addFailedLogin(ctx, user); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidCredentials
+	}
+
+	s.resetFailedLogins(ctx, user)
+
+	// the status is revealed only to callers knowing the password
+	if err = checkCanLogIn(user); err != nil {
+		return nil, err
+	}
+
+	// the hash is upgraded as soon as the hasher's algorithm or parameters change
+	if s.hasher.NeedsRehash(user.PasswordHash) {
+		if hash, err := s.hasher.Hash(password); err == nil {
+			rehashed := *user
+			rehashed.PasswordHash = hash
+			// failing to store the new hash doesn't fail the login, it's retried on the next one
+			if err = s.userStore.Update(ctx, &rehashed); err == nil {
+				user = &rehashed
+			}
+		}
+	}
+
+	return user, nil
+}
+
+func (s *userService) Login(ctx context.Context, email, password string) (*model.Token, error) {
+	user, err := s.Authenticate(ctx, email, password)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.MFAEnabled {
+		return s.challengeMFA(user)
+	}
+
+	// every login starts a new family of refresh tokens
+	familyID, err := newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	return s.issueTokens(ctx, user, familyID)
+}
+
+const (
+	// DefaultPageSize is the count of users listed if the query doesn't limit it
+	DefaultPageSize = 20
+	// MaxPageSize is the maximum count of users listed at once
+	MaxPageSize = 100
+)
+
+func (s *userService) List(ctx context.Context, query model.UserQuery) (*model.UserPage, error) {
+	if query.Limit == 0 {
+		query.Limit = DefaultPageSize
+	}
+
+	if err := s.validateQuery(query); err != nil {
+		return nil, err
+	}
+
+	page, err := s.userStore.List(ctx, query)
+	if err != nil {
+		if errors.Is(err, store.ErrInvalidCursor) {
+			return nil, &ValidationErrors{Errors: []ValidationError{{
+				Name:   "cursor",
+				Reason: "invalid cursor, it must be used with the query it was returned for",
+			}}}
+		}
+		return nil, err
+	}
+
+	return page, nil
+}
+
+func (s *userService) validateQuery(query model.UserQuery) *ValidationErrors {
+	var err ValidationErrors
+	if query.Limit < 1 || query.Limit > MaxPageSize {
+		err = err.Append(ValidationError{
+			Name:   "limit",
+			Reason: fmt.Sprintf("limit must be between 1 and %d", MaxPageSize),
+		})
+	}
+
+	switch query.SortBy {
+	case "", model.SortByCreatedAt, model.SortByName, model.SortByEMail:
+	default:
+		err = err.Append(ValidationError{
+			Name:   "sort",
+			Reason: fmt.Sprintf("users can't be sorted by %q", query.SortBy),
+		})
+	}
+
+	if _, ok := model.RoleFromString(string(query.Filter.Role)); query.Filter.Role != "" && !ok {
+		err = err.Append(ValidationError{
+			Name:   "role",
+			Reason: fmt.Sprintf("unknown role %q", query.Filter.Role),
+		})
+	}
+
+	if query.Filter.Status != "" && model.StatusFromString(string(query.Filter.Status)) != query.Filter.Status {
+		err = err.Append(ValidationError{
+			Name:   "status",
+			Reason: fmt.Sprintf("unknown status %q", query.Filter.Status),
+		})
+	}
+
+	f := query.Filter
+	if !f.CreatedAfter.IsZero() && !f.CreatedBefore.IsZero() && !f.CreatedAfter.Before(f.CreatedBefore) {
+		err = err.Append(ValidationError{
+			Name:   "created_after",
+			Reason: "created_after must be before created_before",
+		})
+	}
+
+	// no validation errors
+	if len(err.Errors) == 0 {
+		return nil
+	}
+
+	return &err
+}
+
+// translateStoreError maps errors of the user store to the ones of the service
+func translateStoreError(err error) error {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		return ErrUserNotFound
+	case errors.Is(err, store.ErrDuplicateEMail):
+		return ErrEmailInUse
+	case errors.Is(err, store.ErrVersionConflict):
+		return ErrConcurrentModification
+	case errors.Is(err, store.ErrLastAdmin):
+		return ErrLastAdmin
+	default:
+		return err
+	}
 }
@@ -0,0 +1,434 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/status-owl/user-service/pkg/auth"
+	"github.com/status-owl/user-service/pkg/mail"
+	"github.com/status-owl/user-service/pkg/model"
+	"github.com/status-owl/user-service/pkg/store"
+	"github.com/stretchr/testify/assert"
+)
+
+// testArgon2idParams keep the tests fast, they are way too weak for production
+var testArgon2idParams = Argon2idParams{Memory: 64, Time: 1, Threads: 1}
+
+// testIssuer issues unsigned tokens consisting of the user's id and role,
+// verification tokens consist of the user's id and email address, challenges of the user's id
+type testIssuer struct{}
+
+func (testIssuer) Issue(user *model.User) (*model.Token, error) {
+	return &model.Token{AccessToken: user.ID + ":" + string(user.Role)}, nil
+}
+
+func (testIssuer) IssueEMailVerification(user *model.User, _ time.Duration) (string, error) {
+	return "verify:" + user.ID + ":" + user.EMail, nil
+}
+
+func (testIssuer) VerifyEMailVerification(token string) (*auth.Claims, error) {
+	parts := strings.SplitN(token, ":", 3)
+	if len(parts) != 3 || parts[0] != "verify" {
+		return nil, auth.ErrInvalidToken
+	}
+
+	claims := auth.Claims{EMail: parts[2]}
+	claims.Subject = parts[1]
+	return &claims, nil
+}
+
+func (testIssuer) IssueMFAChallenge(user *model.User, _ time.Duration) (string, error) {
+	return "mfa:" + user.ID, nil
+}
+
+func (testIssuer) VerifyMFAChallenge(token string) (*auth.Claims, error) {
+	if !strings.HasPrefix(token, "mfa:") {
+		return nil, auth.ErrInvalidToken
+	}
+
+	var claims auth.Claims
+	claims.Subject = strings.TrimPrefix(token, "mfa:")
+	return &claims, nil
+}
+
+// testMailer records the sent messages
+type testMailer struct {
+	mu   sync.Mutex
+	sent []*mail.Message
+}
+
+func (m *testMailer) Send(_ context.Context, msg *mail.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+// sentMails returns the messages sent by svc once the mails sent in the background are out
+func sentMails(svc *userService) []*mail.Message {
+	svc.Close()
+
+	m := svc.mailer.(*testMailer)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]*mail.Message(nil), m.sent...)
+}
+
+// newTestService creates a service backed by in-memory stores without any middlewares
+func newTestService() *userService {
+	return &userService{
+		userStore:          store.NewMemoryUserStore(zerolog.Nop()),
+		tokenStore:         store.NewMemoryRefreshTokenStore(zerolog.Nop()),
+		resetStore:         store.NewMemoryPasswordResetTokenStore(zerolog.Nop()),
+		apiKeyStore:        store.NewMemoryAPIKeyStore(zerolog.Nop()),
+		hasher:             NewArgon2idHasher(testArgon2idParams),
+		issuer:             testIssuer{},
+		mailer:             &testMailer{},
+		templates:          mail.DefaultTemplates(),
+		verificationResend: newThrottle(VerificationResendInterval),
+		passwordReset:      newThrottle(PasswordResetInterval),
+		refreshTTL:         time.Hour,
+		lockout:            newLockout(DefaultLockoutPolicy),
+		logger:             zerolog.Nop(),
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	a := assert.New(t)
+	svc := newTestService()
+	ctx := context.Background()
+
+	id, err := svc.Create(ctx, model.RequestedUser{EMail: "john@example.com", Name: "John"})
+	a.Nil(err)
+	_, err = svc.Create(ctx, model.RequestedUser{EMail: "mary@example.com", Name: "Mary"})
+	a.Nil(err)
+
+	// only the name changes
+	user, err := svc.Update(ctx, id, model.UserUpdate{Name: "Johnny"})
+	a.Nil(err)
+	a.Equal("Johnny", user.Name)
+	a.Equal("john@example.com", user.EMail)
+
+	// only the email changes
+	user, err = svc.Update(ctx, id, model.UserUpdate{EMail: "johnny@example.com"})
+	a.Nil(err)
+	a.Equal("Johnny", user.Name)
+	a.Equal("johnny@example.com", user.EMail)
+
+	found, err := svc.FindByID(ctx, id)
+	a.Nil(err)
+	a.Equal(user, found)
+
+	// email addresses stay unique
+	_, err = svc.Update(ctx, id, model.UserUpdate{EMail: "mary@example.com"})
+	a.ErrorIs(err, ErrEmailInUse)
+
+	// keeping the own email address is fine
+	_, err = svc.Update(ctx, id, model.UserUpdate{EMail: "johnny@example.com"})
+	a.Nil(err)
+}
+
+func TestFindByEMail(t *testing.T) {
+	a := assert.New(t)
+	svc := newTestService()
+	ctx := context.Background()
+
+	id, err := svc.Create(ctx, model.RequestedUser{EMail: "john@example.com", Name: "John"})
+	a.Nil(err)
+
+	user, err := svc.FindByEMail(ctx, "john@example.com")
+	a.Nil(err)
+	a.Equal(id, user.ID)
+
+	_, err = svc.FindByEMail(ctx, "mary@example.com")
+	a.ErrorIs(err, ErrUserNotFound)
+}
+
+func TestUpdateValidation(t *testing.T) {
+	a := assert.New(t)
+	svc := newTestService()
+	ctx := context.Background()
+
+	id, err := svc.Create(ctx, model.RequestedUser{EMail: "john@example.com", Name: "John"})
+	a.Nil(err)
+
+	_, err = svc.Update(ctx, id, model.UserUpdate{EMail: "j@e", Name: "  "})
+	verr, ok := err.(*ValidationErrors)
+	a.True(ok, "expected validation errors, got %v", err)
+	a.Equal([]ValidationError{
+		{Name: "email", Reason: "invalid email address"},
+		{Name: "name", Reason: "name is not set"},
+	}, verr.Errors)
+
+	// nothing has been changed
+	user, err := svc.FindByID(ctx, id)
+	a.Nil(err)
+	a.Equal("John", user.Name)
+}
+
+func TestUpdateNotExisting(t *testing.T) {
+	_, err := newTestService().Update(context.Background(), "123", model.UserUpdate{Name: "John"})
+	assert.ErrorIs(t, err, ErrUserNotFound)
+}
+
+func TestUpdateVersion(t *testing.T) {
+	a := assert.New(t)
+	svc := newTestService()
+	ctx := context.Background()
+
+	id, err := svc.Create(ctx, model.RequestedUser{EMail: "john@example.com", Name: "John"})
+	a.Nil(err)
+
+	user, err := svc.Update(ctx, id, model.UserUpdate{Name: "Johnny", Version: 1})
+	a.Nil(err)
+	a.Equal(int64(2), user.Version)
+
+	// the changes are based on an outdated version
+	_, err = svc.Update(ctx, id, model.UserUpdate{Name: "Jack", Version: 1})
+	a.ErrorIs(err, ErrVersionMismatch)
+
+	user, err = svc.FindByID(ctx, id)
+	a.Nil(err)
+	a.Equal("Johnny", user.Name)
+}
+
+func TestList(t *testing.T) {
+	a := assert.New(t)
+	svc := newTestService()
+	ctx := context.Background()
+
+	for i := 0; i < DefaultPageSize+1; i++ {
+		_, err := svc.Create(ctx, model.RequestedUser{EMail: fmt.Sprintf("john%02d@example.com", i), Name: "John"})
+		a.Nil(err)
+	}
+
+	// the page size defaults to DefaultPageSize
+	page, err := svc.List(ctx, model.UserQuery{})
+	a.Nil(err)
+	a.Len(page.Users, DefaultPageSize)
+	a.NotEmpty(page.NextCursor)
+
+	page, err = svc.List(ctx, model.UserQuery{Cursor: page.NextCursor})
+	a.Nil(err)
+	a.Len(page.Users, 1)
+	a.Empty(page.NextCursor)
+}
+
+func TestListValidation(t *testing.T) {
+	svc := newTestService()
+	now := time.Now()
+
+	for _, tt := range []struct {
+		query model.UserQuery
+		field string
+	}{
+		{model.UserQuery{Limit: -1}, "limit"},
+		{model.UserQuery{Limit: MaxPageSize + 1}, "limit"},
+		{model.UserQuery{SortBy: "role"}, "sort"},
+		{model.UserQuery{Filter: model.UserFilter{Role: "OWNER"}}, "role"},
+		{model.UserQuery{Filter: model.UserFilter{CreatedAfter: now, CreatedBefore: now}}, "created_after"},
+		{model.UserQuery{Cursor: "invalid"}, "cursor"},
+	} {
+		_, err := svc.List(context.Background(), tt.query)
+
+		var validationErr *ValidationErrors
+		if assert.ErrorAs(t, err, &validationErr, tt.query.String()) {
+			assert.Equal(t, tt.field, validationErr.Errors[0].Name)
+		}
+	}
+}
+
+func TestCreateWithPassword(t *testing.T) {
+	a := assert.New(t)
+	svc := newTestService()
+	ctx := context.Background()
+
+	id, err := svc.Create(ctx, model.RequestedUser{EMail: "john@example.com", Name: "John", Password: "correct-Horse-7"})
+	a.Nil(err)
+
+	user, err := svc.FindByID(ctx, id)
+	a.Nil(err)
+	a.NotContains(user.PasswordHash, "correct-Horse-7", "only the hash is stored")
+	ok, err := svc.hasher.Verify("correct-Horse-7", user.PasswordHash)
+	a.Nil(err)
+	a.True(ok)
+
+	// weak passwords are rejected
+	_, err = svc.Create(ctx, model.RequestedUser{EMail: "mary@example.com", Name: "Mary", Password: "secret"})
+	var validationErr *ValidationErrors
+	if a.ErrorAs(err, &validationErr) {
+		a.Equal("password", validationErr.Errors[0].Name)
+	}
+}
+
+func TestCreateFirstAdmin(t *testing.T) {
+	a := assert.New(t)
+	svc := newTestService()
+	ctx := context.Background()
+
+	id, err := svc.Create(ctx, model.RequestedUser{EMail: "john@example.com", Name: "John", Password: "correct-Horse-7"})
+	a.Nil(err)
+	first, err := svc.FindByID(ctx, id)
+	a.Nil(err)
+	a.Equal(model.Admin, first.Role, "the first user becomes an admin")
+
+	id, err = svc.Create(ctx, model.RequestedUser{EMail: "mary@example.com", Name: "Mary", Password: "correct-Horse-7"})
+	a.Nil(err)
+	second, err := svc.FindByID(ctx, id)
+	a.Nil(err)
+	a.Equal(model.Regular, second.Role)
+}
+
+func TestAssignRole(t *testing.T) {
+	a := assert.New(t)
+	svc := newTestService()
+	ctx := context.Background()
+
+	_, err := svc.Create(ctx, model.RequestedUser{EMail: "john@example.com", Name: "John", Password: "correct-Horse-7"})
+	a.Nil(err)
+	id, err := svc.Create(ctx, model.RequestedUser{EMail: "mary@example.com", Name: "Mary", Password: "correct-Horse-7"})
+	a.Nil(err)
+
+	user, err := svc.AssignRole(ctx, id, model.Reporter)
+	a.Nil(err)
+	a.Equal(model.Reporter, user.Role)
+	a.Equal(int64(2), user.Version)
+
+	stored, err := svc.FindByID(ctx, id)
+	a.Nil(err)
+	a.Equal(model.Reporter, stored.Role)
+
+	_, err = svc.AssignRole(ctx, id, "OWNER")
+	var validationErr *ValidationErrors
+	if a.ErrorAs(err, &validationErr) {
+		a.Equal("role", validationErr.Errors[0].Name)
+	}
+
+	_, err = svc.AssignRole(ctx, "unknown", model.Reporter)
+	a.ErrorIs(err, ErrUserNotFound)
+}
+
+func TestRemoveLastAdmin(t *testing.T) {
+	a := assert.New(t)
+	svc := newTestService()
+	ctx := context.Background()
+
+	adminID, err := svc.Create(ctx, model.RequestedUser{EMail: "john@example.com", Name: "John", Password: "correct-Horse-7"})
+	a.Nil(err)
+	userID, err := svc.Create(ctx, model.RequestedUser{EMail: "mary@example.com", Name: "Mary", Password: "correct-Horse-7"})
+	a.Nil(err)
+
+	_, err = svc.AssignRole(ctx, adminID, model.Reporter)
+	a.ErrorIs(err, ErrLastAdmin)
+	a.ErrorIs(svc.Delete(ctx, adminID), ErrLastAdmin)
+
+	// once there is another admin the first one can go
+	_, err = svc.AssignRole(ctx, userID, model.Admin)
+	a.Nil(err)
+	a.Nil(svc.Delete(ctx, adminID))
+}
+
+func TestChangePassword(t *testing.T) {
+	a := assert.New(t)
+	svc := newTestService()
+	ctx := context.Background()
+
+	id, err := svc.Create(ctx, model.RequestedUser{EMail: "john@example.com", Name: "John", Password: "correct-Horse-7"})
+	a.Nil(err)
+
+	a.ErrorIs(svc.ChangePassword(ctx, id, "wrong-Horse-7", "battery-Staple-8"), ErrInvalidCredentials)
+	a.ErrorIs(svc.ChangePassword(ctx, "unknown", "correct-Horse-7", "battery-Staple-8"), ErrUserNotFound)
+
+	var validationErr *ValidationErrors
+	a.ErrorAs(svc.ChangePassword(ctx, id, "correct-Horse-7", "john-Horse-7"), &validationErr)
+
+	a.Nil(svc.ChangePassword(ctx, id, "correct-Horse-7", "battery-Staple-8"))
+
+	_, err = svc.Authenticate(ctx, "john@example.com", "correct-Horse-7")
+	a.ErrorIs(err, ErrInvalidCredentials)
+	_, err = svc.Authenticate(ctx, "john@example.com", "battery-Staple-8")
+	a.Nil(err)
+
+	// users without a password have to reset it
+	id, err = svc.Create(ctx, model.RequestedUser{EMail: "mary@example.com", Name: "Mary"})
+	a.Nil(err)
+	a.ErrorIs(svc.ChangePassword(ctx, id, "", "battery-Staple-8"), ErrInvalidCredentials)
+}
+
+func TestAuthenticate(t *testing.T) {
+	a := assert.New(t)
+	svc := newTestService()
+	ctx := context.Background()
+
+	id, err := svc.Create(ctx, model.RequestedUser{EMail: "john@example.com", Name: "John", Password: "correct-Horse-7"})
+	a.Nil(err)
+	_, err = svc.Create(ctx, model.RequestedUser{EMail: "mary@example.com", Name: "Mary"})
+	a.Nil(err)
+
+	user, err := svc.Authenticate(ctx, "john@example.com", "correct-Horse-7")
+	a.Nil(err)
+	a.Equal(id, user.ID)
+
+	for _, tt := range []struct{ email, password string }{
+		{"john@example.com", "wrong-Horse-7"},
+		{"john@example.com", ""},
+		{"unknown@example.com", "correct-Horse-7"},
+		{"mary@example.com", ""},
+	} {
+		_, err = svc.Authenticate(ctx, tt.email, tt.password)
+		a.ErrorIs(err, ErrInvalidCredentials, tt.email)
+	}
+}
+
+func TestAuthenticateRehash(t *testing.T) {
+	a := assert.New(t)
+	svc := newTestService()
+	ctx := context.Background()
+
+	// created with the previous algorithm
+	svc.hasher = NewBcryptHasher(4)
+	id, err := svc.Create(ctx, model.RequestedUser{EMail: "john@example.com", Name: "John", Password: "correct-Horse-7"})
+	a.Nil(err)
+
+	svc.hasher = NewArgon2idHasher(testArgon2idParams)
+	user, err := svc.Authenticate(ctx, "john@example.com", "correct-Horse-7")
+	a.Nil(err)
+
+	stored, err := svc.FindByID(ctx, id)
+	a.Nil(err)
+	a.Equal(stored, user)
+	a.False(svc.hasher.NeedsRehash(stored.PasswordHash), "the hash is upgraded on login")
+
+	// parameter changes are picked up as well
+	svc.hasher = NewArgon2idHasher(Argon2idParams{Memory: 128, Time: 1, Threads: 1})
+	_, err = svc.Authenticate(ctx, "john@example.com", "correct-Horse-7")
+	a.Nil(err)
+
+	stored, err = svc.FindByID(ctx, id)
+	a.Nil(err)
+	a.Contains(stored.PasswordHash, "m=128,")
+}
+
+func TestLogin(t *testing.T) {
+	a := assert.New(t)
+	svc := newTestService()
+	ctx := context.Background()
+
+	id, err := svc.Create(ctx, model.RequestedUser{EMail: "john@example.com", Name: "John", Password: "correct-Horse-7"})
+	a.Nil(err)
+
+	token, err := svc.Login(ctx, "john@example.com", "correct-Horse-7")
+	a.Nil(err)
+	a.Equal(id+":"+string(model.Admin), token.AccessToken, "the first user is an admin")
+	a.NotEmpty(token.RefreshToken)
+
+	_, err = svc.Login(ctx, "john@example.com", "wrong-Horse-7")
+	a.ErrorIs(err, ErrInvalidCredentials)
+}
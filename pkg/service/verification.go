@@ -0,0 +1,139 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/status-owl/user-service/pkg/mail"
+	"github.com/status-owl/user-service/pkg/model"
+)
+
+const (
+	// VerificationTokenTTL is the lifetime of the tokens confirming email addresses
+	VerificationTokenTTL = 24 * time.Hour
+	// VerificationResendInterval is the minimum time between two verification mails to the same user
+	VerificationResendInterval = time.Minute
+)
+
+// sendVerification mails a verification token to given user,
+// failures are logged only since the user can request another mail
+func (s *userService) sendVerification(ctx context.Context, user *model.User) {
+	s.verificationResend.allow(user.ID)
+
+	if err := s.mailVerification(ctx, user); err != nil {
+		s.logger.Error().
+			Err(err).
+			Str("id", user.ID).
+			Msg("failed to send verification mail")
+	}
+}
+
+// mailVerification issues a verification token for given user and mails it
+func (s *userService) mailVerification(ctx context.Context, user *model.User) error {
+	token, err := s.issuer.IssueEMailVerification(user, VerificationTokenTTL)
+	if err != nil {
+		return err
+	}
+
+	// users have no preferred locale yet
+	msg, err := s.templates.Render("verification", mail.DefaultLocale, struct {
+		Name       string
+		Token      string
+		ValidHours int
+	}{user.Name, token, int(VerificationTokenTTL / time.Hour)})
+	if err != nil {
+		return err
+	}
+
+	msg.To = user.EMail
+	return s.mailer.Send(ctx, msg)
+}
+
+func (s *userService) VerifyEMail(ctx context.Context, id, token string) error {
+	claims, err := s.issuer.VerifyEMailVerification(token)
+	if err != nil || claims.Subject != id {
+		return ErrInvalidVerificationToken
+	}
+
+	user, err := s.userStore.FindByID(ctx, id)
+	if err != nil {
+		return translateStoreError(err)
+	}
+
+	// the address has been changed since the token was issued
+	if user.EMail != claims.EMail {
+		return ErrInvalidVerificationToken
+	}
+
+	if user.EMailVerified {
+		return nil
+	}
+
+	user.EMailVerified = true
+	if user.Status == model.Pending {
+		user.Status = model.Active
+	}
+	if err = s.userStore.Update(ctx, user); err != nil {
+		return translateStoreError(err)
+	}
+
+	return nil
+}
+
+func (s *userService) ResendVerification(ctx context.Context, id string) error {
+	user, err := s.userStore.FindByID(ctx, id)
+	if err != nil {
+		return translateStoreError(err)
+	}
+
+	if user.EMailVerified {
+		return ErrEMailAlreadyVerified
+	}
+
+	if !s.verificationResend.allow(id) {
+		return ErrTooManyRequests
+	}
+
+	return s.mailVerification(ctx, user)
+}
+
+// throttle limits how often an action is performed per key,
+// the state is kept in memory and isn't shared between instances
+type throttle struct {
+	mu       sync.Mutex
+	interval time.Duration
+	// last maps the keys to the time the action has been performed last
+	last map[string]time.Time
+	// now returns the current time, replaced in tests
+	now func() time.Time
+}
+
+func newThrottle(interval time.Duration) *throttle {
+	return &throttle{
+		interval: interval,
+		last:     make(map[string]time.Time),
+		now:      time.Now,
+	}
+}
+
+// allow reports whether the action may be performed for given key and records it if so
+func (t *throttle) allow(key string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	// forget the keys which aren't throttled anymore, so the map doesn't grow forever
+	for k, at := range t.last {
+		if now.Sub(at) >= t.interval {
+			delete(t.last, k)
+		}
+	}
+
+	if _, ok := t.last[key]; ok {
+		return false
+	}
+
+	t.last[key] = now
+	return true
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/status-owl/user-service/pkg/model"
+)
+
+func TestVerifyEMail(t *testing.T) {
+	a := assert.New(t)
+	svc := newTestService()
+	ctx := context.Background()
+
+	id, err := svc.Create(ctx, model.RequestedUser{EMail: "john@example.com", Name: "John"})
+	a.Nil(err)
+
+	user, err := svc.FindByID(ctx, id)
+	a.Nil(err)
+	a.False(user.EMailVerified, "new users are unverified")
+
+	sent := svc.mailer.(*testMailer).sent
+	if a.Len(sent, 1, "a verification token is mailed on creation") {
+		a.Equal("john@example.com", sent[0].To)
+		a.Contains(sent[0].Text, "verify:"+id+":john@example.com")
+	}
+
+	a.ErrorIs(svc.VerifyEMail(ctx, id, "verify:other:john@example.com"), ErrInvalidVerificationToken)
+	a.ErrorIs(svc.VerifyEMail(ctx, id, "forged"), ErrInvalidVerificationToken)
+
+	a.Nil(svc.VerifyEMail(ctx, id, "verify:"+id+":john@example.com"))
+	user, err = svc.FindByID(ctx, id)
+	a.Nil(err)
+	a.True(user.EMailVerified)
+
+	// verifying twice doesn't hurt
+	a.Nil(svc.VerifyEMail(ctx, id, "verify:"+id+":john@example.com"))
+}
+
+func TestVerifyChangedEMail(t *testing.T) {
+	a := assert.New(t)
+	svc := newTestService()
+	ctx := context.Background()
+
+	id, err := svc.Create(ctx, model.RequestedUser{EMail: "john@example.com", Name: "John"})
+	a.Nil(err)
+	a.Nil(svc.VerifyEMail(ctx, id, "verify:"+id+":john@example.com"))
+
+	user, err := svc.Update(ctx, id, model.UserUpdate{EMail: "johnny@example.com"})
+	a.Nil(err)
+	a.False(user.EMailVerified, "changed addresses have to be verified again")
+	a.Len(svc.mailer.(*testMailer).sent, 2)
+
+	// tokens of the previous address are rejected
+	a.ErrorIs(svc.VerifyEMail(ctx, id, "verify:"+id+":john@example.com"), ErrInvalidVerificationToken)
+	a.Nil(svc.VerifyEMail(ctx, id, "verify:"+id+":johnny@example.com"))
+}
+
+func TestResendVerification(t *testing.T) {
+	a := assert.New(t)
+	svc := newTestService()
+	ctx := context.Background()
+
+	now := time.Now()
+	svc.verificationResend.now = func() time.Time { return now }
+
+	id, err := svc.Create(ctx, model.RequestedUser{EMail: "john@example.com", Name: "John"})
+	a.Nil(err)
+
+	a.ErrorIs(svc.ResendVerification(ctx, id), ErrTooManyRequests, "a mail has just been sent")
+
+	now = now.Add(VerificationResendInterval)
+	a.Nil(svc.ResendVerification(ctx, id))
+	a.Len(svc.mailer.(*testMailer).sent, 2)
+	a.ErrorIs(svc.ResendVerification(ctx, id), ErrTooManyRequests)
+
+	a.Nil(svc.VerifyEMail(ctx, id, "verify:"+id+":john@example.com"))
+	now = now.Add(VerificationResendInterval)
+	a.ErrorIs(svc.ResendVerification(ctx, id), ErrEMailAlreadyVerified)
+
+	a.ErrorIs(svc.ResendVerification(ctx, "unknown"), ErrUserNotFound)
+}
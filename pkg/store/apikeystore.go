@@ -0,0 +1,73 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/rs/zerolog"
+	bolt "go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/status-owl/user-service/pkg/model"
+)
+
+// APIKeyStore is responsible for storing personal API keys
+type APIKeyStore interface {
+	Create(ctx context.Context, key *model.APIKey) error
+	// FindByHash returns the key with given hash, it's how presented keys are looked up
+	FindByHash(ctx context.Context, hash string) (*model.APIKey, error)
+	// ListByUser returns the keys of a user, the oldest first
+	ListByUser(ctx context.Context, userID string) ([]*model.APIKey, error)
+	// Delete revokes the key with given id, it has to belong to given user
+	Delete(ctx context.Context, userID, id string) error
+	// DeleteByUser revokes all keys of a user and returns their count
+	DeleteByUser(ctx context.Context, userID string) (int64, error)
+	// DeleteExpired removes all keys expired before given time and returns their count,
+	// keys without expiry are kept
+	DeleteExpired(ctx context.Context, before time.Time) (int64, error)
+}
+
+var (
+	//ErrAPIKeyNotFound signals that an API key doesn't exist, has been revoked or belongs to another user
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	//ErrDuplicateAPIKey signals that an API key with given id or hash already exists
+	ErrDuplicateAPIKey = errors.New("api key already exists")
+)
+
+// NewAPIKeyStore creates an APIKeyStore using mongodb
+func NewAPIKeyStore(client *mongo.Client, logger zerolog.Logger) (APIKeyStore, error) {
+	store := &mongoAPIKeyStore{client}
+	if err := store.createIndexes(); err != nil {
+		return nil, err
+	}
+
+	return APIKeyLoggingMiddleware(logger)(store), nil
+}
+
+// NewMemoryAPIKeyStore creates an APIKeyStore keeping all keys in memory
+func NewMemoryAPIKeyStore(logger zerolog.Logger) APIKeyStore {
+	return APIKeyLoggingMiddleware(logger)(newMemoryAPIKeyStore())
+}
+
+// NewSQLAPIKeyStore creates an APIKeyStore backed by a sql database,
+// pending schema migrations are applied before the store is returned
+func NewSQLAPIKeyStore(db *sql.DB, logger zerolog.Logger) (APIKeyStore, error) {
+	// the schema is shared with the sql user store
+	if err := (&sqlUserStore{db}).migrate(); err != nil {
+		return nil, err
+	}
+
+	return APIKeyLoggingMiddleware(logger)(&sqlAPIKeyStore{db}), nil
+}
+
+// NewBoltAPIKeyStore creates an APIKeyStore backed by an embedded bolt database
+func NewBoltAPIKeyStore(db *bolt.DB, logger zerolog.Logger) (APIKeyStore, error) {
+	store := &boltAPIKeyStore{db}
+	if err := store.createBuckets(); err != nil {
+		return nil, err
+	}
+
+	return APIKeyLoggingMiddleware(logger)(store), nil
+}
@@ -0,0 +1,229 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/status-owl/user-service/pkg/model"
+)
+
+// boltAPIKeyStore implements APIKeyStore using an embedded bolt database file
+type boltAPIKeyStore struct {
+	db *bolt.DB
+}
+
+var (
+	// apiKeysBucket maps key ids to json encoded keys
+	apiKeysBucket = []byte("api_keys")
+	// apiKeyHashesBucket maps the hashes of the keys to their ids
+	apiKeyHashesBucket = []byte("api_key_hashes")
+)
+
+type boltAPIKey struct {
+	ID        string        `json:"id"`
+	UserID    string        `json:"user_id"`
+	Name      string        `json:"name"`
+	Prefix    string        `json:"prefix"`
+	Hash      string        `json:"hash"`
+	Scopes    []model.Scope `json:"scopes"`
+	CreatedAt time.Time     `json:"created_at"`
+	ExpiresAt time.Time     `json:"expires_at"`
+}
+
+func (s *boltAPIKeyStore) createBuckets() error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{apiKeysBucket, apiKeyHashesBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return fmt.Errorf("failed to create bucket %q: %w", name, err)
+			}
+		}
+		return nil
+	})
+}
+
+// getAPIKey decodes the key with given id, nil if it doesn't exist
+func getAPIKey(tx *bolt.Tx, id []byte) (*boltAPIKey, error) {
+	data := tx.Bucket(apiKeysBucket).Get(id)
+	if data == nil {
+		return nil, nil
+	}
+
+	var k boltAPIKey
+	if err := json.Unmarshal(data, &k); err != nil {
+		return nil, fmt.Errorf("failed to decode api key: %w", err)
+	}
+	return &k, nil
+}
+
+// deleteAPIKey removes given key together with its hash
+func deleteAPIKey(tx *bolt.Tx, k *boltAPIKey) error {
+	if err := tx.Bucket(apiKeyHashesBucket).Delete([]byte(k.Hash)); err != nil {
+		return err
+	}
+	return tx.Bucket(apiKeysBucket).Delete([]byte(k.ID))
+}
+
+func (s *boltAPIKeyStore) Create(_ context.Context, key *model.APIKey) error {
+	k := boltAPIKey(*key)
+	k.CreatedAt = k.CreatedAt.UTC().Truncate(time.Millisecond)
+	if !k.ExpiresAt.IsZero() {
+		k.ExpiresAt = k.ExpiresAt.UTC().Truncate(time.Millisecond)
+	}
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		keys, hashes := tx.Bucket(apiKeysBucket), tx.Bucket(apiKeyHashesBucket)
+		if keys.Get([]byte(k.ID)) != nil || hashes.Get([]byte(k.Hash)) != nil {
+			return ErrDuplicateAPIKey
+		}
+
+		data, err := json.Marshal(k)
+		if err != nil {
+			return fmt.Errorf("failed to encode api key: %w", err)
+		}
+		if err = hashes.Put([]byte(k.Hash), []byte(k.ID)); err != nil {
+			return err
+		}
+		return keys.Put([]byte(k.ID), data)
+	})
+	if err != nil {
+		if err == ErrDuplicateAPIKey {
+			return err
+		}
+		return fmt.Errorf("failed to insert api key: %w", err)
+	}
+
+	return nil
+}
+
+func (s *boltAPIKeyStore) FindByHash(_ context.Context, hash string) (*model.APIKey, error) {
+	var k *boltAPIKey
+	err := s.db.View(func(tx *bolt.Tx) error {
+		id := tx.Bucket(apiKeyHashesBucket).Get([]byte(hash))
+		if id == nil {
+			return ErrAPIKeyNotFound
+		}
+
+		var err error
+		if k, err = getAPIKey(tx, id); err != nil {
+			return err
+		}
+		if k == nil {
+			return ErrAPIKeyNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		if err == ErrAPIKeyNotFound {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to find api key: %w", err)
+	}
+
+	key := model.APIKey(*k)
+	return &key, nil
+}
+
+func (s *boltAPIKeyStore) ListByUser(_ context.Context, userID string) ([]*model.APIKey, error) {
+	keys := make([]*model.APIKey, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		// there are no indexes, all keys are scanned
+		return tx.Bucket(apiKeysBucket).ForEach(func(_, v []byte) error {
+			var k boltAPIKey
+			if err := json.Unmarshal(v, &k); err != nil {
+				return fmt.Errorf("failed to decode api key: %w", err)
+			}
+
+			if k.UserID == userID {
+				key := model.APIKey(k)
+				keys = append(keys, &key)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list api keys: %w", err)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].CreatedAt.Equal(keys[j].CreatedAt) {
+			return keys[i].ID < keys[j].ID
+		}
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+
+	return keys, nil
+}
+
+func (s *boltAPIKeyStore) Delete(_ context.Context, userID, id string) error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		k, err := getAPIKey(tx, []byte(id))
+		if err != nil {
+			return err
+		}
+		if k == nil || k.UserID != userID {
+			return ErrAPIKeyNotFound
+		}
+
+		return deleteAPIKey(tx, k)
+	})
+	if err != nil {
+		if err == ErrAPIKeyNotFound {
+			return err
+		}
+		return fmt.Errorf("failed to delete api key: %w", err)
+	}
+
+	return nil
+}
+
+// deleteWhere removes all keys matching given predicate,
+// there are no indexes, all keys are scanned
+func (s *boltAPIKeyStore) deleteWhere(matches func(k *boltAPIKey) bool) (int64, error) {
+	var count int64
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		var matching []*boltAPIKey
+		err := tx.Bucket(apiKeysBucket).ForEach(func(_, v []byte) error {
+			var k boltAPIKey
+			if err := json.Unmarshal(v, &k); err != nil {
+				return fmt.Errorf("failed to decode api key: %w", err)
+			}
+
+			if matches(&k) {
+				matching = append(matching, &k)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		// buckets mustn't be modified while iterating them
+		for _, k := range matching {
+			if err = deleteAPIKey(tx, k); err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete api keys: %w", err)
+	}
+
+	return count, nil
+}
+
+func (s *boltAPIKeyStore) DeleteByUser(_ context.Context, userID string) (int64, error) {
+	return s.deleteWhere(func(k *boltAPIKey) bool { return k.UserID == userID })
+}
+
+func (s *boltAPIKeyStore) DeleteExpired(_ context.Context, before time.Time) (int64, error) {
+	return s.deleteWhere(func(k *boltAPIKey) bool {
+		return !k.ExpiresAt.IsZero() && k.ExpiresAt.Before(before)
+	})
+}
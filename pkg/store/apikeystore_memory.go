@@ -0,0 +1,121 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/status-owl/user-service/pkg/model"
+)
+
+// memoryAPIKeyStore implements APIKeyStore keeping all keys in memory
+type memoryAPIKeyStore struct {
+	mu sync.Mutex
+	// keys maps the ids to the keys
+	keys map[string]model.APIKey
+}
+
+func newMemoryAPIKeyStore() *memoryAPIKeyStore {
+	return &memoryAPIKeyStore{keys: make(map[string]model.APIKey)}
+}
+
+// copyAPIKey returns a copy of k not sharing the scopes
+func copyAPIKey(k model.APIKey) *model.APIKey {
+	k.Scopes = append([]model.Scope(nil), k.Scopes...)
+	return &k
+}
+
+func (s *memoryAPIKeyStore) Create(_ context.Context, key *model.APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, k := range s.keys {
+		if k.ID == key.ID || k.Hash == key.Hash {
+			return ErrDuplicateAPIKey
+		}
+	}
+
+	k := copyAPIKey(*key)
+	k.CreatedAt = k.CreatedAt.UTC().Truncate(time.Millisecond)
+	if !k.ExpiresAt.IsZero() {
+		k.ExpiresAt = k.ExpiresAt.UTC().Truncate(time.Millisecond)
+	}
+	s.keys[k.ID] = *k
+
+	return nil
+}
+
+func (s *memoryAPIKeyStore) FindByHash(_ context.Context, hash string) (*model.APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, k := range s.keys {
+		if k.Hash == hash {
+			return copyAPIKey(k), nil
+		}
+	}
+
+	return nil, ErrAPIKeyNotFound
+}
+
+func (s *memoryAPIKeyStore) ListByUser(_ context.Context, userID string) ([]*model.APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := make([]*model.APIKey, 0)
+	for _, k := range s.keys {
+		if k.UserID == userID {
+			keys = append(keys, copyAPIKey(k))
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].CreatedAt.Equal(keys[j].CreatedAt) {
+			return keys[i].ID < keys[j].ID
+		}
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+
+	return keys, nil
+}
+
+func (s *memoryAPIKeyStore) Delete(_ context.Context, userID, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k, ok := s.keys[id]
+	if !ok || k.UserID != userID {
+		return ErrAPIKeyNotFound
+	}
+
+	delete(s.keys, id)
+	return nil
+}
+
+// deleteWhere removes all keys matching given predicate
+func (s *memoryAPIKeyStore) deleteWhere(matches func(k *model.APIKey) bool) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var count int64
+	for id, k := range s.keys {
+		k := k
+		if matches(&k) {
+			delete(s.keys, id)
+			count++
+		}
+	}
+
+	return count
+}
+
+func (s *memoryAPIKeyStore) DeleteByUser(_ context.Context, userID string) (int64, error) {
+	return s.deleteWhere(func(k *model.APIKey) bool { return k.UserID == userID }), nil
+}
+
+func (s *memoryAPIKeyStore) DeleteExpired(_ context.Context, before time.Time) (int64, error) {
+	return s.deleteWhere(func(k *model.APIKey) bool {
+		return !k.ExpiresAt.IsZero() && k.ExpiresAt.Before(before)
+	}), nil
+}
@@ -0,0 +1,169 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/status-owl/user-service/pkg/model"
+)
+
+// mongoAPIKeyStore implements APIKeyStore using mongodb as backing db
+type mongoAPIKeyStore struct {
+	client *mongo.Client
+}
+
+const apiKeysCollectionName = "api_keys"
+
+type mongoAPIKey struct {
+	ID        string        `bson:"_id"`
+	UserID    string        `bson:"user_id"`
+	Name      string        `bson:"name"`
+	Prefix    string        `bson:"prefix"`
+	Hash      string        `bson:"hash"`
+	Scopes    []model.Scope `bson:"scopes"`
+	CreatedAt time.Time     `bson:"created_at"`
+	// ExpiresAt is missing for keys which never expire
+	ExpiresAt *time.Time `bson:"expires_at,omitempty"`
+}
+
+func (k *mongoAPIKey) toAPIKey() *model.APIKey {
+	key := &model.APIKey{
+		ID:        k.ID,
+		UserID:    k.UserID,
+		Name:      k.Name,
+		Prefix:    k.Prefix,
+		Hash:      k.Hash,
+		Scopes:    k.Scopes,
+		CreatedAt: k.CreatedAt.UTC(),
+	}
+	if k.ExpiresAt != nil {
+		key.ExpiresAt = k.ExpiresAt.UTC()
+	}
+
+	return key
+}
+
+// returns api keys collection
+func (s *mongoAPIKeyStore) col() *mongo.Collection {
+	return s.client.
+		Database(databaseName).
+		Collection(apiKeysCollectionName)
+}
+
+func (s *mongoAPIKeyStore) createIndexes() error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	_, err := s.col().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.M{"hash": 1}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: 1}}},
+		{Keys: bson.M{"expires_at": 1}},
+	})
+	if err != nil {
+		return ErrIndexCreation
+	}
+
+	return nil
+}
+
+func (s *mongoAPIKeyStore) Create(ctx context.Context, key *model.APIKey) error {
+	k := &mongoAPIKey{
+		ID:        key.ID,
+		UserID:    key.UserID,
+		Name:      key.Name,
+		Prefix:    key.Prefix,
+		Hash:      key.Hash,
+		Scopes:    key.Scopes,
+		CreatedAt: key.CreatedAt,
+	}
+	if !key.ExpiresAt.IsZero() {
+		expiresAt := key.ExpiresAt
+		k.ExpiresAt = &expiresAt
+	}
+
+	if _, err := s.col().InsertOne(ctx, k); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrDuplicateAPIKey
+		}
+		return fmt.Errorf("failed to insert api key: %w", err)
+	}
+
+	return nil
+}
+
+func (s *mongoAPIKeyStore) FindByHash(ctx context.Context, hash string) (*model.APIKey, error) {
+	var k mongoAPIKey
+	if err := s.col().FindOne(ctx, bson.M{"hash": hash}).Decode(&k); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrAPIKeyNotFound
+		}
+		return nil, fmt.Errorf("failed to find api key: %w", err)
+	}
+
+	return k.toAPIKey(), nil
+}
+
+func (s *mongoAPIKeyStore) ListByUser(ctx context.Context, userID string) ([]*model.APIKey, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}})
+	cur, err := s.col().Find(ctx, bson.M{"user_id": userID}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list api keys: %w", err)
+	}
+	defer cur.Close(ctx)
+
+	keys := make([]*model.APIKey, 0)
+	for cur.Next(ctx) {
+		var k mongoAPIKey
+		if err = cur.Decode(&k); err != nil {
+			return nil, fmt.Errorf("failed to decode api key: %w", err)
+		}
+		keys = append(keys, k.toAPIKey())
+	}
+
+	if err = cur.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list api keys: %w", err)
+	}
+
+	return keys, nil
+}
+
+func (s *mongoAPIKeyStore) Delete(ctx context.Context, userID, id string) error {
+	count, err := s.deleteMany(ctx, bson.M{"_id": id, "user_id": userID})
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrAPIKeyNotFound
+	}
+
+	return nil
+}
+
+// deleteMany removes all keys matching given filter
+func (s *mongoAPIKeyStore) deleteMany(ctx context.Context, filter bson.M) (int64, error) {
+	result, err := s.col().DeleteMany(ctx, filter)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete api keys: %w", err)
+	}
+
+	return result.DeletedCount, nil
+}
+
+func (s *mongoAPIKeyStore) DeleteByUser(ctx context.Context, userID string) (int64, error) {
+	return s.deleteMany(ctx, bson.M{"user_id": userID})
+}
+
+func (s *mongoAPIKeyStore) DeleteExpired(ctx context.Context, before time.Time) (int64, error) {
+	// keys without expiry don't match, $lt doesn't match missing fields
+	return s.deleteMany(ctx, bson.M{"expires_at": bson.M{"$lt": before}})
+}
+
+// clear removes all api keys from the collection
+func (s *mongoAPIKeyStore) clear(ctx context.Context) (int64, error) {
+	return s.deleteMany(ctx, bson.M{})
+}
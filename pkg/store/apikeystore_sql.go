@@ -0,0 +1,155 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/status-owl/user-service/pkg/model"
+)
+
+// sqlAPIKeyStore implements APIKeyStore using the table api_keys
+type sqlAPIKeyStore struct {
+	db *sql.DB
+}
+
+// apiKeyColumns are the columns scanned by scanAPIKey
+const apiKeyColumns = `id, user_id, name, prefix, hash, scopes, created_at, expires_at`
+
+// expiryToMillis returns the milliseconds since epoch of given expiry, 0 if the key never expires
+func expiryToMillis(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return toMillis(t)
+}
+
+// joinScopes returns the space separated scopes
+func joinScopes(scopes []model.Scope) string {
+	s := make([]string, len(scopes))
+	for i, scope := range scopes {
+		s[i] = string(scope)
+	}
+	return strings.Join(s, " ")
+}
+
+// splitScopes parses the space separated scopes
+func splitScopes(s string) []model.Scope {
+	fields := strings.Fields(s)
+	scopes := make([]model.Scope, len(fields))
+	for i, f := range fields {
+		scopes[i] = model.Scope(f)
+	}
+	return scopes
+}
+
+// scanAPIKey reads a key from a row containing apiKeyColumns
+func scanAPIKey(row interface{ Scan(...interface{}) error }) (*model.APIKey, error) {
+	var (
+		k                    model.APIKey
+		scopes               string
+		createdAt, expiresAt int64
+	)
+
+	if err := row.Scan(&k.ID, &k.UserID, &k.Name, &k.Prefix, &k.Hash, &scopes, &createdAt, &expiresAt); err != nil {
+		return nil, err
+	}
+
+	k.Scopes = splitScopes(scopes)
+	k.CreatedAt = fromMillis(createdAt)
+	k.ExpiresAt = fromMillis(expiresAt)
+	return &k, nil
+}
+
+func (s *sqlAPIKeyStore) Create(ctx context.Context, key *model.APIKey) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO api_keys (`+apiKeyColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		key.ID, key.UserID, key.Name, key.Prefix, key.Hash, joinScopes(key.Scopes),
+		toMillis(key.CreatedAt), expiryToMillis(key.ExpiresAt),
+	)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrDuplicateAPIKey
+		}
+		return fmt.Errorf("failed to insert api key: %w", err)
+	}
+
+	return nil
+}
+
+func (s *sqlAPIKeyStore) FindByHash(ctx context.Context, hash string) (*model.APIKey, error) {
+	k, err := scanAPIKey(s.db.QueryRowContext(ctx,
+		`SELECT `+apiKeyColumns+` FROM api_keys WHERE hash = $1`, hash,
+	))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrAPIKeyNotFound
+		}
+		return nil, fmt.Errorf("failed to find api key: %w", err)
+	}
+
+	return k, nil
+}
+
+func (s *sqlAPIKeyStore) ListByUser(ctx context.Context, userID string) ([]*model.APIKey, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+apiKeyColumns+` FROM api_keys WHERE user_id = $1 ORDER BY created_at, id`, userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list api keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := make([]*model.APIKey, 0)
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan api key: %w", err)
+		}
+		keys = append(keys, k)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list api keys: %w", err)
+	}
+
+	return keys, nil
+}
+
+func (s *sqlAPIKeyStore) Delete(ctx context.Context, userID, id string) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM api_keys WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete api key: %w", err)
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to delete api key: %w", err)
+	}
+	if count == 0 {
+		return ErrAPIKeyNotFound
+	}
+
+	return nil
+}
+
+// deleteWhere removes all keys matching given condition
+func (s *sqlAPIKeyStore) deleteWhere(ctx context.Context, where string, arg interface{}) (int64, error) {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM api_keys WHERE `+where, arg)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete api keys: %w", err)
+	}
+
+	return result.RowsAffected()
+}
+
+func (s *sqlAPIKeyStore) DeleteByUser(ctx context.Context, userID string) (int64, error) {
+	return s.deleteWhere(ctx, `user_id = $1`, userID)
+}
+
+func (s *sqlAPIKeyStore) DeleteExpired(ctx context.Context, before time.Time) (int64, error) {
+	return s.deleteWhere(ctx, `expires_at <> 0 AND expires_at < $1`, toMillis(before))
+}
@@ -0,0 +1,50 @@
+package store_test
+
+import (
+	"testing"
+
+	"github.com/rs/zerolog"
+
+	"github.com/status-owl/user-service/pkg/store"
+	"github.com/status-owl/user-service/pkg/store/storetest"
+)
+
+func TestMongoAPIKeyStore(t *testing.T) {
+	storetest.RunAPIKeys(t, func(t *testing.T) store.APIKeyStore {
+		return store.NewMongoTestStores(t).APIKeys
+	})
+}
+
+func TestPostgresAPIKeyStore(t *testing.T) {
+	storetest.RunAPIKeys(t, func(t *testing.T) store.APIKeyStore {
+		return store.NewPostgresTestStores(t).APIKeys
+	})
+}
+
+func TestMemoryAPIKeyStore(t *testing.T) {
+	storetest.RunAPIKeys(t, func(t *testing.T) store.APIKeyStore {
+		return store.NewMemoryAPIKeyStore(zerolog.Nop())
+	})
+}
+
+func TestSQLAPIKeyStore(t *testing.T) {
+	storetest.RunAPIKeys(t, func(t *testing.T) store.APIKeyStore {
+		s, err := store.NewSQLAPIKeyStore(openSQLite(t), zerolog.Nop())
+		if err != nil {
+			t.Fatalf("failed to create the sql api key store: %s", err.Error())
+		}
+
+		return s
+	})
+}
+
+func TestBoltAPIKeyStore(t *testing.T) {
+	storetest.RunAPIKeys(t, func(t *testing.T) store.APIKeyStore {
+		s, err := store.NewBoltAPIKeyStore(openBolt(t), zerolog.Nop())
+		if err != nil {
+			t.Fatalf("failed to create the bolt api key store: %s", err.Error())
+		}
+
+		return s
+	})
+}
@@ -0,0 +1,32 @@
+package store
+
+import "testing"
+
+// TestStores are the stores of a backend, they're used by the conformance tests living in the store_test package
+type TestStores struct {
+	Users         UserStore
+	RefreshTokens RefreshTokenStore
+	ResetTokens   PasswordResetTokenStore
+	APIKeys       APIKeyStore
+}
+
+// NewMongoTestStores returns the mongodb backed stores after removing all documents
+func NewMongoTestStores(t *testing.T) TestStores {
+	skipInShortMode(t)
+	clearDB()
+
+	return TestStores{Users: store, RefreshTokens: tokenStore, ResetTokens: resetTokenStore, APIKeys: apiKeyStore}
+}
+
+// NewPostgresTestStores returns the postgres backed stores after removing all rows
+func NewPostgresTestStores(t *testing.T) TestStores {
+	skipInShortMode(t)
+	clearPostgres()
+
+	return TestStores{
+		Users:         &sqlUserStore{postgresDB},
+		RefreshTokens: &sqlRefreshTokenStore{postgresDB},
+		ResetTokens:   &sqlPasswordResetTokenStore{postgresDB},
+		APIKeys:       &sqlAPIKeyStore{postgresDB},
+	}
+}
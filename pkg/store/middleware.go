@@ -44,7 +44,7 @@ func (mw *loggingMiddleware) Delete(ctx context.Context, id string) (err error)
 		} else {
 			logger.Info().
 				Str("id", id).
-				Msg("user created")
+				Msg("user deleted")
 		}
 	}()
 
@@ -52,6 +52,64 @@ func (mw *loggingMiddleware) Delete(ctx context.Context, id string) (err error)
 	return
 }
 
+func (mw *loggingMiddleware) List(ctx context.Context, query model.UserQuery) (page *model.UserPage, err error) {
+	logger := mw.logger.With().
+		Str("method", "List").
+		Stringer("query", query).
+		Logger()
+
+	logger.Trace().
+		Msg("about to list users")
+
+	defer func(begin time.Time) {
+		logger = logger.With().
+			Dur("took", time.Since(begin)).
+			Logger()
+
+		if err != nil {
+			logger.Error().
+				Err(err).
+				Msg("failed to list users")
+		} else {
+			logger.Info().
+				Int("count", len(page.Users)).
+				Bool("last", page.NextCursor == "").
+				Msg("users listed")
+		}
+	}(time.Now())
+
+	page, err = mw.next.List(ctx, query)
+	return
+}
+
+func (mw *loggingMiddleware) Update(ctx context.Context, user *model.User) (err error) {
+	logger := mw.logger.With().
+		Str("method", "Update").
+		Stringer("user", user).
+		Logger()
+
+	logger.Trace().
+		Msg("about to update a user")
+
+	defer func(begin time.Time) {
+		logger = logger.With().
+			Dur("took", time.Since(begin)).
+			Logger()
+
+		if err != nil {
+			logger.Error().
+				Err(err).
+				Msg("failed to update user")
+		} else {
+			logger.Info().
+				Msg("user updated")
+		}
+	}(time.Now())
+
+	err = mw.next.Update(ctx, user)
+	return
+}
+
 func (mw *loggingMiddleware) Create(ctx context.Context, user *model.User) (id string, err error) {
 	logger := mw.logger.With().
 		Str("method", "Create").
@@ -81,6 +139,35 @@ func (mw *loggingMiddleware) Create(ctx context.Context, user *model.User) (id s
 	return
 }
 
+func (mw *loggingMiddleware) CreateFirstAdmin(ctx context.Context, user *model.User) (id string, err error) {
+	logger := mw.logger.With().
+		Str("method", "CreateFirstAdmin").
+		Stringer("user", user).
+		Logger()
+
+	logger.Trace().
+		Msg("about to create the first admin")
+
+	defer func(begin time.Time) {
+		logger = logger.With().
+			Dur("took", time.Since(begin)).
+			Logger()
+
+		if err != nil {
+			logger.Error().
+				Err(err).
+				Msg("failed to create the first admin")
+		} else {
+			logger.Info().
+				Str("id", id).
+				Msg("first admin created")
+		}
+	}(time.Now())
+
+	id, err = mw.next.CreateFirstAdmin(ctx, user)
+	return
+}
+
 func (mw *loggingMiddleware) FindByID(ctx context.Context, id string) (user *model.User, err error) {
 	logger := mw.logger.With().
 		Str("method", "FindByID").
@@ -168,12 +255,263 @@ func (mw *loggingMiddleware) HasUsersWithRole(ctx context.Context, role model.Ro
 	return
 }
 
-func (mw *loggingMiddleware) clear(ctx context.Context) (count int64, err error) {
+func (mw *loggingMiddleware) AddFailedLogin(ctx context.Context, id string) (failures int, err error) {
+	logger := mw.logger.With().
+		Str("method", "AddFailedLogin").
+		Str("id", id).
+		Logger()
+
+	logger.Trace().
+		Msg("about to count a failed login")
+
+	defer func(begin time.Time) {
+		logger = logger.With().
+			Dur("took", time.Since(begin)).
+			Logger()
+
+		if err != nil {
+			logger.Error().
+				Err(err).
+				Msg("failed to count a failed login")
+		} else {
+			logger.Info().
+				Int("failures", failures).
+				Msg("failed login counted")
+		}
+	}(time.Now())
+
+	failures, err = mw.next.AddFailedLogin(ctx, id)
+	return
+}
+
+func (mw *loggingMiddleware) LockOutUntil(ctx context.Context, id string, until time.Time) (err error) {
+	logger := mw.logger.With().
+		Str("method", "LockOutUntil").
+		Str("id", id).
+		Time("until", until).
+		Logger()
+
+	logger.Trace().
+		Msg("about to lock out an user")
+
+	defer func(begin time.Time) {
+		logger = logger.With().
+			Dur("took", time.Since(begin)).
+			Logger()
+
+		if err != nil {
+			logger.Error().
+				Err(err).
+				Msg("failed to lock out an user")
+		} else {
+			logger.Info().
+				Msg("user locked out")
+		}
+	}(time.Now())
+
+	err = mw.next.LockOutUntil(ctx, id, until)
+	return
+}
+
+func (mw *loggingMiddleware) ResetFailedLogins(ctx context.Context, id string) (err error) {
+	logger := mw.logger.With().
+		Str("method", "ResetFailedLogins").
+		Str("id", id).
+		Logger()
+
+	logger.Trace().
+		Msg("about to reset the failed logins of an user")
+
+	defer func(begin time.Time) {
+		logger = logger.With().
+			Dur("took", time.Since(begin)).
+			Logger()
+
+		if err != nil {
+			logger.Error().
+				Err(err).
+				Msg("failed to reset the failed logins of an user")
+		} else {
+			logger.Info().
+				Msg("failed logins of an user reset")
+		}
+	}(time.Now())
+
+	err = mw.next.ResetFailedLogins(ctx, id)
+	return
+}
+
+// contains logging middleware for the RefreshTokenStore,
+// the ids are hashes of secrets and never logged
+
+type RefreshTokenMiddleware func(RefreshTokenStore) RefreshTokenStore
+
+func RefreshTokenLoggingMiddleware(logger zerolog.Logger) RefreshTokenMiddleware {
+	return func(next RefreshTokenStore) RefreshTokenStore {
+		return &refreshTokenLoggingMiddleware{
+			logger: logger.With().
+				Str("interface", "RefreshTokenStore").
+				Logger(),
+			next: next,
+		}
+	}
+}
+
+type refreshTokenLoggingMiddleware struct {
+	logger zerolog.Logger
+	next   RefreshTokenStore
+}
+
+func (mw *refreshTokenLoggingMiddleware) Create(ctx context.Context, token *model.RefreshToken) (err error) {
+	logger := mw.logger.With().
+		Str("method", "Create").
+		Stringer("token", token).
+		Logger()
+
+	logger.Trace().
+		Msg("about to create a refresh token")
+
+	defer func(begin time.Time) {
+		logger = logger.With().
+			Dur("took", time.Since(begin)).
+			Logger()
+
+		if err != nil {
+			logger.Error().
+				Err(err).
+				Msg("failed to create refresh token")
+		} else {
+			logger.Info().
+				Msg("refresh token created")
+		}
+	}(time.Now())
+
+	err = mw.next.Create(ctx, token)
+	return
+}
+
+func (mw *refreshTokenLoggingMiddleware) FindByID(ctx context.Context, id string) (token *model.RefreshToken, err error) {
+	logger := mw.logger.With().
+		Str("method", "FindByID").
+		Logger()
+
+	logger.Trace().
+		Msg("about to find a refresh token")
+
+	defer func(begin time.Time) {
+		logger = logger.With().
+			Dur("took", time.Since(begin)).
+			Logger()
+
+		if err != nil {
+			logger.Error().
+				Err(err).
+				Msg("failed to find refresh token")
+		} else {
+			logger.Info().
+				Stringer("token", token).
+				Msg("refresh token found")
+		}
+	}(time.Now())
+
+	token, err = mw.next.FindByID(ctx, id)
+	return
+}
+
+func (mw *refreshTokenLoggingMiddleware) Use(ctx context.Context, id string, at time.Time) (err error) {
+	logger := mw.logger.With().
+		Str("method", "Use").
+		Time("at", at).
+		Logger()
+
+	logger.Trace().
+		Msg("about to use a refresh token")
+
+	defer func(begin time.Time) {
+		logger = logger.With().
+			Dur("took", time.Since(begin)).
+			Logger()
+
+		if err != nil {
+			logger.Error().
+				Err(err).
+				Msg("failed to use refresh token")
+		} else {
+			logger.Info().
+				Msg("refresh token used")
+		}
+	}(time.Now())
+
+	err = mw.next.Use(ctx, id, at)
+	return
+}
+
+func (mw *refreshTokenLoggingMiddleware) DeleteFamily(ctx context.Context, familyID string) (count int64, err error) {
+	logger := mw.logger.With().
+		Str("method", "DeleteFamily").
+		Str("family_id", familyID).
+		Logger()
+
+	logger.Trace().
+		Msg("about to delete a refresh token family")
+
+	defer func(begin time.Time) {
+		logger = logger.With().
+			Dur("took", time.Since(begin)).
+			Logger()
+
+		if err != nil {
+			logger.Error().
+				Err(err).
+				Msg("failed to delete refresh token family")
+		} else {
+			logger.Info().
+				Int64("count", count).
+				Msg("refresh token family deleted")
+		}
+	}(time.Now())
+
+	count, err = mw.next.DeleteFamily(ctx, familyID)
+	return
+}
+
+func (mw *refreshTokenLoggingMiddleware) DeleteByUser(ctx context.Context, userID string) (count int64, err error) {
+	logger := mw.logger.With().
+		Str("method", "DeleteByUser").
+		Str("user_id", userID).
+		Logger()
+
+	logger.Trace().
+		Msg("about to delete the refresh tokens of a user")
+
+	defer func(begin time.Time) {
+		logger = logger.With().
+			Dur("took", time.Since(begin)).
+			Logger()
+
+		if err != nil {
+			logger.Error().
+				Err(err).
+				Msg("failed to delete refresh tokens of user")
+		} else {
+			logger.Info().
+				Int64("count", count).
+				Msg("refresh tokens of user deleted")
+		}
+	}(time.Now())
+
+	count, err = mw.next.DeleteByUser(ctx, userID)
+	return
+}
+
+func (mw *refreshTokenLoggingMiddleware) DeleteExpired(ctx context.Context, before time.Time) (count int64, err error) {
 	logger := mw.logger.With().
-		Str("method", "clear").
+		Str("method", "DeleteExpired").
+		Time("before", before).
 		Logger()
 
-	logger.Trace().Msg("about to remove all users")
+	logger.Trace().
+		Msg("about to delete expired refresh tokens")
 
 	defer func(begin time.Time) {
 		logger = logger.With().
@@ -183,15 +521,370 @@ func (mw *loggingMiddleware) clear(ctx context.Context) (count int64, err error)
 		if err != nil {
 			logger.Error().
 				Err(err).
-				Msg("failed to clear the db")
+				Msg("failed to delete expired refresh tokens")
 		} else {
 			logger.Info().
 				Int64("count", count).
-				Msg("cleared db")
+				Msg("expired refresh tokens deleted")
 		}
+	}(time.Now())
 
+	count, err = mw.next.DeleteExpired(ctx, before)
+	return
+}
+
+// contains logging middleware for the PasswordResetTokenStore,
+// the ids are hashes of secrets and never logged
+
+type PasswordResetTokenMiddleware func(PasswordResetTokenStore) PasswordResetTokenStore
+
+func PasswordResetTokenLoggingMiddleware(logger zerolog.Logger) PasswordResetTokenMiddleware {
+	return func(next PasswordResetTokenStore) PasswordResetTokenStore {
+		return &passwordResetTokenLoggingMiddleware{
+			logger: logger.With().
+				Str("interface", "PasswordResetTokenStore").
+				Logger(),
+			next: next,
+		}
+	}
+}
+
+type passwordResetTokenLoggingMiddleware struct {
+	logger zerolog.Logger
+	next   PasswordResetTokenStore
+}
+
+func (mw *passwordResetTokenLoggingMiddleware) Create(ctx context.Context, token *model.PasswordResetToken) (err error) {
+	logger := mw.logger.With().
+		Str("method", "Create").
+		Stringer("token", token).
+		Logger()
+
+	logger.Trace().
+		Msg("about to create a password reset token")
+
+	defer func(begin time.Time) {
+		logger = logger.With().
+			Dur("took", time.Since(begin)).
+			Logger()
+
+		if err != nil {
+			logger.Error().
+				Err(err).
+				Msg("failed to create password reset token")
+		} else {
+			logger.Info().
+				Msg("password reset token created")
+		}
+	}(time.Now())
+
+	err = mw.next.Create(ctx, token)
+	return
+}
+
+func (mw *passwordResetTokenLoggingMiddleware) FindByID(ctx context.Context, id string) (token *model.PasswordResetToken, err error) {
+	logger := mw.logger.With().
+		Str("method", "FindByID").
+		Logger()
+
+	logger.Trace().
+		Msg("about to find a password reset token")
+
+	defer func(begin time.Time) {
+		logger = logger.With().
+			Dur("took", time.Since(begin)).
+			Logger()
+
+		if err != nil {
+			logger.Error().
+				Err(err).
+				Msg("failed to find password reset token")
+		} else {
+			logger.Info().
+				Stringer("token", token).
+				Msg("password reset token found")
+		}
+	}(time.Now())
+
+	token, err = mw.next.FindByID(ctx, id)
+	return
+}
+
+func (mw *passwordResetTokenLoggingMiddleware) Consume(ctx context.Context, id string) (token *model.PasswordResetToken, err error) {
+	logger := mw.logger.With().
+		Str("method", "Consume").
+		Logger()
+
+	logger.Trace().
+		Msg("about to consume a password reset token")
+
+	defer func(begin time.Time) {
+		logger = logger.With().
+			Dur("took", time.Since(begin)).
+			Logger()
+
+		if err != nil {
+			logger.Error().
+				Err(err).
+				Msg("failed to consume password reset token")
+		} else {
+			logger.Info().
+				Stringer("token", token).
+				Msg("password reset token consumed")
+		}
+	}(time.Now())
+
+	token, err = mw.next.Consume(ctx, id)
+	return
+}
+
+func (mw *passwordResetTokenLoggingMiddleware) DeleteByUser(ctx context.Context, userID string) (count int64, err error) {
+	logger := mw.logger.With().
+		Str("method", "DeleteByUser").
+		Str("user_id", userID).
+		Logger()
+
+	logger.Trace().
+		Msg("about to delete the password reset tokens of a user")
+
+	defer func(begin time.Time) {
+		logger = logger.With().
+			Dur("took", time.Since(begin)).
+			Logger()
+
+		if err != nil {
+			logger.Error().
+				Err(err).
+				Msg("failed to delete password reset tokens of user")
+		} else {
+			logger.Info().
+				Int64("count", count).
+				Msg("password reset tokens of user deleted")
+		}
+	}(time.Now())
+
+	count, err = mw.next.DeleteByUser(ctx, userID)
+	return
+}
+
+func (mw *passwordResetTokenLoggingMiddleware) DeleteExpired(ctx context.Context, before time.Time) (count int64, err error) {
+	logger := mw.logger.With().
+		Str("method", "DeleteExpired").
+		Time("before", before).
+		Logger()
+
+	logger.Trace().
+		Msg("about to delete expired password reset tokens")
+
+	defer func(begin time.Time) {
+		logger = logger.With().
+			Dur("took", time.Since(begin)).
+			Logger()
+
+		if err != nil {
+			logger.Error().
+				Err(err).
+				Msg("failed to delete expired password reset tokens")
+		} else {
+			logger.Info().
+				Int64("count", count).
+				Msg("expired password reset tokens deleted")
+		}
+	}(time.Now())
+
+	count, err = mw.next.DeleteExpired(ctx, before)
+	return
+}
+
+// contains logging middleware for the APIKeyStore,
+// the hashes of the keys are never logged
+
+type APIKeyMiddleware func(APIKeyStore) APIKeyStore
+
+func APIKeyLoggingMiddleware(logger zerolog.Logger) APIKeyMiddleware {
+	return func(next APIKeyStore) APIKeyStore {
+		return &apiKeyLoggingMiddleware{
+			logger: logger.With().
+				Str("interface", "APIKeyStore").
+				Logger(),
+			next: next,
+		}
+	}
+}
+
+type apiKeyLoggingMiddleware struct {
+	logger zerolog.Logger
+	next   APIKeyStore
+}
+
+func (mw *apiKeyLoggingMiddleware) Create(ctx context.Context, key *model.APIKey) (err error) {
+	logger := mw.logger.With().
+		Str("method", "Create").
+		Stringer("key", key).
+		Logger()
+
+	logger.Trace().
+		Msg("about to create an api key")
+
+	defer func(begin time.Time) {
+		logger = logger.With().
+			Dur("took", time.Since(begin)).
+			Logger()
+
+		if err != nil {
+			logger.Error().
+				Err(err).
+				Msg("failed to create api key")
+		} else {
+			logger.Info().
+				Msg("api key created")
+		}
+	}(time.Now())
+
+	err = mw.next.Create(ctx, key)
+	return
+}
+
+func (mw *apiKeyLoggingMiddleware) FindByHash(ctx context.Context, hash string) (key *model.APIKey, err error) {
+	logger := mw.logger.With().
+		Str("method", "FindByHash").
+		Logger()
+
+	logger.Trace().
+		Msg("about to find an api key")
+
+	defer func(begin time.Time) {
+		logger = logger.With().
+			Dur("took", time.Since(begin)).
+			Logger()
+
+		if err != nil {
+			logger.Error().
+				Err(err).
+				Msg("failed to find api key")
+		} else {
+			logger.Info().
+				Stringer("key", key).
+				Msg("api key found")
+		}
+	}(time.Now())
+
+	key, err = mw.next.FindByHash(ctx, hash)
+	return
+}
+
+func (mw *apiKeyLoggingMiddleware) ListByUser(ctx context.Context, userID string) (keys []*model.APIKey, err error) {
+	logger := mw.logger.With().
+		Str("method", "ListByUser").
+		Str("user_id", userID).
+		Logger()
+
+	logger.Trace().
+		Msg("about to list the api keys of a user")
+
+	defer func(begin time.Time) {
+		logger = logger.With().
+			Dur("took", time.Since(begin)).
+			Logger()
+
+		if err != nil {
+			logger.Error().
+				Err(err).
+				Msg("failed to list api keys of user")
+		} else {
+			logger.Info().
+				Int("count", len(keys)).
+				Msg("api keys of user listed")
+		}
+	}(time.Now())
+
+	keys, err = mw.next.ListByUser(ctx, userID)
+	return
+}
+
+func (mw *apiKeyLoggingMiddleware) Delete(ctx context.Context, userID, id string) (err error) {
+	logger := mw.logger.With().
+		Str("method", "Delete").
+		Str("user_id", userID).
+		Str("id", id).
+		Logger()
+
+	logger.Trace().
+		Msg("about to delete an api key")
+
+	defer func(begin time.Time) {
+		logger = logger.With().
+			Dur("took", time.Since(begin)).
+			Logger()
+
+		if err != nil {
+			logger.Error().
+				Err(err).
+				Msg("failed to delete api key")
+		} else {
+			logger.Info().
+				Msg("api key deleted")
+		}
+	}(time.Now())
+
+	err = mw.next.Delete(ctx, userID, id)
+	return
+}
+
+func (mw *apiKeyLoggingMiddleware) DeleteByUser(ctx context.Context, userID string) (count int64, err error) {
+	logger := mw.logger.With().
+		Str("method", "DeleteByUser").
+		Str("user_id", userID).
+		Logger()
+
+	logger.Trace().
+		Msg("about to delete the api keys of a user")
+
+	defer func(begin time.Time) {
+		logger = logger.With().
+			Dur("took", time.Since(begin)).
+			Logger()
+
+		if err != nil {
+			logger.Error().
+				Err(err).
+				Msg("failed to delete api keys of user")
+		} else {
+			logger.Info().
+				Int64("count", count).
+				Msg("api keys of user deleted")
+		}
+	}(time.Now())
+
+	count, err = mw.next.DeleteByUser(ctx, userID)
+	return
+}
+
+func (mw *apiKeyLoggingMiddleware) DeleteExpired(ctx context.Context, before time.Time) (count int64, err error) {
+	logger := mw.logger.With().
+		Str("method", "DeleteExpired").
+		Time("before", before).
+		Logger()
+
+	logger.Trace().
+		Msg("about to delete expired api keys")
+
+	defer func(begin time.Time) {
+		logger = logger.With().
+			Dur("took", time.Since(begin)).
+			Logger()
+
+		if err != nil {
+			logger.Error().
+				Err(err).
+				Msg("failed to delete expired api keys")
+		} else {
+			logger.Info().
+				Int64("count", count).
+				Msg("expired api keys deleted")
+		}
 	}(time.Now())
 
-	count, err = mw.next.clear(ctx)
+	count, err = mw.next.DeleteExpired(ctx, before)
 	return
 }
@@ -0,0 +1,9 @@
+CREATE TABLE users (
+    id    VARCHAR(24) PRIMARY KEY,
+    name  TEXT        NOT NULL,
+    email TEXT        NOT NULL,
+    role  VARCHAR(32) NOT NULL,
+    CONSTRAINT users_email_key UNIQUE (email)
+);
+
+CREATE INDEX users_role_idx ON users (role);
@@ -0,0 +1,4 @@
+-- milliseconds since epoch, users created before have none
+ALTER TABLE users ADD COLUMN created_at BIGINT NOT NULL DEFAULT 0;
+
+CREATE INDEX users_created_at_idx ON users (created_at);
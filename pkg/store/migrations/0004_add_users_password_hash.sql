@@ -0,0 +1,2 @@
+-- empty for users without a password
+ALTER TABLE users ADD COLUMN password_hash TEXT NOT NULL DEFAULT '';
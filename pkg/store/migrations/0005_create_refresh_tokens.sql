@@ -0,0 +1,13 @@
+-- ids are SHA-256 hashes of the tokens, times are milliseconds since epoch
+CREATE TABLE refresh_tokens (
+    id         VARCHAR(64) PRIMARY KEY,
+    user_id    VARCHAR(24) NOT NULL,
+    family_id  VARCHAR(64) NOT NULL,
+    created_at BIGINT      NOT NULL,
+    expires_at BIGINT      NOT NULL,
+    used_at    BIGINT      NOT NULL DEFAULT 0
+);
+
+CREATE INDEX refresh_tokens_user_id_idx ON refresh_tokens (user_id);
+CREATE INDEX refresh_tokens_family_id_idx ON refresh_tokens (family_id);
+CREATE INDEX refresh_tokens_expires_at_idx ON refresh_tokens (expires_at);
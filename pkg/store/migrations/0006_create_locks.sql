@@ -0,0 +1,8 @@
+-- rows updated by transactions which must not run concurrently,
+-- e.g. the ones depending on the count of admins
+CREATE TABLE locks (
+    name    VARCHAR(64) PRIMARY KEY,
+    version BIGINT NOT NULL DEFAULT 0
+);
+
+INSERT INTO locks (name) VALUES ('admins');
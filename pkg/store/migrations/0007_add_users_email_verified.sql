@@ -0,0 +1,2 @@
+-- users created before the verification was introduced are unverified
+ALTER TABLE users ADD COLUMN email_verified BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,10 @@
+-- ids are SHA-256 hashes of the tokens, times are milliseconds since epoch
+CREATE TABLE password_reset_tokens (
+    id         VARCHAR(64) PRIMARY KEY,
+    user_id    VARCHAR(24) NOT NULL,
+    created_at BIGINT      NOT NULL,
+    expires_at BIGINT      NOT NULL
+);
+
+CREATE INDEX password_reset_tokens_user_id_idx ON password_reset_tokens (user_id);
+CREATE INDEX password_reset_tokens_expires_at_idx ON password_reset_tokens (expires_at);
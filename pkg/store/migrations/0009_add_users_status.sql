@@ -0,0 +1,3 @@
+-- users created before the lifecycle was introduced are active
+ALTER TABLE users ADD COLUMN status VARCHAR(16) NOT NULL DEFAULT 'ACTIVE';
+CREATE INDEX users_status_idx ON users (status);
@@ -0,0 +1,3 @@
+-- locked_until is given in milliseconds since epoch, 0 if the user isn't locked out
+ALTER TABLE users ADD COLUMN failed_logins INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN locked_until BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,15 @@
+-- hashes are SHA-256 hashes of the keys, scopes are space separated,
+-- times are milliseconds since epoch, an expires_at of 0 never expires
+CREATE TABLE api_keys (
+    id         VARCHAR(24)  PRIMARY KEY,
+    user_id    VARCHAR(24)  NOT NULL,
+    name       VARCHAR(100) NOT NULL,
+    prefix     VARCHAR(16)  NOT NULL,
+    hash       VARCHAR(64)  NOT NULL UNIQUE,
+    scopes     TEXT         NOT NULL,
+    created_at BIGINT       NOT NULL,
+    expires_at BIGINT       NOT NULL DEFAULT 0
+);
+
+CREATE INDEX api_keys_user_id_idx ON api_keys (user_id);
+CREATE INDEX api_keys_expires_at_idx ON api_keys (expires_at);
@@ -0,0 +1,3 @@
+-- users without privileges used to be stored with the role UNDEFINED,
+-- every role the model doesn't know any more results in a regular user
+UPDATE users SET role = 'REGULAR' WHERE role NOT IN ('ADMIN', 'REPORTER', 'REGULAR');
@@ -0,0 +1,210 @@
+package store
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/status-owl/user-service/pkg/model"
+)
+
+// contains helpers shared by the stores to list users page by page
+
+var (
+	//ErrInvalidCursor signals that a cursor is malformed or doesn't fit the query
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+// cursor identifies the last user of a page,
+// it's only valid for the sort order it was created with
+type cursor struct {
+	SortBy     model.SortField `json:"s"`
+	Descending bool            `json:"d,omitempty"`
+	// Value is the sort value of the last user
+	Value string `json:"v"`
+	ID    string `json:"i"`
+}
+
+// sortField returns the sort field of given query falling back to the creation time
+func sortField(q model.UserQuery) model.SortField {
+	if q.SortBy == "" {
+		return model.SortByCreatedAt
+	}
+	return q.SortBy
+}
+
+// sortValue returns the value of a user's property the users are sorted by
+func sortValue(u *model.User, field model.SortField) string {
+	switch field {
+	case model.SortByName:
+		return u.Name
+	case model.SortByEMail:
+		return u.EMail
+	default:
+		return strconv.FormatInt(toMillis(u.CreatedAt), 10)
+	}
+}
+
+// toMillis converts given time to milliseconds since epoch, the precision all stores keep
+func toMillis(t time.Time) int64 {
+	return t.UnixMilli()
+}
+
+// now returns the current time in the precision all stores keep
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Millisecond)
+}
+
+// encode returns the opaque string representation of the cursor
+func (c *cursor) encode() string {
+	data, err := json.Marshal(c)
+	if err != nil {
+		panic("failed to encode cursor, check your code!")
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor decodes the cursor of given query, it returns nil for the first page
+func decodeCursor(q model.UserQuery) (*cursor, error) {
+	if q.Cursor == "" {
+		return nil, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var c cursor
+	if err = json.Unmarshal(data, &c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	if c.SortBy != sortField(q) || c.Descending != q.Descending || c.ID == "" {
+		return nil, ErrInvalidCursor
+	}
+
+	if c.SortBy == model.SortByCreatedAt {
+		if _, err = strconv.ParseInt(c.Value, 10, 64); err != nil {
+			return nil, ErrInvalidCursor
+		}
+	}
+
+	return &c, nil
+}
+
+// newPage creates a page from users fetched with a limit of q.Limit+1,
+// the additional user only signals that there is a next page
+func newPage(users []*model.User, q model.UserQuery) *model.UserPage {
+	if len(users) <= q.Limit {
+		return &model.UserPage{Users: users}
+	}
+
+	users = users[:q.Limit]
+	last := users[len(users)-1]
+	field := sortField(q)
+
+	next := cursor{
+		SortBy:     field,
+		Descending: q.Descending,
+		Value:      sortValue(last, field),
+		ID:         last.ID,
+	}
+
+	return &model.UserPage{Users: users, NextCursor: next.encode()}
+}
+
+// matches reports whether given user passes the filter
+func matches(u *model.User, f model.UserFilter) bool {
+	if f.Role != "" && u.Role != f.Role {
+		return false
+	}
+
+	if f.Status != "" && u.Status != f.Status {
+		return false
+	}
+
+	if f.EMailPrefix != "" && !strings.HasPrefix(strings.ToLower(u.EMail), strings.ToLower(f.EMailPrefix)) {
+		return false
+	}
+
+	if f.NameContains != "" && !strings.Contains(strings.ToLower(u.Name), strings.ToLower(f.NameContains)) {
+		return false
+	}
+
+	if !f.CreatedBefore.IsZero() && toMillis(u.CreatedAt) >= toMillis(f.CreatedBefore) {
+		return false
+	}
+
+	if !f.CreatedAfter.IsZero() && toMillis(u.CreatedAt) <= toMillis(f.CreatedAfter) {
+		return false
+	}
+
+	return true
+}
+
+// compare compares the sort value and id of given user with the ones of the cursor
+// the result is negative if the user comes first
+func compare(u *model.User, c cursor) int {
+	var result int
+	if c.SortBy == model.SortByCreatedAt {
+		value, _ := strconv.ParseInt(c.Value, 10, 64)
+		ms := toMillis(u.CreatedAt)
+		if ms < value {
+			result = -1
+		} else if ms > value {
+			result = 1
+		}
+	} else {
+		result = strings.Compare(sortValue(u, c.SortBy), c.Value)
+	}
+
+	if result == 0 {
+		result = strings.Compare(u.ID, c.ID)
+	}
+
+	return result
+}
+
+// listUsers filters, sorts and pages given users in memory,
+// it's used by stores which are unable to query their users
+func listUsers(users []*model.User, q model.UserQuery) (*model.UserPage, error) {
+	after, err := decodeCursor(q)
+	if err != nil {
+		return nil, err
+	}
+
+	field := sortField(q)
+	var result []*model.User
+	for _, u := range users {
+		if !matches(u, q.Filter) {
+			continue
+		}
+
+		if after != nil {
+			if c := compare(u, *after); (!q.Descending && c <= 0) || (q.Descending && c >= 0) {
+				continue
+			}
+		}
+
+		result = append(result, u)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		c := compare(result[i], cursor{SortBy: field, Value: sortValue(result[j], field), ID: result[j].ID})
+		if q.Descending {
+			return c > 0
+		}
+		return c < 0
+	})
+
+	if len(result) > q.Limit+1 {
+		result = result[:q.Limit+1]
+	}
+
+	return newPage(result, q), nil
+}
@@ -0,0 +1,71 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/rs/zerolog"
+	bolt "go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/status-owl/user-service/pkg/model"
+)
+
+// PasswordResetTokenStore is responsible for storing password reset tokens,
+// tokens are deleted as soon as they're used
+type PasswordResetTokenStore interface {
+	Create(ctx context.Context, token *model.PasswordResetToken) error
+	FindByID(ctx context.Context, id string) (*model.PasswordResetToken, error)
+	// Consume deletes the token with given id and returns it,
+	// only one of concurrent calls gets the token, the others get ErrResetTokenNotFound
+	Consume(ctx context.Context, id string) (*model.PasswordResetToken, error)
+	// DeleteByUser revokes all tokens of a user and returns their count
+	DeleteByUser(ctx context.Context, userID string) (int64, error)
+	// DeleteExpired removes all tokens expired before given time and returns their count
+	DeleteExpired(ctx context.Context, before time.Time) (int64, error)
+}
+
+var (
+	//ErrResetTokenNotFound signals that a password reset token doesn't exist, has been used or revoked
+	ErrResetTokenNotFound = errors.New("password reset token not found")
+	//ErrDuplicateResetToken signals that a password reset token with given id already exists
+	ErrDuplicateResetToken = errors.New("password reset token already exists")
+)
+
+// NewPasswordResetTokenStore creates a PasswordResetTokenStore using mongodb
+func NewPasswordResetTokenStore(client *mongo.Client, logger zerolog.Logger) (PasswordResetTokenStore, error) {
+	store := &mongoPasswordResetTokenStore{client}
+	if err := store.createIndexes(); err != nil {
+		return nil, err
+	}
+
+	return PasswordResetTokenLoggingMiddleware(logger)(store), nil
+}
+
+// NewMemoryPasswordResetTokenStore creates a PasswordResetTokenStore keeping all tokens in memory
+func NewMemoryPasswordResetTokenStore(logger zerolog.Logger) PasswordResetTokenStore {
+	return PasswordResetTokenLoggingMiddleware(logger)(newMemoryPasswordResetTokenStore())
+}
+
+// NewSQLPasswordResetTokenStore creates a PasswordResetTokenStore backed by a sql database,
+// pending schema migrations are applied before the store is returned
+func NewSQLPasswordResetTokenStore(db *sql.DB, logger zerolog.Logger) (PasswordResetTokenStore, error) {
+	// the schema is shared with the sql user store
+	if err := (&sqlUserStore{db}).migrate(); err != nil {
+		return nil, err
+	}
+
+	return PasswordResetTokenLoggingMiddleware(logger)(&sqlPasswordResetTokenStore{db}), nil
+}
+
+// NewBoltPasswordResetTokenStore creates a PasswordResetTokenStore backed by an embedded bolt database
+func NewBoltPasswordResetTokenStore(db *bolt.DB, logger zerolog.Logger) (PasswordResetTokenStore, error) {
+	store := &boltPasswordResetTokenStore{db}
+	if err := store.createBuckets(); err != nil {
+		return nil, err
+	}
+
+	return PasswordResetTokenLoggingMiddleware(logger)(store), nil
+}
@@ -0,0 +1,153 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/status-owl/user-service/pkg/model"
+)
+
+// boltPasswordResetTokenStore implements PasswordResetTokenStore using an embedded bolt database file
+type boltPasswordResetTokenStore struct {
+	db *bolt.DB
+}
+
+// passwordResetTokensBucket maps token ids to json encoded tokens
+var passwordResetTokensBucket = []byte("password_reset_tokens")
+
+type boltPasswordResetToken struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (s *boltPasswordResetTokenStore) createBuckets() error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(passwordResetTokensBucket); err != nil {
+			return fmt.Errorf("failed to create bucket %q: %w", passwordResetTokensBucket, err)
+		}
+		return nil
+	})
+}
+
+func (s *boltPasswordResetTokenStore) Create(_ context.Context, token *model.PasswordResetToken) error {
+	t := boltPasswordResetToken(*token)
+	t.CreatedAt = t.CreatedAt.UTC().Truncate(time.Millisecond)
+	t.ExpiresAt = t.ExpiresAt.UTC().Truncate(time.Millisecond)
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(passwordResetTokensBucket)
+		if b.Get([]byte(t.ID)) != nil {
+			return ErrDuplicateResetToken
+		}
+
+		data, err := json.Marshal(t)
+		if err != nil {
+			return fmt.Errorf("failed to encode password reset token: %w", err)
+		}
+		return b.Put([]byte(t.ID), data)
+	})
+	if err != nil {
+		if err == ErrDuplicateResetToken {
+			return err
+		}
+		return fmt.Errorf("failed to insert password reset token: %w", err)
+	}
+
+	return nil
+}
+
+func (s *boltPasswordResetTokenStore) FindByID(_ context.Context, id string) (*model.PasswordResetToken, error) {
+	var t boltPasswordResetToken
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(passwordResetTokensBucket).Get([]byte(id))
+		if data == nil {
+			return ErrResetTokenNotFound
+		}
+
+		if err := json.Unmarshal(data, &t); err != nil {
+			return fmt.Errorf("failed to decode password reset token: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		if err == ErrResetTokenNotFound {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to find password reset token: %w", err)
+	}
+
+	token := model.PasswordResetToken(t)
+	return &token, nil
+}
+
+func (s *boltPasswordResetTokenStore) Consume(_ context.Context, id string) (*model.PasswordResetToken, error) {
+	var t boltPasswordResetToken
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(passwordResetTokensBucket)
+		data := b.Get([]byte(id))
+		if data == nil {
+			return ErrResetTokenNotFound
+		}
+
+		if err := json.Unmarshal(data, &t); err != nil {
+			return fmt.Errorf("failed to decode password reset token: %w", err)
+		}
+		return b.Delete([]byte(id))
+	})
+	if err != nil {
+		if err == ErrResetTokenNotFound {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to consume password reset token: %w", err)
+	}
+
+	token := model.PasswordResetToken(t)
+	return &token, nil
+}
+
+// deleteWhere removes all tokens matching given predicate,
+// there are no indexes, all tokens are scanned
+func (s *boltPasswordResetTokenStore) deleteWhere(matches func(t *boltPasswordResetToken) bool) (int64, error) {
+	var count int64
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		c := tx.Bucket(passwordResetTokensBucket).Cursor()
+		for k, v := c.First(); k != nil; {
+			var t boltPasswordResetToken
+			if err := json.Unmarshal(v, &t); err != nil {
+				return fmt.Errorf("failed to decode password reset token: %w", err)
+			}
+
+			if !matches(&t) {
+				k, v = c.Next()
+				continue
+			}
+
+			// the cursor moves to the next key on deletion
+			if err := c.Delete(); err != nil {
+				return err
+			}
+			count++
+			k, v = c.Seek(k)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete password reset tokens: %w", err)
+	}
+
+	return count, nil
+}
+
+func (s *boltPasswordResetTokenStore) DeleteByUser(_ context.Context, userID string) (int64, error) {
+	return s.deleteWhere(func(t *boltPasswordResetToken) bool { return t.UserID == userID })
+}
+
+func (s *boltPasswordResetTokenStore) DeleteExpired(_ context.Context, before time.Time) (int64, error) {
+	return s.deleteWhere(func(t *boltPasswordResetToken) bool { return t.ExpiresAt.Before(before) })
+}
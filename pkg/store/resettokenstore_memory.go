@@ -0,0 +1,85 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/status-owl/user-service/pkg/model"
+)
+
+// memoryPasswordResetTokenStore implements PasswordResetTokenStore keeping all tokens in memory
+type memoryPasswordResetTokenStore struct {
+	mu     sync.Mutex
+	tokens map[string]model.PasswordResetToken
+}
+
+func newMemoryPasswordResetTokenStore() *memoryPasswordResetTokenStore {
+	return &memoryPasswordResetTokenStore{tokens: make(map[string]model.PasswordResetToken)}
+}
+
+func (s *memoryPasswordResetTokenStore) Create(_ context.Context, token *model.PasswordResetToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.tokens[token.ID]; ok {
+		return ErrDuplicateResetToken
+	}
+
+	t := *token
+	t.CreatedAt = t.CreatedAt.UTC().Truncate(time.Millisecond)
+	t.ExpiresAt = t.ExpiresAt.UTC().Truncate(time.Millisecond)
+	s.tokens[t.ID] = t
+
+	return nil
+}
+
+func (s *memoryPasswordResetTokenStore) FindByID(_ context.Context, id string) (*model.PasswordResetToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.tokens[id]
+	if !ok {
+		return nil, ErrResetTokenNotFound
+	}
+
+	return &t, nil
+}
+
+func (s *memoryPasswordResetTokenStore) Consume(_ context.Context, id string) (*model.PasswordResetToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.tokens[id]
+	if !ok {
+		return nil, ErrResetTokenNotFound
+	}
+
+	delete(s.tokens, id)
+	return &t, nil
+}
+
+// deleteWhere removes all tokens matching given predicate
+func (s *memoryPasswordResetTokenStore) deleteWhere(matches func(t *model.PasswordResetToken) bool) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var count int64
+	for id, t := range s.tokens {
+		t := t
+		if matches(&t) {
+			delete(s.tokens, id)
+			count++
+		}
+	}
+
+	return count
+}
+
+func (s *memoryPasswordResetTokenStore) DeleteByUser(_ context.Context, userID string) (int64, error) {
+	return s.deleteWhere(func(t *model.PasswordResetToken) bool { return t.UserID == userID }), nil
+}
+
+func (s *memoryPasswordResetTokenStore) DeleteExpired(_ context.Context, before time.Time) (int64, error) {
+	return s.deleteWhere(func(t *model.PasswordResetToken) bool { return t.ExpiresAt.Before(before) }), nil
+}
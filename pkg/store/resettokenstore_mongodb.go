@@ -0,0 +1,121 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/status-owl/user-service/pkg/model"
+)
+
+// mongoPasswordResetTokenStore implements PasswordResetTokenStore using mongodb as backing db
+type mongoPasswordResetTokenStore struct {
+	client *mongo.Client
+}
+
+const passwordResetTokensCollectionName = "password_reset_tokens"
+
+type mongoPasswordResetToken struct {
+	ID        string    `bson:"_id"`
+	UserID    string    `bson:"user_id"`
+	CreatedAt time.Time `bson:"created_at"`
+	ExpiresAt time.Time `bson:"expires_at"`
+}
+
+func (t *mongoPasswordResetToken) toPasswordResetToken() *model.PasswordResetToken {
+	return &model.PasswordResetToken{
+		ID:        t.ID,
+		UserID:    t.UserID,
+		CreatedAt: t.CreatedAt.UTC(),
+		ExpiresAt: t.ExpiresAt.UTC(),
+	}
+}
+
+// returns password reset tokens collection
+func (s *mongoPasswordResetTokenStore) col() *mongo.Collection {
+	return s.client.
+		Database(databaseName).
+		Collection(passwordResetTokensCollectionName)
+}
+
+func (s *mongoPasswordResetTokenStore) createIndexes() error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	_, err := s.col().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.M{"user_id": 1}},
+		{Keys: bson.M{"expires_at": 1}},
+	})
+	if err != nil {
+		return ErrIndexCreation
+	}
+
+	return nil
+}
+
+func (s *mongoPasswordResetTokenStore) Create(ctx context.Context, token *model.PasswordResetToken) error {
+	_, err := s.col().InsertOne(ctx, &mongoPasswordResetToken{
+		ID:        token.ID,
+		UserID:    token.UserID,
+		CreatedAt: token.CreatedAt,
+		ExpiresAt: token.ExpiresAt,
+	})
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrDuplicateResetToken
+		}
+		return fmt.Errorf("failed to insert password reset token: %w", err)
+	}
+
+	return nil
+}
+
+func (s *mongoPasswordResetTokenStore) FindByID(ctx context.Context, id string) (*model.PasswordResetToken, error) {
+	var t mongoPasswordResetToken
+	if err := s.col().FindOne(ctx, bson.M{"_id": id}).Decode(&t); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrResetTokenNotFound
+		}
+		return nil, fmt.Errorf("failed to find password reset token: %w", err)
+	}
+
+	return t.toPasswordResetToken(), nil
+}
+
+func (s *mongoPasswordResetTokenStore) Consume(ctx context.Context, id string) (*model.PasswordResetToken, error) {
+	var t mongoPasswordResetToken
+	if err := s.col().FindOneAndDelete(ctx, bson.M{"_id": id}).Decode(&t); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrResetTokenNotFound
+		}
+		return nil, fmt.Errorf("failed to consume password reset token: %w", err)
+	}
+
+	return t.toPasswordResetToken(), nil
+}
+
+// deleteMany removes all tokens matching given filter
+func (s *mongoPasswordResetTokenStore) deleteMany(ctx context.Context, filter bson.M) (int64, error) {
+	result, err := s.col().DeleteMany(ctx, filter)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete password reset tokens: %w", err)
+	}
+
+	return result.DeletedCount, nil
+}
+
+func (s *mongoPasswordResetTokenStore) DeleteByUser(ctx context.Context, userID string) (int64, error) {
+	return s.deleteMany(ctx, bson.M{"user_id": userID})
+}
+
+func (s *mongoPasswordResetTokenStore) DeleteExpired(ctx context.Context, before time.Time) (int64, error) {
+	return s.deleteMany(ctx, bson.M{"expires_at": bson.M{"$lt": before}})
+}
+
+// clear removes all password reset tokens from the collection
+func (s *mongoPasswordResetTokenStore) clear(ctx context.Context) (int64, error) {
+	return s.deleteMany(ctx, bson.M{})
+}
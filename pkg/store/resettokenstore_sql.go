@@ -0,0 +1,89 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/status-owl/user-service/pkg/model"
+)
+
+// sqlPasswordResetTokenStore implements PasswordResetTokenStore using the table password_reset_tokens
+type sqlPasswordResetTokenStore struct {
+	db *sql.DB
+}
+
+func (s *sqlPasswordResetTokenStore) Create(ctx context.Context, token *model.PasswordResetToken) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO password_reset_tokens (id, user_id, created_at, expires_at) VALUES ($1, $2, $3, $4)`,
+		token.ID, token.UserID, toMillis(token.CreatedAt), toMillis(token.ExpiresAt),
+	)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrDuplicateResetToken
+		}
+		return fmt.Errorf("failed to insert password reset token: %w", err)
+	}
+
+	return nil
+}
+
+func (s *sqlPasswordResetTokenStore) FindByID(ctx context.Context, id string) (*model.PasswordResetToken, error) {
+	var (
+		t                    model.PasswordResetToken
+		createdAt, expiresAt int64
+	)
+
+	err := s.db.QueryRowContext(ctx,
+		`SELECT id, user_id, created_at, expires_at FROM password_reset_tokens WHERE id = $1`, id,
+	).Scan(&t.ID, &t.UserID, &createdAt, &expiresAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrResetTokenNotFound
+		}
+		return nil, fmt.Errorf("failed to find password reset token: %w", err)
+	}
+
+	t.CreatedAt = fromMillis(createdAt)
+	t.ExpiresAt = fromMillis(expiresAt)
+	return &t, nil
+}
+
+func (s *sqlPasswordResetTokenStore) Consume(ctx context.Context, id string) (*model.PasswordResetToken, error) {
+	t, err := s.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := s.deleteWhere(ctx, `id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// only the caller actually deleting the token gets it
+	if count == 0 {
+		return nil, ErrResetTokenNotFound
+	}
+
+	return t, nil
+}
+
+// deleteWhere removes all tokens matching given condition
+func (s *sqlPasswordResetTokenStore) deleteWhere(ctx context.Context, where string, arg interface{}) (int64, error) {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM password_reset_tokens WHERE `+where, arg)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete password reset tokens: %w", err)
+	}
+
+	return result.RowsAffected()
+}
+
+func (s *sqlPasswordResetTokenStore) DeleteByUser(ctx context.Context, userID string) (int64, error) {
+	return s.deleteWhere(ctx, `user_id = $1`, userID)
+}
+
+func (s *sqlPasswordResetTokenStore) DeleteExpired(ctx context.Context, before time.Time) (int64, error) {
+	return s.deleteWhere(ctx, `expires_at < $1`, toMillis(before))
+}
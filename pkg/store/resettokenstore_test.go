@@ -0,0 +1,50 @@
+package store_test
+
+import (
+	"testing"
+
+	"github.com/rs/zerolog"
+
+	"github.com/status-owl/user-service/pkg/store"
+	"github.com/status-owl/user-service/pkg/store/storetest"
+)
+
+func TestMongoPasswordResetTokenStore(t *testing.T) {
+	storetest.RunPasswordResetTokens(t, func(t *testing.T) store.PasswordResetTokenStore {
+		return store.NewMongoTestStores(t).ResetTokens
+	})
+}
+
+func TestPostgresPasswordResetTokenStore(t *testing.T) {
+	storetest.RunPasswordResetTokens(t, func(t *testing.T) store.PasswordResetTokenStore {
+		return store.NewPostgresTestStores(t).ResetTokens
+	})
+}
+
+func TestMemoryPasswordResetTokenStore(t *testing.T) {
+	storetest.RunPasswordResetTokens(t, func(t *testing.T) store.PasswordResetTokenStore {
+		return store.NewMemoryPasswordResetTokenStore(zerolog.Nop())
+	})
+}
+
+func TestSQLPasswordResetTokenStore(t *testing.T) {
+	storetest.RunPasswordResetTokens(t, func(t *testing.T) store.PasswordResetTokenStore {
+		s, err := store.NewSQLPasswordResetTokenStore(openSQLite(t), zerolog.Nop())
+		if err != nil {
+			t.Fatalf("failed to create the sql password reset token store: %s", err.Error())
+		}
+
+		return s
+	})
+}
+
+func TestBoltPasswordResetTokenStore(t *testing.T) {
+	storetest.RunPasswordResetTokens(t, func(t *testing.T) store.PasswordResetTokenStore {
+		s, err := store.NewBoltPasswordResetTokenStore(openBolt(t), zerolog.Nop())
+		if err != nil {
+			t.Fatalf("failed to create the bolt password reset token store: %s", err.Error())
+		}
+
+		return s
+	})
+}
@@ -0,0 +1,190 @@
+package storetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/status-owl/user-service/pkg/model"
+	"github.com/status-owl/user-service/pkg/store"
+)
+
+// APIKeyFactory returns an empty store.APIKeyStore, it's called once per test case
+type APIKeyFactory func(t *testing.T) store.APIKeyStore
+
+// RunAPIKeys executes the conformance suite against the api key stores created by given factory
+func RunAPIKeys(t *testing.T, newStore APIKeyFactory) {
+	tests := []struct {
+		name string
+		test func(*testing.T, store.APIKeyStore)
+	}{
+		{"Create", testCreateAPIKey},
+		{"CreateWithoutExpiry", testCreateAPIKeyWithoutExpiry},
+		{"FindByHashNotExisting", testFindAPIKeyNotExisting},
+		{"CreateDuplicate", testCreateDuplicateAPIKey},
+		{"ListByUser", testListAPIKeysByUser},
+		{"Delete", testDeleteAPIKey},
+		{"DeleteOfAnotherUser", testDeleteAPIKeyOfAnotherUser},
+		{"DeleteByUser", testDeleteAPIKeysByUser},
+		{"DeleteExpired", testDeleteExpiredAPIKeys},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newStore(t))
+		})
+	}
+}
+
+// newAPIKey returns a key valid for an hour, its hash is derived from the id
+func newAPIKey(id, userID string) model.APIKey {
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	return model.APIKey{
+		ID:        id,
+		UserID:    userID,
+		Name:      "ci " + id,
+		Prefix:    "sowl_" + id,
+		Hash:      "hash-" + id,
+		Scopes:    []model.Scope{model.ScopeUsersRead},
+		CreatedAt: now,
+		ExpiresAt: now.Add(time.Hour),
+	}
+}
+
+// mustCreateAPIKeys persists copies of given keys
+func mustCreateAPIKeys(t *testing.T, s store.APIKeyStore, keys ...model.APIKey) {
+	t.Helper()
+
+	for _, key := range keys {
+		key := key
+		if err := s.Create(context.Background(), &key); err != nil {
+			t.Fatalf("failed to create api key: %s", err.Error())
+		}
+	}
+}
+
+// assertAPIKeysExist asserts which of the keys with given ids exist
+func assertAPIKeysExist(t *testing.T, s store.APIKeyStore, expected map[string]bool) {
+	t.Helper()
+
+	for id, exists := range expected {
+		_, err := s.FindByHash(context.Background(), "hash-"+id)
+		if exists {
+			assert.Nil(t, err, "key %s should exist", id)
+		} else {
+			assert.Equal(t, store.ErrAPIKeyNotFound, err, "key %s should not exist", id)
+		}
+	}
+}
+
+func testCreateAPIKey(t *testing.T, s store.APIKeyStore) {
+	a := assert.New(t)
+
+	key := newAPIKey("k1", "u1")
+	key.Scopes = []model.Scope{model.ScopeUsersRead, model.ScopeUsersWrite}
+	mustCreateAPIKeys(t, s, key)
+
+	actual, err := s.FindByHash(context.Background(), "hash-k1")
+	require.NoError(t, err)
+	a.Equal(&key, actual)
+}
+
+func testCreateAPIKeyWithoutExpiry(t *testing.T, s store.APIKeyStore) {
+	a := assert.New(t)
+
+	key := newAPIKey("k1", "u1")
+	key.ExpiresAt = time.Time{}
+	mustCreateAPIKeys(t, s, key)
+
+	actual, err := s.FindByHash(context.Background(), "hash-k1")
+	require.NoError(t, err)
+	a.True(actual.ExpiresAt.IsZero(), "key should never expire")
+	a.Equal(&key, actual)
+}
+
+func testFindAPIKeyNotExisting(t *testing.T, s store.APIKeyStore) {
+	_, err := s.FindByHash(context.Background(), "hash-k1")
+	assert.Equal(t, store.ErrAPIKeyNotFound, err)
+}
+
+func testCreateDuplicateAPIKey(t *testing.T, s store.APIKeyStore) {
+	a := assert.New(t)
+	mustCreateAPIKeys(t, s, newAPIKey("k1", "u1"))
+
+	sameID := newAPIKey("k1", "u2")
+	sameID.Hash = "hash-other"
+	a.Equal(store.ErrDuplicateAPIKey, s.Create(context.Background(), &sameID))
+
+	sameHash := newAPIKey("k2", "u2")
+	sameHash.Hash = "hash-k1"
+	a.Equal(store.ErrDuplicateAPIKey, s.Create(context.Background(), &sameHash))
+}
+
+func testListAPIKeysByUser(t *testing.T, s store.APIKeyStore) {
+	a := assert.New(t)
+
+	first := newAPIKey("k2", "u1")
+	first.CreatedAt = first.CreatedAt.Add(-time.Minute)
+	second := newAPIKey("k1", "u1")
+	mustCreateAPIKeys(t, s, second, newAPIKey("k3", "u2"), first)
+
+	keys, err := s.ListByUser(context.Background(), "u1")
+	require.NoError(t, err)
+	a.Equal([]*model.APIKey{&first, &second}, keys, "the oldest key comes first")
+
+	keys, err = s.ListByUser(context.Background(), "u3")
+	require.NoError(t, err)
+	a.Empty(keys)
+}
+
+func testDeleteAPIKey(t *testing.T, s store.APIKeyStore) {
+	a := assert.New(t)
+	ctx := context.Background()
+
+	mustCreateAPIKeys(t, s, newAPIKey("k1", "u1"), newAPIKey("k2", "u1"))
+
+	a.Nil(s.Delete(ctx, "u1", "k1"))
+	a.Equal(store.ErrAPIKeyNotFound, s.Delete(ctx, "u1", "k1"))
+	assertAPIKeysExist(t, s, map[string]bool{"k1": false, "k2": true})
+}
+
+func testDeleteAPIKeyOfAnotherUser(t *testing.T, s store.APIKeyStore) {
+	mustCreateAPIKeys(t, s, newAPIKey("k1", "u1"))
+
+	assert.Equal(t, store.ErrAPIKeyNotFound, s.Delete(context.Background(), "u2", "k1"))
+	assertAPIKeysExist(t, s, map[string]bool{"k1": true})
+}
+
+func testDeleteAPIKeysByUser(t *testing.T, s store.APIKeyStore) {
+	a := assert.New(t)
+
+	mustCreateAPIKeys(t, s,
+		newAPIKey("k1", "u1"),
+		newAPIKey("k2", "u1"),
+		newAPIKey("k3", "u2"),
+	)
+
+	count, err := s.DeleteByUser(context.Background(), "u1")
+	require.NoError(t, err)
+	a.EqualValues(2, count)
+	assertAPIKeysExist(t, s, map[string]bool{"k1": false, "k2": false, "k3": true})
+}
+
+func testDeleteExpiredAPIKeys(t *testing.T, s store.APIKeyStore) {
+	a := assert.New(t)
+
+	expired := newAPIKey("k1", "u1")
+	expired.ExpiresAt = expired.CreatedAt.Add(-time.Minute)
+	neverExpiring := newAPIKey("k3", "u1")
+	neverExpiring.ExpiresAt = time.Time{}
+	mustCreateAPIKeys(t, s, expired, newAPIKey("k2", "u1"), neverExpiring)
+
+	count, err := s.DeleteExpired(context.Background(), time.Now())
+	require.NoError(t, err)
+	a.EqualValues(1, count)
+	assertAPIKeysExist(t, s, map[string]bool{"k1": false, "k2": true, "k3": true})
+}
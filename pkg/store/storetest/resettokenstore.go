@@ -0,0 +1,180 @@
+package storetest
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/status-owl/user-service/pkg/model"
+	"github.com/status-owl/user-service/pkg/store"
+)
+
+// PasswordResetTokenFactory returns an empty store.PasswordResetTokenStore, it's called once per test case
+type PasswordResetTokenFactory func(t *testing.T) store.PasswordResetTokenStore
+
+// RunPasswordResetTokens executes the conformance suite against the password reset token stores created by given factory
+func RunPasswordResetTokens(t *testing.T, newStore PasswordResetTokenFactory) {
+	tests := []struct {
+		name string
+		test func(*testing.T, store.PasswordResetTokenStore)
+	}{
+		{"Create", testCreateResetToken},
+		{"FindByIDNotExisting", testFindResetTokenNotExisting},
+		{"Consume", testConsumeResetToken},
+		{"ConsumeNotExisting", testConsumeResetTokenNotExisting},
+		{"ConsumeConcurrently", testConsumeResetTokenConcurrently},
+		{"CreateDuplicate", testCreateDuplicateResetToken},
+		{"DeleteByUser", testDeleteResetTokensByUser},
+		{"DeleteExpired", testDeleteExpiredResetTokens},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newStore(t))
+		})
+	}
+}
+
+// newResetToken returns a token valid for an hour
+func newResetToken(id, userID string) model.PasswordResetToken {
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	return model.PasswordResetToken{
+		ID:        id,
+		UserID:    userID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(time.Hour),
+	}
+}
+
+// mustCreateResetTokens persists copies of given tokens
+func mustCreateResetTokens(t *testing.T, s store.PasswordResetTokenStore, tokens ...model.PasswordResetToken) {
+	t.Helper()
+
+	for _, token := range tokens {
+		token := token
+		if err := s.Create(context.Background(), &token); err != nil {
+			t.Fatalf("failed to create password reset token: %s", err.Error())
+		}
+	}
+}
+
+// assertResetTokensExist asserts which of the tokens with given ids exist
+func assertResetTokensExist(t *testing.T, s store.PasswordResetTokenStore, expected map[string]bool) {
+	t.Helper()
+
+	for id, exists := range expected {
+		_, err := s.FindByID(context.Background(), id)
+		if exists {
+			assert.Nil(t, err, "token %s should exist", id)
+		} else {
+			assert.Equal(t, store.ErrResetTokenNotFound, err, "token %s should not exist", id)
+		}
+	}
+}
+
+func testCreateResetToken(t *testing.T, s store.PasswordResetTokenStore) {
+	a := assert.New(t)
+
+	token := newResetToken("t1", "u1")
+	mustCreateResetTokens(t, s, token)
+
+	actual, err := s.FindByID(context.Background(), "t1")
+	require.NoError(t, err)
+	a.Equal(&token, actual)
+}
+
+func testFindResetTokenNotExisting(t *testing.T, s store.PasswordResetTokenStore) {
+	_, err := s.FindByID(context.Background(), "t1")
+	assert.Equal(t, store.ErrResetTokenNotFound, err)
+}
+
+func testConsumeResetToken(t *testing.T, s store.PasswordResetTokenStore) {
+	a := assert.New(t)
+	ctx := context.Background()
+
+	token := newResetToken("t1", "u1")
+	mustCreateResetTokens(t, s, token)
+
+	actual, err := s.Consume(ctx, "t1")
+	require.NoError(t, err)
+	a.Equal(&token, actual)
+
+	// a token can be used only once
+	_, err = s.Consume(ctx, "t1")
+	a.Equal(store.ErrResetTokenNotFound, err)
+	assertResetTokensExist(t, s, map[string]bool{"t1": false})
+}
+
+func testConsumeResetTokenNotExisting(t *testing.T, s store.PasswordResetTokenStore) {
+	_, err := s.Consume(context.Background(), "t1")
+	assert.Equal(t, store.ErrResetTokenNotFound, err)
+}
+
+func testConsumeResetTokenConcurrently(t *testing.T, s store.PasswordResetTokenStore) {
+	mustCreateResetTokens(t, s, newResetToken("t1", "u1"))
+
+	const callers = 8
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		consumed int
+	)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			_, err := s.Consume(context.Background(), "t1")
+			if err == nil {
+				mu.Lock()
+				consumed++
+				mu.Unlock()
+			} else {
+				assert.Equal(t, store.ErrResetTokenNotFound, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 1, consumed, "only one caller gets the token")
+}
+
+func testCreateDuplicateResetToken(t *testing.T, s store.PasswordResetTokenStore) {
+	mustCreateResetTokens(t, s, newResetToken("t1", "u1"))
+
+	token := newResetToken("t1", "u2")
+	assert.Equal(t, store.ErrDuplicateResetToken, s.Create(context.Background(), &token))
+}
+
+func testDeleteResetTokensByUser(t *testing.T, s store.PasswordResetTokenStore) {
+	a := assert.New(t)
+
+	mustCreateResetTokens(t, s,
+		newResetToken("t1", "u1"),
+		newResetToken("t2", "u1"),
+		newResetToken("t3", "u2"),
+	)
+
+	count, err := s.DeleteByUser(context.Background(), "u1")
+	require.NoError(t, err)
+	a.EqualValues(2, count)
+	assertResetTokensExist(t, s, map[string]bool{"t1": false, "t2": false, "t3": true})
+}
+
+func testDeleteExpiredResetTokens(t *testing.T, s store.PasswordResetTokenStore) {
+	a := assert.New(t)
+
+	expired := newResetToken("t1", "u1")
+	expired.ExpiresAt = expired.CreatedAt.Add(-time.Minute)
+	mustCreateResetTokens(t, s, expired, newResetToken("t2", "u1"))
+
+	count, err := s.DeleteExpired(context.Background(), time.Now())
+	require.NoError(t, err)
+	a.EqualValues(1, count)
+	assertResetTokensExist(t, s, map[string]bool{"t1": false, "t2": true})
+}
@@ -0,0 +1,936 @@
+// Package storetest provides conformance test suites for store.UserStore and store.RefreshTokenStore implementations.
+package storetest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/status-owl/user-service/pkg/model"
+	"github.com/status-owl/user-service/pkg/store"
+)
+
+// Factory returns an empty store.UserStore, it's called once per test case
+type Factory func(t *testing.T) store.UserStore
+
+// Run executes the conformance suite against the stores created by given factory,
+// every backend is expected to behave exactly like the mongodb one
+func Run(t *testing.T, newStore Factory) {
+	tests := []struct {
+		name string
+		test func(*testing.T, store.UserStore)
+	}{
+		{"Create", testCreate},
+		{"CreateWithoutRole", testCreateWithoutRole},
+		{"CreateDuplicateEMail", testCreateDuplicateEMail},
+		{"PasswordHash", testPasswordHash},
+		{"FindByID", testFindByID},
+		{"FindByIDMalformedID", testFindByIDMalformedID},
+		{"FindByIDDeletedUser", testFindByIDDeletedUser},
+		{"FindByEMail", testFindByEMail},
+		{"FindByEMailNotExisting", testFindByEMailNotExisting},
+		{"HasUsersWithRole", testHasUsersWithRole},
+		{"CreateFirstAdmin", testCreateFirstAdmin},
+		{"CreateFirstAdminExisting", testCreateFirstAdminExisting},
+		{"CreateFirstAdminConcurrently", testCreateFirstAdminConcurrently},
+		{"List", testList},
+		{"ListEmpty", testListEmpty},
+		{"ListPages", testListPages},
+		{"ListSorted", testListSorted},
+		{"ListFiltered", testListFiltered},
+		{"ListCreatedBetween", testListCreatedBetween},
+		{"ListInvalidCursor", testListInvalidCursor},
+		{"Update", testUpdate},
+		{"UpdateKeepEMail", testUpdateKeepEMail},
+		{"UpdateDuplicateEMail", testUpdateDuplicateEMail},
+		{"UpdateNotExisting", testUpdateNotExisting},
+		{"UpdateRole", testUpdateRole},
+		{"UpdateEMailVerified", testUpdateEMailVerified},
+		{"UpdateMFA", testUpdateMFA},
+		{"UpdateDemoteLastAdmin", testUpdateDemoteLastAdmin},
+		{"UpdateVersion", testUpdateVersion},
+		{"UpdateVersionConflict", testUpdateVersionConflict},
+		{"Delete", testDelete},
+		{"DeleteNotExisting", testDeleteNotExisting},
+		{"DeleteMalformedID", testDeleteMalformedID},
+		{"DeleteLastAdmin", testDeleteLastAdmin},
+		{"RemoveAdminsConcurrently", testRemoveAdminsConcurrently},
+		{"FailedLogins", testFailedLogins},
+		{"FailedLoginsConcurrently", testFailedLoginsConcurrently},
+		{"FailedLoginsNotExisting", testFailedLoginsNotExisting},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newStore(t))
+		})
+	}
+}
+
+var fixtures = struct {
+	admin, reporter, regular, withoutRole model.User
+}{
+	admin: model.User{
+		Name:   "Mary Doe",
+		EMail:  "mary.doe@example.com",
+		Role:   model.Admin,
+		Status: model.Active,
+	},
+	reporter: model.User{
+		Name:   "Fritz Nebel",
+		EMail:  "fritz.nebel@example.com",
+		Role:   model.Reporter,
+		Status: model.Pending,
+	},
+	regular: model.User{
+		Name:   "John Doe",
+		EMail:  "john.doe@example.com",
+		Role:   model.Regular,
+		Status: model.Suspended,
+	},
+	withoutRole: model.User{
+		Name:  "Mark Defoe",
+		EMail: "mark.defoe@example.com",
+	},
+}
+
+// mustCreate persists a copy of given user and returns the generated id
+func mustCreate(t *testing.T, s store.UserStore, user model.User) string {
+	t.Helper()
+
+	id, err := s.Create(context.Background(), &user)
+	if err != nil {
+		t.Fatalf("failed to create user: %s", err.Error())
+	}
+
+	return id
+}
+
+// mustFind returns the user with given id
+func mustFind(t *testing.T, s store.UserStore, id string) *model.User {
+	t.Helper()
+
+	user, err := s.FindByID(context.Background(), id)
+	if err != nil {
+		t.Fatalf("failed to find user: %s", err.Error())
+	}
+
+	return user
+}
+
+func testCreate(t *testing.T, s store.UserStore) {
+	a := assert.New(t)
+
+	before := time.Now().Truncate(time.Millisecond)
+	user := fixtures.reporter
+	id, err := s.Create(context.Background(), &user)
+	require.NoError(t, err)
+	a.NotEmpty(id)
+	a.Empty(user.ID, "the given user must not be modified")
+
+	actual, err := s.FindByID(context.Background(), id)
+	require.NoError(t, err)
+	a.False(actual.CreatedAt.Before(before), "the creation time is set by the store")
+	a.False(actual.CreatedAt.After(time.Now()), "the creation time is set by the store")
+	a.Equal(&model.User{
+		ID:        id,
+		Name:      user.Name,
+		EMail:     user.EMail,
+		Role:      user.Role,
+		Status:    user.Status,
+		Version:   1,
+		CreatedAt: actual.CreatedAt,
+	}, actual)
+
+	// every user gets its own id
+	other := mustCreate(t, s, fixtures.admin)
+	a.NotEqual(id, other)
+}
+
+func testCreateWithoutRole(t *testing.T, s store.UserStore) {
+	id := mustCreate(t, s, fixtures.withoutRole)
+
+	actual, err := s.FindByID(context.Background(), id)
+	require.NoError(t, err)
+	assert.Equal(t, model.Regular, actual.Role)
+	assert.Equal(t, model.Active, actual.Status, "users without a status are active")
+}
+
+func testCreateDuplicateEMail(t *testing.T, s store.UserStore) {
+	a := assert.New(t)
+	mustCreate(t, s, fixtures.reporter)
+
+	duplicate := fixtures.admin
+	duplicate.EMail = fixtures.reporter.EMail
+	_, err := s.Create(context.Background(), &duplicate)
+	a.ErrorIs(err, store.ErrDuplicateEMail)
+
+	// the original user is left untouched
+	actual, err := s.FindByEMail(context.Background(), fixtures.reporter.EMail)
+	require.NoError(t, err)
+	a.Equal(fixtures.reporter.Name, actual.Name)
+	a.Equal(fixtures.reporter.Role, actual.Role)
+}
+
+func testPasswordHash(t *testing.T, s store.UserStore) {
+	a := assert.New(t)
+
+	user := fixtures.reporter
+	user.PasswordHash = "$argon2id$v=19$m=65536,t=3,p=4$c2FsdA$aGFzaA"
+	id := mustCreate(t, s, user)
+	withoutPassword := mustCreate(t, s, fixtures.admin)
+
+	actual := mustFind(t, s, id)
+	a.Equal(user.PasswordHash, actual.PasswordHash)
+	a.Empty(mustFind(t, s, withoutPassword).PasswordHash)
+
+	actual, err := s.FindByEMail(context.Background(), user.EMail)
+	require.NoError(t, err)
+	a.Equal(user.PasswordHash, actual.PasswordHash)
+
+	// the hash is replaced by an update
+	updated := mustFind(t, s, id)
+	updated.PasswordHash = "$2a$10$abcdefghijklmnopqrstuu5UhWDrNzEyZVb4xuYnxNDSHIIqH8zEa"
+	a.Nil(s.Update(context.Background(), updated))
+	a.Equal(updated.PasswordHash, mustFind(t, s, id).PasswordHash)
+
+	// and can be removed
+	updated.PasswordHash = ""
+	a.Nil(s.Update(context.Background(), updated))
+	a.Empty(mustFind(t, s, id).PasswordHash)
+}
+
+func testFindByID(t *testing.T, s store.UserStore) {
+	a := assert.New(t)
+
+	ids := make(map[string]model.User)
+	for _, u := range []model.User{fixtures.admin, fixtures.reporter, fixtures.regular} {
+		ids[mustCreate(t, s, u)] = u
+	}
+
+	for id, expected := range ids {
+		actual, err := s.FindByID(context.Background(), id)
+		require.NoError(t, err)
+		a.Equal(id, actual.ID)
+		a.Equal(expected.Name, actual.Name)
+		a.Equal(expected.EMail, actual.EMail)
+		a.Equal(expected.Role, actual.Role)
+	}
+}
+
+func testFindByIDMalformedID(t *testing.T, s store.UserStore) {
+	for _, id := range []string{"", "123", "not-an-id", "zzzzzzzzzzzzzzzzzzzzzzzz"} {
+		_, err := s.FindByID(context.Background(), id)
+		assert.ErrorIs(t, err, store.ErrNotFound, "id %q", id)
+	}
+}
+
+func testFindByIDDeletedUser(t *testing.T, s store.UserStore) {
+	id := mustCreate(t, s, fixtures.reporter)
+	assert.Nil(t, s.Delete(context.Background(), id))
+
+	_, err := s.FindByID(context.Background(), id)
+	assert.ErrorIs(t, err, store.ErrNotFound)
+}
+
+func testFindByEMail(t *testing.T, s store.UserStore) {
+	a := assert.New(t)
+	mustCreate(t, s, fixtures.admin)
+	id := mustCreate(t, s, fixtures.reporter)
+
+	actual, err := s.FindByEMail(context.Background(), fixtures.reporter.EMail)
+	require.NoError(t, err)
+	a.Equal(id, actual.ID)
+	a.Equal(fixtures.reporter.Name, actual.Name)
+	a.Equal(fixtures.reporter.EMail, actual.EMail)
+	a.Equal(fixtures.reporter.Role, actual.Role)
+}
+
+func testFindByEMailNotExisting(t *testing.T, s store.UserStore) {
+	mustCreate(t, s, fixtures.reporter)
+
+	_, err := s.FindByEMail(context.Background(), "not-existing-user@example.com")
+	assert.ErrorIs(t, err, store.ErrNotFound)
+}
+
+func testHasUsersWithRole(t *testing.T, s store.UserStore) {
+	a := assert.New(t)
+
+	exist, err := s.HasUsersWithRole(context.Background(), model.Admin)
+	require.NoError(t, err)
+	a.False(exist, "an empty store has no admins")
+
+	reporterID := mustCreate(t, s, fixtures.reporter)
+	mustCreate(t, s, fixtures.withoutRole)
+
+	exist, err = s.HasUsersWithRole(context.Background(), model.Admin)
+	require.NoError(t, err)
+	a.False(exist)
+
+	exist, err = s.HasUsersWithRole(context.Background(), model.Reporter)
+	require.NoError(t, err)
+	a.True(exist)
+
+	exist, err = s.HasUsersWithRole(context.Background(), model.Regular)
+	require.NoError(t, err)
+	a.True(exist, "users without a role are stored as regular users")
+
+	id := mustCreate(t, s, fixtures.admin)
+	exist, err = s.HasUsersWithRole(context.Background(), model.Admin)
+	require.NoError(t, err)
+	a.True(exist)
+
+	a.Nil(s.Delete(context.Background(), reporterID))
+	exist, err = s.HasUsersWithRole(context.Background(), model.Reporter)
+	require.NoError(t, err)
+	a.False(exist, "the only reporter was deleted")
+
+	a.Equal(store.ErrLastAdmin, s.Delete(context.Background(), id))
+	exist, err = s.HasUsersWithRole(context.Background(), model.Admin)
+	require.NoError(t, err)
+	a.True(exist, "the only admin can't be deleted")
+}
+
+func testCreateFirstAdmin(t *testing.T, s store.UserStore) {
+	a := assert.New(t)
+	ctx := context.Background()
+
+	user := fixtures.regular
+	id, err := s.CreateFirstAdmin(ctx, &user)
+	require.NoError(t, err)
+	a.Equal(model.Regular, user.Role, "the given user must not be modified")
+	a.Equal(model.Admin, mustFind(t, s, id).Role)
+
+	user = fixtures.reporter
+	_, err = s.CreateFirstAdmin(ctx, &user)
+	a.Equal(store.ErrAdminExists, err)
+
+	_, err = s.FindByEMail(ctx, user.EMail)
+	a.Equal(store.ErrNotFound, err, "the user must not be created")
+}
+
+func testCreateFirstAdminExisting(t *testing.T, s store.UserStore) {
+	a := assert.New(t)
+	ctx := context.Background()
+
+	mustCreate(t, s, fixtures.admin)
+
+	user := fixtures.regular
+	_, err := s.CreateFirstAdmin(ctx, &user)
+	a.Equal(store.ErrAdminExists, err)
+
+}
+
+func testCreateFirstAdminConcurrently(t *testing.T, s store.UserStore) {
+	a := assert.New(t)
+
+	const count = 8
+	errs := make(chan error, count)
+
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := s.CreateFirstAdmin(context.Background(), &model.User{
+				Name:  fmt.Sprintf("User %d", i),
+				EMail: fmt.Sprintf("user%d@example.com", i),
+			})
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	var created int
+	for err := range errs {
+		if err == nil {
+			created++
+		} else {
+			a.Equal(store.ErrAdminExists, err)
+		}
+	}
+	a.Equal(1, created, "exactly one user becomes admin")
+
+	page, err := s.List(context.Background(), model.UserQuery{Filter: model.UserFilter{Role: model.Admin}, Limit: count})
+	require.NoError(t, err)
+	a.Len(page.Users, 1)
+}
+
+// mustCreateAll persists copies of given users one after another
+// making sure every one of them has its own creation time
+func mustCreateAll(t *testing.T, s store.UserStore, users ...model.User) []string {
+	t.Helper()
+
+	ids := make([]string, 0, len(users))
+	for _, u := range users {
+		ids = append(ids, mustCreate(t, s, u))
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	return ids
+}
+
+// mustList returns the ids of the users of the page listed by given query
+func mustList(t *testing.T, s store.UserStore, query model.UserQuery) ([]string, string) {
+	t.Helper()
+
+	page, err := s.List(context.Background(), query)
+	if err != nil {
+		t.Fatalf("failed to list users: %s", err.Error())
+	}
+
+	ids := make([]string, 0, len(page.Users))
+	for _, u := range page.Users {
+		ids = append(ids, u.ID)
+	}
+
+	return ids, page.NextCursor
+}
+
+func testList(t *testing.T, s store.UserStore) {
+	a := assert.New(t)
+	ids := mustCreateAll(t, s, fixtures.admin, fixtures.reporter, fixtures.regular)
+
+	page, err := s.List(context.Background(), model.UserQuery{Limit: 10})
+	require.NoError(t, err)
+	a.Empty(page.NextCursor, "all users fit on the first page")
+	if a.Len(page.Users, 3) {
+		// users are listed in creation order by default
+		for i, id := range ids {
+			a.Equal(mustFind(t, s, id), page.Users[i])
+		}
+	}
+
+	actual, _ := mustList(t, s, model.UserQuery{Limit: 10, Descending: true})
+	a.Equal([]string{ids[2], ids[1], ids[0]}, actual)
+}
+
+func testListEmpty(t *testing.T, s store.UserStore) {
+	page, err := s.List(context.Background(), model.UserQuery{Limit: 10})
+	require.NoError(t, err)
+	assert.Empty(t, page.Users)
+	assert.Empty(t, page.NextCursor)
+}
+
+func testListPages(t *testing.T, s store.UserStore) {
+	a := assert.New(t)
+	ids := mustCreateAll(t, s, fixtures.admin, fixtures.reporter, fixtures.regular, fixtures.withoutRole)
+
+	for _, tt := range []struct {
+		sortBy     model.SortField
+		descending bool
+	}{
+		{model.SortByCreatedAt, false},
+		{model.SortByCreatedAt, true},
+		{model.SortByName, false},
+		{model.SortByEMail, true},
+	} {
+		query := model.UserQuery{SortBy: tt.sortBy, Descending: tt.descending, Limit: 4}
+		all, _ := mustList(t, s, query)
+
+		query.Limit = 3
+		first, cursor := mustList(t, s, query)
+		a.Equal(all[:3], first, "sort by %s", tt.sortBy)
+		a.NotEmpty(cursor, "sort by %s", tt.sortBy)
+
+		query.Cursor = cursor
+		second, cursor := mustList(t, s, query)
+		a.Equal(all[3:], second, "sort by %s", tt.sortBy)
+		a.Empty(cursor, "sort by %s", tt.sortBy)
+	}
+
+	// a full last page still has a cursor pointing to an empty page
+	first, cursor := mustList(t, s, model.UserQuery{Limit: 2})
+	a.Equal(ids[:2], first)
+
+	second, cursor := mustList(t, s, model.UserQuery{Limit: 2, Cursor: cursor})
+	a.Equal(ids[2:], second)
+	a.Empty(cursor)
+}
+
+func testListSorted(t *testing.T, s store.UserStore) {
+	a := assert.New(t)
+	// Fritz Nebel, John Doe, Mark Defoe, Mary Doe
+	ids := mustCreateAll(t, s, fixtures.admin, fixtures.reporter, fixtures.regular, fixtures.withoutRole)
+	admin, reporter, regular, withoutRole := ids[0], ids[1], ids[2], ids[3]
+
+	actual, _ := mustList(t, s, model.UserQuery{SortBy: model.SortByName, Limit: 10})
+	a.Equal([]string{reporter, regular, withoutRole, admin}, actual)
+
+	actual, _ = mustList(t, s, model.UserQuery{SortBy: model.SortByName, Descending: true, Limit: 10})
+	a.Equal([]string{admin, withoutRole, regular, reporter}, actual)
+
+	actual, _ = mustList(t, s, model.UserQuery{SortBy: model.SortByEMail, Limit: 10})
+	a.Equal([]string{reporter, regular, withoutRole, admin}, actual)
+
+	// users with the same sort value are ordered by their ids
+	for _, id := range []string{regular, withoutRole} {
+		u := mustFind(t, s, id)
+		u.Name = "Doe"
+		a.Nil(s.Update(context.Background(), u))
+	}
+
+	first, cursor := mustList(t, s, model.UserQuery{SortBy: model.SortByName, Limit: 1})
+	second, _ := mustList(t, s, model.UserQuery{SortBy: model.SortByName, Limit: 1, Cursor: cursor})
+	a.ElementsMatch([]string{regular, withoutRole}, append(first, second...))
+}
+
+func testListFiltered(t *testing.T, s store.UserStore) {
+	a := assert.New(t)
+	ids := mustCreateAll(t, s, fixtures.admin, fixtures.reporter, fixtures.regular, fixtures.withoutRole)
+	admin, reporter, regular, withoutRole := ids[0], ids[1], ids[2], ids[3]
+
+	for _, tt := range []struct {
+		name     string
+		filter   model.UserFilter
+		expected []string
+	}{
+		{"role", model.UserFilter{Role: model.Admin}, []string{admin}},
+		{"regular role", model.UserFilter{Role: model.Regular}, []string{regular, withoutRole}},
+		{"unknown role", model.UserFilter{Role: "UNDEFINED"}, []string{}},
+		{"status", model.UserFilter{Status: model.Suspended}, []string{regular}},
+		{"active status", model.UserFilter{Status: model.Active}, []string{admin, withoutRole}},
+		{"email prefix", model.UserFilter{EMailPrefix: "MA"}, []string{admin, withoutRole}},
+		{"email in the middle", model.UserFilter{EMailPrefix: "doe"}, []string{}},
+		{"email wildcard", model.UserFilter{EMailPrefix: "%"}, []string{}},
+		{"name", model.UserFilter{NameContains: "doe"}, []string{admin, regular}},
+		{"name wildcard", model.UserFilter{NameContains: "_"}, []string{}},
+		{"combined", model.UserFilter{NameContains: "e", EMailPrefix: "m", Role: model.Regular}, []string{withoutRole}},
+	} {
+		actual, cursor := mustList(t, s, model.UserQuery{Filter: tt.filter, Limit: 10})
+		a.Equal(tt.expected, actual, tt.name)
+		a.Empty(cursor, tt.name)
+	}
+
+	// the filter applies to all pages
+	query := model.UserQuery{Filter: model.UserFilter{NameContains: "doe"}, Limit: 1}
+	first, cursor := mustList(t, s, query)
+	a.Equal([]string{admin}, first)
+
+	query.Cursor = cursor
+	second, _ := mustList(t, s, query)
+	a.Equal([]string{regular}, second)
+	a.NotContains(second, reporter)
+}
+
+func testListCreatedBetween(t *testing.T, s store.UserStore) {
+	a := assert.New(t)
+	first := mustCreateAll(t, s, fixtures.admin)[0]
+	start := mustFind(t, s, first).CreatedAt
+
+	ids := mustCreateAll(t, s, fixtures.reporter, fixtures.regular)
+	end := mustFind(t, s, ids[1]).CreatedAt
+	last := mustCreateAll(t, s, fixtures.withoutRole)[0]
+
+	// both bounds are exclusive
+	actual, _ := mustList(t, s, model.UserQuery{Filter: model.UserFilter{CreatedAfter: start}, Limit: 10})
+	a.Equal([]string{ids[0], ids[1], last}, actual)
+
+	actual, _ = mustList(t, s, model.UserQuery{Filter: model.UserFilter{CreatedBefore: end}, Limit: 10})
+	a.Equal([]string{first, ids[0]}, actual)
+
+	actual, _ = mustList(t, s, model.UserQuery{
+		Filter: model.UserFilter{CreatedAfter: start, CreatedBefore: end.Add(time.Millisecond)},
+		Limit:  10,
+	})
+	a.Equal(ids, actual)
+}
+
+func testListInvalidCursor(t *testing.T, s store.UserStore) {
+	a := assert.New(t)
+	mustCreateAll(t, s, fixtures.admin, fixtures.reporter)
+
+	_, cursor := mustList(t, s, model.UserQuery{Limit: 1})
+	a.NotEmpty(cursor)
+
+	for _, query := range []model.UserQuery{
+		{Limit: 1, Cursor: "not a cursor"},
+		{Limit: 1, Cursor: "bm90IGEgY3Vyc29y"},
+		// cursors are bound to the sort order they were created with
+		{Limit: 1, Cursor: cursor, SortBy: model.SortByName},
+		{Limit: 1, Cursor: cursor, Descending: true},
+	} {
+		_, err := s.List(context.Background(), query)
+		a.ErrorIs(err, store.ErrInvalidCursor, "cursor %q", query.Cursor)
+	}
+}
+
+func testUpdate(t *testing.T, s store.UserStore) {
+	a := assert.New(t)
+	id := mustCreate(t, s, fixtures.reporter)
+	otherID := mustCreate(t, s, fixtures.admin)
+
+	updated := &model.User{
+		ID:        id,
+		Name:      "Fritz Nebelmann",
+		EMail:     "fritz.nebelmann@example.com",
+		Role:      model.Reporter,
+		Status:    model.Locked,
+		Version:   1,
+		CreatedAt: mustFind(t, s, id).CreatedAt,
+	}
+	a.Nil(s.Update(context.Background(), updated))
+
+	actual, err := s.FindByID(context.Background(), id)
+	require.NoError(t, err)
+	a.Equal(updated, actual)
+
+	actual, err = s.FindByEMail(context.Background(), updated.EMail)
+	require.NoError(t, err)
+	a.Equal(id, actual.ID)
+
+	// the previous email address is released
+	_, err = s.FindByEMail(context.Background(), fixtures.reporter.EMail)
+	a.ErrorIs(err, store.ErrNotFound)
+	mustCreate(t, s, fixtures.reporter)
+
+	// other users are left untouched
+	actual, err = s.FindByID(context.Background(), otherID)
+	require.NoError(t, err)
+	a.Equal(fixtures.admin.Name, actual.Name)
+}
+
+func testUpdateKeepEMail(t *testing.T, s store.UserStore) {
+	a := assert.New(t)
+	id := mustCreate(t, s, fixtures.reporter)
+
+	updated := mustFind(t, s, id)
+	updated.Name = "Fritz Nebelmann"
+	a.Nil(s.Update(context.Background(), updated))
+
+	actual, err := s.FindByEMail(context.Background(), fixtures.reporter.EMail)
+	require.NoError(t, err)
+	a.Equal(updated.Name, actual.Name)
+}
+
+func testUpdateDuplicateEMail(t *testing.T, s store.UserStore) {
+	a := assert.New(t)
+	id := mustCreate(t, s, fixtures.reporter)
+	mustCreate(t, s, fixtures.admin)
+
+	updated := mustFind(t, s, id)
+	updated.EMail = fixtures.admin.EMail
+	a.ErrorIs(s.Update(context.Background(), updated), store.ErrDuplicateEMail)
+
+	// nothing has been changed
+	actual, err := s.FindByID(context.Background(), id)
+	require.NoError(t, err)
+	a.Equal(fixtures.reporter.EMail, actual.EMail)
+
+	actual, err = s.FindByEMail(context.Background(), fixtures.admin.EMail)
+	require.NoError(t, err)
+	a.Equal(fixtures.admin.Name, actual.Name)
+}
+
+func testUpdateNotExisting(t *testing.T, s store.UserStore) {
+	a := assert.New(t)
+	id := mustCreate(t, s, fixtures.reporter)
+	a.Nil(s.Delete(context.Background(), id))
+
+	for _, id := range []string{id, "", "abcde"} {
+		updated := fixtures.reporter
+		updated.ID = id
+		updated.Version = 1
+		a.ErrorIs(s.Update(context.Background(), &updated), store.ErrNotFound, "id %q", id)
+	}
+
+	// a failed update doesn't create a user
+	_, err := s.FindByEMail(context.Background(), fixtures.reporter.EMail)
+	a.ErrorIs(err, store.ErrNotFound)
+}
+
+func testUpdateRole(t *testing.T, s store.UserStore) {
+	a := assert.New(t)
+	id := mustCreate(t, s, fixtures.reporter)
+
+	updated := mustFind(t, s, id)
+	updated.Role = model.Admin
+	a.Nil(s.Update(context.Background(), updated))
+
+	exist, err := s.HasUsersWithRole(context.Background(), model.Reporter)
+	require.NoError(t, err)
+	a.False(exist)
+
+	exist, err = s.HasUsersWithRole(context.Background(), model.Admin)
+	require.NoError(t, err)
+	a.True(exist)
+}
+
+func testUpdateEMailVerified(t *testing.T, s store.UserStore) {
+	a := assert.New(t)
+	id := mustCreate(t, s, fixtures.reporter)
+
+	user := mustFind(t, s, id)
+	a.False(user.EMailVerified, "new users are unverified")
+
+	user.EMailVerified = true
+	a.Nil(s.Update(context.Background(), user))
+	a.True(mustFind(t, s, id).EMailVerified)
+
+	verified := fixtures.regular
+	verified.EMailVerified = true
+	a.True(mustFind(t, s, mustCreate(t, s, verified)).EMailVerified)
+}
+
+func testUpdateMFA(t *testing.T, s store.UserStore) {
+	a := assert.New(t)
+	id := mustCreate(t, s, fixtures.reporter)
+
+	user := mustFind(t, s, id)
+	a.False(user.MFAEnabled, "new users have no authenticator")
+	a.Empty(user.TOTPSecret)
+	a.Nil(user.RecoveryCodes)
+
+	user.TOTPSecret = "JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP"
+	user.MFAEnabled = true
+	user.TOTPLastStep = 54_321_987
+	user.RecoveryCodes = []string{"3a5f", "9b0c"}
+	a.Nil(s.Update(context.Background(), user))
+
+	actual := mustFind(t, s, id)
+	a.Equal(user.TOTPSecret, actual.TOTPSecret)
+	a.True(actual.MFAEnabled)
+	a.Equal(user.TOTPLastStep, actual.TOTPLastStep)
+	a.Equal(user.RecoveryCodes, actual.RecoveryCodes)
+
+	// consuming the last recovery code and disabling
+	actual.RecoveryCodes = nil
+	actual.TOTPSecret = ""
+	actual.MFAEnabled = false
+	a.Nil(s.Update(context.Background(), actual))
+
+	actual = mustFind(t, s, id)
+	a.Empty(actual.TOTPSecret)
+	a.False(actual.MFAEnabled)
+	a.Empty(actual.RecoveryCodes)
+}
+
+func testUpdateDemoteLastAdmin(t *testing.T, s store.UserStore) {
+	a := assert.New(t)
+	id := mustCreate(t, s, fixtures.admin)
+
+	demoted := mustFind(t, s, id)
+	demoted.Role = model.Reporter
+	a.Equal(store.ErrLastAdmin, s.Update(context.Background(), demoted))
+	a.Equal(int64(1), demoted.Version, "the version is kept on failure")
+
+	stored := mustFind(t, s, id)
+	a.Equal(model.Admin, stored.Role)
+	a.Equal(int64(1), stored.Version)
+
+	// as soon as there is another admin the first one can be demoted
+	mustCreate(t, s, model.User{Name: "Max Doe", EMail: "max.doe@example.com", Role: model.Admin})
+	a.Nil(s.Update(context.Background(), demoted))
+	a.Equal(model.Reporter, mustFind(t, s, id).Role)
+
+	// admins can be updated without being demoted
+	other := mustFind(t, s, mustCreate(t, s, model.User{Name: "Eve Doe", EMail: "eve.doe@example.com", Role: model.Admin}))
+	other.Name = "Eve Smith"
+	a.Nil(s.Update(context.Background(), other))
+}
+
+func testUpdateVersion(t *testing.T, s store.UserStore) {
+	a := assert.New(t)
+	id := mustCreate(t, s, fixtures.reporter)
+
+	user := mustFind(t, s, id)
+	a.Equal(int64(1), user.Version, "new users start with version 1")
+
+	for version := int64(2); version < 5; version++ {
+		a.Nil(s.Update(context.Background(), user))
+		a.Equal(version, user.Version, "the version of the given user is incremented")
+		a.Equal(version, mustFind(t, s, id).Version)
+	}
+}
+
+func testUpdateVersionConflict(t *testing.T, s store.UserStore) {
+	a := assert.New(t)
+	id := mustCreate(t, s, fixtures.reporter)
+
+	// two concurrent modifications based on the same version
+	first, second := mustFind(t, s, id), mustFind(t, s, id)
+
+	first.Name = "Fritz Nebelmann"
+	a.Nil(s.Update(context.Background(), first))
+
+	second.Name = "Fritz Nebelhorn"
+	a.ErrorIs(s.Update(context.Background(), second), store.ErrVersionConflict)
+	a.Equal(int64(1), second.Version, "the version of a rejected user is left untouched")
+
+	// the first modification wins
+	a.Equal(first, mustFind(t, s, id))
+}
+
+func testDelete(t *testing.T, s store.UserStore) {
+	a := assert.New(t)
+	id := mustCreate(t, s, fixtures.reporter)
+	otherID := mustCreate(t, s, fixtures.admin)
+
+	a.Nil(s.Delete(context.Background(), id))
+
+	_, err := s.FindByEMail(context.Background(), fixtures.reporter.EMail)
+	a.ErrorIs(err, store.ErrNotFound)
+
+	// other users are left untouched
+	_, err = s.FindByID(context.Background(), otherID)
+	require.NoError(t, err)
+
+	// the email address can be used again
+	_, err = s.Create(context.Background(), &model.User{
+		Name:  "Fritz Nebel Jr.",
+		EMail: fixtures.reporter.EMail,
+	})
+	require.NoError(t, err)
+}
+
+func testDeleteNotExisting(t *testing.T, s store.UserStore) {
+	id := mustCreate(t, s, fixtures.reporter)
+	assert.Nil(t, s.Delete(context.Background(), id))
+
+	err := s.Delete(context.Background(), id)
+	assert.ErrorIs(t, err, store.ErrNotFound)
+}
+
+func testDeleteMalformedID(t *testing.T, s store.UserStore) {
+	mustCreate(t, s, fixtures.reporter)
+
+	for _, id := range []string{"", "abcde", "zzzzzzzzzzzzzzzzzzzzzzzz"} {
+		err := s.Delete(context.Background(), id)
+		assert.ErrorIs(t, err, store.ErrNotFound, "id %q", id)
+	}
+}
+
+func testDeleteLastAdmin(t *testing.T, s store.UserStore) {
+	a := assert.New(t)
+	id := mustCreate(t, s, fixtures.admin)
+
+	a.Equal(store.ErrLastAdmin, s.Delete(context.Background(), id))
+	mustFind(t, s, id)
+
+	// as soon as there is another admin the first one can be deleted
+	mustCreate(t, s, model.User{Name: "Max Doe", EMail: "max.doe@example.com", Role: model.Admin})
+	a.Nil(s.Delete(context.Background(), id))
+}
+
+func testRemoveAdminsConcurrently(t *testing.T, s store.UserStore) {
+	a := assert.New(t)
+
+	const count = 6
+	admins := make([]*model.User, 0, count)
+	for i := 0; i < count; i++ {
+		id := mustCreate(t, s, model.User{
+			Name:  fmt.Sprintf("Admin %d", i),
+			EMail: fmt.Sprintf("admin%d@example.com", i),
+			Role:  model.Admin,
+		})
+		admins = append(admins, mustFind(t, s, id))
+	}
+
+	errs := make(chan error, count)
+
+	var wg sync.WaitGroup
+	for i, admin := range admins {
+		wg.Add(1)
+		go func(i int, admin *model.User) {
+			defer wg.Done()
+			// half of the admins is deleted, the other half is demoted
+			if i%2 == 0 {
+				errs <- s.Delete(context.Background(), admin.ID)
+			} else {
+				admin.Role = model.Reporter
+				errs <- s.Update(context.Background(), admin)
+			}
+		}(i, admin)
+	}
+	wg.Wait()
+	close(errs)
+
+	var refused int
+	for err := range errs {
+		if err != nil {
+			a.Equal(store.ErrLastAdmin, err)
+			refused++
+		}
+	}
+	a.Equal(1, refused, "exactly one admin is kept")
+
+	page, err := s.List(context.Background(), model.UserQuery{Filter: model.UserFilter{Role: model.Admin}, Limit: count})
+	require.NoError(t, err)
+	a.Len(page.Users, 1)
+}
+
+func testFailedLogins(t *testing.T, s store.UserStore) {
+	a := assert.New(t)
+	ctx := context.Background()
+	id := mustCreate(t, s, fixtures.reporter)
+
+	failures, err := s.AddFailedLogin(ctx, id)
+	require.NoError(t, err)
+	a.Equal(1, failures)
+	failures, err = s.AddFailedLogin(ctx, id)
+	require.NoError(t, err)
+	a.Equal(2, failures)
+
+	until := time.Now().Add(time.Minute).Truncate(time.Millisecond).UTC()
+	a.Nil(s.LockOutUntil(ctx, id, until))
+
+	actual := mustFind(t, s, id)
+	a.Equal(2, actual.FailedLogins)
+	a.True(until.Equal(actual.LockedUntil), "expected %s, got %s", until, actual.LockedUntil)
+	a.Equal(int64(1), actual.Version, "the login bookkeeping doesn't change the version")
+
+	// updates leave the failed logins untouched
+	actual.Name = "Fritz Nebelmann"
+	actual.FailedLogins = 0
+	actual.LockedUntil = time.Time{}
+	a.Nil(s.Update(ctx, actual))
+	actual = mustFind(t, s, id)
+	a.Equal(2, actual.FailedLogins)
+	a.True(until.Equal(actual.LockedUntil))
+
+	a.Nil(s.ResetFailedLogins(ctx, id))
+	actual = mustFind(t, s, id)
+	a.Equal(0, actual.FailedLogins)
+	a.True(actual.LockedUntil.IsZero())
+}
+
+func testFailedLoginsConcurrently(t *testing.T, s store.UserStore) {
+	a := assert.New(t)
+	id := mustCreate(t, s, fixtures.reporter)
+
+	const count = 8
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.AddFailedLogin(context.Background(), id)
+			a.Nil(err)
+		}()
+	}
+	wg.Wait()
+
+	a.Equal(count, mustFind(t, s, id).FailedLogins, "no failed login is lost")
+}
+
+func testFailedLoginsNotExisting(t *testing.T, s store.UserStore) {
+	a := assert.New(t)
+	ctx := context.Background()
+	id := mustCreate(t, s, fixtures.reporter)
+	a.Nil(s.Delete(ctx, id))
+
+	_, err := s.AddFailedLogin(ctx, id)
+	a.ErrorIs(err, store.ErrNotFound)
+	a.ErrorIs(s.LockOutUntil(ctx, id, time.Now()), store.ErrNotFound)
+	a.ErrorIs(s.ResetFailedLogins(ctx, id), store.ErrNotFound)
+
+	_, err = s.AddFailedLogin(ctx, "malformed")
+	a.ErrorIs(err, store.ErrNotFound)
+}
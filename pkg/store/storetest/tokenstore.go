@@ -0,0 +1,174 @@
+package storetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/status-owl/user-service/pkg/model"
+	"github.com/status-owl/user-service/pkg/store"
+)
+
+// RefreshTokenFactory returns an empty store.RefreshTokenStore, it's called once per test case
+type RefreshTokenFactory func(t *testing.T) store.RefreshTokenStore
+
+// RunRefreshTokens executes the conformance suite against the refresh token stores created by given factory
+func RunRefreshTokens(t *testing.T, newStore RefreshTokenFactory) {
+	tests := []struct {
+		name string
+		test func(*testing.T, store.RefreshTokenStore)
+	}{
+		{"Create", testCreateRefreshToken},
+		{"CreateDuplicate", testCreateDuplicateRefreshToken},
+		{"FindByIDNotExisting", testFindRefreshTokenNotExisting},
+		{"Use", testUseRefreshToken},
+		{"UseNotExisting", testUseRefreshTokenNotExisting},
+		{"DeleteFamily", testDeleteRefreshTokenFamily},
+		{"DeleteByUser", testDeleteRefreshTokensByUser},
+		{"DeleteExpired", testDeleteExpiredRefreshTokens},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newStore(t))
+		})
+	}
+}
+
+// newRefreshToken returns an unused token valid for an hour
+func newRefreshToken(id, userID, familyID string) model.RefreshToken {
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	return model.RefreshToken{
+		ID:        id,
+		UserID:    userID,
+		FamilyID:  familyID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(time.Hour),
+	}
+}
+
+// mustCreateTokens persists copies of given tokens
+func mustCreateTokens(t *testing.T, s store.RefreshTokenStore, tokens ...model.RefreshToken) {
+	t.Helper()
+
+	for _, token := range tokens {
+		token := token
+		if err := s.Create(context.Background(), &token); err != nil {
+			t.Fatalf("failed to create refresh token: %s", err.Error())
+		}
+	}
+}
+
+// assertTokensExist asserts which of the tokens with given ids exist
+func assertTokensExist(t *testing.T, s store.RefreshTokenStore, expected map[string]bool) {
+	t.Helper()
+
+	for id, exists := range expected {
+		_, err := s.FindByID(context.Background(), id)
+		if exists {
+			assert.Nil(t, err, "token %s should exist", id)
+		} else {
+			assert.Equal(t, store.ErrTokenNotFound, err, "token %s should not exist", id)
+		}
+	}
+}
+
+func testCreateRefreshToken(t *testing.T, s store.RefreshTokenStore) {
+	a := assert.New(t)
+
+	token := newRefreshToken("t1", "u1", "f1")
+	mustCreateTokens(t, s, token)
+
+	actual, err := s.FindByID(context.Background(), "t1")
+	require.NoError(t, err)
+	a.Equal(&token, actual)
+	a.True(actual.UsedAt.IsZero())
+}
+
+func testCreateDuplicateRefreshToken(t *testing.T, s store.RefreshTokenStore) {
+	mustCreateTokens(t, s, newRefreshToken("t1", "u1", "f1"))
+
+	token := newRefreshToken("t1", "u2", "f2")
+	assert.Equal(t, store.ErrDuplicateToken, s.Create(context.Background(), &token))
+}
+
+func testFindRefreshTokenNotExisting(t *testing.T, s store.RefreshTokenStore) {
+	_, err := s.FindByID(context.Background(), "t1")
+	assert.Equal(t, store.ErrTokenNotFound, err)
+}
+
+func testUseRefreshToken(t *testing.T, s store.RefreshTokenStore) {
+	a := assert.New(t)
+	ctx := context.Background()
+
+	mustCreateTokens(t, s, newRefreshToken("t1", "u1", "f1"))
+
+	at := time.Now().UTC().Truncate(time.Millisecond)
+	a.Nil(s.Use(ctx, "t1", at))
+
+	actual, err := s.FindByID(ctx, "t1")
+	require.NoError(t, err)
+	a.True(at.Equal(actual.UsedAt))
+
+	// a token can be used only once
+	a.Equal(store.ErrTokenUsed, s.Use(ctx, "t1", at.Add(time.Second)))
+
+	actual, err = s.FindByID(ctx, "t1")
+	require.NoError(t, err)
+	a.True(at.Equal(actual.UsedAt), "the first usage is kept")
+}
+
+func testUseRefreshTokenNotExisting(t *testing.T, s store.RefreshTokenStore) {
+	assert.Equal(t, store.ErrTokenNotFound, s.Use(context.Background(), "t1", time.Now()))
+}
+
+func testDeleteRefreshTokenFamily(t *testing.T, s store.RefreshTokenStore) {
+	a := assert.New(t)
+
+	mustCreateTokens(t, s,
+		newRefreshToken("t1", "u1", "f1"),
+		newRefreshToken("t2", "u1", "f1"),
+		newRefreshToken("t3", "u1", "f2"),
+	)
+
+	count, err := s.DeleteFamily(context.Background(), "f1")
+	require.NoError(t, err)
+	a.EqualValues(2, count)
+	assertTokensExist(t, s, map[string]bool{"t1": false, "t2": false, "t3": true})
+
+	count, err = s.DeleteFamily(context.Background(), "f1")
+	require.NoError(t, err)
+	a.EqualValues(0, count)
+}
+
+func testDeleteRefreshTokensByUser(t *testing.T, s store.RefreshTokenStore) {
+	a := assert.New(t)
+
+	mustCreateTokens(t, s,
+		newRefreshToken("t1", "u1", "f1"),
+		newRefreshToken("t2", "u1", "f2"),
+		newRefreshToken("t3", "u2", "f3"),
+	)
+
+	count, err := s.DeleteByUser(context.Background(), "u1")
+	require.NoError(t, err)
+	a.EqualValues(2, count)
+	assertTokensExist(t, s, map[string]bool{"t1": false, "t2": false, "t3": true})
+}
+
+func testDeleteExpiredRefreshTokens(t *testing.T, s store.RefreshTokenStore) {
+	a := assert.New(t)
+
+	expired := newRefreshToken("t1", "u1", "f1")
+	expired.ExpiresAt = expired.CreatedAt.Add(-time.Minute)
+	mustCreateTokens(t, s, expired, newRefreshToken("t2", "u1", "f1"))
+
+	count, err := s.DeleteExpired(context.Background(), time.Now())
+	require.NoError(t, err)
+	a.EqualValues(1, count)
+	assertTokensExist(t, s, map[string]bool{"t1": false, "t2": true})
+}
@@ -0,0 +1,75 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/rs/zerolog"
+	bolt "go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/status-owl/user-service/pkg/model"
+)
+
+// RefreshTokenStore is responsible for storing refresh tokens,
+// revoked tokens are deleted while used ones are kept until they expire to detect their reuse
+type RefreshTokenStore interface {
+	Create(ctx context.Context, token *model.RefreshToken) error
+	FindByID(ctx context.Context, id string) (*model.RefreshToken, error)
+	// Use marks an unused token as used at given time,
+	// it returns ErrTokenUsed if the token has been used before
+	Use(ctx context.Context, id string, at time.Time) error
+	// DeleteFamily revokes all tokens of a family and returns their count
+	DeleteFamily(ctx context.Context, familyID string) (int64, error)
+	// DeleteByUser revokes all tokens of a user and returns their count
+	DeleteByUser(ctx context.Context, userID string) (int64, error)
+	// DeleteExpired removes all tokens expired before given time and returns their count
+	DeleteExpired(ctx context.Context, before time.Time) (int64, error)
+}
+
+var (
+	//ErrTokenNotFound signals that a refresh token doesn't exist or has been revoked
+	ErrTokenNotFound = errors.New("refresh token not found")
+	//ErrTokenUsed signals that a refresh token has already been used
+	ErrTokenUsed = errors.New("refresh token has already been used")
+	//ErrDuplicateToken signals that a refresh token with given id already exists
+	ErrDuplicateToken = errors.New("refresh token already exists")
+)
+
+// NewRefreshTokenStore creates a RefreshTokenStore using mongodb
+func NewRefreshTokenStore(client *mongo.Client, logger zerolog.Logger) (RefreshTokenStore, error) {
+	store := &mongoRefreshTokenStore{client}
+	if err := store.createIndexes(); err != nil {
+		return nil, err
+	}
+
+	return RefreshTokenLoggingMiddleware(logger)(store), nil
+}
+
+// NewMemoryRefreshTokenStore creates a RefreshTokenStore keeping all tokens in memory
+func NewMemoryRefreshTokenStore(logger zerolog.Logger) RefreshTokenStore {
+	return RefreshTokenLoggingMiddleware(logger)(newMemoryRefreshTokenStore())
+}
+
+// NewSQLRefreshTokenStore creates a RefreshTokenStore backed by a sql database,
+// pending schema migrations are applied before the store is returned
+func NewSQLRefreshTokenStore(db *sql.DB, logger zerolog.Logger) (RefreshTokenStore, error) {
+	// the schema is shared with the sql user store
+	if err := (&sqlUserStore{db}).migrate(); err != nil {
+		return nil, err
+	}
+
+	return RefreshTokenLoggingMiddleware(logger)(&sqlRefreshTokenStore{db}), nil
+}
+
+// NewBoltRefreshTokenStore creates a RefreshTokenStore backed by an embedded bolt database
+func NewBoltRefreshTokenStore(db *bolt.DB, logger zerolog.Logger) (RefreshTokenStore, error) {
+	store := &boltRefreshTokenStore{db}
+	if err := store.createBuckets(); err != nil {
+		return nil, err
+	}
+
+	return RefreshTokenLoggingMiddleware(logger)(store), nil
+}
@@ -0,0 +1,171 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/status-owl/user-service/pkg/model"
+)
+
+// boltRefreshTokenStore implements RefreshTokenStore using an embedded bolt database file
+type boltRefreshTokenStore struct {
+	db *bolt.DB
+}
+
+// refreshTokensBucket maps token ids to json encoded tokens
+var refreshTokensBucket = []byte("refresh_tokens")
+
+type boltRefreshToken struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"user_id"`
+	FamilyID  string    `json:"family_id"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	UsedAt    time.Time `json:"used_at"`
+}
+
+func (s *boltRefreshTokenStore) createBuckets() error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(refreshTokensBucket); err != nil {
+			return fmt.Errorf("failed to create bucket %q: %w", refreshTokensBucket, err)
+		}
+		return nil
+	})
+}
+
+// getBoltRefreshToken reads the token with given id, returns ErrTokenNotFound if it doesn't exist
+func getBoltRefreshToken(tx *bolt.Tx, id string) (*model.RefreshToken, error) {
+	data := tx.Bucket(refreshTokensBucket).Get([]byte(id))
+	if data == nil {
+		return nil, ErrTokenNotFound
+	}
+
+	var t boltRefreshToken
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, fmt.Errorf("failed to decode refresh token: %w", err)
+	}
+
+	token := model.RefreshToken(t)
+	return &token, nil
+}
+
+// putBoltRefreshToken writes given token
+func putBoltRefreshToken(tx *bolt.Tx, token *model.RefreshToken) error {
+	data, err := json.Marshal(boltRefreshToken(*token))
+	if err != nil {
+		return fmt.Errorf("failed to encode refresh token: %w", err)
+	}
+
+	return tx.Bucket(refreshTokensBucket).Put([]byte(token.ID), data)
+}
+
+func (s *boltRefreshTokenStore) Create(_ context.Context, token *model.RefreshToken) error {
+	t := *token
+	t.CreatedAt = t.CreatedAt.UTC().Truncate(time.Millisecond)
+	t.ExpiresAt = t.ExpiresAt.UTC().Truncate(time.Millisecond)
+	t.UsedAt = time.Time{}
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(refreshTokensBucket).Get([]byte(t.ID)) != nil {
+			return ErrDuplicateToken
+		}
+		return putBoltRefreshToken(tx, &t)
+	})
+	if err != nil {
+		if err == ErrDuplicateToken {
+			return err
+		}
+		return fmt.Errorf("failed to insert refresh token: %w", err)
+	}
+
+	return nil
+}
+
+func (s *boltRefreshTokenStore) FindByID(_ context.Context, id string) (*model.RefreshToken, error) {
+	var t *model.RefreshToken
+	err := s.db.View(func(tx *bolt.Tx) (err error) {
+		t, err = getBoltRefreshToken(tx, id)
+		return
+	})
+	if err != nil {
+		if err == ErrTokenNotFound {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to find refresh token: %w", err)
+	}
+
+	return t, nil
+}
+
+func (s *boltRefreshTokenStore) Use(_ context.Context, id string, at time.Time) error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		t, err := getBoltRefreshToken(tx, id)
+		if err != nil {
+			return err
+		}
+
+		if !t.UsedAt.IsZero() {
+			return ErrTokenUsed
+		}
+
+		t.UsedAt = at.UTC().Truncate(time.Millisecond)
+		return putBoltRefreshToken(tx, t)
+	})
+	if err != nil {
+		if err == ErrTokenNotFound || err == ErrTokenUsed {
+			return err
+		}
+		return fmt.Errorf("failed to use refresh token: %w", err)
+	}
+
+	return nil
+}
+
+// deleteWhere removes all tokens matching given predicate,
+// there are no indexes, all tokens are scanned
+func (s *boltRefreshTokenStore) deleteWhere(matches func(t *boltRefreshToken) bool) (int64, error) {
+	var count int64
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		c := tx.Bucket(refreshTokensBucket).Cursor()
+		for k, v := c.First(); k != nil; {
+			var t boltRefreshToken
+			if err := json.Unmarshal(v, &t); err != nil {
+				return fmt.Errorf("failed to decode refresh token: %w", err)
+			}
+
+			if !matches(&t) {
+				k, v = c.Next()
+				continue
+			}
+
+			// the cursor moves to the next key on deletion
+			if err := c.Delete(); err != nil {
+				return err
+			}
+			count++
+			k, v = c.Seek(k)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete refresh tokens: %w", err)
+	}
+
+	return count, nil
+}
+
+func (s *boltRefreshTokenStore) DeleteFamily(_ context.Context, familyID string) (int64, error) {
+	return s.deleteWhere(func(t *boltRefreshToken) bool { return t.FamilyID == familyID })
+}
+
+func (s *boltRefreshTokenStore) DeleteByUser(_ context.Context, userID string) (int64, error) {
+	return s.deleteWhere(func(t *boltRefreshToken) bool { return t.UserID == userID })
+}
+
+func (s *boltRefreshTokenStore) DeleteExpired(_ context.Context, before time.Time) (int64, error) {
+	return s.deleteWhere(func(t *boltRefreshToken) bool { return t.ExpiresAt.Before(before) })
+}
@@ -0,0 +1,96 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/status-owl/user-service/pkg/model"
+)
+
+// memoryRefreshTokenStore implements RefreshTokenStore keeping all tokens in memory
+type memoryRefreshTokenStore struct {
+	mu     sync.Mutex
+	tokens map[string]model.RefreshToken
+}
+
+func newMemoryRefreshTokenStore() *memoryRefreshTokenStore {
+	return &memoryRefreshTokenStore{tokens: make(map[string]model.RefreshToken)}
+}
+
+func (s *memoryRefreshTokenStore) Create(_ context.Context, token *model.RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.tokens[token.ID]; ok {
+		return ErrDuplicateToken
+	}
+
+	t := *token
+	t.CreatedAt = t.CreatedAt.UTC().Truncate(time.Millisecond)
+	t.ExpiresAt = t.ExpiresAt.UTC().Truncate(time.Millisecond)
+	t.UsedAt = time.Time{}
+	s.tokens[t.ID] = t
+
+	return nil
+}
+
+func (s *memoryRefreshTokenStore) FindByID(_ context.Context, id string) (*model.RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.tokens[id]
+	if !ok {
+		return nil, ErrTokenNotFound
+	}
+
+	return &t, nil
+}
+
+func (s *memoryRefreshTokenStore) Use(_ context.Context, id string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.tokens[id]
+	if !ok {
+		return ErrTokenNotFound
+	}
+
+	if !t.UsedAt.IsZero() {
+		return ErrTokenUsed
+	}
+
+	t.UsedAt = at.UTC().Truncate(time.Millisecond)
+	s.tokens[id] = t
+
+	return nil
+}
+
+// deleteWhere removes all tokens matching given predicate
+func (s *memoryRefreshTokenStore) deleteWhere(matches func(t *model.RefreshToken) bool) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var count int64
+	for id, t := range s.tokens {
+		t := t
+		if matches(&t) {
+			delete(s.tokens, id)
+			count++
+		}
+	}
+
+	return count
+}
+
+func (s *memoryRefreshTokenStore) DeleteFamily(_ context.Context, familyID string) (int64, error) {
+	return s.deleteWhere(func(t *model.RefreshToken) bool { return t.FamilyID == familyID }), nil
+}
+
+func (s *memoryRefreshTokenStore) DeleteByUser(_ context.Context, userID string) (int64, error) {
+	return s.deleteWhere(func(t *model.RefreshToken) bool { return t.UserID == userID }), nil
+}
+
+func (s *memoryRefreshTokenStore) DeleteExpired(_ context.Context, before time.Time) (int64, error) {
+	return s.deleteWhere(func(t *model.RefreshToken) bool { return t.ExpiresAt.Before(before) }), nil
+}
@@ -0,0 +1,142 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/status-owl/user-service/pkg/model"
+)
+
+// mongoRefreshTokenStore implements RefreshTokenStore using mongodb as backing db
+type mongoRefreshTokenStore struct {
+	client *mongo.Client
+}
+
+const refreshTokensCollectionName = "refresh_tokens"
+
+type mongoRefreshToken struct {
+	ID        string    `bson:"_id"`
+	UserID    string    `bson:"user_id"`
+	FamilyID  string    `bson:"family_id"`
+	CreatedAt time.Time `bson:"created_at"`
+	ExpiresAt time.Time `bson:"expires_at"`
+	UsedAt    time.Time `bson:"used_at,omitempty"`
+}
+
+func (t *mongoRefreshToken) toRefreshToken() *model.RefreshToken {
+	token := &model.RefreshToken{
+		ID:        t.ID,
+		UserID:    t.UserID,
+		FamilyID:  t.FamilyID,
+		CreatedAt: t.CreatedAt.UTC(),
+		ExpiresAt: t.ExpiresAt.UTC(),
+	}
+	if !t.UsedAt.IsZero() {
+		token.UsedAt = t.UsedAt.UTC()
+	}
+	return token
+}
+
+// returns refresh tokens collection
+func (s *mongoRefreshTokenStore) col() *mongo.Collection {
+	return s.client.
+		Database(databaseName).
+		Collection(refreshTokensCollectionName)
+}
+
+func (s *mongoRefreshTokenStore) createIndexes() error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	_, err := s.col().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.M{"user_id": 1}},
+		{Keys: bson.M{"family_id": 1}},
+		{Keys: bson.M{"expires_at": 1}},
+	})
+	if err != nil {
+		return ErrIndexCreation
+	}
+
+	return nil
+}
+
+func (s *mongoRefreshTokenStore) Create(ctx context.Context, token *model.RefreshToken) error {
+	_, err := s.col().InsertOne(ctx, &mongoRefreshToken{
+		ID:        token.ID,
+		UserID:    token.UserID,
+		FamilyID:  token.FamilyID,
+		CreatedAt: token.CreatedAt,
+		ExpiresAt: token.ExpiresAt,
+	})
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrDuplicateToken
+		}
+		return fmt.Errorf("failed to insert refresh token: %w", err)
+	}
+
+	return nil
+}
+
+func (s *mongoRefreshTokenStore) FindByID(ctx context.Context, id string) (*model.RefreshToken, error) {
+	var t mongoRefreshToken
+	if err := s.col().FindOne(ctx, bson.M{"_id": id}).Decode(&t); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrTokenNotFound
+		}
+		return nil, fmt.Errorf("failed to find refresh token: %w", err)
+	}
+
+	return t.toRefreshToken(), nil
+}
+
+func (s *mongoRefreshTokenStore) Use(ctx context.Context, id string, at time.Time) error {
+	result, err := s.col().UpdateOne(ctx,
+		bson.M{"_id": id, "used_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"used_at": at}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to use refresh token: %w", err)
+	}
+
+	if result.MatchedCount == 0 {
+		// either the token doesn't exist or it has been used
+		if _, err = s.FindByID(ctx, id); err != nil {
+			return err
+		}
+		return ErrTokenUsed
+	}
+
+	return nil
+}
+
+// deleteMany removes all tokens matching given filter
+func (s *mongoRefreshTokenStore) deleteMany(ctx context.Context, filter bson.M) (int64, error) {
+	result, err := s.col().DeleteMany(ctx, filter)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete refresh tokens: %w", err)
+	}
+
+	return result.DeletedCount, nil
+}
+
+func (s *mongoRefreshTokenStore) DeleteFamily(ctx context.Context, familyID string) (int64, error) {
+	return s.deleteMany(ctx, bson.M{"family_id": familyID})
+}
+
+func (s *mongoRefreshTokenStore) DeleteByUser(ctx context.Context, userID string) (int64, error) {
+	return s.deleteMany(ctx, bson.M{"user_id": userID})
+}
+
+func (s *mongoRefreshTokenStore) DeleteExpired(ctx context.Context, before time.Time) (int64, error) {
+	return s.deleteMany(ctx, bson.M{"expires_at": bson.M{"$lt": before}})
+}
+
+// clear removes all refresh tokens from the collection
+func (s *mongoRefreshTokenStore) clear(ctx context.Context) (int64, error) {
+	return s.deleteMany(ctx, bson.M{})
+}
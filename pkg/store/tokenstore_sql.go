@@ -0,0 +1,107 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/status-owl/user-service/pkg/model"
+)
+
+// sqlRefreshTokenStore implements RefreshTokenStore using the table refresh_tokens
+type sqlRefreshTokenStore struct {
+	db *sql.DB
+}
+
+// fromMillis converts milliseconds since epoch to a time, 0 results in the zero time
+func fromMillis(ms int64) time.Time {
+	if ms == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms).UTC()
+}
+
+func (s *sqlRefreshTokenStore) Create(ctx context.Context, token *model.RefreshToken) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO refresh_tokens (id, user_id, family_id, created_at, expires_at) VALUES ($1, $2, $3, $4, $5)`,
+		token.ID, token.UserID, token.FamilyID, toMillis(token.CreatedAt), toMillis(token.ExpiresAt),
+	)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrDuplicateToken
+		}
+		return fmt.Errorf("failed to insert refresh token: %w", err)
+	}
+
+	return nil
+}
+
+func (s *sqlRefreshTokenStore) FindByID(ctx context.Context, id string) (*model.RefreshToken, error) {
+	var (
+		t                            model.RefreshToken
+		createdAt, expiresAt, usedAt int64
+	)
+
+	err := s.db.QueryRowContext(ctx,
+		`SELECT id, user_id, family_id, created_at, expires_at, used_at FROM refresh_tokens WHERE id = $1`, id,
+	).Scan(&t.ID, &t.UserID, &t.FamilyID, &createdAt, &expiresAt, &usedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrTokenNotFound
+		}
+		return nil, fmt.Errorf("failed to find refresh token: %w", err)
+	}
+
+	t.CreatedAt = fromMillis(createdAt)
+	t.ExpiresAt = fromMillis(expiresAt)
+	t.UsedAt = fromMillis(usedAt)
+	return &t, nil
+}
+
+func (s *sqlRefreshTokenStore) Use(ctx context.Context, id string, at time.Time) error {
+	result, err := s.db.ExecContext(ctx,
+		`UPDATE refresh_tokens SET used_at = $2 WHERE id = $1 AND used_at = 0`, id, toMillis(at),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to use refresh token: %w", err)
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to use refresh token: %w", err)
+	}
+
+	if count == 0 {
+		// either the token doesn't exist or it has been used
+		if _, err = s.FindByID(ctx, id); err != nil {
+			return err
+		}
+		return ErrTokenUsed
+	}
+
+	return nil
+}
+
+// deleteWhere removes all tokens matching given condition
+func (s *sqlRefreshTokenStore) deleteWhere(ctx context.Context, where string, arg interface{}) (int64, error) {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM refresh_tokens WHERE `+where, arg)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete refresh tokens: %w", err)
+	}
+
+	return result.RowsAffected()
+}
+
+func (s *sqlRefreshTokenStore) DeleteFamily(ctx context.Context, familyID string) (int64, error) {
+	return s.deleteWhere(ctx, `family_id = $1`, familyID)
+}
+
+func (s *sqlRefreshTokenStore) DeleteByUser(ctx context.Context, userID string) (int64, error) {
+	return s.deleteWhere(ctx, `user_id = $1`, userID)
+}
+
+func (s *sqlRefreshTokenStore) DeleteExpired(ctx context.Context, before time.Time) (int64, error) {
+	return s.deleteWhere(ctx, `expires_at < $1`, toMillis(before))
+}
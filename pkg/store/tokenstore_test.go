@@ -0,0 +1,50 @@
+package store_test
+
+import (
+	"testing"
+
+	"github.com/rs/zerolog"
+
+	"github.com/status-owl/user-service/pkg/store"
+	"github.com/status-owl/user-service/pkg/store/storetest"
+)
+
+func TestMongoRefreshTokenStore(t *testing.T) {
+	storetest.RunRefreshTokens(t, func(t *testing.T) store.RefreshTokenStore {
+		return store.NewMongoTestStores(t).RefreshTokens
+	})
+}
+
+func TestPostgresRefreshTokenStore(t *testing.T) {
+	storetest.RunRefreshTokens(t, func(t *testing.T) store.RefreshTokenStore {
+		return store.NewPostgresTestStores(t).RefreshTokens
+	})
+}
+
+func TestMemoryRefreshTokenStore(t *testing.T) {
+	storetest.RunRefreshTokens(t, func(t *testing.T) store.RefreshTokenStore {
+		return store.NewMemoryRefreshTokenStore(zerolog.Nop())
+	})
+}
+
+func TestSQLRefreshTokenStore(t *testing.T) {
+	storetest.RunRefreshTokens(t, func(t *testing.T) store.RefreshTokenStore {
+		s, err := store.NewSQLRefreshTokenStore(openSQLite(t), zerolog.Nop())
+		if err != nil {
+			t.Fatalf("failed to create the sql refresh token store: %s", err.Error())
+		}
+
+		return s
+	})
+}
+
+func TestBoltRefreshTokenStore(t *testing.T) {
+	storetest.RunRefreshTokens(t, func(t *testing.T) store.RefreshTokenStore {
+		s, err := store.NewBoltRefreshTokenStore(openBolt(t), zerolog.Nop())
+		if err != nil {
+			t.Fatalf("failed to create the bolt refresh token store: %s", err.Error())
+		}
+
+		return s
+	})
+}
@@ -2,10 +2,13 @@ package store
 
 import (
 	"context"
+	"database/sql"
 	"errors"
+	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/status-owl/user-service/pkg/model"
+	bolt "go.etcd.io/bbolt"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
@@ -15,21 +18,90 @@ type UserStore interface {
 	FindByID(ctx context.Context, id string) (*model.User, error)
 	FindByEMail(ctx context.Context, email string) (*model.User, error)
 	HasUsersWithRole(ctx context.Context, role model.Role) (bool, error)
+	// CreateFirstAdmin creates given user with the role model.Admin if there is no admin yet,
+	// the check and the creation are atomic. It returns ErrAdminExists if there is an admin already.
+	CreateFirstAdmin(ctx context.Context, user *model.User) (string, error)
+	// List returns a page of users matching the query, query.Limit has to be positive
+	List(ctx context.Context, query model.UserQuery) (*model.UserPage, error)
+	// Update replaces name, email, its verification and role of the user with user.ID
+	// if its stored version equals user.Version, the version is incremented on success.
+	// It returns ErrLastAdmin instead of demoting the last admin.
+	Update(ctx context.Context, user *model.User) error
+	// Delete removes the user with given id, it returns ErrLastAdmin instead of removing the last admin
 	Delete(ctx context.Context, id string) error
-
-	clear(ctx context.Context) (int64, error)
+	// AddFailedLogin atomically increments the failed logins of the user with given id and returns their count
+	AddFailedLogin(ctx context.Context, id string) (int, error)
+	// LockOutUntil sets the time the user with given id may log in again
+	LockOutUntil(ctx context.Context, id string, until time.Time) error
+	// ResetFailedLogins clears the failed logins and the lockout of the user with given id,
+	// unlike Update neither of the login methods increments the version
+	ResetFailedLogins(ctx context.Context, id string) error
 }
 
 var (
 	//ErrNotFound signals that a user could not be found
 	ErrNotFound = errors.New("user not found")
+	//ErrDuplicateEMail signals that a user with given email address already exists
+	ErrDuplicateEMail = errors.New("user with given email address already exists")
+	//ErrVersionConflict signals that a user has been modified since it was read
+	ErrVersionConflict = errors.New("user has been modified concurrently")
+	//ErrAdminExists signals that the first admin can't be created since there is an admin already
+	ErrAdminExists = errors.New("admin already exists")
+	//ErrLastAdmin signals that the last admin can't be removed or demoted
+	ErrLastAdmin = errors.New("last admin can't be removed")
 )
 
+// storedRole returns the role a user is stored and read with, users without a role
+// or with one the model doesn't know are regular users, so they don't gain any privileges
+func storedRole(role string) model.Role {
+	if r, ok := model.RoleFromString(role); ok {
+		return r
+	}
+	return model.Regular
+}
+
 func NewUserStore(client *mongo.Client, logger zerolog.Logger) (UserStore, error) {
 	store := &mongoUserStore{client}
 	if err := store.createIndexes(); err != nil {
 		return nil, err
 	}
+	if err := store.migrateRoles(); err != nil {
+		return nil, err
+	}
+	if err := store.migrateCreatedAt(); err != nil {
+		return nil, err
+	}
+
+	return LoggingMiddleware(logger)(store), nil
+}
+
+// NewMemoryUserStore creates a UserStore keeping all users in memory,
+// nothing survives a restart
+func NewMemoryUserStore(logger zerolog.Logger) UserStore {
+	return LoggingMiddleware(logger)(newMemoryUserStore())
+}
+
+// NewSQLUserStore creates a UserStore backed by a sql database,
+// pending schema migrations are applied before the store is returned
+func NewSQLUserStore(db *sql.DB, logger zerolog.Logger) (UserStore, error) {
+	store := &sqlUserStore{db}
+	if err := store.migrate(); err != nil {
+		return nil, err
+	}
+
+	return LoggingMiddleware(logger)(store), nil
+}
+
+// NewBoltUserStore creates a UserStore backed by an embedded bolt database,
+// it's meant for single node deployments without a database server
+func NewBoltUserStore(db *bolt.DB, logger zerolog.Logger) (UserStore, error) {
+	store := &boltUserStore{db}
+	if err := store.createBuckets(); err != nil {
+		return nil, err
+	}
+	if err := store.migrateRoles(); err != nil {
+		return nil, err
+	}
 
 	return LoggingMiddleware(logger)(store), nil
 }
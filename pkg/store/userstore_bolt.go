@@ -0,0 +1,543 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/status-owl/user-service/pkg/model"
+)
+
+// boltUserStore implements UserStore using an embedded bolt database file,
+// every write is committed in its own fsync'ed transaction
+type boltUserStore struct {
+	db *bolt.DB
+}
+
+var (
+	// usersBucket maps user ids to json encoded users
+	usersBucket = []byte("users")
+	// emailIndexBucket maps email addresses to user ids
+	emailIndexBucket = []byte("users_by_email")
+	// roleIndexBucket contains a key <role>\x00<id> for every user
+	roleIndexBucket = []byte("users_by_role")
+)
+
+type boltUser struct {
+	ID            string    `json:"id"`
+	Name          string    `json:"name"`
+	EMail         string    `json:"email"`
+	EMailVerified bool      `json:"email_verified,omitempty"`
+	Role          string    `json:"role"`
+	Status        string    `json:"status,omitempty"`
+	Version       int64     `json:"version"`
+	CreatedAt     time.Time `json:"created_at"`
+	PwdHash       string    `json:"pwd_hash,omitempty"`
+	FailedLogins  int       `json:"failed_logins,omitempty"`
+	LockedUntil   time.Time `json:"locked_until,omitempty"`
+	TOTPSecret    string    `json:"totp_secret,omitempty"`
+	MFAEnabled    bool      `json:"mfa_enabled,omitempty"`
+	TOTPLastStep  int64     `json:"totp_last_step,omitempty"`
+	RecoveryCodes []string  `json:"recovery_codes,omitempty"`
+}
+
+func newBoltUser(id string, user *model.User) *boltUser {
+	return &boltUser{
+		ID:            id,
+		Name:          user.Name,
+		EMail:         user.EMail,
+		EMailVerified: user.EMailVerified,
+		Role:          string(storedRole(string(user.Role))),
+		Status:        string(model.StatusFromString(string(user.Status))),
+		Version:       user.Version,
+		CreatedAt:     user.CreatedAt,
+		PwdHash:       user.PasswordHash,
+		FailedLogins:  user.FailedLogins,
+		LockedUntil:   user.LockedUntil,
+		TOTPSecret:    user.TOTPSecret,
+		MFAEnabled:    user.MFAEnabled,
+		TOTPLastStep:  user.TOTPLastStep,
+		RecoveryCodes: user.RecoveryCodes,
+	}
+}
+
+func (u *boltUser) toUser() *model.User {
+	return &model.User{
+		ID:            u.ID,
+		Name:          u.Name,
+		EMail:         u.EMail,
+		EMailVerified: u.EMailVerified,
+		Role:          storedRole(u.Role),
+		Status:        model.StatusFromString(u.Status),
+		Version:       u.Version,
+		CreatedAt:     u.CreatedAt,
+		PasswordHash:  u.PwdHash,
+		FailedLogins:  u.FailedLogins,
+		LockedUntil:   u.LockedUntil,
+		TOTPSecret:    u.TOTPSecret,
+		MFAEnabled:    u.MFAEnabled,
+		TOTPLastStep:  u.TOTPLastStep,
+		RecoveryCodes: u.RecoveryCodes,
+	}
+}
+
+func roleIndexKey(role, id string) []byte {
+	return []byte(role + "\x00" + id)
+}
+
+func (s *boltUserStore) createBuckets() error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{usersBucket, emailIndexBucket, roleIndexBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return fmt.Errorf("failed to create bucket %q: %w", name, err)
+			}
+		}
+		return nil
+	})
+}
+
+// migrateRoles stores the users with a role the model doesn't know as regular users,
+// like the users without privileges which used to be stored with the role UNDEFINED.
+// It's a no-op once all users have been migrated.
+func (s *boltUserStore) migrateRoles() error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		users := tx.Bucket(usersBucket)
+		roles := tx.Bucket(roleIndexBucket)
+
+		// the bucket mustn't be modified while iterating it
+		var outdated []*boltUser
+		err := users.ForEach(func(k, v []byte) error {
+			var u boltUser
+			if err := json.Unmarshal(v, &u); err != nil {
+				return fmt.Errorf("failed to decode user %q: %w", k, err)
+			}
+			if _, ok := model.RoleFromString(u.Role); !ok {
+				outdated = append(outdated, &u)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, u := range outdated {
+			if err = roles.Delete(roleIndexKey(u.Role, u.ID)); err != nil {
+				return err
+			}
+
+			u.Role = string(model.Regular)
+			data, err := json.Marshal(u)
+			if err != nil {
+				return fmt.Errorf("failed to encode user: %w", err)
+			}
+			if err = users.Put([]byte(u.ID), data); err != nil {
+				return err
+			}
+			if err = roles.Put(roleIndexKey(u.Role, u.ID), nil); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to migrate the roles of the users: %w", err)
+	}
+
+	return nil
+}
+
+// clear removes all users from the database
+func (s *boltUserStore) clear(_ context.Context) (int64, error) {
+	var count int64
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		count = int64(tx.Bucket(usersBucket).Stats().KeyN)
+
+		for _, name := range [][]byte{usersBucket, emailIndexBucket, roleIndexBucket} {
+			if err := tx.DeleteBucket(name); err != nil {
+				return err
+			}
+			if _, err := tx.CreateBucket(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to clear the database: %w", err)
+	}
+
+	return count, nil
+}
+
+// getBoltUser reads the user with given id, returns ErrNotFound if it doesn't exist
+func getBoltUser(tx *bolt.Tx, id []byte) (*boltUser, error) {
+	data := tx.Bucket(usersBucket).Get(id)
+	if data == nil {
+		return nil, ErrNotFound
+	}
+
+	var u boltUser
+	if err := json.Unmarshal(data, &u); err != nil {
+		return nil, fmt.Errorf("failed to decode user %q: %w", id, err)
+	}
+
+	return &u, nil
+}
+
+func (s *boltUserStore) Create(_ context.Context, user *model.User) (string, error) {
+	var id string
+	err := s.db.Update(func(tx *bolt.Tx) (err error) {
+		id, err = createBoltUser(tx, user)
+		return
+	})
+	if err != nil {
+		if err == ErrDuplicateEMail {
+			return "", err
+		}
+		return "", fmt.Errorf("failed to insert user: %w", err)
+	}
+
+	return id, nil
+}
+
+// createBoltUser inserts given user and returns the generated id
+func createBoltUser(tx *bolt.Tx, user *model.User) (string, error) {
+	// ids look like the ones generated by mongodb,
+	// so the backends are interchangeable
+	u := newBoltUser(primitive.NewObjectID().Hex(), user)
+	u.Version = 1
+	u.CreatedAt = now()
+
+	data, err := json.Marshal(u)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode user: %w", err)
+	}
+
+	emails := tx.Bucket(emailIndexBucket)
+	if emails.Get([]byte(u.EMail)) != nil {
+		return "", ErrDuplicateEMail
+	}
+
+	if err := tx.Bucket(usersBucket).Put([]byte(u.ID), data); err != nil {
+		return "", err
+	}
+	if err := emails.Put([]byte(u.EMail), []byte(u.ID)); err != nil {
+		return "", err
+	}
+	if err := tx.Bucket(roleIndexBucket).Put(roleIndexKey(u.Role, u.ID), nil); err != nil {
+		return "", err
+	}
+
+	return u.ID, nil
+}
+
+func (s *boltUserStore) FindByID(_ context.Context, id string) (*model.User, error) {
+	var u *boltUser
+	err := s.db.View(func(tx *bolt.Tx) (err error) {
+		u, err = getBoltUser(tx, []byte(id))
+		return
+	})
+	if err != nil {
+		if err == ErrNotFound {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to find user by id: %w", err)
+	}
+
+	return u.toUser(), nil
+}
+
+func (s *boltUserStore) FindByEMail(_ context.Context, email string) (*model.User, error) {
+	var u *boltUser
+	err := s.db.View(func(tx *bolt.Tx) (err error) {
+		id := tx.Bucket(emailIndexBucket).Get([]byte(email))
+		if id == nil {
+			return ErrNotFound
+		}
+
+		u, err = getBoltUser(tx, id)
+		return
+	})
+	if err != nil {
+		if err == ErrNotFound {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to find user by email: %w", err)
+	}
+
+	return u.toUser(), nil
+}
+
+func (s *boltUserStore) HasUsersWithRole(_ context.Context, role model.Role) (bool, error) {
+	var exist bool
+	err := s.db.View(func(tx *bolt.Tx) error {
+		exist = hasBoltUsersWithRole(tx, role)
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to determine users with role %q: %w", role, err)
+	}
+
+	return exist, nil
+}
+
+// hasBoltUsersWithRole reports whether the role index contains a user with given role
+func hasBoltUsersWithRole(tx *bolt.Tx, role model.Role) bool {
+	prefix := roleIndexKey(string(role), "")
+	k, _ := tx.Bucket(roleIndexBucket).Cursor().Seek(prefix)
+	return k != nil && bytes.HasPrefix(k, prefix)
+}
+
+func (s *boltUserStore) CreateFirstAdmin(_ context.Context, user *model.User) (string, error) {
+	admin := *user
+	admin.Role = model.Admin
+
+	// bolt allows a single write transaction at a time
+	var id string
+	err := s.db.Update(func(tx *bolt.Tx) (err error) {
+		if hasBoltUsersWithRole(tx, model.Admin) {
+			return ErrAdminExists
+		}
+
+		id, err = createBoltUser(tx, &admin)
+		return
+	})
+	if err != nil {
+		if err == ErrDuplicateEMail || err == ErrAdminExists {
+			return "", err
+		}
+		return "", fmt.Errorf("failed to insert admin: %w", err)
+	}
+
+	return id, nil
+}
+
+func (s *boltUserStore) List(_ context.Context, query model.UserQuery) (*model.UserPage, error) {
+	var users []*model.User
+	err := s.db.View(func(tx *bolt.Tx) error {
+		// only users with the requested role need to be decoded
+		if query.Filter.Role != "" {
+			prefix := roleIndexKey(string(query.Filter.Role), "")
+			c := tx.Bucket(roleIndexBucket).Cursor()
+			for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+				u, err := getBoltUser(tx, bytes.TrimPrefix(k, prefix))
+				if err != nil {
+					return err
+				}
+				users = append(users, u.toUser())
+			}
+			return nil
+		}
+
+		return tx.Bucket(usersBucket).ForEach(func(k, v []byte) error {
+			var u boltUser
+			if err := json.Unmarshal(v, &u); err != nil {
+				return fmt.Errorf("failed to decode user %q: %w", k, err)
+			}
+			users = append(users, u.toUser())
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+
+	return listUsers(users, query)
+}
+
+func (s *boltUserStore) Update(_ context.Context, user *model.User) error {
+	u := newBoltUser(user.ID, user)
+	u.Version++
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		current, err := getBoltUser(tx, []byte(u.ID))
+		if err != nil {
+			return err
+		}
+
+		if current.Version != user.Version {
+			return ErrVersionConflict
+		}
+
+		u.CreatedAt = current.CreatedAt
+		u.FailedLogins = current.FailedLogins
+		u.LockedUntil = current.LockedUntil
+		data, err := json.Marshal(u)
+		if err != nil {
+			return fmt.Errorf("failed to encode user: %w", err)
+		}
+
+		emails := tx.Bucket(emailIndexBucket)
+		if id := emails.Get([]byte(u.EMail)); id != nil && string(id) != u.ID {
+			return ErrDuplicateEMail
+		}
+
+		roles := tx.Bucket(roleIndexBucket)
+		if err = emails.Delete([]byte(current.EMail)); err != nil {
+			return err
+		}
+		if err = roles.Delete(roleIndexKey(current.Role, current.ID)); err != nil {
+			return err
+		}
+
+		if err = tx.Bucket(usersBucket).Put([]byte(u.ID), data); err != nil {
+			return err
+		}
+		if err = emails.Put([]byte(u.EMail), []byte(u.ID)); err != nil {
+			return err
+		}
+		if err = roles.Put(roleIndexKey(u.Role, u.ID), nil); err != nil {
+			return err
+		}
+
+		// returning an error rolls back the demotion
+		if current.Role == string(model.Admin) && !hasBoltUsersWithRole(tx, model.Admin) {
+			return ErrLastAdmin
+		}
+		return nil
+	})
+	if err != nil {
+		if err == ErrNotFound || err == ErrDuplicateEMail || err == ErrVersionConflict || err == ErrLastAdmin {
+			return err
+		}
+		return fmt.Errorf("failed to update user %q: %w", user.ID, err)
+	}
+
+	user.Version = u.Version
+	return nil
+}
+
+func (s *boltUserStore) AddFailedLogin(_ context.Context, id string) (int, error) {
+	var failures int
+	err := s.updateBoltUser(id, func(u *boltUser) {
+		u.FailedLogins++
+		failures = u.FailedLogins
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return failures, nil
+}
+
+func (s *boltUserStore) LockOutUntil(_ context.Context, id string, until time.Time) error {
+	return s.updateBoltUser(id, func(u *boltUser) {
+		u.LockedUntil = until
+	})
+}
+
+func (s *boltUserStore) ResetFailedLogins(_ context.Context, id string) error {
+	return s.updateBoltUser(id, func(u *boltUser) {
+		u.FailedLogins = 0
+		u.LockedUntil = time.Time{}
+	})
+}
+
+// updateBoltUser applies fn to the user with given id without incrementing its version,
+// it's meant for the login bookkeeping which doesn't touch the indexed fields
+func (s *boltUserStore) updateBoltUser(id string, fn func(u *boltUser)) error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		u, err := getBoltUser(tx, []byte(id))
+		if err != nil {
+			return err
+		}
+
+		fn(u)
+		data, err := json.Marshal(u)
+		if err != nil {
+			return fmt.Errorf("failed to encode user: %w", err)
+		}
+
+		return tx.Bucket(usersBucket).Put([]byte(id), data)
+	})
+	if err != nil {
+		if err == ErrNotFound {
+			return err
+		}
+		return fmt.Errorf("failed to update user %q: %w", id, err)
+	}
+
+	return nil
+}
+
+func (s *boltUserStore) Delete(_ context.Context, id string) error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		u, err := getBoltUser(tx, []byte(id))
+		if err != nil {
+			return err
+		}
+
+		if err = tx.Bucket(usersBucket).Delete([]byte(id)); err != nil {
+			return err
+		}
+		if err = tx.Bucket(emailIndexBucket).Delete([]byte(u.EMail)); err != nil {
+			return err
+		}
+		if err = tx.Bucket(roleIndexBucket).Delete(roleIndexKey(u.Role, u.ID)); err != nil {
+			return err
+		}
+
+		// returning an error rolls back the removal
+		if u.Role == string(model.Admin) && !hasBoltUsersWithRole(tx, model.Admin) {
+			return ErrLastAdmin
+		}
+		return nil
+	})
+	if err != nil {
+		if err == ErrNotFound || err == ErrLastAdmin {
+			return err
+		}
+		return fmt.Errorf("failed to delete user %q: %w", id, err)
+	}
+
+	return nil
+}
+
+// WriteBoltBackup writes a consistent copy of the whole bolt database to w,
+// the database keeps serving reads and writes while the backup is taken
+func WriteBoltBackup(db *bolt.DB, w io.Writer) (int64, error) {
+	var size int64
+	err := db.View(func(tx *bolt.Tx) (err error) {
+		size, err = tx.WriteTo(w)
+		return
+	})
+
+	return size, err
+}
+
+// WriteBoltBackupFile writes a consistent copy of the whole bolt database to the file at path,
+// readable by the owner only. The copy is written next to it and renamed once complete,
+// so path never holds a partial backup.
+func WriteBoltBackupFile(db *bolt.DB, path string) (int64, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create backup file: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	size, err := WriteBoltBackup(db, tmp)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to write backup file: %w", err)
+	}
+
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return 0, fmt.Errorf("failed to move backup file: %w", err)
+	}
+
+	return size, nil
+}
@@ -0,0 +1,168 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/status-owl/user-service/pkg/model"
+)
+
+func newBoltTestStore(t *testing.T, path string) *boltUserStore {
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatalf("failed to open bolt database: %s", err.Error())
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	s := &boltUserStore{db}
+	if err = s.createBuckets(); err != nil {
+		t.Fatalf("failed to create buckets: %s", err.Error())
+	}
+
+	return s
+}
+
+func TestBoltClear(t *testing.T) {
+	a := assert.New(t)
+	s := newBoltTestStore(t, filepath.Join(t.TempDir(), "users.db"))
+
+	for _, u := range fixturesAllUsers {
+		_, err := s.Create(context.Background(), u)
+		a.Nil(err)
+	}
+
+	count, err := s.clear(context.Background())
+	a.Nil(err)
+	a.Equal(int64(len(fixturesAllUsers)), count)
+
+	for _, u := range fixturesAllUsers {
+		_, err := s.FindByEMail(context.Background(), u.EMail)
+		a.ErrorIs(err, ErrNotFound)
+
+		exist, err := s.HasUsersWithRole(context.Background(), u.Role)
+		a.Nil(err)
+		a.False(exist)
+	}
+}
+
+func TestBoltReopen(t *testing.T) {
+	a := assert.New(t)
+	path := filepath.Join(t.TempDir(), "users.db")
+
+	s := newBoltTestStore(t, path)
+	id, err := s.Create(context.Background(), fixtures.users.admin)
+	a.Nil(err)
+	a.Nil(s.db.Close())
+
+	// users survive a restart
+	s = newBoltTestStore(t, path)
+	u, err := s.FindByID(context.Background(), id)
+	a.Nil(err)
+	a.Equal(fixtures.users.admin.EMail, u.EMail)
+}
+
+func TestWriteBoltBackup(t *testing.T) {
+	a := assert.New(t)
+	dir := t.TempDir()
+
+	s := newBoltTestStore(t, filepath.Join(dir, "users.db"))
+	id, err := s.Create(context.Background(), fixtures.users.reporter)
+	a.Nil(err)
+
+	var buf bytes.Buffer
+	size, err := WriteBoltBackup(s.db, &buf)
+	a.Nil(err)
+	a.Equal(int64(buf.Len()), size)
+
+	// the store keeps working while the backup is restored elsewhere
+	_, err = s.Create(context.Background(), fixtures.users.admin)
+	a.Nil(err)
+
+	backupPath := filepath.Join(dir, "backup.db")
+	a.Nil(os.WriteFile(backupPath, buf.Bytes(), 0600))
+
+	restored := newBoltTestStore(t, backupPath)
+	u, err := restored.FindByID(context.Background(), id)
+	a.Nil(err)
+	a.Equal(fixtures.users.reporter.EMail, u.EMail)
+
+	_, err = restored.FindByEMail(context.Background(), fixtures.users.admin.EMail)
+	a.ErrorIs(err, ErrNotFound, "users created after the backup are not part of it")
+}
+
+func TestWriteBoltBackupFile(t *testing.T) {
+	a := assert.New(t)
+	dir := t.TempDir()
+
+	s := newBoltTestStore(t, filepath.Join(dir, "users.db"))
+	id, err := s.Create(context.Background(), fixtures.users.reporter)
+	a.Nil(err)
+
+	backupPath := filepath.Join(dir, "backup.db")
+	a.Nil(os.WriteFile(backupPath, []byte("previous backup"), 0644))
+
+	size, err := WriteBoltBackupFile(s.db, backupPath)
+	a.Nil(err)
+
+	info, err := os.Stat(backupPath)
+	if a.Nil(err) {
+		a.Equal(size, info.Size(), "the previous backup is replaced")
+		a.Equal(os.FileMode(0600), info.Mode().Perm(), "backups contain credentials")
+	}
+
+	entries, err := os.ReadDir(dir)
+	a.Nil(err)
+	a.Len(entries, 2, "no temporary files are left behind")
+
+	restored := newBoltTestStore(t, backupPath)
+	u, err := restored.FindByID(context.Background(), id)
+	a.Nil(err)
+	a.Equal(fixtures.users.reporter.EMail, u.EMail)
+}
+
+func TestBoltMigrateRoles(t *testing.T) {
+	a := assert.New(t)
+	s := newBoltTestStore(t, filepath.Join(t.TempDir(), "users.db"))
+	ctx := context.Background()
+
+	id, err := s.Create(ctx, fixtures.users.reporter)
+	a.Nil(err)
+
+	// store a user like it has been stored before the roles were reconciled
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		data, err := json.Marshal(&boltUser{ID: "1", Name: "John", EMail: "john@example.com", Role: "UNDEFINED"})
+		if err != nil {
+			return err
+		}
+		if err = tx.Bucket(usersBucket).Put([]byte("1"), data); err != nil {
+			return err
+		}
+		return tx.Bucket(roleIndexBucket).Put(roleIndexKey("UNDEFINED", "1"), nil)
+	})
+	a.Nil(err)
+
+	a.Nil(s.migrateRoles())
+	// migrating again is a no-op
+	a.Nil(s.migrateRoles())
+
+	page, err := s.List(ctx, model.UserQuery{Filter: model.UserFilter{Role: model.Regular}, Limit: 10})
+	a.Nil(err)
+	if a.Len(page.Users, 1) {
+		a.Equal("1", page.Users[0].ID)
+	}
+
+	page, err = s.List(ctx, model.UserQuery{Filter: model.UserFilter{Role: "UNDEFINED"}, Limit: 10})
+	a.Nil(err)
+	a.Empty(page.Users)
+
+	reporter, err := s.FindByID(ctx, id)
+	a.Nil(err)
+	a.Equal(model.Reporter, reporter.Role, "known roles are kept")
+}
@@ -0,0 +1,264 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/status-owl/user-service/pkg/model"
+)
+
+// memoryUserStore implements UserStore keeping all users in memory,
+// it's meant to be used in tests and for local runs
+type memoryUserStore struct {
+	mu sync.RWMutex
+	// users maps user ids to users
+	users map[string]model.User
+	// emails maps email addresses to user ids
+	emails map[string]string
+}
+
+func newMemoryUserStore() *memoryUserStore {
+	return &memoryUserStore{
+		users:  make(map[string]model.User),
+		emails: make(map[string]string),
+	}
+}
+
+// clear removes all users from the store
+func (s *memoryUserStore) clear(_ context.Context) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count := int64(len(s.users))
+	s.users = make(map[string]model.User)
+	s.emails = make(map[string]string)
+
+	return count, nil
+}
+
+func (s *memoryUserStore) Create(_ context.Context, user *model.User) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.create(user)
+}
+
+// create inserts a copy of given user, the caller has to hold the write lock
+func (s *memoryUserStore) create(user *model.User) (string, error) {
+	if _, ok := s.emails[user.EMail]; ok {
+		return "", ErrDuplicateEMail
+	}
+
+	// ids look like the ones generated by mongodb,
+	// so the backends are interchangeable
+	u := *user
+	u.ID = primitive.NewObjectID().Hex()
+	u.Role = storedRole(string(u.Role))
+	u.Status = model.StatusFromString(string(u.Status))
+	u.Version = 1
+	u.CreatedAt = now()
+	u.RecoveryCodes = copyStrings(user.RecoveryCodes)
+
+	s.users[u.ID] = u
+	s.emails[u.EMail] = u.ID
+
+	return u.ID, nil
+}
+
+func (s *memoryUserStore) FindByID(_ context.Context, id string) (*model.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	u, ok := s.users[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return &u, nil
+}
+
+func (s *memoryUserStore) FindByEMail(_ context.Context, email string) (*model.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	id, ok := s.emails[email]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	u := s.users[id]
+	return &u, nil
+}
+
+func (s *memoryUserStore) HasUsersWithRole(_ context.Context, role model.Role) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.hasUsersWithRole(role), nil
+}
+
+// hasUsersWithRole reports whether a user with given role exists, the caller has to hold a lock
+func (s *memoryUserStore) hasUsersWithRole(role model.Role) bool {
+	for _, u := range s.users {
+		if u.Role == role {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isLastAdmin reports whether the user with given id is the only admin, the caller has to hold a lock
+func (s *memoryUserStore) isLastAdmin(id string) bool {
+	if s.users[id].Role != model.Admin {
+		return false
+	}
+
+	for _, u := range s.users {
+		if u.Role == model.Admin && u.ID != id {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (s *memoryUserStore) CreateFirstAdmin(_ context.Context, user *model.User) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.hasUsersWithRole(model.Admin) {
+		return "", ErrAdminExists
+	}
+
+	admin := *user
+	admin.Role = model.Admin
+	return s.create(&admin)
+}
+
+func (s *memoryUserStore) List(_ context.Context, query model.UserQuery) (*model.UserPage, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	users := make([]*model.User, 0, len(s.users))
+	for _, u := range s.users {
+		u := u
+		users = append(users, &u)
+	}
+
+	return listUsers(users, query)
+}
+
+func (s *memoryUserStore) Update(_ context.Context, user *model.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.users[user.ID]
+	if !ok {
+		return ErrNotFound
+	}
+
+	if current.Version != user.Version {
+		return ErrVersionConflict
+	}
+
+	if storedRole(string(user.Role)) != model.Admin && s.isLastAdmin(user.ID) {
+		return ErrLastAdmin
+	}
+
+	if id, ok := s.emails[user.EMail]; ok && id != user.ID {
+		return ErrDuplicateEMail
+	}
+
+	u := *user
+	u.Role = storedRole(string(u.Role))
+	u.Status = model.StatusFromString(string(u.Status))
+	u.Version++
+	u.CreatedAt = current.CreatedAt
+	u.FailedLogins = current.FailedLogins
+	u.LockedUntil = current.LockedUntil
+	u.RecoveryCodes = copyStrings(user.RecoveryCodes)
+
+	delete(s.emails, current.EMail)
+	s.users[u.ID] = u
+	s.emails[u.EMail] = u.ID
+
+	user.Version = u.Version
+	return nil
+}
+
+func (s *memoryUserStore) AddFailedLogin(_ context.Context, id string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[id]
+	if !ok {
+		return 0, ErrNotFound
+	}
+
+	u.FailedLogins++
+	s.users[id] = u
+
+	return u.FailedLogins, nil
+}
+
+func (s *memoryUserStore) LockOutUntil(_ context.Context, id string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+
+	u.LockedUntil = until
+	s.users[id] = u
+
+	return nil
+}
+
+func (s *memoryUserStore) ResetFailedLogins(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+
+	u.FailedLogins = 0
+	u.LockedUntil = time.Time{}
+	s.users[id] = u
+
+	return nil
+}
+
+func (s *memoryUserStore) Delete(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+
+	if s.isLastAdmin(id) {
+		return ErrLastAdmin
+	}
+
+	delete(s.users, id)
+	delete(s.emails, u.EMail)
+
+	return nil
+}
+
+// copyStrings returns a copy of given slice, so the stored users don't share arrays with the callers
+func copyStrings(values []string) []string {
+	if values == nil {
+		return nil
+	}
+	return append([]string{}, values...)
+}
@@ -0,0 +1,55 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryCreateUserConcurrently(t *testing.T) {
+	s := newMemoryUserStore()
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		failed int
+	)
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := s.Create(context.Background(), fixtures.users.admin); err != nil {
+				mu.Lock()
+				failed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 9, failed, "only one user with the same email is expected to be created")
+}
+
+func TestMemoryClear(t *testing.T) {
+	a := assert.New(t)
+	s := newMemoryUserStore()
+
+	var ids []string
+	for _, u := range fixturesAllUsers {
+		id, err := s.Create(context.Background(), u)
+		a.Nil(err)
+		ids = append(ids, id)
+	}
+
+	count, err := s.clear(context.Background())
+	a.Nil(err)
+	a.Equal(int64(len(fixturesAllUsers)), count)
+
+	for _, id := range ids {
+		_, err := s.FindByID(context.Background(), id)
+		a.ErrorIs(err, ErrNotFound)
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"regexp"
+	"strconv"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -22,14 +24,31 @@ type mongoUserStore struct {
 const (
 	databaseName   = "user-service"
 	collectionName = "users"
+	// locksCollectionName contains documents written by transactions which must not run concurrently
+	locksCollectionName = "locks"
+	adminsLockID        = "admins"
 )
 
 type mongoUser struct {
-	ID      primitive.ObjectID `bson:"_id"`
-	Name    string             `bson:"name"`
-	EMail   string             `bson:"email"`
-	PwdHash string             `bson:"pwd_hash"`
-	Role    string             `bson:"role"`
+	ID    primitive.ObjectID `bson:"_id"`
+	Name  string             `bson:"name"`
+	EMail string             `bson:"email"`
+	// EMailVerified is missing in documents written before verification was introduced
+	EMailVerified bool   `bson:"email_verified,omitempty"`
+	PwdHash       string `bson:"pwd_hash"`
+	Role          string `bson:"role"`
+	// Status is missing in documents written before the lifecycle was introduced, they're active
+	Status  string `bson:"status,omitempty"`
+	Version int64  `bson:"version"`
+	// CreatedAt is missing in documents written before it was introduced until migrateCreatedAt has run
+	CreatedAt    time.Time `bson:"created_at,omitempty"`
+	FailedLogins int       `bson:"failed_logins,omitempty"`
+	LockedUntil  time.Time `bson:"locked_until,omitempty"`
+	// TOTPSecret, MFAEnabled, TOTPLastStep and RecoveryCodes are missing until the user enrolls an authenticator
+	TOTPSecret    string   `bson:"totp_secret,omitempty"`
+	MFAEnabled    bool     `bson:"mfa_enabled,omitempty"`
+	TOTPLastStep  int64    `bson:"totp_last_step,omitempty"`
+	RecoveryCodes []string `bson:"recovery_codes,omitempty"`
 }
 
 var (
@@ -40,22 +59,80 @@ var (
 // note that the id is going to be overwritten with generated one based on current timestamp
 func newMongoUser(user *model.User) *mongoUser {
 	return &mongoUser{
-		ID:    primitive.NewObjectID(),
-		Name:  user.Name,
-		EMail: user.EMail,
-		Role:  string(user.Role),
+		ID:            primitive.NewObjectID(),
+		Name:          user.Name,
+		EMail:         user.EMail,
+		EMailVerified: user.EMailVerified,
+		Role:          string(storedRole(string(user.Role))),
+		Status:        string(model.StatusFromString(string(user.Status))),
+		PwdHash:       user.PasswordHash,
+		Version:       1,
+		CreatedAt:     now(),
 	}
 }
 
 func (u *mongoUser) toUser() *model.User {
 	return &model.User{
-		ID:    u.ID.Hex(),
-		Name:  u.Name,
-		EMail: u.EMail,
-		Role:  model.RoleFromString(u.Role),
+		ID:            u.ID.Hex(),
+		Name:          u.Name,
+		EMail:         u.EMail,
+		EMailVerified: u.EMailVerified,
+		Role:          storedRole(u.Role),
+		Status:        model.StatusFromString(u.Status),
+		Version:       u.Version,
+		CreatedAt:     u.CreatedAt.UTC(),
+		PasswordHash:  u.PwdHash,
+		FailedLogins:  u.FailedLogins,
+		LockedUntil:   u.LockedUntil.UTC(),
+		TOTPSecret:    u.TOTPSecret,
+		MFAEnabled:    u.MFAEnabled,
+		TOTPLastStep:  u.TOTPLastStep,
+		RecoveryCodes: u.RecoveryCodes,
 	}
 }
 
+// migrateRoles stores the users with a role the model doesn't know as regular users,
+// like the users without privileges which used to be stored with the role UNDEFINED.
+// It's a no-op once all users have been migrated.
+func (s *mongoUserStore) migrateRoles() error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	known := make(bson.A, len(model.Roles))
+	for i, r := range model.Roles {
+		known[i] = string(r)
+	}
+
+	_, err := s.col().UpdateMany(ctx,
+		bson.M{"role": bson.M{"$nin": known}},
+		bson.M{"$set": bson.M{"role": string(model.Regular)}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to migrate the roles of the users: %w", err)
+	}
+
+	return nil
+}
+
+// migrateCreatedAt stores the creation time of the users written before it was introduced,
+// it's taken from the object id, which contains it in seconds. Users are sorted and paginated
+// by the stored field, so it has to be present in every document. It's a no-op once all users
+// have been migrated.
+func (s *mongoUserStore) migrateCreatedAt() error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	_, err := s.col().UpdateMany(ctx,
+		bson.M{"created_at": bson.M{"$exists": false}},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{"created_at": bson.M{"$toDate": "$_id"}}}}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to migrate the creation time of the users: %w", err)
+	}
+
+	return nil
+}
+
 // returns users collections
 func (s *mongoUserStore) col() *mongo.Collection {
 	return s.client.
@@ -73,17 +150,72 @@ func (s *mongoUserStore) createIndexes() error {
 		Options: &options.IndexOptions{Unique: &emailUnique},
 	}
 
+	// used to filter and sort users while listing them
+	roleIndex := mongo.IndexModel{Keys: bson.M{"role": 1}}
+	createdAtIndex := mongo.IndexModel{Keys: bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}}
+
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
 	defer cancel()
 
-	_, err := c.Indexes().CreateOne(ctx, emailIndex)
+	_, err := c.Indexes().CreateMany(ctx, []mongo.IndexModel{emailIndex, roleIndex, createdAtIndex})
 	if err != nil {
 		return ErrIndexCreation
 	}
 
+	// collections can't be created within transactions by all server versions
+	_, err = s.locks().UpdateOne(ctx,
+		bson.M{"_id": adminsLockID},
+		bson.M{"$setOnInsert": bson.M{"version": int64(0)}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create the admins lock: %w", err)
+	}
+
 	return nil
 }
 
+// returns the locks collection
+func (s *mongoUserStore) locks() *mongo.Collection {
+	return s.client.
+		Database(databaseName).
+		Collection(locksCollectionName)
+}
+
+// withAdminsLock runs fn in a transaction writing the lock document of the admins,
+// concurrent transactions changing admins conflict and are retried.
+// Transactions need a replica set, a single node one is sufficient.
+func (s *mongoUserStore) withAdminsLock(ctx context.Context, fn func(sc mongo.SessionContext) error) error {
+	session, err := s.client.StartSession()
+	if err != nil {
+		return fmt.Errorf("failed to start session: %w", err)
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		if _, err := s.locks().UpdateOne(sc,
+			bson.M{"_id": adminsLockID},
+			bson.M{"$inc": bson.M{"version": 1}},
+		); err != nil {
+			return nil, fmt.Errorf("failed to lock admins: %w", err)
+		}
+
+		return nil, fn(sc)
+	})
+
+	return err
+}
+
+// countAdmins returns the count of admins
+func (s *mongoUserStore) countAdmins(ctx context.Context) (int64, error) {
+	count, err := s.col().CountDocuments(ctx, bson.M{"role": string(model.Admin)})
+	if err != nil {
+		return 0, fmt.Errorf("failed to count admins: %w", err)
+	}
+
+	return count, nil
+}
+
 // clear removes all users from the collection
 func (s *mongoUserStore) clear(ctx context.Context) (int64, error) {
 	result, err := s.col().DeleteMany(ctx, bson.M{})
@@ -98,12 +230,43 @@ func (s *mongoUserStore) Create(ctx context.Context, user *model.User) (string,
 	c := s.col()
 	result, err := c.InsertOne(ctx, newMongoUser(user))
 	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return "", ErrDuplicateEMail
+		}
 		return "", err
 	}
 
 	return result.InsertedID.(primitive.ObjectID).Hex(), nil
 }
 
+func (s *mongoUserStore) CreateFirstAdmin(ctx context.Context, user *model.User) (string, error) {
+	admin := newMongoUser(user)
+	admin.Role = string(model.Admin)
+
+	err := s.withAdminsLock(ctx, func(sc mongo.SessionContext) error {
+		count, err := s.countAdmins(sc)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrAdminExists
+		}
+
+		if _, err = s.col().InsertOne(sc, admin); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				return ErrDuplicateEMail
+			}
+			return fmt.Errorf("failed to insert admin: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return admin.ID.Hex(), nil
+}
+
 func (s *mongoUserStore) FindByID(ctx context.Context, id string) (*model.User, error) {
 	var u mongoUser
 	// first check if the id can be converted to a mongo's object id
@@ -137,43 +300,287 @@ func (s *mongoUserStore) FindByEMail(ctx context.Context, email string) (*model.
 }
 
 func (s *mongoUserStore) HasUsersWithRole(ctx context.Context, role model.Role) (bool, error) {
-	matchStage := bson.D{{"$match", bson.D{{"role", string(role)}}}}
-	countStage := bson.D{{"$count", "count"}}
+	count, err := s.col().CountDocuments(ctx, bson.M{"role": string(role)}, options.Count().SetLimit(1))
+	if err != nil {
+		return false, fmt.Errorf("failed to count users with role %q: %w", role, err)
+	}
+
+	return count > 0, nil
+}
 
-	cursor, err := s.col().Aggregate(ctx, mongo.Pipeline{matchStage, countStage})
+// mongoSortFields maps the sort fields to the ones of the documents
+var mongoSortFields = map[model.SortField]string{
+	model.SortByCreatedAt: "created_at",
+	model.SortByName:      "name",
+	model.SortByEMail:     "email",
+}
+
+func (s *mongoUserStore) List(ctx context.Context, query model.UserQuery) (*model.UserPage, error) {
+	after, err := decodeCursor(query)
 	if err != nil {
-		return false, fmt.Errorf("failed to execute pipeline: %w", err)
+		return nil, err
 	}
 
-	var results []bson.M
-	err = cursor.All(ctx, &results)
+	var conditions bson.A
+
+	f := query.Filter
+	if f.Role != "" {
+		conditions = append(conditions, bson.M{"role": string(f.Role)})
+	}
+	if f.Status == model.Active {
+		// documents without a status are active
+		conditions = append(conditions, bson.M{"status": bson.M{"$in": bson.A{string(f.Status), nil}}})
+	} else if f.Status != "" {
+		conditions = append(conditions, bson.M{"status": string(f.Status)})
+	}
+	if f.EMailPrefix != "" {
+		conditions = append(conditions, bson.M{"email": primitive.Regex{
+			Pattern: "^" + regexp.QuoteMeta(f.EMailPrefix), Options: "i",
+		}})
+	}
+	if f.NameContains != "" {
+		conditions = append(conditions, bson.M{"name": primitive.Regex{
+			Pattern: regexp.QuoteMeta(f.NameContains), Options: "i",
+		}})
+	}
+	if !f.CreatedBefore.IsZero() {
+		conditions = append(conditions, bson.M{"created_at": bson.M{"$lt": f.CreatedBefore}})
+	}
+	if !f.CreatedAfter.IsZero() {
+		conditions = append(conditions, bson.M{"created_at": bson.M{"$gt": f.CreatedAfter}})
+	}
+
+	field, direction, op := mongoSortFields[sortField(query)], 1, "$gt"
+	if query.Descending {
+		direction, op = -1, "$lt"
+	}
+
+	if after != nil {
+		id, err := primitive.ObjectIDFromHex(after.ID)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+
+		var value interface{} = after.Value
+		if after.SortBy == model.SortByCreatedAt {
+			ms, _ := strconv.ParseInt(after.Value, 10, 64)
+			value = time.UnixMilli(ms)
+		}
+
+		conditions = append(conditions, bson.M{"$or": bson.A{
+			bson.M{field: bson.M{op: value}},
+			bson.M{field: value, "_id": bson.M{op: id}},
+		}})
+	}
+
+	filter := bson.M{}
+	if len(conditions) > 0 {
+		filter["$and"] = conditions
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: field, Value: direction}, {Key: "_id", Value: direction}}).
+		SetLimit(int64(query.Limit + 1))
+
+	cur, err := s.col().Find(ctx, filter, opts)
 	if err != nil {
-		return false, fmt.Errorf("failed to extract pipeline results: %w", err)
+		return nil, fmt.Errorf("failed to list users: %w", err)
 	}
 
-	if len(results) == 0 {
-		return false, nil
+	var docs []mongoUser
+	if err = cur.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
 	}
 
-	count := results[0]["count"].(int32)
-	fmt.Println(count)
+	users := make([]*model.User, 0, len(docs))
+	for i := range docs {
+		users = append(users, docs[i].toUser())
+	}
 
-	return count > 0, nil
+	return newPage(users, query), nil
 }
 
-func (s *mongoUserStore) Delete(ctx context.Context, id string) error {
-	objectId, err := primitive.ObjectIDFromHex(id)
+func (s *mongoUserStore) Update(ctx context.Context, user *model.User) error {
+	objectId, err := primitive.ObjectIDFromHex(user.ID)
 	if err != nil {
 		return ErrNotFound
 	}
 
-	_, err = s.col().DeleteOne(ctx, bson.M{"_id": objectId})
+	filter := bson.M{"_id": objectId, "version": user.Version}
+	if user.Version == 0 {
+		// documents written before versioning was introduced
+		filter["version"] = bson.M{"$exists": false}
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"name":           user.Name,
+			"email":          user.EMail,
+			"email_verified": user.EMailVerified,
+			"role":           string(storedRole(string(user.Role))),
+			"status":         string(model.StatusFromString(string(user.Status))),
+			"pwd_hash":       user.PasswordHash,
+			"totp_secret":    user.TOTPSecret,
+			"mfa_enabled":    user.MFAEnabled,
+			"totp_last_step": user.TOTPLastStep,
+			"recovery_codes": user.RecoveryCodes,
+		},
+		"$inc": bson.M{"version": 1},
+	}
+
+	// demoting admins is guarded by the admins lock, see updateAdmin
+	unguarded := filter
+	if storedRole(string(user.Role)) != model.Admin {
+		unguarded = bson.M{"$and": bson.A{filter, bson.M{"role": bson.M{"$ne": string(model.Admin)}}}}
+	}
+
+	result, err := s.col().UpdateOne(ctx, unguarded, update)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrDuplicateEMail
+		}
+		return fmt.Errorf("failed to update user %q: %w", user.ID, err)
+	}
+
+	if result.MatchedCount == 0 {
+		// either the user doesn't exist, it has another version or it's an admin
+		var current mongoUser
+		if err = s.col().FindOne(ctx, bson.M{"_id": objectId}).Decode(&current); err != nil {
+			if err == mongo.ErrNoDocuments {
+				return ErrNotFound
+			}
+			return fmt.Errorf("failed to update user %q: %w", user.ID, err)
+		}
+		if current.Version != user.Version {
+			return ErrVersionConflict
+		}
+		if err = s.updateAdmin(ctx, filter, update); err != nil {
+			return err
+		}
+	}
+
+	user.Version++
+	return nil
+}
+
+// updateAdmin applies update to the user matching filter in a transaction holding the admins lock,
+// the transaction is aborted if no admin is left afterwards
+func (s *mongoUserStore) updateAdmin(ctx context.Context, filter, update bson.M) error {
+	return s.withAdminsLock(ctx, func(sc mongo.SessionContext) error {
+		result, err := s.col().UpdateOne(sc, filter, update)
+		if err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				return ErrDuplicateEMail
+			}
+			return fmt.Errorf("failed to update admin: %w", err)
+		}
+		if result.MatchedCount == 0 {
+			return ErrVersionConflict
+		}
+
+		return s.ensureAdminsLeft(sc)
+	})
+}
+
+// ensureAdminsLeft returns ErrLastAdmin if the current transaction has removed all admins
+func (s *mongoUserStore) ensureAdminsLeft(sc mongo.SessionContext) error {
+	count, err := s.countAdmins(sc)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrLastAdmin
+	}
+
+	return nil
+}
+
+func (s *mongoUserStore) AddFailedLogin(ctx context.Context, id string) (int, error) {
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return 0, ErrNotFound
+	}
+
+	var u mongoUser
+	err = s.col().FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": objectId},
+		bson.M{"$inc": bson.M{"failed_logins": 1}},
+		options.FindOneAndUpdate().
+			SetReturnDocument(options.After).
+			SetProjection(bson.M{"failed_logins": 1}),
+	).Decode(&u)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			return ErrNotFound
+			return 0, ErrNotFound
 		}
-		return fmt.Errorf("failed to delete user %q: %w", id, err)
+		return 0, fmt.Errorf("failed to count failed login of user %q: %w", id, err)
+	}
+
+	return u.FailedLogins, nil
+}
+
+func (s *mongoUserStore) LockOutUntil(ctx context.Context, id string, until time.Time) error {
+	return s.updateLogins(ctx, id, bson.M{"$set": bson.M{"locked_until": until}})
+}
+
+func (s *mongoUserStore) ResetFailedLogins(ctx context.Context, id string) error {
+	return s.updateLogins(ctx, id, bson.M{"$unset": bson.M{"failed_logins": "", "locked_until": ""}})
+}
+
+// updateLogins applies update to the login bookkeeping of the user with given id,
+// the version isn't incremented
+func (s *mongoUserStore) updateLogins(ctx context.Context, id string, update bson.M) error {
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrNotFound
+	}
+
+	result, err := s.col().UpdateOne(ctx, bson.M{"_id": objectId}, update)
+	if err != nil {
+		return fmt.Errorf("failed to update user %q: %w", id, err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
 	}
 
 	return nil
 }
+
+func (s *mongoUserStore) Delete(ctx context.Context, id string) error {
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrNotFound
+	}
+
+	// removing admins is guarded by the admins lock
+	result, err := s.col().DeleteOne(ctx, bson.M{"_id": objectId, "role": bson.M{"$ne": string(model.Admin)}})
+	if err != nil {
+		return fmt.Errorf("failed to delete user %q: %w", id, err)
+	}
+
+	if result.DeletedCount > 0 {
+		return nil
+	}
+
+	// either the user doesn't exist or it's an admin
+	count, err := s.col().CountDocuments(ctx, bson.M{"_id": objectId})
+	if err != nil {
+		return fmt.Errorf("failed to delete user %q: %w", id, err)
+	}
+	if count == 0 {
+		return ErrNotFound
+	}
+
+	return s.withAdminsLock(ctx, func(sc mongo.SessionContext) error {
+		result, err := s.col().DeleteOne(sc, bson.M{"_id": objectId})
+		if err != nil {
+			return fmt.Errorf("failed to delete admin %q: %w", id, err)
+		}
+		if result.DeletedCount == 0 {
+			return ErrNotFound
+		}
+
+		return s.ensureAdminsLeft(sc)
+	})
+}
@@ -2,26 +2,37 @@ package store
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
 	"os"
 	"testing"
 	"time"
 
-	"github.com/rs/zerolog"
 	"github.com/status-owl/user-service/pkg/model"
 	"github.com/stretchr/testify/assert"
 	tc "github.com/testcontainers/testcontainers-go"
 	"github.com/testcontainers/testcontainers-go/wait"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 var mongoClient *mongo.Client
-var store UserStore
+var store *mongoUserStore
+var tokenStore *mongoRefreshTokenStore
+var resetTokenStore *mongoPasswordResetTokenStore
+var apiKeyStore *mongoAPIKeyStore
 
 func TestMain(m *testing.M) {
+	flag.Parse()
+
+	// mongodb and postgres tests need docker, skip them in short mode
+	if testing.Short() {
+		os.Exit(m.Run())
+	}
+
 	ctx := context.Background()
 
 	mongoContainer, err := setupMongo(ctx)
@@ -40,79 +51,56 @@ func TestMain(m *testing.M) {
 		log.Fatalf("failed to establish a mongodb connection: %s", err.Error())
 	}
 
-	store, err = NewUserStore(mongoClient, zerolog.New(os.Stdout).With().Caller().Logger())
-	if err != nil {
+	store = &mongoUserStore{mongoClient}
+	if err = store.createIndexes(); err != nil {
 		log.Fatalf("failed to create the userStore: %s", err.Error())
 	}
 
-	os.Exit(m.Run())
-}
-
-func TestCreateUser(t *testing.T) {
-	expectedUser := fixtures.users.withoutRole
-	id, err := store.Create(context.Background(), expectedUser)
-	if err != nil {
-		t.Error(err)
+	tokenStore = &mongoRefreshTokenStore{mongoClient}
+	if err = tokenStore.createIndexes(); err != nil {
+		log.Fatalf("failed to create the refresh token store: %s", err.Error())
 	}
 
-	// now we expect that the actualUser exists
-	actualUser, err := store.FindByID(context.Background(), id)
-	assert.Nil(t, err)
-	assert.Equal(t, id, actualUser.ID)
-	assert.NotEqual(t, id, primitive.NilObjectID.Hex(), "make sure the id was generated")
-	assert.Equal(t, expectedUser.Name, actualUser.Name)
-	assert.Equal(t, expectedUser.EMail, actualUser.EMail)
-}
+	resetTokenStore = &mongoPasswordResetTokenStore{mongoClient}
+	if err = resetTokenStore.createIndexes(); err != nil {
+		log.Fatalf("failed to create the password reset token store: %s", err.Error())
+	}
 
-func TestFindByEmail(t *testing.T) {
-	clearDB()
-	expectedUser := fixtures.users.withoutRole
+	apiKeyStore = &mongoAPIKeyStore{mongoClient}
+	if err = apiKeyStore.createIndexes(); err != nil {
+		log.Fatalf("failed to create the api key store: %s", err.Error())
+	}
 
-	id, err := store.Create(context.Background(), expectedUser)
-	assert.Nil(t, err)
+	postgresContainer, err := setupPostgres(ctx)
+	if err != nil {
+		log.Fatalf("failed to initialize postgres via docker: %s", err.Error())
+	}
 
-	actualUser, err := store.FindByEMail(context.Background(), expectedUser.EMail)
-	assert.Nil(t, err)
-	assert.Equal(t, id, actualUser.ID)
-	assert.Equal(t, expectedUser.EMail, actualUser.EMail)
-	assert.Equal(t, expectedUser.Name, actualUser.Name)
+	defer func() {
+		if err = postgresContainer.Terminate(ctx); err != nil {
+			log.Fatalf("failed to terminate postgres container: %s", err.Error())
+		}
+	}()
 
-	_, err = store.FindByEMail(context.Background(), "not-existing-user@example.com")
-	assert.ErrorIs(t, err, ErrNotFound)
-}
+	postgresDB, err = connectPostgres(postgresContainer.URL)
+	if err != nil {
+		log.Fatalf("failed to establish a postgres connection: %s", err.Error())
+	}
 
-func TestFindByID(t *testing.T) {
-	_, err := store.FindByID(context.Background(), "123")
-	assert.ErrorIs(t, err, ErrNotFound)
+	os.Exit(m.Run())
 }
 
-func TestHasUserWithRole(t *testing.T) {
-	// clear db
-	// make sure a admin user does not exist
-	// writes a couple of users with one of them being admin
-	// makes sure at least one admin user does exist
-	clearDB()
-
-	a := assert.New(t)
-
-	// don't expect a admin user
-	exist, err := store.HasUsersWithRole(context.Background(), model.Admin)
-	a.Nil(err)
-	a.False(exist)
-
-	// write users
-	for _, user := range fixturesAllUsers {
-		_, err := store.Create(context.Background(), user)
-		a.Nil(err)
+// skipInShortMode skips tests depending on a running mongodb or postgres
+func skipInShortMode(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping docker backed test in short mode")
 	}
-
-	// expect an admin
-	exist, err = store.HasUsersWithRole(context.Background(), model.Admin)
-	a.Nil(err)
-	a.True(exist)
 }
 
 func TestClear(t *testing.T) {
+	skipInShortMode(t)
+	clearDB()
+
 	a := assert.New(t)
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
@@ -140,20 +128,78 @@ func TestClear(t *testing.T) {
 	}
 }
 
-func TestDelete(t *testing.T) {
+func TestMongoMigrateRoles(t *testing.T) {
+	skipInShortMode(t)
 	clearDB()
 
 	a := assert.New(t)
-	u := fixtures.users.reporter
-	id, err := store.Create(context.Background(), u)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	id, err := store.Create(ctx, fixtures.users.reporter)
+	a.Nil(err)
+
+	// store users like they have been stored before the roles were reconciled
+	_, err = store.col().InsertMany(ctx, []interface{}{
+		bson.M{"name": "John", "email": "john@example.com", "role": "UNDEFINED"},
+		bson.M{"name": "Jane", "email": "jane@example.com"},
+	})
+	a.Nil(err)
+
+	a.Nil(store.migrateRoles())
+
+	count, err := store.col().CountDocuments(ctx, bson.M{"role": string(model.Regular)})
 	a.Nil(err)
+	a.Equal(int64(2), count)
 
-	err = store.Delete(context.Background(), id)
+	reporter, err := store.FindByID(ctx, id)
 	a.Nil(err)
+	a.Equal(model.Reporter, reporter.Role, "known roles are kept")
+}
+
+func TestMongoMigrateCreatedAt(t *testing.T) {
+	skipInShortMode(t)
+	clearDB()
+
+	a := assert.New(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// store users like they have been stored before the creation time was introduced
+	createdAt := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	ids := make([]primitive.ObjectID, 3)
+	for i := range ids {
+		ids[i] = primitive.NewObjectIDFromTimestamp(createdAt.Add(time.Duration(i) * time.Hour))
+		_, err := store.col().InsertOne(ctx, bson.M{
+			"_id":   ids[i],
+			"name":  fmt.Sprintf("John %d", i),
+			"email": fmt.Sprintf("john%d@example.com", i),
+			"role":  string(model.Regular),
+		})
+		a.Nil(err)
+	}
+
+	a.Nil(store.migrateCreatedAt())
+	a.Nil(store.migrateCreatedAt(), "migrated users are kept")
 
-	// should return ErrNotFound for not existing user
-	err = store.Delete(context.Background(), "abcde")
-	a.ErrorIs(err, ErrNotFound)
+	count, err := store.col().CountDocuments(ctx, bson.M{"created_at": bson.M{"$exists": false}})
+	a.Nil(err)
+	a.Zero(count)
+
+	// the migrated users are paginated in the order of their creation, none is skipped or repeated
+	query := model.UserQuery{Limit: 1}
+	for i, id := range ids {
+		page, err := store.List(ctx, query)
+		if !a.Nil(err) || !a.Len(page.Users, 1) {
+			return
+		}
+		a.Equal(id.Hex(), page.Users[0].ID)
+		a.Equal(createdAt.Add(time.Duration(i)*time.Hour), page.Users[0].CreatedAt)
+		query.Cursor = page.NextCursor
+	}
+	a.Empty(query.Cursor)
 }
 
 type mongoContainer struct {
@@ -166,19 +212,27 @@ func clearDB() {
 	if err != nil {
 		panic(err)
 	}
+
+	if _, err = tokenStore.clear(context.Background()); err != nil {
+		panic(err)
+	}
+
+	if _, err = resetTokenStore.clear(context.Background()); err != nil {
+		panic(err)
+	}
+
+	if _, err = apiKeyStore.clear(context.Background()); err != nil {
+		panic(err)
+	}
 }
 
+// setupMongo starts a single node replica set, transactions aren't supported by standalone servers
 func setupMongo(ctx context.Context) (*mongoContainer, error) {
-	user, pwd := "root", "secret"
-
 	req := tc.ContainerRequest{
 		Image:        "mongo:4.4.2-bionic",
 		ExposedPorts: []string{"27017/tcp"},
-		Env: map[string]string{
-			"MONGO_INITDB_ROOT_USERNAME": user,
-			"MONGO_INITDB_ROOT_PASSWORD": pwd,
-		},
-		WaitingFor: wait.ForLog("Waiting for connections"),
+		Cmd:          []string{"--replSet", "rs0", "--bind_ip_all"},
+		WaitingFor:   wait.ForLog("Waiting for connections"),
 	}
 
 	container, err := tc.GenericContainer(ctx, tc.GenericContainerRequest{
@@ -190,6 +244,13 @@ func setupMongo(ctx context.Context) (*mongoContainer, error) {
 		return nil, err
 	}
 
+	if err = initiateReplicaSet(ctx, container); err != nil {
+		if err := container.Terminate(ctx); err != nil {
+			panic(err)
+		}
+		return nil, err
+	}
+
 	mappedPort, err := container.MappedPort(ctx, "27017")
 	if err != nil {
 		if err = container.Terminate(ctx); err != nil {
@@ -206,20 +267,39 @@ func setupMongo(ctx context.Context) (*mongoContainer, error) {
 		return nil, fmt.Errorf("failed to determine host: %w", err)
 	}
 
-	uri := fmt.Sprintf("mongodb://%s:%s@%s:%s", user, pwd, host, mappedPort.Port())
+	// the replica set member is only reachable by its container internal address
+	uri := fmt.Sprintf("mongodb://%s:%s/?directConnection=true", host, mappedPort.Port())
 	return &mongoContainer{Container: container, URI: uri}, nil
 }
 
+// initiateReplicaSet initiates the replica set and waits until the node has become primary
+func initiateReplicaSet(ctx context.Context, container tc.Container) error {
+	code, err := container.Exec(ctx, []string{"mongo", "--quiet", "--eval", "rs.initiate()"})
+	if err != nil || code != 0 {
+		return fmt.Errorf("failed to initiate the replica set: exit code %d: %v", code, err)
+	}
+
+	for i := 0; i < 60; i++ {
+		code, err = container.Exec(ctx, []string{"mongo", "--quiet", "--eval", "quit(db.isMaster().ismaster ? 0 : 1)"})
+		if err == nil && code == 0 {
+			return nil
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+
+	return fmt.Errorf("replica set member didn't become primary")
+}
+
 var fixtures = struct {
 	users struct {
-		undefined, admin, reporter, withoutRole *model.User
+		regular, admin, reporter, withoutRole *model.User
 	}
 }{
-	users: struct{ undefined, admin, reporter, withoutRole *model.User }{
-		undefined: &model.User{
+	users: struct{ regular, admin, reporter, withoutRole *model.User }{
+		regular: &model.User{
 			Name:  "John Doe",
 			EMail: "john.doe@example.com",
-			Role:  model.Undefined,
+			Role:  model.Regular,
 		},
 		admin: &model.User{
 			Name:  "Mary Doe",
@@ -240,7 +320,7 @@ var fixtures = struct {
 
 // fixturesAllUsers contains all users from the fixture
 var fixturesAllUsers = []*model.User{
-	fixtures.users.undefined,
+	fixtures.users.regular,
 	fixtures.users.admin,
 	fixtures.users.reporter,
 	fixtures.users.withoutRole,
@@ -0,0 +1,94 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	// registers the postgres driver
+	_ "github.com/lib/pq"
+	tc "github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+// postgresDB is shared by the postgres backed stores, unlike the sqlite ones
+// it's used by many connections concurrently like in production
+var postgresDB *sql.DB
+
+type postgresContainer struct {
+	tc.Container
+	URL string
+}
+
+// setupPostgres starts the postgres version of the docker-compose file
+func setupPostgres(ctx context.Context) (*postgresContainer, error) {
+	req := tc.ContainerRequest{
+		Image:        "postgres:14-alpine",
+		ExposedPorts: []string{"5432/tcp"},
+		Env: map[string]string{
+			"POSTGRES_USER":     "root",
+			"POSTGRES_PASSWORD": "secret",
+			"POSTGRES_DB":       "users",
+		},
+		// the server is restarted once the init scripts have run
+		WaitingFor: wait.ForLog("database system is ready to accept connections").WithOccurrence(2),
+	}
+
+	container, err := tc.GenericContainer(ctx, tc.GenericContainerRequest{
+		ContainerRequest: req,
+		Started:          true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	mappedPort, err := container.MappedPort(ctx, "5432")
+	if err != nil {
+		if err = container.Terminate(ctx); err != nil {
+			panic(err)
+		}
+		return nil, fmt.Errorf("failed to determine mapped port: %w", err)
+	}
+
+	host, err := container.Host(ctx)
+	if err != nil {
+		if err = container.Terminate(ctx); err != nil {
+			panic(err)
+		}
+		return nil, fmt.Errorf("failed to determine host: %w", err)
+	}
+
+	url := fmt.Sprintf("postgres://root:secret@%s:%s/users?sslmode=disable", host, mappedPort.Port())
+	return &postgresContainer{Container: container, URL: url}, nil
+}
+
+// connectPostgres opens the database of the container and applies the schema migrations
+func connectPostgres(url string) (*sql.DB, error) {
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err = db.PingContext(ctx); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	if err = (&sqlUserStore{db}).migrate(); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// clearPostgres removes all users, tokens and api keys, the locks are kept
+func clearPostgres() {
+	_, err := postgresDB.Exec(`TRUNCATE users, refresh_tokens, password_reset_tokens, api_keys CASCADE`)
+	if err != nil {
+		panic(err)
+	}
+}
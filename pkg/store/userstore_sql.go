@@ -0,0 +1,580 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/status-owl/user-service/pkg/model"
+)
+
+// sqlUserStore implements UserStore on top of database/sql,
+// the queries are written in the postgres dialect which is understood by sqlite as well
+type sqlUserStore struct {
+	db *sql.DB
+}
+
+// migrations contains the versioned schema migrations,
+// every file is named <version>_<description>.sql
+//
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+var (
+	ErrMigration = errors.New("failed to migrate the database schema")
+)
+
+type migration struct {
+	version int
+	name    string
+}
+
+// listMigrations returns all embedded migrations ordered by their version
+func listMigrations() ([]migration, error) {
+	entries, err := fs.ReadDir(migrations, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	var result []migration
+	for _, e := range entries {
+		prefix := strings.SplitN(e.Name(), "_", 2)[0]
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("migration %q has no valid version: %w", e.Name(), err)
+		}
+		result = append(result, migration{version: version, name: e.Name()})
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].version < result[j].version })
+	return result, nil
+}
+
+// migrate applies all migrations which haven't been applied yet,
+// every migration runs in its own transaction
+func (s *sqlUserStore) migrate() error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	if _, err := s.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		applied_at TIMESTAMP NOT NULL
+	)`); err != nil {
+		return fmt.Errorf("%w: %s", ErrMigration, err.Error())
+	}
+
+	all, err := listMigrations()
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrMigration, err.Error())
+	}
+
+	for _, m := range all {
+		if err := s.applyMigration(ctx, m); err != nil {
+			return fmt.Errorf("%w: %s: %s", ErrMigration, m.name, err.Error())
+		}
+	}
+
+	return nil
+}
+
+func (s *sqlUserStore) applyMigration(ctx context.Context, m migration) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var applied int
+	if err = tx.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM schema_migrations WHERE version = $1`, m.version,
+	).Scan(&applied); err != nil {
+		return err
+	}
+
+	if applied > 0 {
+		return nil
+	}
+
+	script, err := migrations.ReadFile("migrations/" + m.name)
+	if err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, string(script)); err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx,
+		`INSERT INTO schema_migrations (version, applied_at) VALUES ($1, $2)`, m.version, time.Now().UTC(),
+	); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// clear removes all users from the table
+func (s *sqlUserStore) clear(ctx context.Context) (int64, error) {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM users`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to clear table users: %w", err)
+	}
+
+	return result.RowsAffected()
+}
+
+// isUniqueViolation reports whether given error was caused by a violated unique constraint
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "23505"
+	}
+
+	// sqlite drivers expose the extended result code
+	var sqliteErr interface{ Code() int }
+	if errors.As(err, &sqliteErr) {
+		// SQLITE_CONSTRAINT_UNIQUE or SQLITE_CONSTRAINT_PRIMARYKEY
+		return sqliteErr.Code() == 2067 || sqliteErr.Code() == 1555
+	}
+
+	return false
+}
+
+func (s *sqlUserStore) Create(ctx context.Context, user *model.User) (string, error) {
+	return insertUser(ctx, s.db, user)
+}
+
+// execer is implemented by sql.DB and sql.Tx
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// insertUser inserts given user and returns the generated id
+func insertUser(ctx context.Context, db execer, user *model.User) (string, error) {
+	// ids look like the ones generated by mongodb,
+	// so the backends are interchangeable
+	id := primitive.NewObjectID().Hex()
+
+	_, err := db.ExecContext(ctx,
+		`INSERT INTO users (id, name, email, role, version, created_at, password_hash, email_verified, status)
+		VALUES ($1, $2, $3, $4, 1, $5, $6, $7, $8)`,
+		id, user.Name, user.EMail, string(storedRole(string(user.Role))), toMillis(now()), user.PasswordHash,
+		user.EMailVerified, string(model.StatusFromString(string(user.Status))),
+	)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return "", ErrDuplicateEMail
+		}
+		return "", fmt.Errorf("failed to insert user: %w", err)
+	}
+
+	return id, nil
+}
+
+// withAdminsLock runs fn in a transaction holding the lock row of the admins,
+// so concurrent transactions changing admins are serialized
+func (s *sqlUserStore) withAdminsLock(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// the row stays locked until the transaction ends
+	if _, err = tx.ExecContext(ctx, `UPDATE locks SET version = version + 1 WHERE name = 'admins'`); err != nil {
+		return fmt.Errorf("failed to lock admins: %w", err)
+	}
+
+	if err = fn(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// countAdmins returns the count of admins seen by given transaction
+func countAdmins(ctx context.Context, tx *sql.Tx) (int64, error) {
+	var count int64
+	err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM users WHERE role = $1`, string(model.Admin)).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count admins: %w", err)
+	}
+
+	return count, nil
+}
+
+func (s *sqlUserStore) CreateFirstAdmin(ctx context.Context, user *model.User) (string, error) {
+	admin := *user
+	admin.Role = model.Admin
+
+	var id string
+	err := s.withAdminsLock(ctx, func(tx *sql.Tx) error {
+		count, err := countAdmins(ctx, tx)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrAdminExists
+		}
+
+		id, err = insertUser(ctx, tx, &admin)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+// userColumns are the columns scanned by scanUser
+const userColumns = `id, name, email, role, version, created_at, password_hash, email_verified, status,
+	failed_logins, locked_until, totp_secret, mfa_enabled, totp_last_step, recovery_codes`
+
+// scanUser reads a user from a row containing userColumns
+func scanUser(row interface{ Scan(...interface{}) error }) (*model.User, error) {
+	var (
+		u             model.User
+		role          string
+		status        string
+		createdAt     int64
+		lockedUntil   int64
+		recoveryCodes string
+	)
+
+	if err := row.Scan(&u.ID, &u.Name, &u.EMail, &role, &u.Version, &createdAt, &u.PasswordHash, &u.EMailVerified,
+		&status, &u.FailedLogins, &lockedUntil, &u.TOTPSecret, &u.MFAEnabled, &u.TOTPLastStep, &recoveryCodes); err != nil {
+		return nil, err
+	}
+
+	u.Role = storedRole(role)
+	u.Status = model.StatusFromString(status)
+	u.CreatedAt = time.UnixMilli(createdAt).UTC()
+	if lockedUntil > 0 {
+		u.LockedUntil = time.UnixMilli(lockedUntil).UTC()
+	}
+	if recoveryCodes != "" {
+		u.RecoveryCodes = strings.Fields(recoveryCodes)
+	}
+	return &u, nil
+}
+
+// findOne returns the first user matching given condition
+func (s *sqlUserStore) findOne(ctx context.Context, where string, args ...interface{}) (*model.User, error) {
+	u, err := scanUser(s.db.QueryRowContext(ctx,
+		`SELECT `+userColumns+` FROM users WHERE `+where, args...,
+	))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return u, nil
+}
+
+func (s *sqlUserStore) FindByID(ctx context.Context, id string) (*model.User, error) {
+	u, err := s.findOne(ctx, `id = $1`, id)
+	if err != nil && err != ErrNotFound {
+		return nil, fmt.Errorf("failed to find user by id: %w", err)
+	}
+
+	return u, err
+}
+
+func (s *sqlUserStore) FindByEMail(ctx context.Context, email string) (*model.User, error) {
+	u, err := s.findOne(ctx, `email = $1`, email)
+	if err != nil && err != ErrNotFound {
+		return nil, fmt.Errorf("failed to find user by email: %w", err)
+	}
+
+	return u, err
+}
+
+func (s *sqlUserStore) HasUsersWithRole(ctx context.Context, role model.Role) (bool, error) {
+	var exist bool
+	err := s.db.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM users WHERE role = $1)`, string(role),
+	).Scan(&exist)
+	if err != nil {
+		return false, fmt.Errorf("failed to determine users with role %q: %w", role, err)
+	}
+
+	return exist, nil
+}
+
+// sqlSortColumns maps the sort fields to their columns
+var sqlSortColumns = map[model.SortField]string{
+	model.SortByCreatedAt: "created_at",
+	model.SortByName:      "name",
+	model.SortByEMail:     "email",
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern using \ as escape character
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+func (s *sqlUserStore) List(ctx context.Context, query model.UserQuery) (*model.UserPage, error) {
+	after, err := decodeCursor(query)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		conditions = []string{"1 = 1"}
+		args       []interface{}
+	)
+
+	// arg adds a query argument and returns its placeholder
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	f := query.Filter
+	if f.Role != "" {
+		conditions = append(conditions, "role = "+arg(string(f.Role)))
+	}
+	if f.Status != "" {
+		conditions = append(conditions, "status = "+arg(string(f.Status)))
+	}
+	if f.EMailPrefix != "" {
+		conditions = append(conditions,
+			`LOWER(email) LIKE `+arg(escapeLike(strings.ToLower(f.EMailPrefix))+"%")+` ESCAPE '\'`)
+	}
+	if f.NameContains != "" {
+		conditions = append(conditions,
+			`LOWER(name) LIKE `+arg("%"+escapeLike(strings.ToLower(f.NameContains))+"%")+` ESCAPE '\'`)
+	}
+	if !f.CreatedBefore.IsZero() {
+		conditions = append(conditions, "created_at < "+arg(toMillis(f.CreatedBefore)))
+	}
+	if !f.CreatedAfter.IsZero() {
+		conditions = append(conditions, "created_at > "+arg(toMillis(f.CreatedAfter)))
+	}
+
+	column, direction, op := sqlSortColumns[sortField(query)], "ASC", ">"
+	if query.Descending {
+		direction, op = "DESC", "<"
+	}
+
+	if after != nil {
+		var value interface{} = after.Value
+		if after.SortBy == model.SortByCreatedAt {
+			value, _ = strconv.ParseInt(after.Value, 10, 64)
+		}
+
+		v := arg(value)
+		conditions = append(conditions, fmt.Sprintf(
+			"(%s %s %s OR (%s = %s AND id %s %s))", column, op, v, column, v, op, arg(after.ID),
+		))
+	}
+
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(
+		`SELECT `+userColumns+` FROM users WHERE %s ORDER BY %s %s, id %s LIMIT %s`,
+		strings.Join(conditions, " AND "), column, direction, direction, arg(query.Limit+1),
+	), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var users []*model.User
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list users: %w", err)
+		}
+		users = append(users, u)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+
+	return newPage(users, query), nil
+}
+
+func (s *sqlUserStore) Update(ctx context.Context, user *model.User) error {
+	// demoting admins is guarded by the admins lock, see updateAdmin
+	count, err := updateUser(ctx, s.db, user, storedRole(string(user.Role)) != model.Admin)
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		// either the user doesn't exist, it has another version or it's an admin
+		current, err := s.findOne(ctx, `id = $1`, user.ID)
+		if err != nil {
+			return err
+		}
+		if current.Version != user.Version {
+			return ErrVersionConflict
+		}
+		return s.updateAdmin(ctx, user)
+	}
+
+	user.Version++
+	return nil
+}
+
+// updateUser updates given user if its stored version equals user.Version and returns the count of updated rows,
+// admins are skipped if skipAdmins is set
+func updateUser(ctx context.Context, db execer, user *model.User, skipAdmins bool) (int64, error) {
+	query := `UPDATE users SET name = $2, email = $3, role = $4, password_hash = $6, email_verified = $7, status = $8,
+		totp_secret = $9, mfa_enabled = $10, totp_last_step = $11, recovery_codes = $12,
+		version = version + 1 WHERE id = $1 AND version = $5`
+	args := []interface{}{
+		user.ID, user.Name, user.EMail, string(storedRole(string(user.Role))), user.Version, user.PasswordHash,
+		user.EMailVerified, string(model.StatusFromString(string(user.Status))),
+		// recovery codes are hex encoded hashes, so they can't contain spaces
+		user.TOTPSecret, user.MFAEnabled, user.TOTPLastStep, strings.Join(user.RecoveryCodes, " "),
+	}
+	if skipAdmins {
+		query += ` AND role <> $13`
+		args = append(args, string(model.Admin))
+	}
+
+	result, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return 0, ErrDuplicateEMail
+		}
+		return 0, fmt.Errorf("failed to update user %q: %w", user.ID, err)
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to update user %q: %w", user.ID, err)
+	}
+
+	return count, nil
+}
+
+// updateAdmin updates given user while holding the admins lock,
+// the update is rolled back if no admin is left afterwards
+func (s *sqlUserStore) updateAdmin(ctx context.Context, user *model.User) error {
+	err := s.withAdminsLock(ctx, func(tx *sql.Tx) error {
+		count, err := updateUser(ctx, tx, user, false)
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrVersionConflict
+		}
+
+		return ensureAdminsLeft(ctx, tx)
+	})
+	if err != nil {
+		return err
+	}
+
+	user.Version++
+	return nil
+}
+
+// ensureAdminsLeft returns ErrLastAdmin if given transaction has removed all admins
+func ensureAdminsLeft(ctx context.Context, tx *sql.Tx) error {
+	count, err := countAdmins(ctx, tx)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrLastAdmin
+	}
+
+	return nil
+}
+
+func (s *sqlUserStore) AddFailedLogin(ctx context.Context, id string) (int, error) {
+	var failures int
+	err := s.db.QueryRowContext(ctx,
+		`UPDATE users SET failed_logins = failed_logins + 1 WHERE id = $1 RETURNING failed_logins`, id,
+	).Scan(&failures)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrNotFound
+		}
+		return 0, fmt.Errorf("failed to count failed login of user %q: %w", id, err)
+	}
+
+	return failures, nil
+}
+
+func (s *sqlUserStore) LockOutUntil(ctx context.Context, id string, until time.Time) error {
+	return s.updateLogins(ctx, `UPDATE users SET locked_until = $2 WHERE id = $1`, id, toMillis(until))
+}
+
+func (s *sqlUserStore) ResetFailedLogins(ctx context.Context, id string) error {
+	return s.updateLogins(ctx, `UPDATE users SET failed_logins = 0, locked_until = 0 WHERE id = $1`, id)
+}
+
+// updateLogins runs given statement updating the login bookkeeping of the user with given id,
+// the version isn't incremented
+func (s *sqlUserStore) updateLogins(ctx context.Context, query, id string, args ...interface{}) error {
+	result, err := s.db.ExecContext(ctx, query, append([]interface{}{id}, args...)...)
+	if err != nil {
+		return fmt.Errorf("failed to update user %q: %w", id, err)
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to update user %q: %w", id, err)
+	}
+	if count == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *sqlUserStore) Delete(ctx context.Context, id string) error {
+	// removing admins is guarded by the admins lock
+	result, err := s.db.ExecContext(ctx, `DELETE FROM users WHERE id = $1 AND role <> $2`, id, string(model.Admin))
+	if err != nil {
+		return fmt.Errorf("failed to delete user %q: %w", id, err)
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to delete user %q: %w", id, err)
+	}
+
+	if count > 0 {
+		return nil
+	}
+
+	// either the user doesn't exist or it's an admin
+	if _, err = s.findOne(ctx, `id = $1`, id); err != nil {
+		return err
+	}
+
+	return s.withAdminsLock(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, `DELETE FROM users WHERE id = $1`, id)
+		if err != nil {
+			return fmt.Errorf("failed to delete user %q: %w", id, err)
+		}
+
+		count, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to delete user %q: %w", id, err)
+		}
+		if count == 0 {
+			return ErrNotFound
+		}
+
+		return ensureAdminsLeft(ctx, tx)
+	})
+}
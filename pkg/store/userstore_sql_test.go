@@ -0,0 +1,97 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	_ "modernc.org/sqlite"
+
+	"github.com/status-owl/user-service/pkg/model"
+)
+
+func newSQLiteUserStore(t *testing.T) *sqlUserStore {
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open sqlite database: %s", err.Error())
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = db.Close() })
+
+	return &sqlUserStore{db}
+}
+
+func TestListMigrations(t *testing.T) {
+	a := assert.New(t)
+
+	all, err := listMigrations()
+	a.Nil(err)
+	a.NotEmpty(all)
+
+	for i, m := range all {
+		a.Equal(i+1, m.version, "migration versions are expected to be consecutive")
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	a := assert.New(t)
+	s := newSQLiteUserStore(t)
+
+	a.Nil(s.migrate())
+	// applying the migrations again is a no-op
+	a.Nil(s.migrate())
+
+	all, err := listMigrations()
+	a.Nil(err)
+
+	var count int
+	err = s.db.QueryRow(`SELECT COUNT(*) FROM schema_migrations`).Scan(&count)
+	a.Nil(err)
+	a.Equal(len(all), count)
+}
+
+func TestSQLClear(t *testing.T) {
+	a := assert.New(t)
+	s := newSQLiteUserStore(t)
+	a.Nil(s.migrate())
+
+	for _, u := range fixturesAllUsers {
+		_, err := s.Create(context.Background(), u)
+		a.Nil(err)
+	}
+
+	count, err := s.clear(context.Background())
+	a.Nil(err)
+	a.Equal(int64(len(fixturesAllUsers)), count)
+
+	for _, u := range fixturesAllUsers {
+		_, err := s.FindByEMail(context.Background(), u.EMail)
+		a.ErrorIs(err, ErrNotFound)
+	}
+}
+
+func TestSQLMigrateRoles(t *testing.T) {
+	a := assert.New(t)
+	s := newSQLiteUserStore(t)
+	a.Nil(s.migrate())
+
+	ctx := context.Background()
+	id, err := s.Create(ctx, fixtures.users.reporter)
+	a.Nil(err)
+	_, err = s.db.Exec(`INSERT INTO users (id, name, email, role, version, created_at) VALUES ('1', 'John', 'john@example.com', 'UNDEFINED', 1, 0)`)
+	a.Nil(err)
+
+	// run the role migration again as if the user had been stored before
+	_, err = s.db.Exec(`DELETE FROM schema_migrations WHERE version = 13`)
+	a.Nil(err)
+	a.Nil(s.migrate())
+
+	var role string
+	a.Nil(s.db.QueryRow(`SELECT role FROM users WHERE id = '1'`).Scan(&role))
+	a.Equal("REGULAR", role)
+
+	reporter, err := s.FindByID(ctx, id)
+	a.Nil(err)
+	a.Equal(model.Reporter, reporter.Role, "known roles are kept")
+}
@@ -0,0 +1,82 @@
+package store_test
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog"
+	bolt "go.etcd.io/bbolt"
+	_ "modernc.org/sqlite"
+
+	"github.com/status-owl/user-service/pkg/store"
+	"github.com/status-owl/user-service/pkg/store/storetest"
+)
+
+// openSQLite opens an in-memory sqlite database, which is closed once the test is done
+func openSQLite(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open sqlite database: %s", err.Error())
+	}
+	// every connection to :memory: opens its own database
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = db.Close() })
+
+	return db
+}
+
+// openBolt opens a bolt database in the temporary directory of the test, it's closed once the test is done
+func openBolt(t *testing.T) *bolt.DB {
+	t.Helper()
+
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "users.db"), 0600, nil)
+	if err != nil {
+		t.Fatalf("failed to open bolt database: %s", err.Error())
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	return db
+}
+
+func TestMongoUserStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.UserStore {
+		return store.NewMongoTestStores(t).Users
+	})
+}
+
+func TestPostgresUserStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.UserStore {
+		return store.NewPostgresTestStores(t).Users
+	})
+}
+
+func TestMemoryUserStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.UserStore {
+		return store.NewMemoryUserStore(zerolog.Nop())
+	})
+}
+
+func TestSQLUserStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.UserStore {
+		s, err := store.NewSQLUserStore(openSQLite(t), zerolog.Nop())
+		if err != nil {
+			t.Fatalf("failed to create the sql user store: %s", err.Error())
+		}
+
+		return s
+	})
+}
+
+func TestBoltUserStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.UserStore {
+		s, err := store.NewBoltUserStore(openBolt(t), zerolog.Nop())
+		if err != nil {
+			t.Fatalf("failed to create the bolt user store: %s", err.Error())
+		}
+
+		return s
+	})
+}
@@ -0,0 +1,106 @@
+// Package totp implements the time-based one-time passwords of RFC 6238
+// as understood by the common authenticator apps: HMAC-SHA1, 6 digits and 30 second steps.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// Digits is the length of the codes
+	Digits = 6
+	// Period is the duration of a time step, every step has its own code
+	Period = 30 * time.Second
+	// secretSize is the size of generated secrets in bytes, RFC 4226 recommends 160 bits
+	secretSize = 20
+)
+
+var (
+	// ErrInvalidSecret signals that a secret isn't base32 encoded
+	ErrInvalidSecret = errors.New("invalid totp secret")
+
+	// encoding is used for the secrets, authenticator apps expect them unpadded
+	encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+)
+
+// GenerateSecret returns a new random base32 encoded secret
+func GenerateSecret() (string, error) {
+	secret := make([]byte, secretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("failed to generate totp secret: %w", err)
+	}
+
+	return encoding.EncodeToString(secret), nil
+}
+
+// Step returns the time step given time belongs to
+func Step(at time.Time) int64 {
+	return at.Unix() / int64(Period/time.Second)
+}
+
+// Code returns the code of given base32 encoded secret for given time step
+func Code(secret string, step int64) (string, error) {
+	key, err := encoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", ErrInvalidSecret
+	}
+
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	// dynamic truncation of RFC 4226
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%0*d", Digits, value%1000000), nil
+}
+
+// Validate checks code against the steps around given time, skew steps before and after are accepted
+// to make up for clocks running apart. It returns the matching step, callers have to reject steps
+// which have been used before, so a code can't be replayed.
+func Validate(secret, code string, at time.Time, skew int) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != Digits {
+		return 0, false
+	}
+
+	current := Step(at)
+	for i := -skew; i <= skew; i++ {
+		expected, err := Code(secret, current+int64(i))
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return current + int64(i), true
+		}
+	}
+
+	return 0, false
+}
+
+// ProvisioningURI returns the otpauth URI authenticator apps are provisioned with, usually shown as QR code
+func ProvisioningURI(secret, issuer, account string) string {
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(Digits))
+	params.Set("period", fmt.Sprint(int(Period/time.Second)))
+
+	label := url.PathEscape(issuer) + ":" + url.PathEscape(account)
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
@@ -0,0 +1,89 @@
+package totp
+
+import (
+	"encoding/base32"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// rfcSecret is the SHA1 secret of the test vectors in appendix B of RFC 6238
+var rfcSecret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestCode(t *testing.T) {
+	// the RFC lists 8 digit codes, these are their last 6 digits
+	tests := []struct {
+		at   int64
+		want string
+	}{
+		{at: 59, want: "287082"},
+		{at: 1111111109, want: "081804"},
+		{at: 1111111111, want: "050471"},
+		{at: 1234567890, want: "005924"},
+		{at: 2000000000, want: "279037"},
+		{at: 20000000000, want: "353130"},
+	}
+
+	for _, tt := range tests {
+		code, err := Code(rfcSecret, Step(time.Unix(tt.at, 0)))
+		assert.Nil(t, err)
+		assert.Equal(t, tt.want, code, "code at %d", tt.at)
+	}
+
+	_, err := Code("not base32!", 1)
+	assert.ErrorIs(t, err, ErrInvalidSecret)
+}
+
+func TestValidate(t *testing.T) {
+	a := assert.New(t)
+	at := time.Unix(1111111109, 0)
+
+	step, ok := Validate(rfcSecret, "081804", at, 1)
+	a.True(ok)
+	a.Equal(Step(at), step)
+
+	// the code of the previous step is accepted within the skew
+	step, ok = Validate(rfcSecret, "081804", at.Add(Period), 1)
+	a.True(ok)
+	a.Equal(Step(at), step)
+
+	_, ok = Validate(rfcSecret, "081804", at.Add(2*Period), 1)
+	a.False(ok)
+	_, ok = Validate(rfcSecret, "081804", at.Add(Period), 0)
+	a.False(ok)
+	_, ok = Validate(rfcSecret, "000000", at, 1)
+	a.False(ok)
+	_, ok = Validate(rfcSecret, "81804", at, 1)
+	a.False(ok)
+}
+
+func TestGenerateSecret(t *testing.T) {
+	a := assert.New(t)
+
+	secret, err := GenerateSecret()
+	a.Nil(err)
+	a.Len(secret, 32, "160 bits are 32 base32 characters")
+
+	other, err := GenerateSecret()
+	a.Nil(err)
+	a.NotEqual(secret, other)
+
+	_, err = Code(secret, 1)
+	a.Nil(err)
+}
+
+func TestProvisioningURI(t *testing.T) {
+	a := assert.New(t)
+
+	uri, err := url.Parse(ProvisioningURI("JBSWY3DPEHPK3PXP", "status owl", "john@example.com"))
+	a.Nil(err)
+	a.Equal("otpauth", uri.Scheme)
+	a.Equal("totp", uri.Host)
+	a.Equal("/status owl:john@example.com", uri.Path)
+	a.Equal("JBSWY3DPEHPK3PXP", uri.Query().Get("secret"))
+	a.Equal("status owl", uri.Query().Get("issuer"))
+	a.Equal("6", uri.Query().Get("digits"))
+	a.Equal("30", uri.Query().Get("period"))
+}
@@ -0,0 +1,128 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/status-owl/user-service/pkg/auth"
+	"github.com/status-owl/user-service/pkg/service"
+)
+
+// TokenVerifier verifies access tokens and returns their claims
+type TokenVerifier interface {
+	Verify(token string) (*auth.Claims, error)
+}
+
+// APIKeyAuthenticator returns the callers personal API keys have been issued to
+type APIKeyAuthenticator interface {
+	AuthenticateAPIKey(ctx context.Context, key string) (*auth.Principal, error)
+}
+
+// isAPIKey reports whether a bearer token is a personal API key instead of an access token
+func isAPIKey(token string) bool {
+	return strings.HasPrefix(token, service.APIKeyPrefix)
+}
+
+// bearerToken extracts the token of an Authorization header using the Bearer scheme
+func bearerToken(header string) (string, bool) {
+	const scheme = "bearer "
+	if len(header) <= len(scheme) || !strings.EqualFold(header[:len(scheme)], scheme) {
+		return "", false
+	}
+
+	token := strings.TrimSpace(header[len(scheme):])
+	return token, token != ""
+}
+
+// AuthMiddleware authenticates the caller of a http request by the access token or the API key
+// of the Authorization header, the caller is added to the request context.
+// Requests without a token are passed on anonymously, the service decides if that's sufficient.
+func AuthMiddleware(verifier TokenVerifier, keys APIKeyAuthenticator, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		if header == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token, ok := bearerToken(header)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_request"`)
+			handleError(w, &Problem{
+				Status: http.StatusUnauthorized,
+				Title:  http.StatusText(http.StatusUnauthorized),
+				Detail: "the Authorization header must use the Bearer scheme",
+			})
+			return
+		}
+
+		if isAPIKey(token) {
+			principal, err := keys.AuthenticateAPIKey(r.Context(), token)
+			if err != nil {
+				if errors.Is(err, service.ErrInvalidAPIKey) {
+					w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				}
+				handleError(w, err2Problem(err))
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(auth.NewContext(r.Context(), principal)))
+			return
+		}
+
+		claims, err := verifier.Verify(token)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			handleError(w, &Problem{
+				Status: http.StatusUnauthorized,
+				Title:  http.StatusText(http.StatusUnauthorized),
+				Detail: "invalid access token",
+			})
+			return
+		}
+
+		ctx := auth.NewContext(r.Context(), auth.PrincipalFromClaims(claims))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// AuthUnaryInterceptor authenticates the caller of a rpc by the access token or the API key
+// of the authorization metadata, the caller is added to the context.
+// Calls without a token are passed on anonymously, the service decides if that's sufficient.
+func AuthUnaryInterceptor(verifier TokenVerifier, keys APIKeyAuthenticator) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		values := md.Get("authorization")
+		if len(values) == 0 {
+			return handler(ctx, req)
+		}
+
+		token, ok := bearerToken(values[0])
+		if !ok {
+			return nil, status.Error(codes.Unauthenticated, "the authorization metadata must use the Bearer scheme")
+		}
+
+		if isAPIKey(token) {
+			principal, err := keys.AuthenticateAPIKey(ctx, token)
+			if err != nil {
+				return nil, err2GrpcStatus(err).Err()
+			}
+
+			return handler(auth.NewContext(ctx, principal), req)
+		}
+
+		claims, err := verifier.Verify(token)
+		if err != nil {
+			return nil, status.Error(codes.Unauthenticated, "invalid access token")
+		}
+
+		return handler(auth.NewContext(ctx, auth.PrincipalFromClaims(claims)), req)
+	}
+}
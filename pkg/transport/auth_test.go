@@ -0,0 +1,204 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/status-owl/user-service/pkg/auth"
+	"github.com/status-owl/user-service/pkg/model"
+	"github.com/status-owl/user-service/pkg/service"
+)
+
+// staticVerifier accepts the token "valid" only
+type staticVerifier struct{}
+
+func (staticVerifier) Verify(token string) (*auth.Claims, error) {
+	if token != "valid" {
+		return nil, auth.ErrInvalidToken
+	}
+	return &auth.Claims{Role: model.Admin, RegisteredClaims: jwt.RegisteredClaims{Subject: "123"}}, nil
+}
+
+// staticAPIKeys accepts the key "sowl_valid" only, "sowl_suspended" belongs to a suspended user
+type staticAPIKeys struct{}
+
+func (staticAPIKeys) AuthenticateAPIKey(_ context.Context, key string) (*auth.Principal, error) {
+	switch key {
+	case "sowl_valid":
+		return apiKeyPrincipal, nil
+	case "sowl_suspended":
+		return nil, service.ErrUserSuspended
+	default:
+		return nil, service.ErrInvalidAPIKey
+	}
+}
+
+var apiKeyPrincipal = &auth.Principal{
+	UserID:   "456",
+	Role:     model.Reporter,
+	APIKeyID: "k1",
+	Scopes:   []model.Scope{model.ScopeUsersRead},
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	tests := []struct {
+		name          string
+		authorization string
+		// want
+		code          int
+		wantPrincipal *auth.Principal
+		response      *Problem
+	}{
+		{
+			name: "should pass anonymous requests",
+			code: http.StatusOK,
+		},
+		{
+			name:          "should add the caller to the context",
+			authorization: "Bearer valid",
+			code:          http.StatusOK,
+			wantPrincipal: &auth.Principal{UserID: "123", Role: model.Admin},
+		},
+		{
+			name:          "should accept the scheme case insensitive",
+			authorization: "bearer valid",
+			code:          http.StatusOK,
+			wantPrincipal: &auth.Principal{UserID: "123", Role: model.Admin},
+		},
+		{
+			name:          "should respond with 401 if the token is invalid",
+			authorization: "Bearer invalid",
+			code:          http.StatusUnauthorized,
+			response: &Problem{
+				Detail: "invalid access token",
+				Status: http.StatusUnauthorized,
+				Title:  http.StatusText(http.StatusUnauthorized),
+			},
+		},
+		{
+			name:          "should add the owner of an api key to the context",
+			authorization: "Bearer sowl_valid",
+			code:          http.StatusOK,
+			wantPrincipal: apiKeyPrincipal,
+		},
+		{
+			name:          "should respond with 401 if the api key is invalid",
+			authorization: "Bearer sowl_invalid",
+			code:          http.StatusUnauthorized,
+			response: &Problem{
+				Detail: "invalid, expired or revoked api key",
+				Status: http.StatusUnauthorized,
+				Title:  http.StatusText(http.StatusUnauthorized),
+			},
+		},
+		{
+			name:          "should respond with 401 if another scheme is used",
+			authorization: "Basic am9objpzZWNyZXQ=",
+			code:          http.StatusUnauthorized,
+			response: &Problem{
+				Detail: "the Authorization header must use the Bearer scheme",
+				Status: http.StatusUnauthorized,
+				Title:  http.StatusText(http.StatusUnauthorized),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+
+			req, err := http.NewRequest(http.MethodGet, "/users/123", nil)
+			a.Nil(err)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+
+			rr := httptest.NewRecorder()
+
+			var gotPrincipal *auth.Principal
+			AuthMiddleware(staticVerifier{}, staticAPIKeys{}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotPrincipal, _ = auth.FromContext(r.Context())
+			})).ServeHTTP(rr, req)
+
+			a.Equal(tt.code, rr.Code)
+			a.Equal(tt.wantPrincipal, gotPrincipal)
+			if tt.response != nil {
+				a.NotEmpty(rr.Header().Get("WWW-Authenticate"))
+
+				var actualResponse Problem
+				a.Nil(json.NewDecoder(rr.Body).Decode(&actualResponse))
+				a.Equal(*tt.response, actualResponse)
+			}
+		})
+	}
+}
+
+func TestAuthUnaryInterceptor(t *testing.T) {
+	tests := []struct {
+		name          string
+		authorization string
+		// want
+		wantPrincipal *auth.Principal
+		wantErr       error
+	}{
+		{
+			name: "should pass anonymous calls",
+		},
+		{
+			name:          "should add the caller to the context",
+			authorization: "Bearer valid",
+			wantPrincipal: &auth.Principal{UserID: "123", Role: model.Admin},
+		},
+		{
+			name:          "should return an Unauthenticated error if the token is invalid",
+			authorization: "Bearer invalid",
+			wantErr:       status.Error(codes.Unauthenticated, "invalid access token"),
+		},
+		{
+			name:          "should add the owner of an api key to the context",
+			authorization: "Bearer sowl_valid",
+			wantPrincipal: apiKeyPrincipal,
+		},
+		{
+			name:          "should return an Unauthenticated error if the api key is invalid",
+			authorization: "Bearer sowl_invalid",
+			wantErr:       status.Error(codes.Unauthenticated, "invalid, expired or revoked api key"),
+		},
+		{
+			name:          "should refuse the api keys of suspended users",
+			authorization: "Bearer sowl_suspended",
+			wantErr:       status.Error(codes.PermissionDenied, "user has been suspended"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+
+			ctx := context.Background()
+			if tt.authorization != "" {
+				ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", tt.authorization))
+			}
+
+			var gotPrincipal *auth.Principal
+			_, err := AuthUnaryInterceptor(staticVerifier{}, staticAPIKeys{})(ctx, nil, &grpc.UnaryServerInfo{},
+				func(ctx context.Context, req interface{}) (interface{}, error) {
+					gotPrincipal, _ = auth.FromContext(ctx)
+					return nil, nil
+				})
+
+			a.Equal(tt.wantErr, err)
+			a.Equal(tt.wantPrincipal, gotPrincipal)
+		})
+	}
+}
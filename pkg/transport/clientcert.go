@@ -0,0 +1,62 @@
+package transport
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"github.com/status-owl/user-service/pkg/auth"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"net/http"
+)
+
+// leafCert returns the certificate a client presented on the handshake. The servers verify
+// client certificates on the handshake already, connections with invalid ones are refused.
+func leafCert(state *tls.ConnectionState) (*x509.Certificate, bool) {
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return nil, false
+	}
+	return state.PeerCertificates[0], true
+}
+
+// ClientCertMiddleware adds the client certificate of a http request to the request context,
+// requests without one are passed on unchanged
+func ClientCertMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cert, ok := leafCert(r.TLS); ok {
+			r = r.WithContext(auth.NewClientCertContext(r.Context(), cert))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// withClientCert returns a copy of ctx carrying the client certificate of the grpc peer
+func withClientCert(ctx context.Context) context.Context {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ctx
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		return ctx
+	}
+	if cert, ok := leafCert(&info.State); ok {
+		return auth.NewClientCertContext(ctx, cert)
+	}
+	return ctx
+}
+
+// ClientCertUnaryInterceptor adds the client certificate of the peer to the context of a call
+func ClientCertUnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		return handler(withClientCert(ctx), req)
+	}
+}
+
+// ClientCertStreamInterceptor adds the client certificate of the peer to the context of a stream
+func ClientCertStreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &wrappedStream{ServerStream: ss, ctx: withClientCert(ss.Context())})
+	}
+}
@@ -0,0 +1,69 @@
+package transport
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"github.com/status-owl/user-service/pkg/auth"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientCertMiddleware(t *testing.T) {
+	a := assert.New(t)
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "status-service"}}
+
+	var got *x509.Certificate
+	handler := ClientCertMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = auth.ClientCertFromContext(r.Context())
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/users", nil)
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	a.Equal(cert, got)
+
+	// neither plaintext requests nor TLS ones without a client certificate carry one
+	got = nil
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users", nil))
+	a.Nil(got)
+
+	req = httptest.NewRequest(http.MethodGet, "/users", nil)
+	req.TLS = &tls.ConnectionState{}
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	a.Nil(got)
+}
+
+func TestClientCertInterceptor(t *testing.T) {
+	a := assert.New(t)
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "status-service"}}
+	info := &grpc.UnaryServerInfo{FullMethod: "/pb.UserService/GetUser"}
+	interceptor := ClientCertUnaryInterceptor()
+
+	call := func(ctx context.Context) *x509.Certificate {
+		var got *x509.Certificate
+		_, err := interceptor(ctx, nil, info, func(ctx context.Context, _ interface{}) (interface{}, error) {
+			got, _ = auth.ClientCertFromContext(ctx)
+			return nil, nil
+		})
+		a.Nil(err)
+		return got
+	}
+
+	addr := &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 4242}
+	ctx := peer.NewContext(context.Background(), &peer.Peer{
+		Addr:     addr,
+		AuthInfo: credentials.TLSInfo{State: tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}},
+	})
+	a.Equal(cert, call(ctx))
+
+	a.Nil(call(peer.NewContext(context.Background(), &peer.Peer{Addr: addr})), "plaintext calls carry no certificate")
+	a.Nil(call(context.Background()))
+}
@@ -3,12 +3,17 @@ package transport
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/status-owl/user-service/pb"
+	"github.com/status-owl/user-service/pkg/auth"
 	"github.com/status-owl/user-service/pkg/model"
 	"github.com/status-owl/user-service/pkg/service"
 	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"time"
 )
 
 //go:generate protoc --go_out=../../pb --go-grpc_out=../../pb  --go_opt=paths=source_relative --go-grpc_opt=paths=source_relative  --proto_path=../../pb ../../pb/usersvc.proto
@@ -25,8 +30,9 @@ func NewBaseGrpcServer(svc service.UserService) pb.UserServiceServer {
 
 func (s grpcServer) CreateUser(ctx context.Context, req *pb.CreateUserRequest) (*pb.CreateUserReply, error) {
 	id, err := s.svc.Create(ctx, model.RequestedUser{
-		EMail: req.Email,
-		Name:  req.Name,
+		EMail:    req.Email,
+		Name:     req.Name,
+		Password: req.Password,
 	})
 
 	if err != nil {
@@ -36,6 +42,441 @@ func (s grpcServer) CreateUser(ctx context.Context, req *pb.CreateUserRequest) (
 	return &pb.CreateUserReply{Id: id}, nil
 }
 
+func (s grpcServer) GetUser(ctx context.Context, req *pb.GetUserRequest) (*pb.GetUserReply, error) {
+	user, err := s.svc.FindByID(ctx, req.Id)
+	if err != nil {
+		return nil, err2GrpcStatus(err).Err()
+	}
+
+	return &pb.GetUserReply{User: modelUser2Pb(user)}, nil
+}
+
+func (s grpcServer) GetUserByEmail(ctx context.Context, req *pb.GetUserByEmailRequest) (*pb.GetUserByEmailReply, error) {
+	user, err := s.svc.FindByEMail(ctx, req.Email)
+	if err != nil {
+		return nil, err2GrpcStatus(err).Err()
+	}
+
+	return &pb.GetUserByEmailReply{User: modelUser2Pb(user)}, nil
+}
+
+func (s grpcServer) UpdateUser(ctx context.Context, req *pb.UpdateUserRequest) (*pb.UpdateUserReply, error) {
+	if req.Role != pb.Role_UNKNOWN {
+		return nil, status.Error(codes.InvalidArgument, "role can't be changed via UpdateUser")
+	}
+
+	user, err := s.svc.Update(ctx, req.Id, model.UserUpdate{
+		EMail:   req.Email,
+		Name:    req.Name,
+		Version: req.Version,
+	})
+
+	if err != nil {
+		return nil, err2GrpcStatus(err).Err()
+	}
+
+	return &pb.UpdateUserReply{Version: user.Version, User: modelUser2Pb(user)}, nil
+}
+
+func (s grpcServer) DeleteUser(ctx context.Context, req *pb.DeleteUserRequest) (*pb.DeleteUserReply, error) {
+	if err := s.svc.Delete(ctx, req.Id); err != nil {
+		return nil, err2GrpcStatus(err).Err()
+	}
+
+	return &pb.DeleteUserReply{}, nil
+}
+
+func (s grpcServer) ListUsers(ctx context.Context, req *pb.ListUsersRequest) (*pb.ListUsersReply, error) {
+	role, err := pbRole2Model(req.Role)
+	if err != nil {
+		return nil, err2GrpcStatus(err).Err()
+	}
+	userStatus, err := pbStatus2Model(req.Status)
+	if err != nil {
+		return nil, err2GrpcStatus(err).Err()
+	}
+
+	query := model.UserQuery{
+		Filter: model.UserFilter{
+			Role:         role,
+			Status:       userStatus,
+			EMailPrefix:  req.EmailPrefix,
+			NameContains: req.NameContains,
+		},
+		Limit:  int(req.PageSize),
+		Cursor: req.PageToken,
+	}
+
+	if req.CreatedAfter != nil {
+		query.Filter.CreatedAfter = req.CreatedAfter.AsTime()
+	}
+	if req.CreatedBefore != nil {
+		query.Filter.CreatedBefore = req.CreatedBefore.AsTime()
+	}
+
+	if req.OrderBy != "" {
+		var ok bool
+		if query.SortBy, query.Descending, ok = parseSort(req.OrderBy); !ok {
+			return nil, status.Errorf(codes.InvalidArgument, "users can't be ordered by %q", req.OrderBy)
+		}
+	}
+
+	page, err := s.svc.List(ctx, query)
+	if err != nil {
+		return nil, err2GrpcStatus(err).Err()
+	}
+
+	reply := pb.ListUsersReply{NextPageToken: page.NextCursor}
+	for _, u := range page.Users {
+		reply.Users = append(reply.Users, modelUser2Pb(u))
+	}
+
+	return &reply, nil
+}
+
+func (s grpcServer) ChangePassword(ctx context.Context, req *pb.ChangePasswordRequest) (*pb.ChangePasswordReply, error) {
+	if err := s.svc.ChangePassword(ctx, req.Id, req.CurrentPassword, req.NewPassword); err != nil {
+		return nil, err2GrpcStatus(err).Err()
+	}
+
+	return &pb.ChangePasswordReply{}, nil
+}
+
+func (s grpcServer) Login(ctx context.Context, req *pb.LoginRequest) (*pb.LoginReply, error) {
+	// the failed logins are tracked per peer address
+	if p, ok := peer.FromContext(ctx); ok {
+		ctx = auth.NewClientIPContext(ctx, hostOf(p.Addr.String()))
+	}
+
+	token, err := s.svc.Login(ctx, req.Email, req.Password)
+	if err != nil {
+		return nil, err2GrpcStatus(err).Err()
+	}
+
+	return modelToken2Pb(token), nil
+}
+
+func (s grpcServer) RefreshToken(ctx context.Context, req *pb.RefreshTokenRequest) (*pb.LoginReply, error) {
+	token, err := s.svc.Refresh(ctx, req.RefreshToken)
+	if err != nil {
+		return nil, err2GrpcStatus(err).Err()
+	}
+
+	return modelToken2Pb(token), nil
+}
+
+func (s grpcServer) Logout(ctx context.Context, req *pb.LogoutRequest) (*pb.LogoutReply, error) {
+	if err := s.svc.Logout(ctx, req.RefreshToken); err != nil {
+		return nil, err2GrpcStatus(err).Err()
+	}
+
+	return &pb.LogoutReply{}, nil
+}
+
+func (s grpcServer) LogoutEverywhere(ctx context.Context, req *pb.LogoutEverywhereRequest) (*pb.LogoutEverywhereReply, error) {
+	if err := s.svc.LogoutEverywhere(ctx, req.Id); err != nil {
+		return nil, err2GrpcStatus(err).Err()
+	}
+
+	return &pb.LogoutEverywhereReply{}, nil
+}
+
+func (s grpcServer) AssignRole(ctx context.Context, req *pb.AssignRoleRequest) (*pb.AssignRoleReply, error) {
+	role, err := pbRole2Model(req.Role)
+	if err != nil {
+		return nil, err2GrpcStatus(err).Err()
+	}
+
+	user, err := s.svc.AssignRole(ctx, req.Id, role)
+	if err != nil {
+		return nil, err2GrpcStatus(err).Err()
+	}
+
+	return &pb.AssignRoleReply{User: modelUser2Pb(user)}, nil
+}
+
+func (s grpcServer) VerifyEmail(ctx context.Context, req *pb.VerifyEmailRequest) (*pb.VerifyEmailReply, error) {
+	if err := s.svc.VerifyEMail(ctx, req.Id, req.Token); err != nil {
+		return nil, err2GrpcStatus(err).Err()
+	}
+
+	return &pb.VerifyEmailReply{}, nil
+}
+
+func (s grpcServer) ResendVerificationEmail(ctx context.Context, req *pb.ResendVerificationEmailRequest) (*pb.ResendVerificationEmailReply, error) {
+	if err := s.svc.ResendVerification(ctx, req.Id); err != nil {
+		return nil, err2GrpcStatus(err).Err()
+	}
+
+	return &pb.ResendVerificationEmailReply{}, nil
+}
+
+func (s grpcServer) RequestPasswordReset(ctx context.Context, req *pb.RequestPasswordResetRequest) (*pb.RequestPasswordResetReply, error) {
+	if err := s.svc.RequestPasswordReset(ctx, req.Email); err != nil {
+		return nil, err2GrpcStatus(err).Err()
+	}
+
+	return &pb.RequestPasswordResetReply{}, nil
+}
+
+func (s grpcServer) ResetPassword(ctx context.Context, req *pb.ResetPasswordRequest) (*pb.ResetPasswordReply, error) {
+	if err := s.svc.ResetPassword(ctx, req.Token, req.NewPassword); err != nil {
+		return nil, err2GrpcStatus(err).Err()
+	}
+
+	return &pb.ResetPasswordReply{}, nil
+}
+
+func (s grpcServer) SuspendUser(ctx context.Context, req *pb.SuspendUserRequest) (*pb.SuspendUserReply, error) {
+	user, err := s.svc.Suspend(ctx, req.Id)
+	if err != nil {
+		return nil, err2GrpcStatus(err).Err()
+	}
+
+	return &pb.SuspendUserReply{User: modelUser2Pb(user)}, nil
+}
+
+func (s grpcServer) ReactivateUser(ctx context.Context, req *pb.ReactivateUserRequest) (*pb.ReactivateUserReply, error) {
+	user, err := s.svc.Reactivate(ctx, req.Id)
+	if err != nil {
+		return nil, err2GrpcStatus(err).Err()
+	}
+
+	return &pb.ReactivateUserReply{User: modelUser2Pb(user)}, nil
+}
+
+func (s grpcServer) LockUser(ctx context.Context, req *pb.LockUserRequest) (*pb.LockUserReply, error) {
+	user, err := s.svc.Lock(ctx, req.Id)
+	if err != nil {
+		return nil, err2GrpcStatus(err).Err()
+	}
+
+	return &pb.LockUserReply{User: modelUser2Pb(user)}, nil
+}
+
+func (s grpcServer) UnlockUser(ctx context.Context, req *pb.UnlockUserRequest) (*pb.UnlockUserReply, error) {
+	user, err := s.svc.Unlock(ctx, req.Id)
+	if err != nil {
+		return nil, err2GrpcStatus(err).Err()
+	}
+
+	return &pb.UnlockUserReply{User: modelUser2Pb(user)}, nil
+}
+
+func (s grpcServer) EnrollMfa(ctx context.Context, req *pb.EnrollMfaRequest) (*pb.EnrollMfaReply, error) {
+	enrollment, err := s.svc.EnrollMFA(ctx, req.Id)
+	if err != nil {
+		return nil, err2GrpcStatus(err).Err()
+	}
+
+	return &pb.EnrollMfaReply{Secret: enrollment.Secret, ProvisioningUri: enrollment.URI}, nil
+}
+
+func (s grpcServer) ConfirmMfa(ctx context.Context, req *pb.ConfirmMfaRequest) (*pb.ConfirmMfaReply, error) {
+	codes, err := s.svc.ConfirmMFA(ctx, req.Id, req.Code)
+	if err != nil {
+		return nil, err2GrpcStatus(err).Err()
+	}
+
+	return &pb.ConfirmMfaReply{RecoveryCodes: codes}, nil
+}
+
+func (s grpcServer) DisableMfa(ctx context.Context, req *pb.DisableMfaRequest) (*pb.DisableMfaReply, error) {
+	if err := s.svc.DisableMFA(ctx, req.Id, req.Code); err != nil {
+		return nil, err2GrpcStatus(err).Err()
+	}
+
+	return &pb.DisableMfaReply{}, nil
+}
+
+func (s grpcServer) VerifyMfa(ctx context.Context, req *pb.VerifyMfaRequest) (*pb.LoginReply, error) {
+	// wrong codes count as failed logins of the peer address
+	if p, ok := peer.FromContext(ctx); ok {
+		ctx = auth.NewClientIPContext(ctx, hostOf(p.Addr.String()))
+	}
+
+	token, err := s.svc.VerifyMFA(ctx, req.MfaToken, req.Code)
+	if err != nil {
+		return nil, err2GrpcStatus(err).Err()
+	}
+
+	return modelToken2Pb(token), nil
+}
+
+func (s grpcServer) CreateApiKey(ctx context.Context, req *pb.CreateApiKeyRequest) (*pb.CreateApiKeyReply, error) {
+	var scopes []model.Scope
+	for _, scope := range req.Scopes {
+		scopes = append(scopes, model.Scope(scope))
+	}
+
+	var expiresAt time.Time
+	if req.ExpiresAt != nil {
+		expiresAt = req.ExpiresAt.AsTime()
+	}
+
+	apiKey, key, err := s.svc.CreateAPIKey(ctx, req.Id, req.Name, scopes, expiresAt)
+	if err != nil {
+		return nil, err2GrpcStatus(err).Err()
+	}
+
+	return &pb.CreateApiKeyReply{ApiKey: modelAPIKey2Pb(apiKey), Key: key}, nil
+}
+
+func (s grpcServer) ListApiKeys(ctx context.Context, req *pb.ListApiKeysRequest) (*pb.ListApiKeysReply, error) {
+	keys, err := s.svc.ListAPIKeys(ctx, req.Id)
+	if err != nil {
+		return nil, err2GrpcStatus(err).Err()
+	}
+
+	reply := &pb.ListApiKeysReply{ApiKeys: make([]*pb.ApiKey, 0, len(keys))}
+	for _, k := range keys {
+		reply.ApiKeys = append(reply.ApiKeys, modelAPIKey2Pb(k))
+	}
+
+	return reply, nil
+}
+
+func (s grpcServer) RevokeApiKey(ctx context.Context, req *pb.RevokeApiKeyRequest) (*pb.RevokeApiKeyReply, error) {
+	if err := s.svc.RevokeAPIKey(ctx, req.Id, req.KeyId); err != nil {
+		return nil, err2GrpcStatus(err).Err()
+	}
+
+	return &pb.RevokeApiKeyReply{}, nil
+}
+
+// modelAPIKey2Pb maps an API key to the grpc api, the hash isn't part of it
+func modelAPIKey2Pb(k *model.APIKey) *pb.ApiKey {
+	key := &pb.ApiKey{
+		Id:        k.ID,
+		Name:      k.Name,
+		Prefix:    k.Prefix,
+		Scopes:    make([]string, 0, len(k.Scopes)),
+		CreatedAt: timestamppb.New(k.CreatedAt),
+	}
+	for _, scope := range k.Scopes {
+		key.Scopes = append(key.Scopes, string(scope))
+	}
+	if !k.ExpiresAt.IsZero() {
+		key.ExpiresAt = timestamppb.New(k.ExpiresAt)
+	}
+
+	return key
+}
+
+// modelToken2Pb maps issued tokens to the reply of a login,
+// challenges for a second factor carry the mfa token only
+func modelToken2Pb(token *model.Token) *pb.LoginReply {
+	if token.MFAToken != "" {
+		return &pb.LoginReply{MfaToken: token.MFAToken, ExpiresIn: expiresIn(token)}
+	}
+
+	return &pb.LoginReply{
+		AccessToken:  token.AccessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    expiresIn(token),
+		RefreshToken: token.RefreshToken,
+	}
+}
+
+// modelUser2Pb maps an user of the model to the one of the grpc api
+func modelUser2Pb(u *model.User) *pb.User {
+	user := &pb.User{
+		Id:            u.ID,
+		Name:          u.Name,
+		Email:         u.EMail,
+		EmailVerified: u.EMailVerified,
+		Role:          modelRole2Pb(u.Role),
+		Status:        modelStatus2Pb(u.Status),
+		Version:       u.Version,
+		CreatedAt:     timestamppb.New(u.CreatedAt),
+		FailedLogins:  int32(u.FailedLogins),
+		MfaEnabled:    u.MFAEnabled,
+	}
+	if !u.LockedUntil.IsZero() {
+		user.LockedUntil = timestamppb.New(u.LockedUntil)
+	}
+
+	return user
+}
+
+// pbRole2Model maps the roles of the grpc api to the ones of the model,
+// pb.Role_UNKNOWN is the unset value and results in an empty role.
+// Values outside of the enum are rejected with a validation error.
+func pbRole2Model(role pb.Role) (model.Role, error) {
+	switch role {
+	case pb.Role_UNKNOWN:
+		return "", nil
+	case pb.Role_ADMIN:
+		return model.Admin, nil
+	case pb.Role_REPORTER:
+		return model.Reporter, nil
+	case pb.Role_REGULAR:
+		return model.Regular, nil
+	default:
+		return "", &service.ValidationErrors{Errors: []service.ValidationError{{
+			Name:   "role",
+			Reason: fmt.Sprintf("unknown role %d", role),
+		}}}
+	}
+}
+
+// modelRole2Pb maps the roles of the model to the ones of the grpc api
+func modelRole2Pb(role model.Role) pb.Role {
+	switch role {
+	case model.Admin:
+		return pb.Role_ADMIN
+	case model.Reporter:
+		return pb.Role_REPORTER
+	case model.Regular:
+		return pb.Role_REGULAR
+	default:
+		return pb.Role_UNKNOWN
+	}
+}
+
+// pbStatus2Model maps the statuses of the grpc api to the ones of the model,
+// pb.Status_STATUS_UNKNOWN is the unset value and results in an empty status.
+// Values outside of the enum are rejected with a validation error.
+func pbStatus2Model(s pb.Status) (model.Status, error) {
+	switch s {
+	case pb.Status_STATUS_UNKNOWN:
+		return "", nil
+	case pb.Status_PENDING:
+		return model.Pending, nil
+	case pb.Status_ACTIVE:
+		return model.Active, nil
+	case pb.Status_SUSPENDED:
+		return model.Suspended, nil
+	case pb.Status_LOCKED:
+		return model.Locked, nil
+	case pb.Status_DELETED:
+		return model.Deleted, nil
+	default:
+		return "", &service.ValidationErrors{Errors: []service.ValidationError{{
+			Name:   "status",
+			Reason: fmt.Sprintf("unknown status %d", s),
+		}}}
+	}
+}
+
+// modelStatus2Pb maps the statuses of the model to the ones of the grpc api
+func modelStatus2Pb(s model.Status) pb.Status {
+	switch s {
+	case model.Pending:
+		return pb.Status_PENDING
+	case model.Active:
+		return pb.Status_ACTIVE
+	case model.Suspended:
+		return pb.Status_SUSPENDED
+	case model.Locked:
+		return pb.Status_LOCKED
+	case model.Deleted:
+		return pb.Status_DELETED
+	default:
+		return pb.Status_STATUS_UNKNOWN
+	}
+}
+
 func err2GrpcStatus(err error) *status.Status {
 
 	var stat *status.Status
@@ -51,7 +492,7 @@ func err2GrpcStatus(err error) *status.Status {
 
 		stat, err = status.New(
 			codes.InvalidArgument,
-			"couldn't create a user due to invalid arguments",
+			"couldn't process the request due to invalid arguments",
 		).WithDetails(&errdetails.BadRequest{FieldViolations: fieldViolations})
 
 		if err != nil {
@@ -61,6 +502,52 @@ func err2GrpcStatus(err error) *status.Status {
 		stat = status.New(codes.AlreadyExists, "user with this email address already exists")
 	} else if errors.Is(err, service.ErrUserNotFound) {
 		stat = status.New(codes.NotFound, "user with given id doesn't exist")
+	} else if errors.Is(err, service.ErrVersionMismatch) {
+		stat = status.New(codes.FailedPrecondition, "user has been modified since the requested version")
+	} else if errors.Is(err, service.ErrConcurrentModification) {
+		stat = status.New(codes.Aborted, "user has been modified concurrently, try again")
+	} else if errors.Is(err, service.ErrInvalidCredentials) {
+		stat = status.New(codes.Unauthenticated, "invalid credentials")
+	} else if errors.Is(err, service.ErrUnauthenticated) {
+		stat = status.New(codes.Unauthenticated, "authentication required")
+	} else if errors.Is(err, service.ErrForbidden) {
+		stat = status.New(codes.PermissionDenied, "not allowed to perform this operation")
+	} else if errors.Is(err, service.ErrInvalidVerificationToken) {
+		stat = status.New(codes.InvalidArgument, "invalid or expired verification token")
+	} else if errors.Is(err, service.ErrInvalidResetToken) {
+		stat = status.New(codes.InvalidArgument, "invalid, expired or already used password reset token")
+	} else if errors.Is(err, service.ErrEMailAlreadyVerified) {
+		stat = status.New(codes.FailedPrecondition, "email address has already been verified")
+	} else if errors.Is(err, service.ErrTooManyRequests) {
+		stat = status.New(codes.ResourceExhausted, "too many requests, try again later")
+	} else if errors.Is(err, service.ErrLastAdmin) {
+		stat = status.New(codes.FailedPrecondition, "the last admin can't be deleted or demoted")
+	} else if errors.Is(err, service.ErrAdminNotSuspendable) {
+		stat = status.New(codes.FailedPrecondition, "admins can't be suspended or locked, revoke the role first")
+	} else if terr := (*service.TransitionError)(nil); errors.As(err, &terr) {
+		stat = status.New(codes.FailedPrecondition, terr.Error())
+	} else if errors.Is(err, service.ErrUserSuspended) {
+		stat = status.New(codes.PermissionDenied, "user has been suspended")
+	} else if errors.Is(err, service.ErrUserLocked) {
+		stat = status.New(codes.PermissionDenied, "user has been locked")
+	} else if errors.Is(err, service.ErrTooManyFailedLogins) {
+		stat = status.New(codes.ResourceExhausted, "too many failed logins, try again later")
+	} else if errors.Is(err, service.ErrMFARequired) {
+		stat = status.New(codes.PermissionDenied, "admins have to enable multi-factor authentication and log in with it")
+	} else if errors.Is(err, service.ErrMFAAlreadyEnabled) {
+		stat = status.New(codes.FailedPrecondition, "multi-factor authentication has already been enabled")
+	} else if errors.Is(err, service.ErrMFANotEnrolled) {
+		stat = status.New(codes.FailedPrecondition, "no authenticator has been enrolled")
+	} else if errors.Is(err, service.ErrInvalidMFACode) {
+		stat = status.New(codes.InvalidArgument, "invalid code")
+	} else if errors.Is(err, service.ErrInvalidMFAToken) {
+		stat = status.New(codes.Unauthenticated, "invalid or expired mfa token, log in again")
+	} else if errors.Is(err, service.ErrInvalidAPIKey) {
+		stat = status.New(codes.Unauthenticated, "invalid, expired or revoked api key")
+	} else if errors.Is(err, service.ErrAPIKeyNotFound) {
+		stat = status.New(codes.NotFound, "api key with given id doesn't exist")
+	} else if errors.Is(err, service.ErrInvalidRefreshToken) || errors.Is(err, service.ErrRefreshTokenReused) {
+		stat = status.New(codes.Unauthenticated, "invalid refresh token")
 	} else {
 		stat = status.New(codes.Internal, err.Error())
 	}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"github.com/golang/mock/gomock"
 	"github.com/status-owl/user-service/pb"
+	"github.com/status-owl/user-service/pkg/model"
 	"github.com/status-owl/user-service/pkg/service"
 	"github.com/stretchr/testify/assert"
 	"google.golang.org/genproto/googleapis/rpc/errdetails"
@@ -12,8 +13,11 @@ import (
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
 	"net"
 	"testing"
+	"time"
 )
 
 func TestCreateAccount(t *testing.T) {
@@ -43,7 +47,7 @@ func TestCreateAccount(t *testing.T) {
 				},
 			}},
 			wantReply: nil,
-			wantErr:   grpcBadRequest("couldn't create a user due to invalid arguments", map[string]string{"email": "invalid"}),
+			wantErr:   grpcBadRequest("couldn't process the request due to invalid arguments", map[string]string{"email": "invalid"}),
 		},
 		{
 			name:      "should return an AlreadyExists error if email is already in use",
@@ -66,12 +70,13 @@ func TestCreateAccount(t *testing.T) {
 			client, svc := setUpTest(t)
 
 			svc.EXPECT().
-				Create(gomock.Any(), gomock.Any()).
+				Create(gomock.Any(), gomock.Eq(model.RequestedUser{Name: "a", EMail: "b", Password: "c"})).
 				Return(tt.id, tt.err)
 
 			gotReply, gotErr := client.CreateUser(context.Background(), &pb.CreateUserRequest{
-				Name:  "a",
-				Email: "b",
+				Name:     "a",
+				Email:    "b",
+				Password: "c",
 			})
 
 			a := assert.New(t)
@@ -85,6 +90,868 @@ func TestCreateAccount(t *testing.T) {
 	}
 }
 
+func TestUpdateAccount(t *testing.T) {
+	createdAt := time.Date(2021, 11, 3, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		req  *pb.UpdateUserRequest
+		// UserService return parameters
+		user   *model.User
+		err    error
+		called bool
+		// want
+		wantReply *pb.UpdateUserReply
+		wantErr   error
+	}{
+		{
+			name:   "should return the updated user on success",
+			req:    &pb.UpdateUserRequest{Id: "123", Name: "a", Version: 3},
+			user:   &model.User{ID: "123", Name: "a", Role: model.Reporter, Version: 4, CreatedAt: createdAt},
+			called: true,
+			wantReply: &pb.UpdateUserReply{Version: 4, User: &pb.User{
+				Id:        "123",
+				Name:      "a",
+				Role:      pb.Role_REPORTER,
+				Version:   4,
+				CreatedAt: timestamppb.New(createdAt),
+			}},
+		},
+		{
+			name:    "should return a NotFound error if the user doesn't exist",
+			req:     &pb.UpdateUserRequest{Id: "123", Email: "b"},
+			err:     service.ErrUserNotFound,
+			called:  true,
+			wantErr: status.Error(codes.NotFound, "user with given id doesn't exist"),
+		},
+		{
+			name:    "should return an AlreadyExists error if email is already in use",
+			req:     &pb.UpdateUserRequest{Id: "123", Email: "b"},
+			err:     service.ErrEmailInUse,
+			called:  true,
+			wantErr: status.Error(codes.AlreadyExists, "user with this email address already exists"),
+		},
+		{
+			name:    "should return a FailedPrecondition error if the user has another version",
+			req:     &pb.UpdateUserRequest{Id: "123", Name: "a", Version: 3},
+			err:     service.ErrVersionMismatch,
+			called:  true,
+			wantErr: status.Error(codes.FailedPrecondition, "user has been modified since the requested version"),
+		},
+		{
+			name:    "should return an Aborted error if the user has been modified concurrently",
+			req:     &pb.UpdateUserRequest{Id: "123", Name: "a"},
+			err:     service.ErrConcurrentModification,
+			called:  true,
+			wantErr: status.Error(codes.Aborted, "user has been modified concurrently, try again"),
+		},
+		{
+			name:    "should return an InvalidArgument error if the role is about to be changed",
+			req:     &pb.UpdateUserRequest{Id: "123", Role: pb.Role_ADMIN},
+			wantErr: status.Error(codes.InvalidArgument, "role can't be changed via UpdateUser"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, svc := setUpTest(t)
+
+			if tt.called {
+				svc.EXPECT().
+					Update(gomock.Any(), gomock.Eq(tt.req.Id), gomock.Eq(model.UserUpdate{
+						EMail:   tt.req.Email,
+						Name:    tt.req.Name,
+						Version: tt.req.Version,
+					})).
+					Return(tt.user, tt.err)
+			}
+
+			gotReply, gotErr := client.UpdateUser(context.Background(), tt.req)
+
+			a := assert.New(t)
+			if tt.wantReply == nil {
+				a.Nil(gotReply)
+			} else {
+				a.True(proto.Equal(tt.wantReply, gotReply), "got %v", gotReply)
+			}
+			a.Equal(tt.wantErr, gotErr)
+		})
+	}
+}
+
+func TestGetAccount(t *testing.T) {
+	createdAt := time.Date(2021, 11, 3, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		// UserService return parameters
+		user *model.User
+		err  error
+		// want
+		wantReply *pb.GetUserReply
+		wantErr   error
+	}{
+		{
+			name: "should return the user on success",
+			user: &model.User{
+				ID:            "123",
+				Name:          "John",
+				EMail:         "john@example.com",
+				EMailVerified: true,
+				Role:          model.Admin,
+				Status:        model.Active,
+				MFAEnabled:    true,
+				Version:       2,
+				CreatedAt:     createdAt,
+			},
+			wantReply: &pb.GetUserReply{User: &pb.User{
+				Id:            "123",
+				Name:          "John",
+				Email:         "john@example.com",
+				EmailVerified: true,
+				Role:          pb.Role_ADMIN,
+				Status:        pb.Status_ACTIVE,
+				MfaEnabled:    true,
+				Version:       2,
+				CreatedAt:     timestamppb.New(createdAt),
+			}},
+		},
+		{
+			name:    "should return a NotFound error if the user doesn't exist",
+			err:     service.ErrUserNotFound,
+			wantErr: status.Error(codes.NotFound, "user with given id doesn't exist"),
+		},
+		{
+			name:    "should return a PermissionDenied error if the caller may not read the user",
+			err:     service.ErrForbidden,
+			wantErr: status.Error(codes.PermissionDenied, "not allowed to perform this operation"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, svc := setUpTest(t)
+
+			svc.EXPECT().
+				FindByID(gomock.Any(), "123").
+				Return(tt.user, tt.err)
+
+			gotReply, gotErr := client.GetUser(context.Background(), &pb.GetUserRequest{Id: "123"})
+
+			a := assert.New(t)
+			if tt.wantReply != nil {
+				a.True(proto.Equal(tt.wantReply, gotReply), "got %v", gotReply)
+			} else {
+				a.Nil(gotReply)
+			}
+			a.Equal(tt.wantErr, gotErr)
+		})
+	}
+}
+
+func TestGetAccountByEmail(t *testing.T) {
+	a := assert.New(t)
+	client, svc := setUpTest(t)
+
+	svc.EXPECT().
+		FindByEMail(gomock.Any(), "john@example.com").
+		Return(&model.User{ID: "123", EMail: "john@example.com", Role: model.Reporter}, nil)
+	svc.EXPECT().
+		FindByEMail(gomock.Any(), "jane@example.com").
+		Return(nil, service.ErrUserNotFound)
+
+	reply, err := client.GetUserByEmail(context.Background(), &pb.GetUserByEmailRequest{Email: "john@example.com"})
+	a.Nil(err)
+	a.Equal("123", reply.GetUser().GetId())
+	a.Equal(pb.Role_REPORTER, reply.GetUser().GetRole())
+
+	_, err = client.GetUserByEmail(context.Background(), &pb.GetUserByEmailRequest{Email: "jane@example.com"})
+	a.Equal(codes.NotFound, status.Code(err))
+}
+
+func TestDeleteAccount(t *testing.T) {
+	tests := []struct {
+		name string
+		// UserService return parameters
+		err error
+		// want
+		wantErr error
+	}{
+		{
+			name: "should succeed if the user has been deleted",
+		},
+		{
+			name:    "should return a NotFound error if the user doesn't exist",
+			err:     service.ErrUserNotFound,
+			wantErr: status.Error(codes.NotFound, "user with given id doesn't exist"),
+		},
+		{
+			name:    "should return a FailedPrecondition error for the last admin",
+			err:     service.ErrLastAdmin,
+			wantErr: status.Error(codes.FailedPrecondition, "the last admin can't be deleted or demoted"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, svc := setUpTest(t)
+
+			svc.EXPECT().
+				Delete(gomock.Any(), "123").
+				Return(tt.err)
+
+			gotReply, gotErr := client.DeleteUser(context.Background(), &pb.DeleteUserRequest{Id: "123"})
+
+			a := assert.New(t)
+			if tt.wantErr == nil {
+				a.NotNil(gotReply)
+			} else {
+				a.Nil(gotReply)
+			}
+			a.Equal(tt.wantErr, gotErr)
+		})
+	}
+}
+
+func TestListAccounts(t *testing.T) {
+	created := time.Date(2021, 12, 24, 18, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		req  *pb.ListUsersRequest
+		// expected query passed to the UserService, nil if it isn't called
+		query *model.UserQuery
+		// UserService return parameters
+		page *model.UserPage
+		err  error
+		// want
+		wantReply *pb.ListUsersReply
+		wantErr   error
+	}{
+		{
+			name: "should return the users and the next page token",
+			req: &pb.ListUsersRequest{
+				Role:         pb.Role_ADMIN,
+				EmailPrefix:  "jo",
+				NameContains: "doe",
+				CreatedAfter: timestamppb.New(created),
+				OrderBy:      "-email",
+				PageSize:     1,
+				PageToken:    "abc",
+			},
+			query: &model.UserQuery{
+				Filter: model.UserFilter{
+					Role:         model.Admin,
+					EMailPrefix:  "jo",
+					NameContains: "doe",
+					CreatedAfter: created,
+				},
+				SortBy:     model.SortByEMail,
+				Descending: true,
+				Limit:      1,
+				Cursor:     "abc",
+			},
+			page: &model.UserPage{
+				Users: []*model.User{
+					{ID: "123", Name: "John Doe", EMail: "john@example.com", Role: model.Admin, Version: 2, CreatedAt: created},
+				},
+				NextCursor: "def",
+			},
+			wantReply: &pb.ListUsersReply{
+				Users: []*pb.User{
+					{
+						Id:        "123",
+						Name:      "John Doe",
+						Email:     "john@example.com",
+						Role:      pb.Role_ADMIN,
+						Version:   2,
+						CreatedAt: timestamppb.New(created),
+					},
+				},
+				NextPageToken: "def",
+			},
+		},
+		{
+			name:  "should return an InvalidArgument error if the page token is invalid",
+			req:   &pb.ListUsersRequest{PageToken: "abc"},
+			query: &model.UserQuery{Cursor: "abc"},
+			err: &service.ValidationErrors{Errors: []service.ValidationError{
+				{Name: "cursor", Reason: "invalid cursor"},
+			}},
+			wantErr: grpcBadRequest("couldn't process the request due to invalid arguments", map[string]string{"cursor": "invalid cursor"}),
+		},
+		{
+			name:    "should return an InvalidArgument error if the order is unknown",
+			req:     &pb.ListUsersRequest{OrderBy: "role"},
+			wantErr: status.Error(codes.InvalidArgument, `users can't be ordered by "role"`),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, svc := setUpTest(t)
+
+			if tt.query != nil {
+				svc.EXPECT().
+					List(gomock.Any(), gomock.Eq(*tt.query)).
+					Return(tt.page, tt.err)
+			}
+
+			gotReply, gotErr := client.ListUsers(context.Background(), tt.req)
+
+			a := assert.New(t)
+			if tt.wantReply == nil {
+				a.Nil(gotReply)
+			} else {
+				a.True(proto.Equal(tt.wantReply, gotReply), "got %v", gotReply)
+			}
+			a.Equal(tt.wantErr, gotErr)
+		})
+	}
+}
+
+func TestChangeAccountPassword(t *testing.T) {
+	tests := []struct {
+		name string
+		// UserService return parameters
+		err error
+		// want
+		wantErr error
+	}{
+		{
+			name: "should return an empty reply on success",
+		},
+		{
+			name:    "should return an Unauthenticated error if the current password doesn't match",
+			err:     service.ErrInvalidCredentials,
+			wantErr: status.Error(codes.Unauthenticated, "invalid credentials"),
+		},
+		{
+			name:    "should return a PermissionDenied error if the caller isn't allowed to",
+			err:     service.ErrForbidden,
+			wantErr: status.Error(codes.PermissionDenied, "not allowed to perform this operation"),
+		},
+		{
+			name: "should return an InvalidArgument error if the new password is too weak",
+			err: &service.ValidationErrors{Errors: []service.ValidationError{
+				{Name: "password", Reason: "too weak"},
+			}},
+			wantErr: grpcBadRequest("couldn't process the request due to invalid arguments", map[string]string{"password": "too weak"}),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, svc := setUpTest(t)
+
+			svc.EXPECT().
+				ChangePassword(gomock.Any(), "123", "old", "new").
+				Return(tt.err)
+
+			gotReply, gotErr := client.ChangePassword(context.Background(), &pb.ChangePasswordRequest{
+				Id:              "123",
+				CurrentPassword: "old",
+				NewPassword:     "new",
+			})
+
+			a := assert.New(t)
+			if tt.wantErr == nil {
+				a.NotNil(gotReply)
+			} else {
+				a.Nil(gotReply)
+			}
+			a.Equal(tt.wantErr, gotErr)
+		})
+	}
+}
+
+func TestLoginAccount(t *testing.T) {
+	tests := []struct {
+		name string
+		// UserService return parameters
+		token *model.Token
+		err   error
+		// want
+		wantReply *pb.LoginReply
+		wantErr   error
+	}{
+		{
+			name:      "should return the access token on success",
+			token:     &model.Token{AccessToken: "token", ExpiresAt: time.Now().Add(15 * time.Minute), RefreshToken: "refresh"},
+			wantReply: &pb.LoginReply{AccessToken: "token", TokenType: "Bearer", ExpiresIn: 900, RefreshToken: "refresh"},
+		},
+		{
+			name:      "should return the challenge if the user has to pass a second factor",
+			token:     &model.Token{MFAToken: "challenge", ExpiresAt: time.Now().Add(5 * time.Minute)},
+			wantReply: &pb.LoginReply{MfaToken: "challenge", ExpiresIn: 300},
+		},
+		{
+			name:    "should return an Unauthenticated error if the credentials are invalid",
+			err:     service.ErrInvalidCredentials,
+			wantErr: status.Error(codes.Unauthenticated, "invalid credentials"),
+		},
+		{
+			name:    "should return a ResourceExhausted error if the user is locked out",
+			err:     service.ErrTooManyFailedLogins,
+			wantErr: status.Error(codes.ResourceExhausted, "too many failed logins, try again later"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, svc := setUpTest(t)
+
+			svc.EXPECT().
+				Login(gomock.Any(), "john@example.com", "secret").
+				Return(tt.token, tt.err)
+
+			gotReply, gotErr := client.Login(context.Background(), &pb.LoginRequest{
+				Email:    "john@example.com",
+				Password: "secret",
+			})
+
+			a := assert.New(t)
+			if tt.wantReply == nil {
+				a.Nil(gotReply)
+			} else {
+				a.True(proto.Equal(tt.wantReply, gotReply), "got %v", gotReply)
+			}
+			a.Equal(tt.wantErr, gotErr)
+		})
+	}
+}
+
+func TestRefreshAccountToken(t *testing.T) {
+	tests := []struct {
+		name string
+		// UserService return parameters
+		token *model.Token
+		err   error
+		// want
+		wantReply *pb.LoginReply
+		wantErr   error
+	}{
+		{
+			name:      "should return the new tokens on success",
+			token:     &model.Token{AccessToken: "token", ExpiresAt: time.Now().Add(15 * time.Minute), RefreshToken: "next"},
+			wantReply: &pb.LoginReply{AccessToken: "token", TokenType: "Bearer", ExpiresIn: 900, RefreshToken: "next"},
+		},
+		{
+			name:    "should return an Unauthenticated error if the refresh token has been reused",
+			err:     service.ErrRefreshTokenReused,
+			wantErr: status.Error(codes.Unauthenticated, "invalid refresh token"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, svc := setUpTest(t)
+
+			svc.EXPECT().
+				Refresh(gomock.Any(), "refresh").
+				Return(tt.token, tt.err)
+
+			gotReply, gotErr := client.RefreshToken(context.Background(), &pb.RefreshTokenRequest{RefreshToken: "refresh"})
+
+			a := assert.New(t)
+			if tt.wantReply == nil {
+				a.Nil(gotReply)
+			} else {
+				a.True(proto.Equal(tt.wantReply, gotReply), "got %v", gotReply)
+			}
+			a.Equal(tt.wantErr, gotErr)
+		})
+	}
+}
+
+func TestLogoutAccount(t *testing.T) {
+	client, svc := setUpTest(t)
+
+	svc.EXPECT().
+		Logout(gomock.Any(), "refresh").
+		Return(nil)
+
+	_, err := client.Logout(context.Background(), &pb.LogoutRequest{RefreshToken: "refresh"})
+	assert.Nil(t, err)
+}
+
+func TestLogoutAccountEverywhere(t *testing.T) {
+	client, svc := setUpTest(t)
+
+	svc.EXPECT().
+		LogoutEverywhere(gomock.Any(), "123").
+		Return(service.ErrUserNotFound)
+
+	_, err := client.LogoutEverywhere(context.Background(), &pb.LogoutEverywhereRequest{Id: "123"})
+	assert.Equal(t, status.Error(codes.NotFound, "user with given id doesn't exist"), err)
+}
+
+func TestAssignAccountRole(t *testing.T) {
+	createdAt := time.Date(2021, 11, 3, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		// UserService return parameters
+		user *model.User
+		err  error
+		// want
+		wantReply *pb.AssignRoleReply
+		wantErr   error
+	}{
+		{
+			name: "should return the user on success",
+			user: &model.User{ID: "123", Name: "John", EMail: "john@example.com", Role: model.Reporter, Version: 2, CreatedAt: createdAt},
+			wantReply: &pb.AssignRoleReply{User: &pb.User{
+				Id:        "123",
+				Name:      "John",
+				Email:     "john@example.com",
+				Role:      pb.Role_REPORTER,
+				Version:   2,
+				CreatedAt: timestamppb.New(createdAt),
+			}},
+		},
+		{
+			name:    "should return a PermissionDenied error if the caller isn't an admin",
+			err:     service.ErrForbidden,
+			wantErr: status.Error(codes.PermissionDenied, "not allowed to perform this operation"),
+		},
+		{
+			name:    "should return a NotFound error if the user doesn't exist",
+			err:     service.ErrUserNotFound,
+			wantErr: status.Error(codes.NotFound, "user with given id doesn't exist"),
+		},
+		{
+			name:    "should return a FailedPrecondition error if the last admin would be demoted",
+			err:     service.ErrLastAdmin,
+			wantErr: status.Error(codes.FailedPrecondition, "the last admin can't be deleted or demoted"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, svc := setUpTest(t)
+
+			svc.EXPECT().
+				AssignRole(gomock.Any(), "123", model.Reporter).
+				Return(tt.user, tt.err)
+
+			gotReply, gotErr := client.AssignRole(context.Background(), &pb.AssignRoleRequest{
+				Id:   "123",
+				Role: pb.Role_REPORTER,
+			})
+
+			a := assert.New(t)
+			if tt.wantReply != nil {
+				a.True(proto.Equal(tt.wantReply, gotReply), "got %v", gotReply)
+			} else {
+				a.Nil(gotReply)
+			}
+			a.Equal(tt.wantErr, gotErr)
+		})
+	}
+}
+
+func TestUnknownAccountRole(t *testing.T) {
+	a := assert.New(t)
+	// the service isn't called for roles outside of the enum
+	client, _ := setUpTest(t)
+	wantErr := grpcBadRequest("couldn't process the request due to invalid arguments", map[string]string{"role": "unknown role 7"})
+
+	_, err := client.AssignRole(context.Background(), &pb.AssignRoleRequest{Id: "123", Role: pb.Role(7)})
+	a.Equal(wantErr, err)
+
+	_, err = client.ListUsers(context.Background(), &pb.ListUsersRequest{Role: pb.Role(7)})
+	a.Equal(wantErr, err)
+}
+
+func TestUnknownAccountStatus(t *testing.T) {
+	a := assert.New(t)
+	// the service isn't called for statuses outside of the enum, they'd list every user otherwise
+	client, _ := setUpTest(t)
+	wantErr := grpcBadRequest("couldn't process the request due to invalid arguments", map[string]string{"status": "unknown status 9"})
+
+	_, err := client.ListUsers(context.Background(), &pb.ListUsersRequest{Status: pb.Status(9)})
+	a.Equal(wantErr, err)
+}
+
+func TestSuspendAccount(t *testing.T) {
+	createdAt := time.Date(2021, 11, 3, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		// UserService return parameters
+		user *model.User
+		err  error
+		// want
+		wantReply *pb.SuspendUserReply
+		wantErr   error
+	}{
+		{
+			name: "should return the user on success",
+			user: &model.User{ID: "123", Name: "John", EMail: "john@example.com", Status: model.Suspended, Version: 2, CreatedAt: createdAt},
+			wantReply: &pb.SuspendUserReply{User: &pb.User{
+				Id:        "123",
+				Name:      "John",
+				Email:     "john@example.com",
+				Status:    pb.Status_SUSPENDED,
+				Version:   2,
+				CreatedAt: timestamppb.New(createdAt),
+			}},
+		},
+		{
+			name:    "should return a FailedPrecondition error if the transition isn't allowed",
+			err:     &service.TransitionError{From: model.Suspended, To: model.Suspended},
+			wantErr: status.Error(codes.FailedPrecondition, "user can't change from status SUSPENDED to SUSPENDED"),
+		},
+		{
+			name:    "should return a FailedPrecondition error for admins",
+			err:     service.ErrAdminNotSuspendable,
+			wantErr: status.Error(codes.FailedPrecondition, "admins can't be suspended or locked, revoke the role first"),
+		},
+		{
+			name:    "should return a NotFound error if the user doesn't exist",
+			err:     service.ErrUserNotFound,
+			wantErr: status.Error(codes.NotFound, "user with given id doesn't exist"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, svc := setUpTest(t)
+
+			svc.EXPECT().
+				Suspend(gomock.Any(), "123").
+				Return(tt.user, tt.err)
+
+			gotReply, gotErr := client.SuspendUser(context.Background(), &pb.SuspendUserRequest{Id: "123"})
+
+			a := assert.New(t)
+			if tt.wantReply != nil {
+				a.True(proto.Equal(tt.wantReply, gotReply), "got %v", gotReply)
+			} else {
+				a.Nil(gotReply)
+			}
+			a.Equal(tt.wantErr, gotErr)
+		})
+	}
+}
+
+func TestReactivateAndLockAccount(t *testing.T) {
+	a := assert.New(t)
+	client, svc := setUpTest(t)
+
+	svc.EXPECT().
+		Reactivate(gomock.Any(), "123").
+		Return(&model.User{ID: "123", Status: model.Active}, nil)
+	svc.EXPECT().
+		Lock(gomock.Any(), "123").
+		Return(&model.User{ID: "123", Status: model.Locked}, nil)
+
+	reactivated, err := client.ReactivateUser(context.Background(), &pb.ReactivateUserRequest{Id: "123"})
+	a.Nil(err)
+	a.Equal(pb.Status_ACTIVE, reactivated.GetUser().GetStatus())
+
+	locked, err := client.LockUser(context.Background(), &pb.LockUserRequest{Id: "123"})
+	a.Nil(err)
+	a.Equal(pb.Status_LOCKED, locked.GetUser().GetStatus())
+}
+
+func TestUnlockAccount(t *testing.T) {
+	a := assert.New(t)
+	client, svc := setUpTest(t)
+
+	lockedUntil := time.Date(2021, 11, 3, 10, 0, 0, 0, time.UTC)
+	svc.EXPECT().
+		Unlock(gomock.Any(), "123").
+		Return(&model.User{ID: "123", Status: model.Active}, nil)
+	svc.EXPECT().
+		Lock(gomock.Any(), "456").
+		Return(&model.User{ID: "456", Status: model.Locked, FailedLogins: 5, LockedUntil: lockedUntil}, nil)
+
+	unlocked, err := client.UnlockUser(context.Background(), &pb.UnlockUserRequest{Id: "123"})
+	a.Nil(err)
+	a.Zero(unlocked.GetUser().GetFailedLogins())
+	a.Nil(unlocked.GetUser().GetLockedUntil())
+
+	locked, err := client.LockUser(context.Background(), &pb.LockUserRequest{Id: "456"})
+	a.Nil(err)
+	a.Equal(int32(5), locked.GetUser().GetFailedLogins())
+	a.True(proto.Equal(timestamppb.New(lockedUntil), locked.GetUser().GetLockedUntil()))
+}
+
+func TestAccountMFA(t *testing.T) {
+	a := assert.New(t)
+	client, svc := setUpTest(t)
+
+	svc.EXPECT().
+		EnrollMFA(gomock.Any(), "123").
+		Return(&model.MFAEnrollment{Secret: "JBSWY3DPEHPK3PXP", URI: "otpauth://totp/x"}, nil)
+	svc.EXPECT().
+		ConfirmMFA(gomock.Any(), "123", "123456").
+		Return([]string{"5f2a9-c03e1"}, nil)
+	svc.EXPECT().
+		DisableMFA(gomock.Any(), "123", "000000").
+		Return(service.ErrInvalidMFACode)
+	svc.EXPECT().
+		EnrollMFA(gomock.Any(), "456").
+		Return(nil, service.ErrMFARequired)
+
+	enrolled, err := client.EnrollMfa(context.Background(), &pb.EnrollMfaRequest{Id: "123"})
+	a.Nil(err)
+	a.Equal("JBSWY3DPEHPK3PXP", enrolled.GetSecret())
+	a.Equal("otpauth://totp/x", enrolled.GetProvisioningUri())
+
+	confirmed, err := client.ConfirmMfa(context.Background(), &pb.ConfirmMfaRequest{Id: "123", Code: "123456"})
+	a.Nil(err)
+	a.Equal([]string{"5f2a9-c03e1"}, confirmed.GetRecoveryCodes())
+
+	_, err = client.DisableMfa(context.Background(), &pb.DisableMfaRequest{Id: "123", Code: "000000"})
+	a.Equal(status.Error(codes.InvalidArgument, "invalid code"), err)
+
+	_, err = client.EnrollMfa(context.Background(), &pb.EnrollMfaRequest{Id: "456"})
+	a.Equal(codes.PermissionDenied, status.Code(err))
+}
+
+func TestAccountAPIKeys(t *testing.T) {
+	a := assert.New(t)
+	client, svc := setUpTest(t)
+
+	createdAt := time.Date(2021, 12, 24, 18, 0, 0, 0, time.UTC)
+	apiKey := &model.APIKey{
+		ID:        "k1",
+		UserID:    "123",
+		Name:      "ci",
+		Prefix:    "sowl_abcdefgh",
+		Hash:      "secret hash",
+		Scopes:    model.Scopes,
+		CreatedAt: createdAt,
+	}
+
+	svc.EXPECT().
+		CreateAPIKey(gomock.Any(), "123", "ci", nil, time.Time{}).
+		Return(apiKey, "sowl_abcdefghijkl", nil)
+	svc.EXPECT().
+		ListAPIKeys(gomock.Any(), "123").
+		Return([]*model.APIKey{apiKey}, nil)
+	svc.EXPECT().
+		RevokeAPIKey(gomock.Any(), "123", "k2").
+		Return(service.ErrAPIKeyNotFound)
+
+	wantKey := &pb.ApiKey{
+		Id:        "k1",
+		Name:      "ci",
+		Prefix:    "sowl_abcdefgh",
+		Scopes:    []string{"users:read", "users:write"},
+		CreatedAt: timestamppb.New(createdAt),
+	}
+
+	created, err := client.CreateApiKey(context.Background(), &pb.CreateApiKeyRequest{Id: "123", Name: "ci"})
+	a.Nil(err)
+	a.Equal("sowl_abcdefghijkl", created.GetKey())
+	a.True(proto.Equal(wantKey, created.GetApiKey()), "got %v", created.GetApiKey())
+
+	listed, err := client.ListApiKeys(context.Background(), &pb.ListApiKeysRequest{Id: "123"})
+	a.Nil(err)
+	if a.Len(listed.GetApiKeys(), 1) {
+		a.True(proto.Equal(wantKey, listed.GetApiKeys()[0]), "got %v", listed.GetApiKeys()[0])
+	}
+
+	_, err = client.RevokeApiKey(context.Background(), &pb.RevokeApiKeyRequest{Id: "123", KeyId: "k2"})
+	a.Equal(codes.NotFound, status.Code(err))
+}
+
+func TestVerifyAccountMFA(t *testing.T) {
+	a := assert.New(t)
+	client, svc := setUpTest(t)
+
+	svc.EXPECT().
+		VerifyMFA(gomock.Any(), "challenge", "123456").
+		Return(&model.Token{AccessToken: "token", ExpiresAt: time.Now().Add(15 * time.Minute), RefreshToken: "refresh"}, nil)
+	svc.EXPECT().
+		VerifyMFA(gomock.Any(), "expired", "123456").
+		Return(nil, service.ErrInvalidMFAToken)
+
+	reply, err := client.VerifyMfa(context.Background(), &pb.VerifyMfaRequest{MfaToken: "challenge", Code: "123456"})
+	a.Nil(err)
+	a.True(proto.Equal(&pb.LoginReply{AccessToken: "token", TokenType: "Bearer", ExpiresIn: 900, RefreshToken: "refresh"}, reply),
+		"got %v", reply)
+
+	_, err = client.VerifyMfa(context.Background(), &pb.VerifyMfaRequest{MfaToken: "expired", Code: "123456"})
+	a.Equal(codes.Unauthenticated, status.Code(err))
+}
+
+func TestVerifyAccountEmail(t *testing.T) {
+	tests := []struct {
+		name string
+		// UserService return parameters
+		err error
+		// want
+		wantErr error
+	}{
+		{
+			name: "should return an empty reply on success",
+		},
+		{
+			name:    "should return an InvalidArgument error for invalid tokens",
+			err:     service.ErrInvalidVerificationToken,
+			wantErr: status.Error(codes.InvalidArgument, "invalid or expired verification token"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, svc := setUpTest(t)
+
+			svc.EXPECT().
+				VerifyEMail(gomock.Any(), "123", "secret").
+				Return(tt.err)
+
+			gotReply, gotErr := client.VerifyEmail(context.Background(), &pb.VerifyEmailRequest{Id: "123", Token: "secret"})
+
+			a := assert.New(t)
+			if tt.wantErr == nil {
+				a.NotNil(gotReply)
+			} else {
+				a.Nil(gotReply)
+			}
+			a.Equal(tt.wantErr, gotErr)
+		})
+	}
+}
+
+func TestResendAccountVerificationEmail(t *testing.T) {
+	client, svc := setUpTest(t)
+
+	svc.EXPECT().
+		ResendVerification(gomock.Any(), "123").
+		Return(service.ErrTooManyRequests)
+
+	_, err := client.ResendVerificationEmail(context.Background(), &pb.ResendVerificationEmailRequest{Id: "123"})
+	assert.Equal(t, status.Error(codes.ResourceExhausted, "too many requests, try again later"), err)
+}
+
+func TestRequestAccountPasswordReset(t *testing.T) {
+	client, svc := setUpTest(t)
+
+	svc.EXPECT().
+		RequestPasswordReset(gomock.Any(), "john@example.com").
+		Return(nil)
+
+	reply, err := client.RequestPasswordReset(context.Background(), &pb.RequestPasswordResetRequest{Email: "john@example.com"})
+	assert.Nil(t, err)
+	assert.NotNil(t, reply)
+}
+
+func TestResetAccountPassword(t *testing.T) {
+	client, svc := setUpTest(t)
+
+	svc.EXPECT().
+		ResetPassword(gomock.Any(), "secret", "battery-Staple-8").
+		Return(service.ErrInvalidResetToken)
+
+	_, err := client.ResetPassword(context.Background(), &pb.ResetPasswordRequest{Token: "secret", NewPassword: "battery-Staple-8"})
+	assert.Equal(t, status.Error(codes.InvalidArgument, "invalid, expired or already used password reset token"), err)
+}
+
 // grpcBadRequest creates a error with code=InvalidArgument and
 // field violations
 func grpcBadRequest(msg string, violations map[string]string) error {
@@ -106,12 +973,13 @@ func grpcBadRequest(msg string, violations map[string]string) error {
 	return stat.Err()
 }
 
-func setUpTest(t *testing.T) (pb.UserServiceClient, *service.MockUserService) {
+// setUpTest starts a grpc server with given options serving a mocked service
+func setUpTest(t *testing.T, opts ...grpc.ServerOption) (pb.UserServiceClient, *service.MockUserService) {
 	ctrl := gomock.NewController(t)
 	svc := service.NewMockUserService(ctrl)
 
 	var lis = bufconn.Listen(1024 * 1024)
-	srv := grpc.NewServer()
+	srv := grpc.NewServer(opts...)
 	pb.RegisterUserServiceServer(srv, NewBaseGrpcServer(svc))
 
 	go func() {
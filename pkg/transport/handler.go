@@ -6,57 +6,892 @@ import (
 	"errors"
 	"fmt"
 	"github.com/rs/zerolog"
+	"net"
 	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/status-owl/user-service/pkg/auth"
+	"github.com/status-owl/user-service/pkg/model"
 	"github.com/status-owl/user-service/pkg/service"
 )
 
 //go:generate oapi-codegen -o model.go --generate=types --package=$GOPACKAGE ../../spec/api-v1.yaml
 
-// NewHTTPHandler creates and returns a configured http.Handler
-func NewHTTPHandler(svc service.UserService, logger zerolog.Logger) http.Handler {
-	return LoggingMiddleware(logger, NewBaseHTTPHandler(svc))
+// NewHTTPHandler creates and returns a configured http.Handler,
+// callers are authenticated by access tokens verified by given verifier or by the API keys of svc,
+// the client certificates of mutual TLS connections are added to the request context
+func NewHTTPHandler(svc service.UserService, verifier TokenVerifier, logger zerolog.Logger) http.Handler {
+	return LoggingMiddleware(logger, ClientCertMiddleware(AuthMiddleware(verifier, svc, NewBaseHTTPHandler(svc))))
 }
 
 // NewBaseHTTPHandler returns a base http.Handler without any configured middlewares
 func NewBaseHTTPHandler(svc service.UserService) http.Handler {
 	mux := http.NewServeMux()
 
-	mux.HandleFunc("/users/", findUserByID(svc))
+	mux.Handle("/auth/token", methods{
+		http.MethodPost: login(svc),
+	})
+	mux.Handle("/auth/mfa", methods{
+		http.MethodPost: verifyMFA(svc),
+	})
+	mux.Handle("/auth/refresh", methods{
+		http.MethodPost: refreshToken(svc),
+	})
+	mux.Handle("/auth/logout", methods{
+		http.MethodPost: logout(svc),
+	})
+	mux.Handle("/auth/password-reset", methods{
+		http.MethodPost: requestPasswordReset(svc),
+	})
+	mux.Handle("/auth/password-reset/confirm", methods{
+		http.MethodPost: resetPassword(svc),
+	})
+	mux.Handle("/users", methods{
+		http.MethodGet: listUsers(svc),
+	})
+	mux.Handle("/users/", subresources{
+		"": methods{
+			http.MethodGet:   findUserByID(svc),
+			http.MethodPatch: updateUser(svc),
+		},
+		"password": methods{
+			http.MethodPut: changePassword(svc),
+		},
+		"sessions": methods{
+			http.MethodDelete: logoutEverywhere(svc),
+		},
+		"role": methods{
+			http.MethodPut: assignRole(svc),
+		},
+		"verify": methods{
+			http.MethodPost: verifyEMail(svc),
+		},
+		"verification-mail": methods{
+			http.MethodPost: resendVerification(svc),
+		},
+		"suspend": methods{
+			http.MethodPost: changeStatus(svc.Suspend),
+		},
+		"lock": methods{
+			http.MethodPost: changeStatus(svc.Lock),
+		},
+		"reactivate": methods{
+			http.MethodPost: changeStatus(svc.Reactivate),
+		},
+		"unlock": methods{
+			http.MethodPost: changeStatus(svc.Unlock),
+		},
+		"mfa": methods{
+			http.MethodPost: enrollMFA(svc),
+		},
+		"mfa/confirm": methods{
+			http.MethodPost: confirmMFA(svc),
+		},
+		"mfa/disable": methods{
+			http.MethodPost: disableMFA(svc),
+		},
+		"api-keys": methods{
+			http.MethodGet:  listAPIKeys(svc),
+			http.MethodPost: createAPIKey(svc),
+		},
+		"api-keys/": methods{
+			http.MethodDelete: revokeAPIKey(svc),
+		},
+	})
 	return mux
 }
 
+// NewJWKSHandler returns a http.Handler serving the public keys
+// the access tokens can be verified with as JSON Web Key Set
+func NewJWKSHandler(keys KeySet) http.Handler {
+	return methods{
+		http.MethodGet: func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.Header().Set("Cache-Control", "public, max-age=300")
+			w.WriteHeader(http.StatusOK)
+			if err := json.NewEncoder(w).Encode(keys.JWKS()); err != nil {
+				panic("failed to encode json")
+			}
+		},
+	}
+}
+
+// KeySet provides the public keys of the access tokens
+type KeySet interface {
+	JWKS() *auth.JWKSet
+}
+
+// subresources dispatches requests of /users/{id}/{subresource} to the handler
+// registered for the subresource, the user itself is registered as empty subresource.
+// The items of nested collections are registered with a trailing slash, e.g. api-keys/ for api-keys/{keyId}
+type subresources map[string]http.Handler
+
+// ServeHTTP satisfies http.Handler interface
+func (s subresources) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var subresource string
+	if i := strings.Index(userPath(r), "/"); i >= 0 {
+		subresource = userPath(r)[i+1:]
+	}
+
+	handler, ok := s[subresource]
+	if i := strings.LastIndex(subresource, "/"); !ok && i >= 0 {
+		handler, ok = s[subresource[:i+1]]
+	}
+	if !ok || strings.HasSuffix(subresource, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// subresourceID returns the id of an item of a nested collection, e.g. the key id of /users/{id}/api-keys/{keyId}
+func subresourceID(r *http.Request) string {
+	return r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+}
+
+// userPath returns the path of a request below /users/
+func userPath(r *http.Request) string {
+	return strings.TrimPrefix(r.URL.Path, "/users/")
+}
+
+// userID returns the user id of a /users/{id} or /users/{id}/{subresource} request
+func userID(r *http.Request) string {
+	id := userPath(r)
+	if i := strings.Index(id, "/"); i >= 0 {
+		return id[:i]
+	}
+	return id
+}
+
+// methods dispatches requests to the handler registered for the request method
+type methods map[string]http.HandlerFunc
+
+// ServeHTTP satisfies http.Handler interface
+func (m methods) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	handler, ok := m[r.Method]
+	if !ok {
+		var allowed []string
+		for method := range m {
+			allowed = append(allowed, method)
+		}
+		sort.Strings(allowed)
+
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	handler(w, r)
+}
+
 func findUserByID(svc service.UserService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodGet {
-			w.WriteHeader(http.StatusMethodNotAllowed)
+		id := userID(r)
+
+		ctx, cancel := context.WithTimeout(r.Context(), time.Second*10)
+		defer cancel()
+
+		user, err := svc.FindByID(ctx, id)
+		if err != nil {
+			handleError(w, err2Problem(err))
+			return
+		}
+
+		writeUser(w, user)
+	}
+}
+
+func login(svc service.UserService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body LoginJSONRequestBody
+		if p, err := decodeRequest(r, &body); err != nil {
+			handleError(w, p)
+			return
+		}
+
+		// proxies aren't trusted, the failed logins are tracked per peer address
+		ctx := auth.NewClientIPContext(r.Context(), hostOf(r.RemoteAddr))
+		ctx, cancel := context.WithTimeout(ctx, time.Second*10)
+		defer cancel()
+
+		token, err := svc.Login(ctx, body.Email, body.Password)
+		if err != nil {
+			handleError(w, err2Problem(err))
+			return
+		}
+
+		writeToken(w, token)
+	}
+}
+
+func verifyMFA(svc service.UserService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body VerifyMfaJSONRequestBody
+		if p, err := decodeRequest(r, &body); err != nil {
+			handleError(w, p)
+			return
+		}
+
+		// wrong codes count as failed logins of the peer address
+		ctx := auth.NewClientIPContext(r.Context(), hostOf(r.RemoteAddr))
+		ctx, cancel := context.WithTimeout(ctx, time.Second*10)
+		defer cancel()
+
+		token, err := svc.VerifyMFA(ctx, body.MfaToken, body.Code)
+		if err != nil {
+			handleError(w, err2Problem(err))
+			return
+		}
+
+		writeToken(w, token)
+	}
+}
+
+func refreshToken(svc service.UserService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body RefreshTokenJSONRequestBody
+		if p, err := decodeRequest(r, &body); err != nil {
+			handleError(w, p)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), time.Second*10)
+		defer cancel()
+
+		token, err := svc.Refresh(ctx, body.RefreshToken)
+		if err != nil {
+			handleError(w, err2Problem(err))
 			return
 		}
 
-		id := r.URL.Path[len("/users/"):]
+		writeToken(w, token)
+	}
+}
+
+func logout(svc service.UserService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body LogoutJSONRequestBody
+		if p, err := decodeRequest(r, &body); err != nil {
+			handleError(w, p)
+			return
+		}
 
 		ctx, cancel := context.WithTimeout(r.Context(), time.Second*10)
 		defer cancel()
 
-		user, err := svc.FindByID(ctx, id)
+		if err := svc.Logout(ctx, body.RefreshToken); err != nil {
+			handleError(w, err2Problem(err))
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func requestPasswordReset(svc service.UserService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body RequestPasswordResetJSONRequestBody
+		if p, err := decodeRequest(r, &body); err != nil {
+			handleError(w, p)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), time.Second*10)
+		defer cancel()
+
+		if err := svc.RequestPasswordReset(ctx, body.Email); err != nil {
+			handleError(w, err2Problem(err))
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+func resetPassword(svc service.UserService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body ResetPasswordJSONRequestBody
+		if p, err := decodeRequest(r, &body); err != nil {
+			handleError(w, p)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), time.Second*10)
+		defer cancel()
+
+		if err := svc.ResetPassword(ctx, body.Token, body.NewPassword); err != nil {
+			handleError(w, err2Problem(err))
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func logoutEverywhere(svc service.UserService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), time.Second*10)
+		defer cancel()
+
+		if err := svc.LogoutEverywhere(ctx, userID(r)); err != nil {
+			handleError(w, err2Problem(err))
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// writeToken responds with given token encoded as JSON,
+// challenges for a second factor are accepted only
+func writeToken(w http.ResponseWriter, token *model.Token) {
+	var body interface{}
+	code := http.StatusOK
+	if token.MFAToken != "" {
+		body = MFAChallenge{MfaToken: token.MFAToken, ExpiresIn: expiresIn(token)}
+		code = http.StatusAccepted
+	} else {
+		access := AccessToken{
+			AccessToken: token.AccessToken,
+			TokenType:   AccessTokenTokenTypeBearer,
+			ExpiresIn:   expiresIn(token),
+		}
+		if token.RefreshToken != "" {
+			access.RefreshToken = &token.RefreshToken
+		}
+		body = access
+	}
+
+	// tokens must not be cached, see RFC 6749 section 5.1
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		panic("failed to encode json")
+	}
+}
+
+// expiresIn returns the seconds until given token expires
+func expiresIn(token *model.Token) int64 {
+	return int64(time.Until(token.ExpiresAt).Round(time.Second) / time.Second)
+}
+
+func listUsers(svc service.UserService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := r.URL.Query()
+
+		query, invalid := parseUserQuery(params)
+		if len(invalid) > 0 {
+			handleError(w, &Problem{
+				Status:        http.StatusBadRequest,
+				Title:         http.StatusText(http.StatusBadRequest),
+				Detail:        "One of the parameters is invalid",
+				InvalidParams: &invalid,
+			})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), time.Second*10)
+		defer cancel()
+
+		page, err := svc.List(ctx, query)
+		if err != nil {
+			handleError(w, err2Problem(err))
+			return
+		}
+
+		list := UserList{Users: make([]User, 0, len(page.Users))}
+		for _, u := range page.Users {
+			list.Users = append(list.Users, newUser(u))
+		}
+
+		// the next page is listed with the same parameters
+		if page.NextCursor != "" {
+			params.Set("cursor", page.NextCursor)
+			next := "/users?" + params.Encode()
+			list.Next = &next
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(&list); err != nil {
+			panic("failed to encode json")
+		}
+	}
+}
+
+// parseUserQuery creates a query from the parameters of a FindUsers request
+func parseUserQuery(params url.Values) (model.UserQuery, []InvalidParam) {
+	var (
+		query   model.UserQuery
+		invalid []InvalidParam
+	)
+
+	if v := params.Get("role"); v != "" {
+		var ok bool
+		if query.Filter.Role, ok = apiRole2Model(Role(v)); !ok {
+			invalid = append(invalid, InvalidParam{Name: "role", Reason: fmt.Sprintf("unknown role %q", v)})
+		}
+	}
+	query.Filter.Status = model.Status(params.Get("status"))
+	query.Filter.EMailPrefix = params.Get("email")
+	query.Filter.NameContains = params.Get("name")
+	query.Cursor = params.Get("cursor")
+
+	for name, t := range map[string]*time.Time{
+		"created_after":  &query.Filter.CreatedAfter,
+		"created_before": &query.Filter.CreatedBefore,
+	} {
+		if v := params.Get(name); v != "" {
+			var err error
+			if *t, err = time.Parse(time.RFC3339, v); err != nil {
+				invalid = append(invalid, InvalidParam{Name: name, Reason: "time must be given in RFC 3339 format"})
+			}
+		}
+	}
+
+	if v := params.Get("sort"); v != "" {
+		var ok bool
+		if query.SortBy, query.Descending, ok = parseSort(v); !ok {
+			invalid = append(invalid, InvalidParam{Name: "sort", Reason: fmt.Sprintf("users can't be sorted by %q", v)})
+		}
+	}
+
+	if v := params.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			invalid = append(invalid, InvalidParam{Name: "limit", Reason: "limit must be a positive number"})
+		}
+		query.Limit = limit
+	}
+
+	// keep the order stable for the clients
+	sort.Slice(invalid, func(i, j int) bool {
+		return invalid[i].Name < invalid[j].Name
+	})
+
+	return query, invalid
+}
+
+// parseSort parses the sort order of users given as property name,
+// a leading - sorts descending
+func parseSort(s string) (model.SortField, bool, bool) {
+	descending := strings.HasPrefix(s, "-")
+	field := model.SortField(strings.TrimPrefix(s, "-"))
+
+	switch field {
+	case model.SortByCreatedAt, model.SortByName, model.SortByEMail:
+		return field, descending, true
+	default:
+		return "", false, false
+	}
+}
+
+func updateUser(svc service.UserService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := userID(r)
+
+		version, ok := parseIfMatch(r.Header.Get("If-Match"))
+		if !ok {
+			handleError(w, &Problem{
+				Status: http.StatusPreconditionFailed,
+				Title:  http.StatusText(http.StatusPreconditionFailed),
+				Detail: "If-Match doesn't contain a valid ETag",
+			})
+			return
+		}
+
+		var body UpdateUserJSONRequestBody
+		if p, err := decodeRequest(r, &body); err != nil {
+			handleError(w, p)
+			return
+		}
+
+		update := model.UserUpdate{Version: version}
+		if body.Email != nil {
+			update.EMail = *body.Email
+		}
+		if body.Name != nil {
+			update.Name = *body.Name
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), time.Second*10)
+		defer cancel()
+
+		user, err := svc.Update(ctx, id, update)
+		if err != nil {
+			handleError(w, err2Problem(err))
+			return
+		}
+
+		writeUser(w, user)
+	}
+}
+
+func changePassword(svc service.UserService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body ChangePasswordJSONRequestBody
+		if p, err := decodeRequest(r, &body); err != nil {
+			handleError(w, p)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), time.Second*10)
+		defer cancel()
+
+		if err := svc.ChangePassword(ctx, userID(r), body.CurrentPassword, body.NewPassword); err != nil {
+			handleError(w, err2Problem(err))
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func assignRole(svc service.UserService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body AssignRoleJSONRequestBody
+		if p, err := decodeRequest(r, &body); err != nil {
+			handleError(w, p)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), time.Second*10)
+		defer cancel()
+
+		role, ok := apiRole2Model(body.Role)
+		if !ok {
+			handleError(w, err2Problem(&service.ValidationErrors{Errors: []service.ValidationError{{
+				Name:   "role",
+				Reason: fmt.Sprintf("unknown role %q", body.Role),
+			}}}))
+			return
+		}
+
+		user, err := svc.AssignRole(ctx, userID(r), role)
+		if err != nil {
+			handleError(w, err2Problem(err))
+			return
+		}
+
+		writeUser(w, user)
+	}
+}
+
+func verifyEMail(svc service.UserService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body VerifyEmailJSONRequestBody
+		if p, err := decodeRequest(r, &body); err != nil {
+			handleError(w, p)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), time.Second*10)
+		defer cancel()
+
+		if err := svc.VerifyEMail(ctx, userID(r), body.Token); err != nil {
+			handleError(w, err2Problem(err))
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func resendVerification(svc service.UserService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), time.Second*10)
+		defer cancel()
+
+		if err := svc.ResendVerification(ctx, userID(r)); err != nil {
+			handleError(w, err2Problem(err))
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+func enrollMFA(svc service.UserService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), time.Second*10)
+		defer cancel()
+
+		enrollment, err := svc.EnrollMFA(ctx, userID(r))
+		if err != nil {
+			handleError(w, err2Problem(err))
+			return
+		}
+
+		writeSecret(w, http.StatusOK, MFAEnrollment{Secret: enrollment.Secret, ProvisioningUri: enrollment.URI})
+	}
+}
+
+func confirmMFA(svc service.UserService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body ConfirmMfaJSONRequestBody
+		if p, err := decodeRequest(r, &body); err != nil {
+			handleError(w, p)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), time.Second*10)
+		defer cancel()
+
+		codes, err := svc.ConfirmMFA(ctx, userID(r), body.Code)
+		if err != nil {
+			handleError(w, err2Problem(err))
+			return
+		}
+
+		writeSecret(w, http.StatusOK, RecoveryCodes{RecoveryCodes: codes})
+	}
+}
+
+func disableMFA(svc service.UserService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body DisableMfaJSONRequestBody
+		if p, err := decodeRequest(r, &body); err != nil {
+			handleError(w, p)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), time.Second*10)
+		defer cancel()
+
+		if err := svc.DisableMFA(ctx, userID(r), body.Code); err != nil {
+			handleError(w, err2Problem(err))
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func createAPIKey(svc service.UserService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body CreateApiKeyJSONRequestBody
+		if p, err := decodeRequest(r, &body); err != nil {
+			handleError(w, p)
+			return
+		}
+
+		var scopes []model.Scope
+		if body.Scopes != nil {
+			for _, scope := range *body.Scopes {
+				scopes = append(scopes, model.Scope(scope))
+			}
+		}
+
+		var expiresAt time.Time
+		if body.ExpiresAt != nil {
+			expiresAt = *body.ExpiresAt
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), time.Second*10)
+		defer cancel()
+
+		apiKey, key, err := svc.CreateAPIKey(ctx, userID(r), body.Name, scopes, expiresAt)
+		if err != nil {
+			handleError(w, err2Problem(err))
+			return
+		}
+
+		writeSecret(w, http.StatusCreated, CreatedAPIKey{APIKey: newAPIKey(apiKey), Key: key})
+	}
+}
+
+func listAPIKeys(svc service.UserService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), time.Second*10)
+		defer cancel()
+
+		keys, err := svc.ListAPIKeys(ctx, userID(r))
 		if err != nil {
 			handleError(w, err2Problem(err))
 			return
 		}
 
+		list := APIKeyList{ApiKeys: make([]APIKey, 0, len(keys))}
+		for _, k := range keys {
+			list.ApiKeys = append(list.ApiKeys, newAPIKey(k))
+		}
+
 		w.Header().Set("Content-Type", "application/json; charset=utf-8")
 		w.WriteHeader(http.StatusOK)
-		if err = json.NewEncoder(w).Encode(&User{
-			Email: user.EMail,
-			Id:    user.ID,
-			Name:  user.Name,
-		}); err != nil {
+		if err = json.NewEncoder(w).Encode(&list); err != nil {
 			panic("failed to encode json")
 		}
 	}
 }
 
+func revokeAPIKey(svc service.UserService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), time.Second*10)
+		defer cancel()
+
+		if err := svc.RevokeAPIKey(ctx, userID(r), subresourceID(r)); err != nil {
+			handleError(w, err2Problem(err))
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// newAPIKey returns the response body of given key, the hash isn't part of it
+func newAPIKey(key *model.APIKey) APIKey {
+	body := APIKey{
+		CreatedAt: key.CreatedAt,
+		Id:        key.ID,
+		Name:      key.Name,
+		Prefix:    key.Prefix,
+		Scopes:    make([]Scope, 0, len(key.Scopes)),
+	}
+	for _, scope := range key.Scopes {
+		body.Scopes = append(body.Scopes, Scope(scope))
+	}
+	if !key.ExpiresAt.IsZero() {
+		expiresAt := key.ExpiresAt
+		body.ExpiresAt = &expiresAt
+	}
+
+	return body
+}
+
+// writeSecret responds with given body encoded as JSON, it's shown once and must not be cached
+func writeSecret(w http.ResponseWriter, code int, body interface{}) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		panic("failed to encode json")
+	}
+}
+
+// hostOf returns the host of a host:port address, addresses without port are returned as they are
+func hostOf(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+// changeStatus returns a handler moving the user to another status with given operation
+func changeStatus(change func(ctx context.Context, id string) (*model.User, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), time.Second*10)
+		defer cancel()
+
+		user, err := change(ctx, userID(r))
+		if err != nil {
+			handleError(w, err2Problem(err))
+			return
+		}
+
+		writeUser(w, user)
+	}
+}
+
+// parseIfMatch extracts the version from an If-Match header,
+// an absent header or * match every version and result in 0
+func parseIfMatch(ifMatch string) (int64, bool) {
+	ifMatch = strings.TrimSpace(ifMatch)
+	if ifMatch == "" || ifMatch == "*" {
+		return 0, true
+	}
+
+	// only a single strong entity tag is supported
+	if len(ifMatch) < 3 || ifMatch[0] != '"' || ifMatch[len(ifMatch)-1] != '"' {
+		return 0, false
+	}
+
+	version, err := strconv.ParseInt(ifMatch[1:len(ifMatch)-1], 10, 64)
+	if err != nil || version < 1 {
+		return 0, false
+	}
+
+	return version, true
+}
+
+// apiRole2Model maps a role of the http api to the one of the model, ok is false for unknown roles
+func apiRole2Model(role Role) (model.Role, bool) {
+	switch role {
+	case RoleADMIN:
+		return model.Admin, true
+	case RoleREPORTER:
+		return model.Reporter, true
+	case RoleREGULAR:
+		return model.Regular, true
+	default:
+		return "", false
+	}
+}
+
+// modelRole2Api maps a role of the model to the one of the http api,
+// roles unknown to the api result in an empty one
+func modelRole2Api(role model.Role) Role {
+	switch role {
+	case model.Admin:
+		return RoleADMIN
+	case model.Reporter:
+		return RoleREPORTER
+	case model.Regular:
+		return RoleREGULAR
+	default:
+		return ""
+	}
+}
+
+// etag returns the entity tag of given user's version
+func etag(user *model.User) string {
+	return strconv.Quote(strconv.FormatInt(user.Version, 10))
+}
+
+// newUser maps an user of the model to the one of the http api
+func newUser(user *model.User) User {
+	body := User{
+		Email:         user.EMail,
+		EmailVerified: user.EMailVerified,
+		Id:            user.ID,
+		MfaEnabled:    user.MFAEnabled,
+		Name:          user.Name,
+		Status:        Status(user.Status),
+	}
+	if role := modelRole2Api(user.Role); role != "" {
+		body.Role = &role
+	}
+	// the service clears the failed logins for callers other than admins
+	if user.FailedLogins > 0 {
+		body.FailedLogins = &user.FailedLogins
+	}
+	if !user.LockedUntil.IsZero() {
+		body.LockedUntil = &user.LockedUntil
+	}
+
+	return body
+}
+
+// writeUser responds with given user encoded as JSON
+func writeUser(w http.ResponseWriter, user *model.User) {
+	body := newUser(user)
+
+	w.Header().Set("ETag", etag(user))
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(&body); err != nil {
+		panic("failed to encode json")
+	}
+}
+
 func decodeRequest(r *http.Request, v interface{}) (*Problem, error) {
 	err := json.NewDecoder(r.Body).Decode(v)
 	if err != nil {
@@ -117,6 +952,144 @@ func err2Problem(err error) *Problem {
 			Title:  http.StatusText(http.StatusNotFound),
 			Detail: "user with given id doesn't exist",
 		}
+	} else if errors.Is(err, service.ErrVersionMismatch) {
+		p = Problem{
+			Status: http.StatusPreconditionFailed,
+			Title:  http.StatusText(http.StatusPreconditionFailed),
+			Detail: "user has been modified in the meantime",
+		}
+	} else if errors.Is(err, service.ErrConcurrentModification) {
+		p = Problem{
+			Status: http.StatusConflict,
+			Title:  http.StatusText(http.StatusConflict),
+			Detail: "user has been modified concurrently, try again",
+		}
+	} else if errors.Is(err, service.ErrInvalidCredentials) {
+		p = Problem{
+			Status: http.StatusUnauthorized,
+			Title:  http.StatusText(http.StatusUnauthorized),
+			Detail: "invalid credentials",
+		}
+	} else if errors.Is(err, service.ErrUnauthenticated) {
+		p = Problem{
+			Status: http.StatusUnauthorized,
+			Title:  http.StatusText(http.StatusUnauthorized),
+			Detail: "authentication required",
+		}
+	} else if errors.Is(err, service.ErrForbidden) {
+		p = Problem{
+			Status: http.StatusForbidden,
+			Title:  http.StatusText(http.StatusForbidden),
+			Detail: "not allowed to perform this operation",
+		}
+	} else if errors.Is(err, service.ErrInvalidVerificationToken) {
+		p = Problem{
+			Status: http.StatusBadRequest,
+			Title:  http.StatusText(http.StatusBadRequest),
+			Detail: "invalid or expired verification token",
+		}
+	} else if errors.Is(err, service.ErrInvalidResetToken) {
+		p = Problem{
+			Status: http.StatusBadRequest,
+			Title:  http.StatusText(http.StatusBadRequest),
+			Detail: "invalid, expired or already used password reset token",
+		}
+	} else if errors.Is(err, service.ErrEMailAlreadyVerified) {
+		p = Problem{
+			Status: http.StatusConflict,
+			Title:  http.StatusText(http.StatusConflict),
+			Detail: "email address has already been verified",
+		}
+	} else if errors.Is(err, service.ErrTooManyRequests) {
+		p = Problem{
+			Status: http.StatusTooManyRequests,
+			Title:  http.StatusText(http.StatusTooManyRequests),
+			Detail: "too many requests, try again later",
+		}
+	} else if errors.Is(err, service.ErrLastAdmin) {
+		p = Problem{
+			Status: http.StatusConflict,
+			Title:  http.StatusText(http.StatusConflict),
+			Detail: "the last admin can't be deleted or demoted",
+		}
+	} else if errors.Is(err, service.ErrAdminNotSuspendable) {
+		p = Problem{
+			Status: http.StatusConflict,
+			Title:  http.StatusText(http.StatusConflict),
+			Detail: "admins can't be suspended or locked, revoke the role first",
+		}
+	} else if terr := (*service.TransitionError)(nil); errors.As(err, &terr) {
+		p = Problem{
+			Status: http.StatusConflict,
+			Title:  http.StatusText(http.StatusConflict),
+			Detail: terr.Error(),
+		}
+	} else if errors.Is(err, service.ErrUserSuspended) {
+		p = Problem{
+			Status: http.StatusForbidden,
+			Title:  http.StatusText(http.StatusForbidden),
+			Detail: "user has been suspended",
+		}
+	} else if errors.Is(err, service.ErrUserLocked) {
+		p = Problem{
+			Status: http.StatusForbidden,
+			Title:  http.StatusText(http.StatusForbidden),
+			Detail: "user has been locked",
+		}
+	} else if errors.Is(err, service.ErrTooManyFailedLogins) {
+		p = Problem{
+			Status: http.StatusTooManyRequests,
+			Title:  http.StatusText(http.StatusTooManyRequests),
+			Detail: "too many failed logins, try again later",
+		}
+	} else if errors.Is(err, service.ErrMFARequired) {
+		p = Problem{
+			Status: http.StatusForbidden,
+			Title:  http.StatusText(http.StatusForbidden),
+			Detail: "admins have to enable multi-factor authentication and log in with it",
+		}
+	} else if errors.Is(err, service.ErrMFAAlreadyEnabled) {
+		p = Problem{
+			Status: http.StatusConflict,
+			Title:  http.StatusText(http.StatusConflict),
+			Detail: "multi-factor authentication has already been enabled",
+		}
+	} else if errors.Is(err, service.ErrMFANotEnrolled) {
+		p = Problem{
+			Status: http.StatusConflict,
+			Title:  http.StatusText(http.StatusConflict),
+			Detail: "no authenticator has been enrolled",
+		}
+	} else if errors.Is(err, service.ErrInvalidMFACode) {
+		p = Problem{
+			Status: http.StatusBadRequest,
+			Title:  http.StatusText(http.StatusBadRequest),
+			Detail: "invalid code",
+		}
+	} else if errors.Is(err, service.ErrInvalidMFAToken) {
+		p = Problem{
+			Status: http.StatusUnauthorized,
+			Title:  http.StatusText(http.StatusUnauthorized),
+			Detail: "invalid or expired mfa token, log in again",
+		}
+	} else if errors.Is(err, service.ErrInvalidAPIKey) {
+		p = Problem{
+			Status: http.StatusUnauthorized,
+			Title:  http.StatusText(http.StatusUnauthorized),
+			Detail: "invalid, expired or revoked api key",
+		}
+	} else if errors.Is(err, service.ErrAPIKeyNotFound) {
+		p = Problem{
+			Status: http.StatusNotFound,
+			Title:  http.StatusText(http.StatusNotFound),
+			Detail: "api key with given id doesn't exist",
+		}
+	} else if errors.Is(err, service.ErrInvalidRefreshToken) || errors.Is(err, service.ErrRefreshTokenReused) {
+		p = Problem{
+			Status: http.StatusUnauthorized,
+			Title:  http.StatusText(http.StatusUnauthorized),
+			Detail: "invalid refresh token",
+		}
 	} else {
 		p = Problem{
 			Status: http.StatusInternalServerError,
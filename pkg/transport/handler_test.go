@@ -2,12 +2,16 @@ package transport
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
+	"github.com/status-owl/user-service/pkg/auth"
 	"github.com/status-owl/user-service/pkg/model"
 	"github.com/status-owl/user-service/pkg/service"
 	"github.com/stretchr/testify/assert"
@@ -28,9 +32,10 @@ func TestFindUserByID(t *testing.T) {
 			name: "should respond with 200 for a valid user",
 			id:   "123",
 			user: &model.User{
-				ID:    "123",
-				Name:  "John",
-				EMail: "john@example.com",
+				ID:      "123",
+				Name:    "John",
+				EMail:   "john@example.com",
+				Version: 2,
 			},
 			err:  nil,
 			code: http.StatusOK,
@@ -87,6 +92,7 @@ func TestFindUserByID(t *testing.T) {
 				a.Nil(err)
 
 				a.Equal("application/json; charset=utf-8", rr.Header().Get("content-type"))
+				a.Equal(`"2"`, rr.Header().Get("ETag"))
 				a.Equal(*expectedResponse, actualResponse)
 
 			case *Problem:
@@ -102,3 +108,1505 @@ func TestFindUserByID(t *testing.T) {
 		})
 	}
 }
+
+func TestUpdateUser(t *testing.T) {
+	tests := []struct {
+		name    string
+		id      string
+		ifMatch string
+		body    string
+		// expected update passed to the user service, nil if the service isn't called
+		update *model.UserUpdate
+		// user service return parameters
+		user *model.User
+		err  error
+		// want
+		code     int
+		etag     string
+		response interface{}
+	}{
+		{
+			name:    "should respond with 200 and the updated user",
+			id:      "123",
+			ifMatch: `"3"`,
+			body:    `{"name": "Johnny"}`,
+			update:  &model.UserUpdate{Name: "Johnny", Version: 3},
+			user: &model.User{
+				ID:      "123",
+				Name:    "Johnny",
+				EMail:   "john@example.com",
+				Version: 4,
+			},
+			code: http.StatusOK,
+			etag: `"4"`,
+			response: &User{
+				Email: "john@example.com",
+				Id:    "123",
+				Name:  "Johnny",
+			},
+		},
+		{
+			name:   "should respond with 400 if the email address is in use",
+			id:     "123",
+			body:   `{"email": "mary@example.com"}`,
+			update: &model.UserUpdate{EMail: "mary@example.com"},
+			err:    service.ErrEmailInUse,
+			code:   http.StatusBadRequest,
+			response: &Problem{
+				Status: http.StatusBadRequest,
+				Title:  http.StatusText(http.StatusBadRequest),
+				InvalidParams: &[]InvalidParam{
+					{Name: "email", Reason: "user with this email address already exists"},
+				},
+			},
+		},
+		{
+			name:   "should respond with 404 if no user is available",
+			id:     "123",
+			body:   `{"name": "Johnny", "email": "johnny@example.com"}`,
+			update: &model.UserUpdate{Name: "Johnny", EMail: "johnny@example.com"},
+			err:    service.ErrUserNotFound,
+			code:   http.StatusNotFound,
+			response: &Problem{
+				Detail: "user with given id doesn't exist",
+				Status: http.StatusNotFound,
+				Title:  http.StatusText(http.StatusNotFound),
+			},
+		},
+		{
+			name:    "should respond with 412 if the user has been modified in the meantime",
+			id:      "123",
+			ifMatch: `"3"`,
+			body:    `{"name": "Johnny"}`,
+			update:  &model.UserUpdate{Name: "Johnny", Version: 3},
+			err:     service.ErrVersionMismatch,
+			code:    http.StatusPreconditionFailed,
+			response: &Problem{
+				Detail: "user has been modified in the meantime",
+				Status: http.StatusPreconditionFailed,
+				Title:  http.StatusText(http.StatusPreconditionFailed),
+			},
+		},
+		{
+			name:    "should respond with 412 if If-Match is malformed",
+			id:      "123",
+			ifMatch: `W/"3"`,
+			body:    `{"name": "Johnny"}`,
+			code:    http.StatusPreconditionFailed,
+			response: &Problem{
+				Detail: "If-Match doesn't contain a valid ETag",
+				Status: http.StatusPreconditionFailed,
+				Title:  http.StatusText(http.StatusPreconditionFailed),
+			},
+		},
+		{
+			name:   "should respond with 409 if the user has been modified concurrently",
+			id:     "123",
+			body:   `{"name": "Johnny"}`,
+			update: &model.UserUpdate{Name: "Johnny"},
+			err:    service.ErrConcurrentModification,
+			code:   http.StatusConflict,
+			response: &Problem{
+				Detail: "user has been modified concurrently, try again",
+				Status: http.StatusConflict,
+				Title:  http.StatusText(http.StatusConflict),
+			},
+		},
+		{
+			name: "should respond with 400 if the payload is no JSON",
+			id:   "123",
+			body: `name=Johnny`,
+			code: http.StatusBadRequest,
+			response: &Problem{
+				Detail: "unexpected payload, expected JSON: invalid character 'a' in literal null (expecting 'u')",
+				Status: http.StatusBadRequest,
+				Title:  http.StatusText(http.StatusBadRequest),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+
+			req, err := http.NewRequest(http.MethodPatch, "/users/"+tt.id, strings.NewReader(tt.body))
+			a.Nil(err)
+			if tt.ifMatch != "" {
+				req.Header.Set("If-Match", tt.ifMatch)
+			}
+
+			rr := httptest.NewRecorder()
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			svc := service.NewMockUserService(ctrl)
+			if tt.update != nil {
+				svc.
+					EXPECT().
+					Update(gomock.Any(), gomock.Eq(tt.id), gomock.Eq(*tt.update)).
+					Return(tt.user, tt.err)
+			}
+
+			NewBaseHTTPHandler(svc).ServeHTTP(rr, req)
+
+			a.Equal(tt.code, rr.Code)
+			a.Equal(tt.etag, rr.Header().Get("ETag"))
+
+			switch expectedResponse := tt.response.(type) {
+			case *User:
+				var actualResponse User
+				a.Nil(json.NewDecoder(rr.Body).Decode(&actualResponse))
+				a.Equal("application/json; charset=utf-8", rr.Header().Get("content-type"))
+				a.Equal(*expectedResponse, actualResponse)
+			case *Problem:
+				var actualResponse Problem
+				a.Nil(json.NewDecoder(rr.Body).Decode(&actualResponse))
+				a.Equal("application/problem+json; charset=utf-8", rr.Header().Get("content-type"))
+				a.Equal(*expectedResponse, actualResponse)
+			default:
+				panic("unexpected response type")
+			}
+		})
+	}
+}
+
+func TestUserMethodNotAllowed(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	req, err := http.NewRequest(http.MethodPut, "/users/123", nil)
+	assert.Nil(t, err)
+
+	rr := httptest.NewRecorder()
+	NewBaseHTTPHandler(service.NewMockUserService(ctrl)).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+	assert.Equal(t, "GET, PATCH", rr.Header().Get("Allow"))
+}
+
+func TestListUsers(t *testing.T) {
+	created := time.Date(2021, 12, 24, 18, 0, 0, 0, time.UTC)
+	admin := RoleADMIN
+	tests := []struct {
+		name  string
+		query string
+		// expected query passed to the user service, nil if the service isn't called
+		userQuery *model.UserQuery
+		// user service return parameters
+		page *model.UserPage
+		err  error
+		// want
+		code     int
+		response interface{}
+	}{
+		{
+			name:      "should respond with 200 and the first page",
+			query:     "",
+			userQuery: &model.UserQuery{},
+			page: &model.UserPage{
+				Users: []*model.User{
+					{ID: "123", Name: "John", EMail: "john@example.com"},
+					{ID: "456", Name: "Mary", EMail: "mary@example.com"},
+				},
+			},
+			code: http.StatusOK,
+			response: &UserList{
+				Users: []User{
+					{Id: "123", Name: "John", Email: "john@example.com"},
+					{Id: "456", Name: "Mary", Email: "mary@example.com"},
+				},
+			},
+		},
+		{
+			name:  "should respond with 200 and link the next page",
+			query: "?role=ADMIN&status=ACTIVE&email=jo&name=doe&sort=-name&limit=1&created_after=2021-12-24T18:00:00Z",
+			userQuery: &model.UserQuery{
+				Filter: model.UserFilter{
+					Role:         model.Admin,
+					Status:       model.Active,
+					EMailPrefix:  "jo",
+					NameContains: "doe",
+					CreatedAfter: created,
+				},
+				SortBy:     model.SortByName,
+				Descending: true,
+				Limit:      1,
+			},
+			page: &model.UserPage{
+				Users:      []*model.User{{ID: "123", Name: "John Doe", EMail: "john@example.com", Role: model.Admin, Status: model.Active}},
+				NextCursor: "abc",
+			},
+			code: http.StatusOK,
+			response: &UserList{
+				Users: []User{{Id: "123", Name: "John Doe", Email: "john@example.com", Role: &admin, Status: StatusACTIVE}},
+				Next: func(s string) *string { return &s }(
+					"/users?created_after=2021-12-24T18%3A00%3A00Z&cursor=abc&email=jo&limit=1&name=doe&role=ADMIN&sort=-name&status=ACTIVE",
+				),
+			},
+		},
+		{
+			name:  "should respond with 400 if parameters are malformed",
+			query: "?sort=role&limit=many&created_before=yesterday&role=UNDEFINED",
+			code:  http.StatusBadRequest,
+			response: &Problem{
+				Detail: "One of the parameters is invalid",
+				Status: http.StatusBadRequest,
+				Title:  http.StatusText(http.StatusBadRequest),
+				InvalidParams: &[]InvalidParam{
+					{Name: "created_before", Reason: "time must be given in RFC 3339 format"},
+					{Name: "limit", Reason: "limit must be a positive number"},
+					{Name: "role", Reason: `unknown role "UNDEFINED"`},
+					{Name: "sort", Reason: `users can't be sorted by "role"`},
+				},
+			},
+		},
+		{
+			name:      "should respond with 400 if the service rejects the query",
+			query:     "?cursor=abc",
+			userQuery: &model.UserQuery{Cursor: "abc"},
+			err: &service.ValidationErrors{Errors: []service.ValidationError{
+				{Name: "cursor", Reason: "invalid cursor"},
+			}},
+			code: http.StatusBadRequest,
+			response: &Problem{
+				Detail: "One of the parameters is invalid",
+				Status: http.StatusBadRequest,
+				Title:  http.StatusText(http.StatusBadRequest),
+				InvalidParams: &[]InvalidParam{
+					{Name: "cursor", Reason: "invalid cursor"},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+
+			req, err := http.NewRequest(http.MethodGet, "/users"+tt.query, nil)
+			a.Nil(err)
+
+			rr := httptest.NewRecorder()
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			svc := service.NewMockUserService(ctrl)
+			if tt.userQuery != nil {
+				svc.
+					EXPECT().
+					List(gomock.Any(), gomock.Eq(*tt.userQuery)).
+					Return(tt.page, tt.err)
+			}
+
+			NewBaseHTTPHandler(svc).ServeHTTP(rr, req)
+
+			a.Equal(tt.code, rr.Code)
+
+			switch expectedResponse := tt.response.(type) {
+			case *UserList:
+				var actualResponse UserList
+				a.Nil(json.NewDecoder(rr.Body).Decode(&actualResponse))
+				a.Equal("application/json; charset=utf-8", rr.Header().Get("content-type"))
+				a.Equal(*expectedResponse, actualResponse)
+			case *Problem:
+				var actualResponse Problem
+				a.Nil(json.NewDecoder(rr.Body).Decode(&actualResponse))
+				a.Equal("application/problem+json; charset=utf-8", rr.Header().Get("content-type"))
+				a.Equal(*expectedResponse, actualResponse)
+			default:
+				panic("unexpected response type")
+			}
+		})
+	}
+}
+
+func TestChangeUserPassword(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		body string
+		// whether the user service is called
+		called bool
+		// user service return parameters
+		err error
+		// want
+		code     int
+		response *Problem
+	}{
+		{
+			name:   "should respond with 204 on success",
+			path:   "/users/123/password",
+			body:   `{"current_password": "old", "new_password": "new"}`,
+			called: true,
+			code:   http.StatusNoContent,
+		},
+		{
+			name:   "should respond with 403 if the caller isn't allowed to",
+			path:   "/users/123/password",
+			body:   `{"current_password": "old", "new_password": "new"}`,
+			called: true,
+			err:    service.ErrForbidden,
+			code:   http.StatusForbidden,
+			response: &Problem{
+				Detail: "not allowed to perform this operation",
+				Status: http.StatusForbidden,
+				Title:  http.StatusText(http.StatusForbidden),
+			},
+		},
+		{
+			name:   "should respond with 401 if the current password doesn't match",
+			path:   "/users/123/password",
+			body:   `{"current_password": "old", "new_password": "new"}`,
+			called: true,
+			err:    service.ErrInvalidCredentials,
+			code:   http.StatusUnauthorized,
+			response: &Problem{
+				Detail: "invalid credentials",
+				Status: http.StatusUnauthorized,
+				Title:  http.StatusText(http.StatusUnauthorized),
+			},
+		},
+		{
+			name:   "should respond with 404 if no user is available",
+			path:   "/users/123/password",
+			body:   `{"current_password": "old", "new_password": "new"}`,
+			called: true,
+			err:    service.ErrUserNotFound,
+			code:   http.StatusNotFound,
+			response: &Problem{
+				Detail: "user with given id doesn't exist",
+				Status: http.StatusNotFound,
+				Title:  http.StatusText(http.StatusNotFound),
+			},
+		},
+		{
+			name: "should respond with 404 for unknown subresources",
+			path: "/users/123/passwords",
+			body: `{"current_password": "old", "new_password": "new"}`,
+			code: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+
+			req, err := http.NewRequest(http.MethodPut, tt.path, strings.NewReader(tt.body))
+			a.Nil(err)
+
+			rr := httptest.NewRecorder()
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			svc := service.NewMockUserService(ctrl)
+			if tt.called {
+				svc.
+					EXPECT().
+					ChangePassword(gomock.Any(), "123", "old", "new").
+					Return(tt.err)
+			}
+
+			NewBaseHTTPHandler(svc).ServeHTTP(rr, req)
+
+			a.Equal(tt.code, rr.Code)
+			if tt.response != nil {
+				var actualResponse Problem
+				a.Nil(json.NewDecoder(rr.Body).Decode(&actualResponse))
+				a.Equal(*tt.response, actualResponse)
+			}
+		})
+	}
+}
+
+func TestAssignUserRole(t *testing.T) {
+	reporter := RoleREPORTER
+
+	tests := []struct {
+		name string
+		body string
+		// whether the user service is called
+		called bool
+		// user service return parameters
+		user *model.User
+		err  error
+		// want
+		code     int
+		response interface{}
+	}{
+		{
+			name:   "should respond with 200 and the user on success",
+			body:   `{"role": "REPORTER"}`,
+			called: true,
+			user:   &model.User{ID: "123", Name: "John", EMail: "john@example.com", Role: model.Reporter, Version: 2},
+			code:   http.StatusOK,
+			response: &User{
+				Email: "john@example.com",
+				Id:    "123",
+				Name:  "John",
+				Role:  &reporter,
+			},
+		},
+		{
+			name:   "should respond with 400 for unknown roles",
+			body:   `{"role": "REPORTER"}`,
+			called: true,
+			err: &service.ValidationErrors{Errors: []service.ValidationError{
+				{Name: "role", Reason: "unknown role"},
+			}},
+			code: http.StatusBadRequest,
+			response: &Problem{
+				Detail:        "One of the parameters is invalid",
+				Status:        http.StatusBadRequest,
+				Title:         http.StatusText(http.StatusBadRequest),
+				InvalidParams: &[]InvalidParam{{Name: "role", Reason: "unknown role"}},
+			},
+		},
+		{
+			name: "should respond with 400 for roles unknown to the api",
+			body: `{"role": "UNDEFINED"}`,
+			code: http.StatusBadRequest,
+			response: &Problem{
+				Detail:        "One of the parameters is invalid",
+				Status:        http.StatusBadRequest,
+				Title:         http.StatusText(http.StatusBadRequest),
+				InvalidParams: &[]InvalidParam{{Name: "role", Reason: `unknown role "UNDEFINED"`}},
+			},
+		},
+		{
+			name:   "should respond with 403 if the caller isn't an admin",
+			body:   `{"role": "REPORTER"}`,
+			called: true,
+			err:    service.ErrForbidden,
+			code:   http.StatusForbidden,
+			response: &Problem{
+				Detail: "not allowed to perform this operation",
+				Status: http.StatusForbidden,
+				Title:  http.StatusText(http.StatusForbidden),
+			},
+		},
+		{
+			name:   "should respond with 409 if the last admin would be demoted",
+			body:   `{"role": "REPORTER"}`,
+			called: true,
+			err:    service.ErrLastAdmin,
+			code:   http.StatusConflict,
+			response: &Problem{
+				Detail: "the last admin can't be deleted or demoted",
+				Status: http.StatusConflict,
+				Title:  http.StatusText(http.StatusConflict),
+			},
+		},
+		{
+			name:   "should respond with 404 if no user is available",
+			body:   `{"role": "REPORTER"}`,
+			called: true,
+			err:    service.ErrUserNotFound,
+			code:   http.StatusNotFound,
+			response: &Problem{
+				Detail: "user with given id doesn't exist",
+				Status: http.StatusNotFound,
+				Title:  http.StatusText(http.StatusNotFound),
+			},
+		},
+		{
+			name: "should respond with 400 for malformed payloads",
+			body: `role=REPORTER`,
+			code: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+
+			req, err := http.NewRequest(http.MethodPut, "/users/123/role", strings.NewReader(tt.body))
+			a.Nil(err)
+
+			rr := httptest.NewRecorder()
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			svc := service.NewMockUserService(ctrl)
+			if tt.called {
+				svc.
+					EXPECT().
+					AssignRole(gomock.Any(), "123", model.Reporter).
+					Return(tt.user, tt.err)
+			}
+
+			NewBaseHTTPHandler(svc).ServeHTTP(rr, req)
+
+			a.Equal(tt.code, rr.Code)
+
+			switch expectedResponse := tt.response.(type) {
+			case *User:
+				var actualResponse User
+				a.Nil(json.NewDecoder(rr.Body).Decode(&actualResponse))
+				a.Equal(`"2"`, rr.Header().Get("ETag"))
+				a.Equal(*expectedResponse, actualResponse)
+			case *Problem:
+				var actualResponse Problem
+				a.Nil(json.NewDecoder(rr.Body).Decode(&actualResponse))
+				a.Equal(*expectedResponse, actualResponse)
+			}
+		})
+	}
+}
+
+func TestChangeUserStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		// user service return parameters
+		user *model.User
+		err  error
+		// want
+		code     int
+		response interface{}
+	}{
+		{
+			name: "should respond with 200 and the user on success",
+			user: &model.User{ID: "123", Name: "John", EMail: "john@example.com", Status: model.Suspended, Version: 2},
+			code: http.StatusOK,
+			response: &User{
+				Email:  "john@example.com",
+				Id:     "123",
+				Name:   "John",
+				Status: StatusSUSPENDED,
+			},
+		},
+		{
+			name: "should respond with 409 if the transition isn't allowed",
+			err:  &service.TransitionError{From: model.Suspended, To: model.Suspended},
+			code: http.StatusConflict,
+			response: &Problem{
+				Detail: "user can't change from status SUSPENDED to SUSPENDED",
+				Status: http.StatusConflict,
+				Title:  http.StatusText(http.StatusConflict),
+			},
+		},
+		{
+			name: "should respond with 409 for admins",
+			err:  service.ErrAdminNotSuspendable,
+			code: http.StatusConflict,
+			response: &Problem{
+				Detail: "admins can't be suspended or locked, revoke the role first",
+				Status: http.StatusConflict,
+				Title:  http.StatusText(http.StatusConflict),
+			},
+		},
+		{
+			name: "should respond with 404 if no user is available",
+			err:  service.ErrUserNotFound,
+			code: http.StatusNotFound,
+			response: &Problem{
+				Detail: "user with given id doesn't exist",
+				Status: http.StatusNotFound,
+				Title:  http.StatusText(http.StatusNotFound),
+			},
+		},
+	}
+
+	for _, operation := range []string{"suspend", "lock", "reactivate"} {
+		for _, tt := range tests {
+			t.Run(operation+" "+tt.name, func(t *testing.T) {
+				a := assert.New(t)
+
+				req, err := http.NewRequest(http.MethodPost, "/users/123/"+operation, nil)
+				a.Nil(err)
+
+				rr := httptest.NewRecorder()
+
+				ctrl := gomock.NewController(t)
+				defer ctrl.Finish()
+
+				svc := service.NewMockUserService(ctrl)
+				var call *gomock.Call
+				switch operation {
+				case "suspend":
+					call = svc.EXPECT().Suspend(gomock.Any(), "123")
+				case "lock":
+					call = svc.EXPECT().Lock(gomock.Any(), "123")
+				case "reactivate":
+					call = svc.EXPECT().Reactivate(gomock.Any(), "123")
+				}
+				call.Return(tt.user, tt.err)
+
+				NewBaseHTTPHandler(svc).ServeHTTP(rr, req)
+
+				a.Equal(tt.code, rr.Code)
+
+				switch expectedResponse := tt.response.(type) {
+				case *User:
+					var actualResponse User
+					a.Nil(json.NewDecoder(rr.Body).Decode(&actualResponse))
+					a.Equal(`"2"`, rr.Header().Get("ETag"))
+					a.Equal(*expectedResponse, actualResponse)
+				case *Problem:
+					var actualResponse Problem
+					a.Nil(json.NewDecoder(rr.Body).Decode(&actualResponse))
+					a.Equal(*expectedResponse, actualResponse)
+				}
+			})
+		}
+	}
+}
+
+func TestLoginUserClientIP(t *testing.T) {
+	a := assert.New(t)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	svc := service.NewMockUserService(ctrl)
+	svc.EXPECT().
+		Login(gomock.Any(), "john@example.com", "secret").
+		DoAndReturn(func(ctx context.Context, _, _ string) (*model.Token, error) {
+			ip, ok := auth.ClientIPFromContext(ctx)
+			a.True(ok)
+			a.Equal("192.0.2.1", ip, "the failed logins are tracked per peer address")
+			return nil, service.ErrInvalidCredentials
+		})
+
+	req, err := http.NewRequest(http.MethodPost, "/auth/token", strings.NewReader(`{"email": "john@example.com", "password": "secret"}`))
+	a.Nil(err)
+	req.RemoteAddr = "192.0.2.1:54321"
+
+	rr := httptest.NewRecorder()
+	NewBaseHTTPHandler(svc).ServeHTTP(rr, req)
+	a.Equal(http.StatusUnauthorized, rr.Code)
+}
+
+func TestUnlockUser(t *testing.T) {
+	a := assert.New(t)
+	lockedUntil := time.Date(2021, 12, 24, 18, 0, 0, 0, time.UTC)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	svc := service.NewMockUserService(ctrl)
+	svc.EXPECT().
+		Unlock(gomock.Any(), "123").
+		Return(&model.User{ID: "123", Name: "John", EMail: "john@example.com", Status: model.Active, Version: 2}, nil)
+	svc.EXPECT().
+		FindByID(gomock.Any(), "456").
+		Return(&model.User{ID: "456", Name: "Mary", EMail: "mary@example.com", Status: model.Active, Version: 2,
+			FailedLogins: 5, LockedUntil: lockedUntil}, nil)
+
+	req, err := http.NewRequest(http.MethodPost, "/users/123/unlock", nil)
+	a.Nil(err)
+	rr := httptest.NewRecorder()
+	NewBaseHTTPHandler(svc).ServeHTTP(rr, req)
+
+	a.Equal(http.StatusOK, rr.Code)
+	a.JSONEq(`{"id": "123", "name": "John", "email": "john@example.com", "email_verified": false, "status": "ACTIVE",
+		"mfa_enabled": false}`, rr.Body.String(), "users without failed logins omit them")
+
+	req, err = http.NewRequest(http.MethodGet, "/users/456", nil)
+	a.Nil(err)
+	rr = httptest.NewRecorder()
+	NewBaseHTTPHandler(svc).ServeHTTP(rr, req)
+
+	a.Equal(http.StatusOK, rr.Code)
+	a.JSONEq(`{"id": "456", "name": "Mary", "email": "mary@example.com", "email_verified": false, "status": "ACTIVE",
+		"mfa_enabled": false, "failed_logins": 5, "locked_until": "2021-12-24T18:00:00Z"}`, rr.Body.String())
+}
+
+func TestLoginUser(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		// whether the user service is called
+		called bool
+		// user service return parameters
+		token *model.Token
+		err   error
+		// want
+		code     int
+		response interface{}
+	}{
+		{
+			name:   "should respond with 200 and the access token",
+			body:   `{"email": "john@example.com", "password": "secret"}`,
+			called: true,
+			token:  &model.Token{AccessToken: "token", ExpiresAt: time.Now().Add(15 * time.Minute), RefreshToken: "refresh"},
+			code:   http.StatusOK,
+			response: &AccessToken{
+				AccessToken:  "token",
+				TokenType:    AccessTokenTokenTypeBearer,
+				ExpiresIn:    900,
+				RefreshToken: stringPtr("refresh"),
+			},
+		},
+		{
+			name:   "should respond with 202 and the challenge if the user has to pass a second factor",
+			body:   `{"email": "john@example.com", "password": "secret"}`,
+			called: true,
+			token:  &model.Token{MFAToken: "challenge", ExpiresAt: time.Now().Add(5 * time.Minute)},
+			code:   http.StatusAccepted,
+			response: &MFAChallenge{
+				MfaToken:  "challenge",
+				ExpiresIn: 300,
+			},
+		},
+		{
+			name:   "should respond with 401 if the credentials are invalid",
+			body:   `{"email": "john@example.com", "password": "secret"}`,
+			called: true,
+			err:    service.ErrInvalidCredentials,
+			code:   http.StatusUnauthorized,
+			response: &Problem{
+				Detail: "invalid credentials",
+				Status: http.StatusUnauthorized,
+				Title:  http.StatusText(http.StatusUnauthorized),
+			},
+		},
+		{
+			name:   "should respond with 429 if the user is locked out",
+			body:   `{"email": "john@example.com", "password": "secret"}`,
+			called: true,
+			err:    service.ErrTooManyFailedLogins,
+			code:   http.StatusTooManyRequests,
+			response: &Problem{
+				Detail: "too many failed logins, try again later",
+				Status: http.StatusTooManyRequests,
+				Title:  http.StatusText(http.StatusTooManyRequests),
+			},
+		},
+		{
+			name:   "should respond with 403 if the user has been suspended",
+			body:   `{"email": "john@example.com", "password": "secret"}`,
+			called: true,
+			err:    service.ErrUserSuspended,
+			code:   http.StatusForbidden,
+			response: &Problem{
+				Detail: "user has been suspended",
+				Status: http.StatusForbidden,
+				Title:  http.StatusText(http.StatusForbidden),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+
+			req, err := http.NewRequest(http.MethodPost, "/auth/token", strings.NewReader(tt.body))
+			a.Nil(err)
+
+			rr := httptest.NewRecorder()
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			svc := service.NewMockUserService(ctrl)
+			if tt.called {
+				svc.
+					EXPECT().
+					Login(gomock.Any(), "john@example.com", "secret").
+					Return(tt.token, tt.err)
+			}
+
+			NewBaseHTTPHandler(svc).ServeHTTP(rr, req)
+
+			a.Equal(tt.code, rr.Code)
+
+			switch expectedResponse := tt.response.(type) {
+			case *AccessToken:
+				var actualResponse AccessToken
+				a.Nil(json.NewDecoder(rr.Body).Decode(&actualResponse))
+				a.Equal("no-store", rr.Header().Get("Cache-Control"))
+				a.Equal(*expectedResponse, actualResponse)
+			case *MFAChallenge:
+				var actualResponse MFAChallenge
+				a.Nil(json.NewDecoder(rr.Body).Decode(&actualResponse))
+				a.Equal("no-store", rr.Header().Get("Cache-Control"))
+				a.Equal(*expectedResponse, actualResponse)
+			case *Problem:
+				var actualResponse Problem
+				a.Nil(json.NewDecoder(rr.Body).Decode(&actualResponse))
+				a.Equal(*expectedResponse, actualResponse)
+			default:
+				panic("unexpected response type")
+			}
+		})
+	}
+}
+
+func TestVerifyUserMFA(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		// whether the user service is called
+		called bool
+		// user service return parameters
+		token *model.Token
+		err   error
+		// want
+		code     int
+		response *Problem
+	}{
+		{
+			name:   "should respond with 200 and the access token",
+			body:   `{"mfa_token": "challenge", "code": "123456"}`,
+			called: true,
+			token:  &model.Token{AccessToken: "token", ExpiresAt: time.Now().Add(15 * time.Minute), RefreshToken: "refresh"},
+			code:   http.StatusOK,
+		},
+		{
+			name:   "should respond with 400 if the code is invalid",
+			body:   `{"mfa_token": "challenge", "code": "123456"}`,
+			called: true,
+			err:    service.ErrInvalidMFACode,
+			code:   http.StatusBadRequest,
+			response: &Problem{
+				Detail: "invalid code",
+				Status: http.StatusBadRequest,
+				Title:  http.StatusText(http.StatusBadRequest),
+			},
+		},
+		{
+			name:   "should respond with 401 if the challenge has expired",
+			body:   `{"mfa_token": "challenge", "code": "123456"}`,
+			called: true,
+			err:    service.ErrInvalidMFAToken,
+			code:   http.StatusUnauthorized,
+			response: &Problem{
+				Detail: "invalid or expired mfa token, log in again",
+				Status: http.StatusUnauthorized,
+				Title:  http.StatusText(http.StatusUnauthorized),
+			},
+		},
+		{
+			name: "should respond with 400 for malformed payloads",
+			body: `code=123456`,
+			code: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+
+			req, err := http.NewRequest(http.MethodPost, "/auth/mfa", strings.NewReader(tt.body))
+			a.Nil(err)
+			req.RemoteAddr = "192.0.2.1:54321"
+
+			rr := httptest.NewRecorder()
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			svc := service.NewMockUserService(ctrl)
+			if tt.called {
+				svc.
+					EXPECT().
+					VerifyMFA(gomock.Any(), "challenge", "123456").
+					DoAndReturn(func(ctx context.Context, _, _ string) (*model.Token, error) {
+						ip, _ := auth.ClientIPFromContext(ctx)
+						a.Equal("192.0.2.1", ip, "wrong codes are tracked per peer address")
+						return tt.token, tt.err
+					})
+			}
+
+			NewBaseHTTPHandler(svc).ServeHTTP(rr, req)
+
+			a.Equal(tt.code, rr.Code)
+			if tt.response != nil {
+				var actualResponse Problem
+				a.Nil(json.NewDecoder(rr.Body).Decode(&actualResponse))
+				a.Equal(*tt.response, actualResponse)
+			} else if tt.token != nil {
+				var actualResponse AccessToken
+				a.Nil(json.NewDecoder(rr.Body).Decode(&actualResponse))
+				a.Equal("token", actualResponse.AccessToken)
+			}
+		})
+	}
+}
+
+func TestEnrollUserMFA(t *testing.T) {
+	a := assert.New(t)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	svc := service.NewMockUserService(ctrl)
+	svc.EXPECT().
+		EnrollMFA(gomock.Any(), "123").
+		Return(&model.MFAEnrollment{Secret: "JBSWY3DPEHPK3PXP", URI: "otpauth://totp/x"}, nil)
+	svc.EXPECT().
+		EnrollMFA(gomock.Any(), "456").
+		Return(nil, service.ErrMFAAlreadyEnabled)
+	svc.EXPECT().
+		ConfirmMFA(gomock.Any(), "123", "123456").
+		Return([]string{"5f2a9-c03e1", "0b7d4-9e6a2"}, nil)
+	svc.EXPECT().
+		ConfirmMFA(gomock.Any(), "456", "123456").
+		Return(nil, service.ErrMFANotEnrolled)
+
+	req, err := http.NewRequest(http.MethodPost, "/users/123/mfa", nil)
+	a.Nil(err)
+	rr := httptest.NewRecorder()
+	NewBaseHTTPHandler(svc).ServeHTTP(rr, req)
+
+	a.Equal(http.StatusOK, rr.Code)
+	a.Equal("no-store", rr.Header().Get("Cache-Control"))
+	a.JSONEq(`{"secret": "JBSWY3DPEHPK3PXP", "provisioning_uri": "otpauth://totp/x"}`, rr.Body.String())
+
+	req, err = http.NewRequest(http.MethodPost, "/users/456/mfa", nil)
+	a.Nil(err)
+	rr = httptest.NewRecorder()
+	NewBaseHTTPHandler(svc).ServeHTTP(rr, req)
+	a.Equal(http.StatusConflict, rr.Code)
+
+	req, err = http.NewRequest(http.MethodPost, "/users/123/mfa/confirm", strings.NewReader(`{"code": "123456"}`))
+	a.Nil(err)
+	rr = httptest.NewRecorder()
+	NewBaseHTTPHandler(svc).ServeHTTP(rr, req)
+
+	a.Equal(http.StatusOK, rr.Code)
+	a.Equal("no-store", rr.Header().Get("Cache-Control"))
+	a.JSONEq(`{"recovery_codes": ["5f2a9-c03e1", "0b7d4-9e6a2"]}`, rr.Body.String())
+
+	req, err = http.NewRequest(http.MethodPost, "/users/456/mfa/confirm", strings.NewReader(`{"code": "123456"}`))
+	a.Nil(err)
+	rr = httptest.NewRecorder()
+	NewBaseHTTPHandler(svc).ServeHTTP(rr, req)
+	a.Equal(http.StatusConflict, rr.Code)
+}
+
+func TestDisableUserMFA(t *testing.T) {
+	a := assert.New(t)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	svc := service.NewMockUserService(ctrl)
+	svc.EXPECT().
+		DisableMFA(gomock.Any(), "123", "5f2a9-c03e1").
+		Return(nil)
+	svc.EXPECT().
+		DisableMFA(gomock.Any(), "123", "000000").
+		Return(service.ErrInvalidMFACode)
+
+	req, err := http.NewRequest(http.MethodPost, "/users/123/mfa/disable", strings.NewReader(`{"code": "5f2a9-c03e1"}`))
+	a.Nil(err)
+	rr := httptest.NewRecorder()
+	NewBaseHTTPHandler(svc).ServeHTTP(rr, req)
+	a.Equal(http.StatusNoContent, rr.Code)
+
+	req, err = http.NewRequest(http.MethodPost, "/users/123/mfa/disable", strings.NewReader(`{"code": "000000"}`))
+	a.Nil(err)
+	rr = httptest.NewRecorder()
+	NewBaseHTTPHandler(svc).ServeHTTP(rr, req)
+	a.Equal(http.StatusBadRequest, rr.Code)
+}
+
+func TestUserAPIKeys(t *testing.T) {
+	a := assert.New(t)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	createdAt := time.Date(2021, 12, 24, 18, 0, 0, 0, time.UTC)
+	expiresAt := createdAt.Add(24 * time.Hour)
+	apiKey := &model.APIKey{
+		ID:        "k1",
+		UserID:    "123",
+		Name:      "ci",
+		Prefix:    "sowl_abcdefgh",
+		Hash:      "secret hash",
+		Scopes:    []model.Scope{model.ScopeUsersRead},
+		CreatedAt: createdAt,
+		ExpiresAt: expiresAt,
+	}
+
+	svc := service.NewMockUserService(ctrl)
+	svc.EXPECT().
+		CreateAPIKey(gomock.Any(), "123", "ci", []model.Scope{model.ScopeUsersRead}, expiresAt).
+		Return(apiKey, "sowl_abcdefghijkl", nil)
+	svc.EXPECT().
+		ListAPIKeys(gomock.Any(), "123").
+		Return([]*model.APIKey{apiKey}, nil)
+	svc.EXPECT().
+		RevokeAPIKey(gomock.Any(), "123", "k1").
+		Return(nil)
+	svc.EXPECT().
+		RevokeAPIKey(gomock.Any(), "123", "k2").
+		Return(service.ErrAPIKeyNotFound)
+
+	req, err := http.NewRequest(http.MethodPost, "/users/123/api-keys",
+		strings.NewReader(`{"name": "ci", "scopes": ["users:read"], "expires_at": "2021-12-25T18:00:00Z"}`))
+	a.Nil(err)
+	rr := httptest.NewRecorder()
+	NewBaseHTTPHandler(svc).ServeHTTP(rr, req)
+
+	a.Equal(http.StatusCreated, rr.Code)
+	a.Equal("no-store", rr.Header().Get("Cache-Control"))
+	a.JSONEq(`{
+		"id": "k1",
+		"name": "ci",
+		"prefix": "sowl_abcdefgh",
+		"scopes": ["users:read"],
+		"created_at": "2021-12-24T18:00:00Z",
+		"expires_at": "2021-12-25T18:00:00Z",
+		"key": "sowl_abcdefghijkl"
+	}`, rr.Body.String())
+
+	req, err = http.NewRequest(http.MethodGet, "/users/123/api-keys", nil)
+	a.Nil(err)
+	rr = httptest.NewRecorder()
+	NewBaseHTTPHandler(svc).ServeHTTP(rr, req)
+
+	a.Equal(http.StatusOK, rr.Code)
+	a.JSONEq(`{"api_keys": [{
+		"id": "k1",
+		"name": "ci",
+		"prefix": "sowl_abcdefgh",
+		"scopes": ["users:read"],
+		"created_at": "2021-12-24T18:00:00Z",
+		"expires_at": "2021-12-25T18:00:00Z"
+	}]}`, rr.Body.String(), "neither the key nor its hash are listed")
+
+	req, err = http.NewRequest(http.MethodDelete, "/users/123/api-keys/k1", nil)
+	a.Nil(err)
+	rr = httptest.NewRecorder()
+	NewBaseHTTPHandler(svc).ServeHTTP(rr, req)
+	a.Equal(http.StatusNoContent, rr.Code)
+
+	req, err = http.NewRequest(http.MethodDelete, "/users/123/api-keys/k2", nil)
+	a.Nil(err)
+	rr = httptest.NewRecorder()
+	NewBaseHTTPHandler(svc).ServeHTTP(rr, req)
+	a.Equal(http.StatusNotFound, rr.Code)
+
+	for _, path := range []string{"/users/123/api-keys/", "/users/123/api-keys/k1/name"} {
+		req, err = http.NewRequest(http.MethodDelete, path, nil)
+		a.Nil(err)
+		rr = httptest.NewRecorder()
+		NewBaseHTTPHandler(svc).ServeHTTP(rr, req)
+		a.Equal(http.StatusNotFound, rr.Code, path)
+	}
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+func TestRefreshUserToken(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		// whether the user service is called
+		called bool
+		// user service return parameters
+		token *model.Token
+		err   error
+		// want
+		code     int
+		response interface{}
+	}{
+		{
+			name:   "should respond with 200 and the new tokens",
+			body:   `{"refresh_token": "refresh"}`,
+			called: true,
+			token:  &model.Token{AccessToken: "token", ExpiresAt: time.Now().Add(15 * time.Minute), RefreshToken: "next"},
+			code:   http.StatusOK,
+			response: &AccessToken{
+				AccessToken:  "token",
+				TokenType:    AccessTokenTokenTypeBearer,
+				ExpiresIn:    900,
+				RefreshToken: stringPtr("next"),
+			},
+		},
+		{
+			name:   "should respond with 401 if the refresh token is invalid",
+			body:   `{"refresh_token": "refresh"}`,
+			called: true,
+			err:    service.ErrInvalidRefreshToken,
+			code:   http.StatusUnauthorized,
+			response: &Problem{
+				Detail: "invalid refresh token",
+				Status: http.StatusUnauthorized,
+				Title:  http.StatusText(http.StatusUnauthorized),
+			},
+		},
+		{
+			name:   "should respond with 401 if the refresh token has been reused",
+			body:   `{"refresh_token": "refresh"}`,
+			called: true,
+			err:    service.ErrRefreshTokenReused,
+			code:   http.StatusUnauthorized,
+			response: &Problem{
+				Detail: "invalid refresh token",
+				Status: http.StatusUnauthorized,
+				Title:  http.StatusText(http.StatusUnauthorized),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+
+			req, err := http.NewRequest(http.MethodPost, "/auth/refresh", strings.NewReader(tt.body))
+			a.Nil(err)
+
+			rr := httptest.NewRecorder()
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			svc := service.NewMockUserService(ctrl)
+			if tt.called {
+				svc.
+					EXPECT().
+					Refresh(gomock.Any(), "refresh").
+					Return(tt.token, tt.err)
+			}
+
+			NewBaseHTTPHandler(svc).ServeHTTP(rr, req)
+
+			a.Equal(tt.code, rr.Code)
+
+			switch expectedResponse := tt.response.(type) {
+			case *AccessToken:
+				var actualResponse AccessToken
+				a.Nil(json.NewDecoder(rr.Body).Decode(&actualResponse))
+				a.Equal("no-store", rr.Header().Get("Cache-Control"))
+				a.Equal(*expectedResponse, actualResponse)
+			case *Problem:
+				var actualResponse Problem
+				a.Nil(json.NewDecoder(rr.Body).Decode(&actualResponse))
+				a.Equal(*expectedResponse, actualResponse)
+			default:
+				panic("unexpected response type")
+			}
+		})
+	}
+}
+
+func TestLogoutUser(t *testing.T) {
+	a := assert.New(t)
+
+	req, err := http.NewRequest(http.MethodPost, "/auth/logout", strings.NewReader(`{"refresh_token": "refresh"}`))
+	a.Nil(err)
+
+	rr := httptest.NewRecorder()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	svc := service.NewMockUserService(ctrl)
+	svc.
+		EXPECT().
+		Logout(gomock.Any(), "refresh").
+		Return(nil)
+
+	NewBaseHTTPHandler(svc).ServeHTTP(rr, req)
+
+	a.Equal(http.StatusNoContent, rr.Code)
+}
+
+func TestLogoutUserEverywhere(t *testing.T) {
+	tests := []struct {
+		name string
+		// user service return parameters
+		err error
+		// want
+		code     int
+		response *Problem
+	}{
+		{
+			name: "should respond with 204 on success",
+			code: http.StatusNoContent,
+		},
+		{
+			name: "should respond with 404 if the user doesn't exist",
+			err:  service.ErrUserNotFound,
+			code: http.StatusNotFound,
+			response: &Problem{
+				Detail: "user with given id doesn't exist",
+				Status: http.StatusNotFound,
+				Title:  http.StatusText(http.StatusNotFound),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+
+			req, err := http.NewRequest(http.MethodDelete, "/users/123/sessions", nil)
+			a.Nil(err)
+
+			rr := httptest.NewRecorder()
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			svc := service.NewMockUserService(ctrl)
+			svc.
+				EXPECT().
+				LogoutEverywhere(gomock.Any(), "123").
+				Return(tt.err)
+
+			NewBaseHTTPHandler(svc).ServeHTTP(rr, req)
+
+			a.Equal(tt.code, rr.Code)
+			if tt.response != nil {
+				var actualResponse Problem
+				a.Nil(json.NewDecoder(rr.Body).Decode(&actualResponse))
+				a.Equal(*tt.response, actualResponse)
+			}
+		})
+	}
+}
+
+func TestVerifyUserEMail(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		// whether the user service is called
+		called bool
+		// user service return parameters
+		err error
+		// want
+		code     int
+		response *Problem
+	}{
+		{
+			name:   "should respond with 204 on success",
+			body:   `{"token": "secret"}`,
+			called: true,
+			code:   http.StatusNoContent,
+		},
+		{
+			name:   "should respond with 400 for invalid tokens",
+			body:   `{"token": "secret"}`,
+			called: true,
+			err:    service.ErrInvalidVerificationToken,
+			code:   http.StatusBadRequest,
+			response: &Problem{
+				Detail: "invalid or expired verification token",
+				Status: http.StatusBadRequest,
+				Title:  http.StatusText(http.StatusBadRequest),
+			},
+		},
+		{
+			name: "should respond with 400 for malformed payloads",
+			body: `token=secret`,
+			code: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+
+			req, err := http.NewRequest(http.MethodPost, "/users/123/verify", strings.NewReader(tt.body))
+			a.Nil(err)
+
+			rr := httptest.NewRecorder()
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			svc := service.NewMockUserService(ctrl)
+			if tt.called {
+				svc.
+					EXPECT().
+					VerifyEMail(gomock.Any(), "123", "secret").
+					Return(tt.err)
+			}
+
+			NewBaseHTTPHandler(svc).ServeHTTP(rr, req)
+
+			a.Equal(tt.code, rr.Code)
+			if tt.response != nil {
+				var actualResponse Problem
+				a.Nil(json.NewDecoder(rr.Body).Decode(&actualResponse))
+				a.Equal(*tt.response, actualResponse)
+			}
+		})
+	}
+}
+
+func TestResendUserVerification(t *testing.T) {
+	tests := []struct {
+		name string
+		// user service return parameters
+		err error
+		// want
+		code     int
+		response *Problem
+	}{
+		{
+			name: "should respond with 202 on success",
+			code: http.StatusAccepted,
+		},
+		{
+			name: "should respond with 409 if the address has been verified already",
+			err:  service.ErrEMailAlreadyVerified,
+			code: http.StatusConflict,
+			response: &Problem{
+				Detail: "email address has already been verified",
+				Status: http.StatusConflict,
+				Title:  http.StatusText(http.StatusConflict),
+			},
+		},
+		{
+			name: "should respond with 429 if a mail has been sent recently",
+			err:  service.ErrTooManyRequests,
+			code: http.StatusTooManyRequests,
+			response: &Problem{
+				Detail: "too many requests, try again later",
+				Status: http.StatusTooManyRequests,
+				Title:  http.StatusText(http.StatusTooManyRequests),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+
+			req, err := http.NewRequest(http.MethodPost, "/users/123/verification-mail", nil)
+			a.Nil(err)
+
+			rr := httptest.NewRecorder()
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			svc := service.NewMockUserService(ctrl)
+			svc.
+				EXPECT().
+				ResendVerification(gomock.Any(), "123").
+				Return(tt.err)
+
+			NewBaseHTTPHandler(svc).ServeHTTP(rr, req)
+
+			a.Equal(tt.code, rr.Code)
+			if tt.response != nil {
+				var actualResponse Problem
+				a.Nil(json.NewDecoder(rr.Body).Decode(&actualResponse))
+				a.Equal(*tt.response, actualResponse)
+			}
+		})
+	}
+}
+
+func TestRequestUserPasswordReset(t *testing.T) {
+	a := assert.New(t)
+
+	req, err := http.NewRequest(http.MethodPost, "/auth/password-reset", strings.NewReader(`{"email": "john@example.com"}`))
+	a.Nil(err)
+
+	rr := httptest.NewRecorder()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	svc := service.NewMockUserService(ctrl)
+	svc.
+		EXPECT().
+		RequestPasswordReset(gomock.Any(), "john@example.com").
+		Return(nil)
+
+	NewBaseHTTPHandler(svc).ServeHTTP(rr, req)
+
+	a.Equal(http.StatusAccepted, rr.Code)
+	a.Empty(rr.Body.String())
+}
+
+func TestResetUserPassword(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		// whether the user service is called
+		called bool
+		// user service return parameters
+		err error
+		// want
+		code     int
+		response *Problem
+	}{
+		{
+			name:   "should respond with 204 on success",
+			body:   `{"token": "secret", "new_password": "battery-Staple-8"}`,
+			called: true,
+			code:   http.StatusNoContent,
+		},
+		{
+			name:   "should respond with 400 for invalid tokens",
+			body:   `{"token": "secret", "new_password": "battery-Staple-8"}`,
+			called: true,
+			err:    service.ErrInvalidResetToken,
+			code:   http.StatusBadRequest,
+			response: &Problem{
+				Detail: "invalid, expired or already used password reset token",
+				Status: http.StatusBadRequest,
+				Title:  http.StatusText(http.StatusBadRequest),
+			},
+		},
+		{
+			name: "should respond with 400 for malformed payloads",
+			body: `token=secret`,
+			code: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+
+			req, err := http.NewRequest(http.MethodPost, "/auth/password-reset/confirm", strings.NewReader(tt.body))
+			a.Nil(err)
+
+			rr := httptest.NewRecorder()
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			svc := service.NewMockUserService(ctrl)
+			if tt.called {
+				svc.
+					EXPECT().
+					ResetPassword(gomock.Any(), "secret", "battery-Staple-8").
+					Return(tt.err)
+			}
+
+			NewBaseHTTPHandler(svc).ServeHTTP(rr, req)
+
+			a.Equal(tt.code, rr.Code)
+			if tt.response != nil {
+				var actualResponse Problem
+				a.Nil(json.NewDecoder(rr.Body).Decode(&actualResponse))
+				a.Equal(*tt.response, actualResponse)
+			}
+		})
+	}
+}
+
+// staticKeySet serves a fixed JSON Web Key Set
+type staticKeySet auth.JWKSet
+
+func (s *staticKeySet) JWKS() *auth.JWKSet {
+	return (*auth.JWKSet)(s)
+}
+
+func TestJWKS(t *testing.T) {
+	a := assert.New(t)
+	keys := &staticKeySet{Keys: []auth.JWK{{KeyType: "RSA", Use: "sig", Algorithm: "RS256", KeyID: "abc", N: "n", E: "AQAB"}}}
+
+	req, err := http.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+	a.Nil(err)
+
+	rr := httptest.NewRecorder()
+	NewJWKSHandler(keys).ServeHTTP(rr, req)
+
+	a.Equal(http.StatusOK, rr.Code)
+	a.Equal("application/json; charset=utf-8", rr.Header().Get("Content-Type"))
+	a.JSONEq(`{"keys": [{"kty": "RSA", "use": "sig", "alg": "RS256", "kid": "abc", "n": "n", "e": "AQAB"}]}`, rr.Body.String())
+}
@@ -0,0 +1,130 @@
+package transport
+
+import (
+	"context"
+	"github.com/heptiolabs/healthcheck"
+	"github.com/rs/zerolog"
+	"github.com/status-owl/user-service/pb"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"sort"
+	"sync"
+	"time"
+)
+
+// HealthWatchInterval is the interval the readiness checks are run in while a client watches the health
+const HealthWatchInterval = 5 * time.Second
+
+// HealthServer implements the standard grpc health checking protocol, grpc.health.v1.Health,
+// with the readiness checks of the http health server. It knows the overall health ("")
+// and the one of the pb.UserService, both are serving if all checks pass.
+type HealthServer struct {
+	healthpb.UnimplementedHealthServer
+
+	checks map[string]healthcheck.Check
+	logger zerolog.Logger
+	// interval is the interval the checks are run in while watching
+	interval time.Duration
+
+	mu   sync.Mutex
+	done chan struct{}
+}
+
+// NewHealthServer creates a HealthServer running given readiness checks
+func NewHealthServer(checks map[string]healthcheck.Check, logger zerolog.Logger) *HealthServer {
+	return &HealthServer{
+		checks:   checks,
+		logger:   logger,
+		interval: HealthWatchInterval,
+		done:     make(chan struct{}),
+	}
+}
+
+// Shutdown reports the services as not serving from now on and ends the watches,
+// so they don't hold up a graceful stop of the server
+func (s *HealthServer) Shutdown() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	select {
+	case <-s.done:
+	default:
+		close(s.done)
+	}
+}
+
+func (s *HealthServer) isShutDown() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// servingStatus runs the checks for given service
+func (s *HealthServer) servingStatus(service string) healthpb.HealthCheckResponse_ServingStatus {
+	if service != "" && service != pb.UserService_ServiceDesc.ServiceName {
+		return healthpb.HealthCheckResponse_SERVICE_UNKNOWN
+	}
+	if s.isShutDown() {
+		return healthpb.HealthCheckResponse_NOT_SERVING
+	}
+
+	// run the checks in a stable order, so the logs are comparable
+	names := make([]string, 0, len(s.checks))
+	for name := range s.checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := s.checks[name](); err != nil {
+			s.logger.Warn().
+				Err(err).
+				Str("check", name).
+				Msg("readiness check failed")
+			return healthpb.HealthCheckResponse_NOT_SERVING
+		}
+	}
+
+	return healthpb.HealthCheckResponse_SERVING
+}
+
+func (s *HealthServer) Check(_ context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	st := s.servingStatus(req.Service)
+	if st == healthpb.HealthCheckResponse_SERVICE_UNKNOWN {
+		return nil, status.Errorf(codes.NotFound, "unknown service %q", req.Service)
+	}
+
+	return &healthpb.HealthCheckResponse{Status: st}, nil
+}
+
+// Watch sends the status of the service whenever it changes, unknown services are reported
+// as SERVICE_UNKNOWN like the protocol demands
+func (s *HealthServer) Watch(req *healthpb.HealthCheckRequest, stream healthpb.Health_WatchServer) error {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	var last healthpb.HealthCheckResponse_ServingStatus = -1
+	for {
+		if st := s.servingStatus(req.Service); st != last {
+			if err := stream.Send(&healthpb.HealthCheckResponse{Status: st}); err != nil {
+				return err
+			}
+			last = st
+		}
+
+		select {
+		case <-stream.Context().Done():
+			return status.Error(codes.Canceled, "stream has ended")
+		case <-s.done:
+			if last != healthpb.HealthCheckResponse_NOT_SERVING && last != healthpb.HealthCheckResponse_SERVICE_UNKNOWN {
+				return stream.Send(&healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_NOT_SERVING})
+			}
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"github.com/heptiolabs/healthcheck"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// setUpHealthTest starts a grpc server serving the health of given checks
+func setUpHealthTest(t *testing.T, checks map[string]healthcheck.Check) (healthpb.HealthClient, *HealthServer) {
+	health := NewHealthServer(checks, zerolog.Nop())
+	health.interval = 10 * time.Millisecond
+
+	lis := bufconn.Listen(1024 * 1024)
+	srv := grpc.NewServer()
+	healthpb.RegisterHealthServer(srv, health)
+
+	go func() {
+		if err := srv.Serve(lis); err != nil {
+			panic("failed to start grpc server")
+		}
+	}()
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+		grpc.WithInsecure(),
+	)
+	if err != nil {
+		panic("failed to connect to the grpc server")
+	}
+
+	t.Cleanup(func() {
+		srv.Stop()
+		_ = conn.Close()
+	})
+
+	return healthpb.NewHealthClient(conn), health
+}
+
+func TestHealthCheck(t *testing.T) {
+	a := assert.New(t)
+	var failing atomic.Value
+	failing.Store(false)
+
+	client, health := setUpHealthTest(t, map[string]healthcheck.Check{
+		"ok": func() error { return nil },
+		"mongodb-check": func() error {
+			if failing.Load().(bool) {
+				return errors.New("server selection timeout")
+			}
+			return nil
+		},
+	})
+	ctx := context.Background()
+
+	for _, service := range []string{"", "pb.UserService"} {
+		resp, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+		a.Nil(err)
+		a.Equal(healthpb.HealthCheckResponse_SERVING, resp.GetStatus(), "service %q", service)
+	}
+
+	failing.Store(true)
+	resp, err := client.Check(ctx, &healthpb.HealthCheckRequest{})
+	a.Nil(err)
+	a.Equal(healthpb.HealthCheckResponse_NOT_SERVING, resp.GetStatus(), "the checks are run for every request")
+
+	_, err = client.Check(ctx, &healthpb.HealthCheckRequest{Service: "pb.Unknown"})
+	a.Equal(codes.NotFound, status.Code(err))
+
+	failing.Store(false)
+	health.Shutdown()
+	resp, err = client.Check(ctx, &healthpb.HealthCheckRequest{})
+	a.Nil(err)
+	a.Equal(healthpb.HealthCheckResponse_NOT_SERVING, resp.GetStatus(), "the server isn't serving while shutting down")
+}
+
+func TestHealthWatch(t *testing.T) {
+	a := assert.New(t)
+	var failing atomic.Value
+	failing.Store(false)
+
+	client, health := setUpHealthTest(t, map[string]healthcheck.Check{
+		"mongodb-check": func() error {
+			if failing.Load().(bool) {
+				return errors.New("server selection timeout")
+			}
+			return nil
+		},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{Service: "pb.UserService"})
+	a.Nil(err)
+
+	resp, err := stream.Recv()
+	a.Nil(err)
+	a.Equal(healthpb.HealthCheckResponse_SERVING, resp.GetStatus())
+
+	// changes are sent once the checks have been run again
+	failing.Store(true)
+	resp, err = stream.Recv()
+	a.Nil(err)
+	a.Equal(healthpb.HealthCheckResponse_NOT_SERVING, resp.GetStatus())
+
+	failing.Store(false)
+	resp, err = stream.Recv()
+	a.Nil(err)
+	a.Equal(healthpb.HealthCheckResponse_SERVING, resp.GetStatus())
+
+	// shutting down ends the watches
+	health.Shutdown()
+	resp, err = stream.Recv()
+	a.Nil(err)
+	a.Equal(healthpb.HealthCheckResponse_NOT_SERVING, resp.GetStatus())
+
+	_, err = stream.Recv()
+	a.Equal(io.EOF, err)
+}
+
+func TestHealthWatchUnknownService(t *testing.T) {
+	a := assert.New(t)
+	client, _ := setUpHealthTest(t, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{Service: "pb.Unknown"})
+	a.Nil(err)
+
+	resp, err := stream.Recv()
+	a.Nil(err)
+	a.Equal(healthpb.HealthCheckResponse_SERVICE_UNKNOWN, resp.GetStatus())
+}
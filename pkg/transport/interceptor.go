@@ -0,0 +1,173 @@
+package transport
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rs/xid"
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// requestIDKey is the metadata key carrying the id of a call, like the Request-Id header of the http api.
+// An id given by the client is kept, so calls can be correlated across services.
+const requestIDKey = "request-id"
+
+// wrappedStream replaces the context of a grpc.ServerStream
+type wrappedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *wrappedStream) Context() context.Context {
+	return s.ctx
+}
+
+// withRequestLogger returns a context carrying a logger with the request id of the call,
+// the handlers get it via zerolog.Ctx. The request id is sent back as header.
+func withRequestLogger(ctx context.Context, logger zerolog.Logger) (context.Context, *zerolog.Logger) {
+	var id string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(requestIDKey); len(values) > 0 && values[0] != "" {
+			id = values[0]
+		}
+	}
+	if id == "" {
+		id = xid.New().String()
+	}
+	_ = grpc.SetHeader(ctx, metadata.Pairs(requestIDKey, id))
+
+	l := logger.With().Str("req_id", id).Logger()
+	if p, ok := peer.FromContext(ctx); ok {
+		l = l.With().Str("ip", hostOf(p.Addr.String())).Logger()
+	}
+
+	return l.WithContext(ctx), &l
+}
+
+// logCall logs a finished call like the access log of the http api,
+// the health checks are logged on debug level only since they're polled by probes
+func logCall(logger *zerolog.Logger, method string, err error, duration time.Duration) {
+	level := zerolog.InfoLevel
+	if strings.HasPrefix(method, "/grpc.health.v1.Health/") {
+		level = zerolog.DebugLevel
+	}
+
+	logger.WithLevel(level).
+		Str("method", method).
+		Stringer("code", status.Code(err)).
+		Dur("duration", duration).
+		Send()
+}
+
+// LoggingUnaryInterceptor logs every call with its request id
+func LoggingUnaryInterceptor(logger zerolog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, l := withRequestLogger(ctx, logger)
+
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		logCall(l, info.FullMethod, err, time.Since(start))
+
+		return resp, err
+	}
+}
+
+// LoggingStreamInterceptor logs every stream with its request id once it's finished
+func LoggingStreamInterceptor(logger zerolog.Logger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, l := withRequestLogger(ss.Context(), logger)
+
+		start := time.Now()
+		err := handler(srv, &wrappedStream{ServerStream: ss, ctx: ctx})
+		logCall(l, info.FullMethod, err, time.Since(start))
+
+		return err
+	}
+}
+
+// GrpcMetrics records the latency of the grpc calls per method and status code
+type GrpcMetrics struct {
+	handled *prometheus.HistogramVec
+}
+
+// NewGrpcMetrics creates the metrics and registers them with given registerer
+func NewGrpcMetrics(reg prometheus.Registerer) *GrpcMetrics {
+	return &GrpcMetrics{
+		handled: promauto.With(reg).NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "status_owl",
+			Subsystem: "user_service",
+			Name:      "grpc_handling_seconds",
+			Help:      "Latency of the grpc calls until they're handled",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "code"}),
+	}
+}
+
+func (m *GrpcMetrics) observe(method string, err error, duration time.Duration) {
+	m.handled.With(prometheus.Labels{
+		"method": method,
+		"code":   status.Code(err).String(),
+	}).Observe(duration.Seconds())
+}
+
+// UnaryInterceptor records the latency of every call
+func (m *GrpcMetrics) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		m.observe(info.FullMethod, err, time.Since(start))
+
+		return resp, err
+	}
+}
+
+// StreamInterceptor records the duration of every stream
+func (m *GrpcMetrics) StreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, ss)
+		m.observe(info.FullMethod, err, time.Since(start))
+
+		return err
+	}
+}
+
+// recoverPanic converts a panic of a handler into an Internal error,
+// the panic is logged with the logger of the context
+func recoverPanic(ctx context.Context, method string, err *error) {
+	if r := recover(); r != nil {
+		zerolog.Ctx(ctx).Error().
+			Str("method", method).
+			Interface("panic", r).
+			Bytes("stack", debug.Stack()).
+			Msg("recovered from a panic")
+
+		*err = status.Error(codes.Internal, "internal error")
+	}
+}
+
+// RecoveryUnaryInterceptor converts panics into Internal errors instead of crashing the process
+func RecoveryUnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		defer recoverPanic(ctx, info.FullMethod, &err)
+
+		return handler(ctx, req)
+	}
+}
+
+// RecoveryStreamInterceptor converts panics into Internal errors instead of crashing the process
+func RecoveryStreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer recoverPanic(ss.Context(), info.FullMethod, &err)
+
+		return handler(srv, ss)
+	}
+}
@@ -0,0 +1,220 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/golang/mock/gomock"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rs/zerolog"
+	"github.com/status-owl/user-service/pb"
+	"github.com/status-owl/user-service/pkg/model"
+	"github.com/status-owl/user-service/pkg/service"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// syncBuffer is a buffer the server's goroutines may write to concurrently
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// lines returns the json log lines written so far
+func (b *syncBuffer) lines(t *testing.T) []map[string]interface{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var lines []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(b.buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var fields map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &fields); err != nil {
+			t.Fatalf("failed to decode log line %q: %s", line, err.Error())
+		}
+		lines = append(lines, fields)
+	}
+	return lines
+}
+
+// setUpInterceptedTest starts a grpc server with the logging, metrics and recovery interceptors
+func setUpInterceptedTest(t *testing.T) (pb.UserServiceClient, *service.MockUserService, *syncBuffer, *prometheus.Registry) {
+	logs := &syncBuffer{}
+	reg := prometheus.NewRegistry()
+	metrics := NewGrpcMetrics(reg)
+
+	client, svc := setUpTest(t, grpc.ChainUnaryInterceptor(
+		LoggingUnaryInterceptor(zerolog.New(logs)),
+		metrics.UnaryInterceptor(),
+		RecoveryUnaryInterceptor(),
+	))
+
+	return client, svc, logs, reg
+}
+
+func TestRecoveryInterceptor(t *testing.T) {
+	a := assert.New(t)
+	client, svc, logs, _ := setUpInterceptedTest(t)
+
+	svc.EXPECT().
+		FindByID(gomock.Any(), "123").
+		DoAndReturn(func(context.Context, string) (*model.User, error) {
+			panic("boom")
+		})
+	svc.EXPECT().
+		FindByID(gomock.Any(), "456").
+		Return(&model.User{ID: "456"}, nil)
+
+	_, err := client.GetUser(context.Background(), &pb.GetUserRequest{Id: "123"})
+	a.Equal(status.Error(codes.Internal, "internal error"), err)
+
+	// the server survives the panic
+	reply, err := client.GetUser(context.Background(), &pb.GetUserRequest{Id: "456"})
+	a.Nil(err)
+	a.Equal("456", reply.GetUser().GetId())
+
+	lines := logs.lines(t)
+	if a.Len(lines, 3) {
+		a.Equal("boom", lines[0]["panic"])
+		a.NotEmpty(lines[0]["stack"])
+		a.Equal(lines[0]["req_id"], lines[1]["req_id"], "the panic is logged with the request id of the call")
+		a.Equal("Internal", lines[1]["code"])
+	}
+}
+
+func TestLoggingInterceptor(t *testing.T) {
+	a := assert.New(t)
+	client, svc, logs, _ := setUpInterceptedTest(t)
+
+	svc.EXPECT().
+		FindByID(gomock.Any(), "123").
+		DoAndReturn(func(ctx context.Context, _ string) (*model.User, error) {
+			// the handlers log with the request id
+			zerolog.Ctx(ctx).Info().Msg("finding")
+			return nil, service.ErrUserNotFound
+		}).
+		Times(2)
+
+	var header metadata.MD
+	_, err := client.GetUser(context.Background(), &pb.GetUserRequest{Id: "123"}, grpc.Header(&header))
+	a.Equal(codes.NotFound, status.Code(err))
+	generated := header.Get(requestIDKey)
+	if a.Len(generated, 1) {
+		a.NotEmpty(generated[0])
+	}
+
+	// the request id of the client is kept
+	ctx := metadata.AppendToOutgoingContext(context.Background(), requestIDKey, "abc")
+	_, err = client.GetUser(ctx, &pb.GetUserRequest{Id: "123"}, grpc.Header(&header))
+	a.Equal(codes.NotFound, status.Code(err))
+	a.Equal([]string{"abc"}, header.Get(requestIDKey))
+
+	lines := logs.lines(t)
+	if a.Len(lines, 4) {
+		a.Equal("finding", lines[0]["message"])
+		a.Equal(generated[0], lines[0]["req_id"])
+		a.Equal("/pb.UserService/GetUser", lines[1]["method"])
+		a.Equal("NotFound", lines[1]["code"])
+		a.Contains(lines[1], "duration")
+		a.Equal("abc", lines[3]["req_id"])
+	}
+}
+
+func TestMetricsInterceptor(t *testing.T) {
+	a := assert.New(t)
+	client, svc, _, reg := setUpInterceptedTest(t)
+
+	svc.EXPECT().
+		FindByID(gomock.Any(), "123").
+		Return(&model.User{ID: "123"}, nil).
+		Times(2)
+	svc.EXPECT().
+		Delete(gomock.Any(), "123").
+		Return(service.ErrLastAdmin)
+
+	for i := 0; i < 2; i++ {
+		_, err := client.GetUser(context.Background(), &pb.GetUserRequest{Id: "123"})
+		a.Nil(err)
+	}
+	_, err := client.DeleteUser(context.Background(), &pb.DeleteUserRequest{Id: "123"})
+	a.Equal(codes.FailedPrecondition, status.Code(err))
+
+	count, err := testutil.GatherAndCount(reg)
+	a.Nil(err)
+	a.Equal(2, count, "one series per method and code")
+	a.Equal(uint64(2), sampleCount(t, reg, "/pb.UserService/GetUser", "OK"))
+	a.Equal(uint64(1), sampleCount(t, reg, "/pb.UserService/DeleteUser", "FailedPrecondition"))
+}
+
+// sampleCount returns the count of calls of given method with given code recorded in reg
+func sampleCount(t *testing.T, reg prometheus.Gatherer, method, code string) uint64 {
+	t.Helper()
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("failed to gather the metrics: %s", err.Error())
+	}
+
+	for _, f := range families {
+		for _, m := range f.GetMetric() {
+			labels := map[string]string{}
+			for _, l := range m.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			if labels["method"] == method && labels["code"] == code {
+				return m.GetHistogram().GetSampleCount()
+			}
+		}
+	}
+	return 0
+}
+
+// testStream is a server stream with a context only
+type testStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *testStream) Context() context.Context {
+	return s.ctx
+}
+
+func TestStreamInterceptors(t *testing.T) {
+	a := assert.New(t)
+	logs := &syncBuffer{}
+	info := &grpc.StreamServerInfo{FullMethod: "/pb.UserService/Watch", IsServerStream: true}
+
+	logging := LoggingStreamInterceptor(zerolog.New(logs))
+	recovery := RecoveryStreamInterceptor()
+
+	// the recovery is nested in the logging like in the chain of the server
+	err := logging(nil, &testStream{ctx: context.Background()}, info, func(srv interface{}, ss grpc.ServerStream) error {
+		a.NotNil(zerolog.Ctx(ss.Context()), "the stream's context carries the logger")
+		return recovery(srv, ss, info, func(interface{}, grpc.ServerStream) error {
+			panic("boom")
+		})
+	})
+	a.Equal(status.Error(codes.Internal, "internal error"), err)
+
+	lines := logs.lines(t)
+	if a.Len(lines, 2) {
+		a.Equal("boom", lines[0]["panic"])
+		a.Equal("/pb.UserService/Watch", lines[1]["method"])
+		a.Equal("Internal", lines[1]["code"])
+	}
+}
@@ -3,6 +3,121 @@
 // Code generated by github.com/deepmap/oapi-codegen version v1.9.0 DO NOT EDIT.
 package transport
 
+import (
+	"time"
+)
+
+const (
+	BearerAuthScopes = "bearerAuth.Scopes"
+)
+
+// Defines values for AccessTokenTokenType.
+const (
+	AccessTokenTokenTypeBearer AccessTokenTokenType = "Bearer"
+)
+
+// Defines values for Role.
+const (
+	RoleADMIN Role = "ADMIN"
+
+	RoleREGULAR Role = "REGULAR"
+
+	RoleREPORTER Role = "REPORTER"
+)
+
+// Defines values for Scope.
+const (
+	ScopeUsersRead Scope = "users:read"
+
+	ScopeUsersWrite Scope = "users:write"
+)
+
+// Defines values for Status.
+const (
+	StatusACTIVE Status = "ACTIVE"
+
+	StatusDELETED Status = "DELETED"
+
+	StatusLOCKED Status = "LOCKED"
+
+	StatusPENDING Status = "PENDING"
+
+	StatusSUSPENDED Status = "SUSPENDED"
+)
+
+// APIKey defines model for APIKey.
+type APIKey struct {
+	CreatedAt time.Time `json:"created_at"`
+
+	// Time the key expires, missing if it never expires
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+
+	// API key ID
+	Id string `json:"id"`
+
+	// What the key is used for
+	Name string `json:"name"`
+
+	// Beginning of the key, tells the keys apart
+	Prefix string  `json:"prefix"`
+	Scopes []Scope `json:"scopes"`
+}
+
+// APIKeyList defines model for APIKeyList.
+type APIKeyList struct {
+	ApiKeys []APIKey `json:"api_keys"`
+}
+
+// APIKeyRequest defines model for APIKeyRequest.
+type APIKeyRequest struct {
+	// Time the key expires, it never expires if missing
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+
+	// What the key is used for
+	Name string `json:"name"`
+
+	// Operations the key may be used for, all if empty
+	Scopes *[]Scope `json:"scopes,omitempty"`
+}
+
+// Access token response of RFC 6749
+type AccessToken struct {
+	// Signed JWT
+	AccessToken string `json:"access_token"`
+
+	// Seconds until the access token expires
+	ExpiresIn int64 `json:"expires_in"`
+
+	// Single use token to obtain a new access token
+	RefreshToken *string              `json:"refresh_token,omitempty"`
+	TokenType    AccessTokenTokenType `json:"token_type"`
+}
+
+// AccessTokenTokenType defines model for AccessToken.TokenType.
+type AccessTokenTokenType string
+
+// CreatedAPIKey defines model for CreatedAPIKey.
+type CreatedAPIKey struct {
+	// Embedded struct due to allOf(#/components/schemas/APIKey)
+	APIKey `yaml:",inline"`
+	// Embedded fields due to inline allOf schema
+	// The key to pass as bearer token, returned this time only
+	Key string `json:"key"`
+}
+
+// Credentials defines model for Credentials.
+type Credentials struct {
+	// Email address
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// EmailVerification defines model for EmailVerification.
+type EmailVerification struct {
+	// Token mailed to the user
+	Token string `json:"token"`
+}
+
 // Represents an invalid property in a bad request
 type InvalidParam struct {
 	// Name of the property
@@ -12,6 +127,84 @@ type InvalidParam struct {
 	Reason string `json:"reason"`
 }
 
+// RSA public key in the JSON Web Key format
+type JWK struct {
+	Alg string `json:"alg"`
+
+	// Exponent, base64url encoded
+	E string `json:"e"`
+
+	// JWK thumbprint (RFC 7638) of the key
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+
+	// Modulus, base64url encoded
+	N   string `json:"n"`
+	Use string `json:"use"`
+}
+
+// JWKSet defines model for JWKSet.
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// Challenge for the second factor of a login
+type MFAChallenge struct {
+	// Seconds until the challenge expires
+	ExpiresIn int64 `json:"expires_in"`
+
+	// Token to pass to /auth/mfa together with a code
+	MfaToken string `json:"mfa_token"`
+}
+
+// MFACode defines model for MFACode.
+type MFACode struct {
+	// Code of the user's authenticator or, to disable, a recovery code
+	Code string `json:"code"`
+}
+
+// MFAEnrollment defines model for MFAEnrollment.
+type MFAEnrollment struct {
+	// otpauth URI of the authenticator, usually shown as QR code
+	ProvisioningUri string `json:"provisioning_uri"`
+
+	// Base32 encoded TOTP secret for entering it manually
+	Secret string `json:"secret"`
+}
+
+// MFAVerification defines model for MFAVerification.
+type MFAVerification struct {
+	// Code of the user's authenticator or a recovery code
+	Code string `json:"code"`
+
+	// Token returned by /auth/token
+	MfaToken string `json:"mfa_token"`
+}
+
+// PasswordChange defines model for PasswordChange.
+type PasswordChange struct {
+	// Current password of the user
+	CurrentPassword string `json:"current_password"`
+
+	// New password, it must contain at least 10 characters of at least three of lower case letters, upper case letters, digits and other characters and must not contain the user's email address or name
+	NewPassword string `json:"new_password"`
+}
+
+// PasswordReset defines model for PasswordReset.
+type PasswordReset struct {
+	// New password, it must contain at least 10 characters of at least three of lower case letters, upper case letters, digits and other characters and must not contain the user's email address or name
+	NewPassword string `json:"new_password"`
+
+	// Token mailed to the user
+	Token string `json:"token"`
+}
+
+// PasswordResetRequest defines model for PasswordResetRequest.
+type PasswordResetRequest struct {
+	// Email address of the user whose password is reset
+	Email string `json:"email"`
+}
+
 // Problem defines model for Problem.
 type Problem struct {
 	// A human readable explanation specific to this occurrence of the problem that is helpful to locate the problem and give advice on how to proceed. Written in English and readable for engineers, usually not suited for non technical stakeholders and not localized.
@@ -28,20 +221,191 @@ type Problem struct {
 	Type *string `json:"type,omitempty"`
 }
 
+// RecoveryCodes defines model for RecoveryCodes.
+type RecoveryCodes struct {
+	// Single use codes replacing the authenticator's ones, shown this time only
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// RefreshTokenRequest defines model for RefreshTokenRequest.
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Role of a user, the first user becomes an admin, every following one a regular user
+type Role string
+
+// RoleAssignment defines model for RoleAssignment.
+type RoleAssignment struct {
+	// Role of a user, the first user becomes an admin, every following one a regular user
+	Role Role `json:"role"`
+}
+
+// Operations an API key may be used for, users:read reads and lists users, users:write creates, updates and deletes them and changes their role and status
+type Scope string
+
+// Lifecycle state of a user, new users are PENDING until they verify their email address. SUSPENDED and LOCKED users can't log in.
+type Status string
+
 // User defines model for User.
 type User struct {
 	// Email address
 	Email string `json:"email"`
 
+	// Whether the email address has been verified
+	EmailVerified bool `json:"email_verified"`
+
+	// Failed logins since the last successful one, shown to admins only
+	FailedLogins *int `json:"failed_logins,omitempty"`
+
 	// User ID
 	Id string `json:"id"`
 
+	// Time the user may log in again after too many failed logins, shown to admins only
+	LockedUntil *time.Time `json:"locked_until,omitempty"`
+
+	// Whether logins require a second factor
+	MfaEnabled bool `json:"mfa_enabled"`
+
 	// User name
 	Name string `json:"name"`
+
+	// Role of a user, the first user becomes an admin, every following one a regular user
+	Role *Role `json:"role,omitempty"`
+
+	// Lifecycle state of a user, new users are PENDING until they verify their email address. SUSPENDED and LOCKED users can't log in.
+	Status Status `json:"status"`
+}
+
+// A page of users
+type UserList struct {
+	// Link to the next page, missing on the last page
+	Next  *string `json:"next,omitempty"`
+	Users []User  `json:"users"`
+}
+
+// Requested changes of a user
+type UserUpdate struct {
+	// Email address
+	Email *string `json:"email,omitempty"`
+
+	// User name
+	Name *string `json:"name,omitempty"`
 }
 
+// LogoutJSONBody defines parameters for Logout.
+type LogoutJSONBody RefreshTokenRequest
+
+// VerifyMfaJSONBody defines parameters for VerifyMfa.
+type VerifyMfaJSONBody MFAVerification
+
+// RequestPasswordResetJSONBody defines parameters for RequestPasswordReset.
+type RequestPasswordResetJSONBody PasswordResetRequest
+
+// ResetPasswordJSONBody defines parameters for ResetPassword.
+type ResetPasswordJSONBody PasswordReset
+
+// RefreshTokenJSONBody defines parameters for RefreshToken.
+type RefreshTokenJSONBody RefreshTokenRequest
+
+// LoginJSONBody defines parameters for Login.
+type LoginJSONBody Credentials
+
 // FindUsersParams defines parameters for FindUsers.
 type FindUsersParams struct {
-	// User's email address
-	Email string `json:"email"`
+	// Only users with this role
+	Role *Role `json:"role,omitempty"`
+
+	// Only users with this status
+	Status *Status `json:"status,omitempty"`
+
+	// Only users whose email address starts with this prefix, case insensitive
+	Email *string `json:"email,omitempty"`
+
+	// Only users whose name contains this text, case insensitive
+	Name *string `json:"name,omitempty"`
+
+	// Only users created after this time
+	CreatedAfter *time.Time `json:"created_after,omitempty"`
+
+	// Only users created before this time
+	CreatedBefore *time.Time `json:"created_before,omitempty"`
+
+	// Property the users are sorted by, a leading - sorts descending
+	Sort *FindUsersParamsSort `json:"sort,omitempty"`
+
+	// Maximum count of users on a page
+	Limit *int `json:"limit,omitempty"`
+
+	// Opaque position of the page to list, taken from the next link of the previous page
+	Cursor *string `json:"cursor,omitempty"`
 }
+
+// FindUsersParamsSort defines parameters for FindUsers.
+type FindUsersParamsSort string
+
+// UpdateUserJSONBody defines parameters for UpdateUser.
+type UpdateUserJSONBody UserUpdate
+
+// UpdateUserParams defines parameters for UpdateUser.
+type UpdateUserParams struct {
+	// ETag of the user the changes are based on, the update is rejected if the user has been modified in the meantime
+	IfMatch *string `json:"If-Match,omitempty"`
+}
+
+// CreateApiKeyJSONBody defines parameters for CreateApiKey.
+type CreateApiKeyJSONBody APIKeyRequest
+
+// ConfirmMfaJSONBody defines parameters for ConfirmMfa.
+type ConfirmMfaJSONBody MFACode
+
+// DisableMfaJSONBody defines parameters for DisableMfa.
+type DisableMfaJSONBody MFACode
+
+// ChangePasswordJSONBody defines parameters for ChangePassword.
+type ChangePasswordJSONBody PasswordChange
+
+// AssignRoleJSONBody defines parameters for AssignRole.
+type AssignRoleJSONBody RoleAssignment
+
+// VerifyEmailJSONBody defines parameters for VerifyEmail.
+type VerifyEmailJSONBody EmailVerification
+
+// LogoutJSONRequestBody defines body for Logout for application/json ContentType.
+type LogoutJSONRequestBody LogoutJSONBody
+
+// VerifyMfaJSONRequestBody defines body for VerifyMfa for application/json ContentType.
+type VerifyMfaJSONRequestBody VerifyMfaJSONBody
+
+// RequestPasswordResetJSONRequestBody defines body for RequestPasswordReset for application/json ContentType.
+type RequestPasswordResetJSONRequestBody RequestPasswordResetJSONBody
+
+// ResetPasswordJSONRequestBody defines body for ResetPassword for application/json ContentType.
+type ResetPasswordJSONRequestBody ResetPasswordJSONBody
+
+// RefreshTokenJSONRequestBody defines body for RefreshToken for application/json ContentType.
+type RefreshTokenJSONRequestBody RefreshTokenJSONBody
+
+// LoginJSONRequestBody defines body for Login for application/json ContentType.
+type LoginJSONRequestBody LoginJSONBody
+
+// UpdateUserJSONRequestBody defines body for UpdateUser for application/json ContentType.
+type UpdateUserJSONRequestBody UpdateUserJSONBody
+
+// CreateApiKeyJSONRequestBody defines body for CreateApiKey for application/json ContentType.
+type CreateApiKeyJSONRequestBody CreateApiKeyJSONBody
+
+// ConfirmMfaJSONRequestBody defines body for ConfirmMfa for application/json ContentType.
+type ConfirmMfaJSONRequestBody ConfirmMfaJSONBody
+
+// DisableMfaJSONRequestBody defines body for DisableMfa for application/json ContentType.
+type DisableMfaJSONRequestBody DisableMfaJSONBody
+
+// ChangePasswordJSONRequestBody defines body for ChangePassword for application/json ContentType.
+type ChangePasswordJSONRequestBody ChangePasswordJSONBody
+
+// AssignRoleJSONRequestBody defines body for AssignRole for application/json ContentType.
+type AssignRoleJSONRequestBody AssignRoleJSONBody
+
+// VerifyEmailJSONRequestBody defines body for VerifyEmail for application/json ContentType.
+type VerifyEmailJSONRequestBody VerifyEmailJSONBody